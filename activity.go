@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	A_ColonyDestroyed = "colony-destroyed"
+	A_Kill            = "kill"
+)
+
+type Activity struct {
+	ts     time.Time
+	kind   string
+	actor  string
+	system *System
+}
+
+var activityLog = make([]Activity, 0, 256)
+
+// recordActivity appends to the server's log of notable events.  Contracts
+// are verified against this log rather than trusting the players involved.
+// The actor is the pilot responsible, or empty when nobody in particular is,
+// as when a besieged colony collapses.
+func recordActivity(kind, actor string, system *System) {
+	a := Activity{ts: clock.Now(), kind: kind, actor: actor, system: system}
+	activityLog = append(activityLog, a)
+	if len(activityLog) > 1000 {
+		activityLog = activityLog[len(activityLog)-1000:]
+	}
+	checkContracts(a)
+}
+
+func findActivity(kind string, system *System, since time.Time) *Activity {
+	for i := len(activityLog) - 1; i >= 0; i-- {
+		a := &activityLog[i]
+		if a.ts.Before(since) {
+			break
+		}
+		if a.kind == kind && a.system == system {
+			return a
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Alliance is a team of pilots who fight and win together.  Unlike a
+// corporation it has no treasury or roles, just a leader and its members,
+// and allies can't hurt each other.
+type Alliance struct {
+	name    string
+	leader  string
+	members map[string]bool
+	invites map[string]bool
+}
+
+var (
+	alliances  = make(map[string]*Alliance, 8)
+	allegiance = make(map[string]*Alliance, 32)
+)
+
+func alliancesTable() {
+	stmnt := `create table if not exists alliances (
+        name text not null unique,
+        leader text not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create alliances table: %v", err)
+	}
+	stmnt = `create table if not exists alliance_members (
+        alliance text not null,
+        member text not null unique
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create alliance members table: %v", err)
+	}
+}
+
+func loadAlliances() {
+	rows, err := db.Query(`select name, leader from alliances`)
+	if err != nil {
+		log_error("unable to load alliances: %v", err)
+		return
+	}
+	for rows.Next() {
+		a := &Alliance{members: make(map[string]bool, 8), invites: make(map[string]bool, 4)}
+		if err := rows.Scan(&a.name, &a.leader); err != nil {
+			log_error("error unpacking row from alliances query: %v", err)
+			continue
+		}
+		alliances[a.name] = a
+	}
+	rows.Close()
+
+	rows, err = db.Query(`select alliance, member from alliance_members`)
+	if err != nil {
+		log_error("unable to load alliance members: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, member string
+		if err := rows.Scan(&name, &member); err != nil {
+			log_error("error unpacking row from alliance members query: %v", err)
+			continue
+		}
+		if a := alliances[name]; a != nil {
+			a.members[member] = true
+			allegiance[member] = a
+		}
+	}
+}
+
+func NewAlliance(name string, founder *Connection) (*Alliance, error) {
+	if _, err := db.Exec(`insert into alliances (name, leader) values (?, ?)`, name, founder.PlayerName()); err != nil {
+		return nil, fmt.Errorf("unable to create alliance %s: %v", name, err)
+	}
+	a := &Alliance{
+		name:    name,
+		leader:  founder.PlayerName(),
+		members: make(map[string]bool, 8),
+		invites: make(map[string]bool, 4),
+	}
+	alliances[name] = a
+	if err := a.Add(founder.PlayerName()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Alliance) Add(name string) error {
+	if _, err := db.Exec(`insert into alliance_members (alliance, member) values (?, ?)`, a.name, name); err != nil {
+		return fmt.Errorf("unable to add %s to alliance %s: %v", name, a.name, err)
+	}
+	a.members[name] = true
+	allegiance[name] = a
+	return nil
+}
+
+// Remove takes a pilot out of the alliance.  Leadership passes to another
+// member if the leader goes, and an alliance with nobody left is disbanded.
+func (a *Alliance) Remove(name string) error {
+	if _, err := db.Exec(`delete from alliance_members where member = ?`, name); err != nil {
+		return fmt.Errorf("unable to remove %s from alliance %s: %v", name, a.name, err)
+	}
+	delete(a.members, name)
+	delete(allegiance, name)
+	if len(a.members) == 0 {
+		delete(alliances, a.name)
+		if _, err := db.Exec(`delete from alliances where name = ?`, a.name); err != nil {
+			return fmt.Errorf("unable to disband alliance %s: %v", a.name, err)
+		}
+		return nil
+	}
+	if name == a.leader {
+		names := a.Members()
+		a.leader = names[0]
+		if _, err := db.Exec(`update alliances set leader = ? where name = ?`, a.leader, a.name); err != nil {
+			return fmt.Errorf("unable to change leader of alliance %s: %v", a.name, err)
+		}
+		a.Notify("%s now leads the alliance", a.leader)
+	}
+	return nil
+}
+
+func (a *Alliance) Members() []string {
+	names := make([]string, 0, len(a.members))
+	for name, _ := range a.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *Alliance) Notify(template string, args ...interface{}) {
+	for conn, _ := range connected {
+		if a.members[conn.PlayerName()] {
+			fmt.Fprintf(conn, "<%s> %s\n", a.name, fmt.Sprintf(template, args...))
+		}
+	}
+}
+
+func (c *Connection) Alliance() *Alliance {
+	return allegiance[c.PlayerName()]
+}
+
+// Allied is true for two different pilots in the same alliance.
+func (c *Connection) Allied(other *Connection) bool {
+	if c == nil || other == nil || c == other {
+		return false
+	}
+	a := c.Alliance()
+	return a != nil && a == other.Alliance()
+}
+
+var allianceCommand = &Command{
+	name: "alliance",
+	help: "alliances are teams of pilots who can't harm each other and share in each other's victory.  usage:\n" +
+		"\talliance   (shows your alliance)\n" +
+		"\talliance create [name]\n" +
+		"\talliance invite [player]\n" +
+		"\talliance join [name]\n" +
+		"\talliance leave\n" +
+		"\talliance kick [player]   (leader only)",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		name := conn.PlayerName()
+		a := conn.Alliance()
+		if len(args) == 0 {
+			if a == nil {
+				fmt.Fprintf(conn, "you're not in an alliance.\n")
+				return
+			}
+			fmt.Fprintf(conn, "alliance: %s\n", a.name)
+			for _, member := range a.Members() {
+				if member == a.leader {
+					fmt.Fprintf(conn, "\t%-20s leader\n", member)
+				} else {
+					fmt.Fprintf(conn, "\t%s\n", member)
+				}
+			}
+			return
+		}
+		switch args[0] {
+		case "create":
+			allianceName := strings.Join(args[1:], " ")
+			if !ValidName(allianceName) {
+				fmt.Fprintf(conn, "that alliance name is illegal.\n")
+				return
+			}
+			if a != nil {
+				fmt.Fprintf(conn, "you're already in an alliance.\n")
+				return
+			}
+			if _, ok := alliances[allianceName]; ok {
+				fmt.Fprintf(conn, "there's already an alliance called %s\n", allianceName)
+				return
+			}
+			if _, err := NewAlliance(allianceName, conn); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "the alliance registry is closed.  try again later.\n")
+				return
+			}
+			fmt.Fprintf(conn, "formed the alliance %s.  you are its leader.\n", allianceName)
+			publishNews("%s has formed the alliance %s", name, allianceName)
+		case "invite":
+			if a == nil {
+				fmt.Fprintf(conn, "you're not in an alliance.\n")
+				return
+			}
+			if len(args) != 2 {
+				fmt.Fprintf(conn, "usage: alliance invite [player]\n")
+				return
+			}
+			a.invites[args[1]] = true
+			a.Notify("%s has invited %s", name, args[1])
+			if other := findConnection(args[1]); other != nil {
+				fmt.Fprintf(other, "you have been invited to join the alliance %s.  use \"alliance join %s\" to accept.\n", a.name, a.name)
+			}
+		case "join":
+			allianceName := strings.Join(args[1:], " ")
+			other, ok := alliances[allianceName]
+			if !ok {
+				fmt.Fprintf(conn, "no such alliance: %s\n", allianceName)
+				return
+			}
+			if a != nil {
+				fmt.Fprintf(conn, "you're already in an alliance.\n")
+				return
+			}
+			if !other.invites[name] {
+				fmt.Fprintf(conn, "you haven't been invited to %s\n", other.name)
+				return
+			}
+			if err := other.Add(name); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "the alliance registry is closed.  try again later.\n")
+				return
+			}
+			delete(other.invites, name)
+			other.Notify("%s has joined the alliance", name)
+		case "leave":
+			if a == nil {
+				fmt.Fprintf(conn, "you're not in an alliance.\n")
+				return
+			}
+			a.Notify("%s has left the alliance", name)
+			if err := a.Remove(name); err != nil {
+				log_error("%v", err)
+			}
+		case "kick":
+			if a == nil || a.leader != name {
+				fmt.Fprintf(conn, "only an alliance leader can kick members.\n")
+				return
+			}
+			if len(args) != 2 || args[1] == name {
+				fmt.Fprintf(conn, "usage: alliance kick [player]\n")
+				return
+			}
+			if !a.members[args[1]] {
+				fmt.Fprintf(conn, "%s isn't a member of %s\n", args[1], a.name)
+				return
+			}
+			a.Notify("%s has been kicked out by %s", args[1], name)
+			if err := a.Remove(args[1]); err != nil {
+				log_error("%v", err)
+			}
+		default:
+			fmt.Fprintf(conn, "no such alliance subcommand: %s\n", args[0])
+		}
+	},
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"time"
+)
+
+func startAnalytics() {
+	analyticsTick()
+}
+
+func analyticsTick() {
+	defer After(5*time.Minute, analyticsTick)
+	recomputeThreat()
+	checkIndicators(takeIndicators())
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+const (
+	S_Derelict = "derelict"
+	S_Wormhole = "wormhole"
+	S_Nest     = "dragon nest"
+)
+
+type Site struct {
+	kind     string
+	bearing  int
+	revealed bool
+}
+
+type AnomalyScan struct {
+	system  *System
+	site    *Site
+	guesses int
+}
+
+func (s *System) Sites() []*Site {
+	if s.sitesRolled {
+		return s.sites
+	}
+	s.sitesRolled = true
+	for kind, chance := range map[string]float64{S_Derelict: 0.25, S_Wormhole: 0.1, S_Nest: 0.1} {
+		if rand.Float64() >= chance {
+			continue
+		}
+		site := &Site{kind: kind, bearing: rand.Intn(360)}
+		s.sites = append(s.sites, site)
+		if kind == S_Nest {
+			s.nest = NewNest(s, site)
+		}
+	}
+	return s.sites
+}
+
+func (s *System) HiddenSite() *Site {
+	for _, site := range s.Sites() {
+		if !site.revealed {
+			return site
+		}
+	}
+	return nil
+}
+
+var anomalyCommand = &Command{
+	name: "anomaly",
+	help: "scans the current system for hidden sites.  use \"anomaly\" to start and \"anomaly [bearing]\" to home in on the signal",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if len(args) == 0 {
+			site := system.HiddenSite()
+			if site == nil {
+				conn.anomaly = nil
+				fmt.Fprintf(conn, "no anomalous signals detected in %s\n", system.name)
+				return
+			}
+			conn.anomaly = &AnomalyScan{system: system, site: site}
+			fmt.Fprintf(conn, "faint anomalous signal detected somewhere between bearings 0 and 359.\n")
+			fmt.Fprintf(conn, "use \"anomaly [bearing]\" to home in on it.  you have 8 sweeps before the signal fades.\n")
+			return
+		}
+		scan := conn.anomaly
+		if scan == nil || scan.system != system {
+			fmt.Fprintf(conn, "you're not tracking any signal.  use \"anomaly\" to start a scan.\n")
+			return
+		}
+		bearing, err := strconv.Atoi(args[0])
+		if err != nil || bearing < 0 || bearing > 359 {
+			fmt.Fprintf(conn, "bearings run from 0 to 359\n")
+			return
+		}
+		scan.guesses++
+		diff := bearing - scan.site.bearing
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= 2 {
+			conn.anomaly = nil
+			scan.site.revealed = true
+			revealSite(conn, system, scan.site)
+			return
+		}
+		if scan.guesses >= 8 {
+			conn.anomaly = nil
+			fmt.Fprintf(conn, "the signal fades into the background noise.\n")
+			return
+		}
+		if bearing < scan.site.bearing {
+			fmt.Fprintf(conn, "signal is stronger at a higher bearing.  (%d sweeps left)\n", 8-scan.guesses)
+		} else {
+			fmt.Fprintf(conn, "signal is stronger at a lower bearing.  (%d sweeps left)\n", 8-scan.guesses)
+		}
+	},
+}
+
+func revealSite(conn *Connection, system *System, site *Site) {
+	log_info("player %s revealed a %s in %s", conn.PlayerName(), site.kind, system.name)
+	switch site.kind {
+	case S_Derelict:
+		salvage := int64(200 + rand.Intn(600))
+		fmt.Fprintf(conn, "you found a derelict ship drifting at bearing %d and salvaged %d space duckets from it.\n", site.bearing, salvage)
+		conn.Deposit(salvage)
+	case S_Wormhole:
+		if system.wormhole != nil {
+			fmt.Fprintf(conn, "you found the mouth of a wormhole, but it's tangled up with the one already open here.\n")
+			return
+		}
+		for i := 0; i < 20; i++ {
+			other, err := randomSystem()
+			if err != nil || other == nil || other == system || other.wormhole != nil {
+				continue
+			}
+			fmt.Fprintf(conn, "you found the mouth of a hidden wormhole at bearing %d!\n", site.bearing)
+			openWormhole(system, other, 10*time.Minute)
+			return
+		}
+	case S_Nest:
+		fmt.Fprintf(conn, "you found a dragon nest at bearing %d.  something very large is sleeping here.\n", site.bearing)
+		if system.nest != nil {
+			fmt.Fprintf(conn, "%d dragons guard it.  use \"assault\" to attack, but bring friends.\n", system.nest.Alive())
+		}
+	}
+}
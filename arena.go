@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type arenaEntry struct {
+	home     *System
+	hull     int
+	kills    int
+	deaths   int
+	lastShot time.Time
+}
+
+type Arena struct {
+	systems   []*System
+	entries   map[*Connection]*arenaEntry
+	matchEnds time.Time
+}
+
+var arena = NewArena()
+
+func NewArena() *Arena {
+	a := &Arena{entries: make(map[*Connection]*arenaEntry, 8)}
+	for i, name := range []string{"Arena Alpha", "Arena Beta", "Arena Gamma", "Arena Delta"} {
+		s := &System{id: -1 - i, name: name, arena: true}
+		switch i {
+		case 1:
+			s.x = 40
+		case 2:
+			s.y = 40
+		case 3:
+			s.z = 40
+		}
+		a.systems = append(a.systems, s)
+	}
+	return a
+}
+
+func arenaTable() {
+	stmnt := `create table if not exists arena (
+        name text unique,
+        rating integer default 1000,
+        matches integer default 0
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create arena table: %v", err)
+	}
+}
+
+func arenaRating(name string) int {
+	row := db.QueryRow(`select rating from arena where name = ?`, name)
+	rating := 1000
+	if err := row.Scan(&rating); err != nil {
+		return 1000
+	}
+	return rating
+}
+
+func adjustArenaRating(name string, delta int) {
+	if _, err := db.Exec(`insert or ignore into arena (name) values (?);`, name); err != nil {
+		log_error("unable to create arena rating for %s: %v", name, err)
+		return
+	}
+	_, err := db.Exec(`
+        update arena
+        set rating = rating + ?, matches = matches + 1
+        where name = ?
+    ;`, delta, name)
+	if err != nil {
+		log_error("unable to update arena rating for %s: %v", name, err)
+	}
+}
+
+func (a *Arena) Notify(template string, args ...interface{}) {
+	for conn, _ := range a.entries {
+		fmt.Fprintf(conn, "[arena] %s\n", fmt.Sprintf(template, args...))
+	}
+}
+
+func (a *Arena) Join(conn *Connection) {
+	home := conn.System()
+	conn.fighters += conn.defenders + conn.harassers
+	conn.defenders, conn.harassers, conn.harassing = 0, 0, nil
+	home.Leave(conn)
+	a.entries[conn] = &arenaEntry{home: home, hull: 100}
+	conn.arena = a
+	a.systems[len(a.entries)%len(a.systems)].Arrive(conn)
+	a.Notify("%s has entered the arena", conn.PlayerName())
+	if len(a.entries) >= 2 && a.matchEnds.IsZero() {
+		a.matchEnds = clock.Now().Add(5 * time.Minute)
+		a.Notify("the match has begun!  it ends in 5 minutes")
+		After(5*time.Minute, a.EndMatch)
+	}
+}
+
+func (a *Arena) Leave(conn *Connection) {
+	e, ok := a.entries[conn]
+	if !ok {
+		return
+	}
+	if s := conn.System(); s != nil {
+		s.Leave(conn)
+	}
+	delete(a.entries, conn)
+	conn.arena = nil
+	if len(a.entries) < 2 && !a.matchEnds.IsZero() {
+		a.EndMatch()
+	}
+	e.home.Arrive(conn)
+	fmt.Fprintf(conn, "you're back in %s, right where you left your ship.\n", e.home.name)
+}
+
+func (a *Arena) EndMatch() {
+	if a.matchEnds.IsZero() {
+		return
+	}
+	a.matchEnds = time.Time{}
+	var best *Connection
+	for conn, e := range a.entries {
+		if best == nil || e.kills > a.entries[best].kills {
+			best = conn
+		}
+	}
+	for conn, e := range a.entries {
+		delta := 10*e.kills - 5*e.deaths
+		if conn == best && e.kills > 0 {
+			delta += 25
+		}
+		adjustArenaRating(conn.PlayerName(), delta)
+		fmt.Fprintf(conn, "[arena] match over.  kills: %d deaths: %d rating change: %+d\n", e.kills, e.deaths, delta)
+		e.kills, e.deaths = 0, 0
+	}
+	if best != nil && a.entries[best] != nil {
+		publishNews("%s has won an arena match", best.PlayerName())
+	}
+}
+
+func (a *Arena) Fire(conn *Connection, to *System) {
+	e := a.entries[conn]
+	if clock.Now().Sub(e.lastShot) < 5*time.Second {
+		fmt.Fprintf(conn, "arena launcher is reloading.\n")
+		return
+	}
+	e.lastShot = clock.Now()
+	delay := conn.System().BombTimeTo(to)
+	fmt.Fprintf(conn, "firing on %s. ETA: %v\n", to.name, delay)
+	After(delay, func() {
+		to.EachConn(func(victim *Connection) {
+			ve, ok := a.entries[victim]
+			if !ok || victim == conn {
+				return
+			}
+			ve.hull -= 50
+			if ve.hull > 0 {
+				fmt.Fprintf(victim, "[arena] you were hit!  hull: %d\n", ve.hull)
+				return
+			}
+			ve.deaths++
+			ve.hull = 100
+			if ae, ok := a.entries[conn]; ok {
+				ae.kills++
+			}
+			a.Notify("%s destroyed %s", conn.PlayerName(), victim.PlayerName())
+			to.Leave(victim)
+			After(5*time.Second, func() {
+				if _, ok := a.entries[victim]; ok {
+					a.systems[0].Arrive(victim)
+					fmt.Fprintf(victim, "[arena] respawned in %s\n", a.systems[0].name)
+				}
+			})
+		})
+	})
+}
+
+func (a *Arena) System(arg string) *System {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 || n >= len(a.systems) {
+		return nil
+	}
+	return a.systems[n]
+}
+
+var arenaCommand = &Command{
+	name:   "arena",
+	help:   "opt-in deathmatches in a pocket galaxy.  subcommands: join, leave, map, goto [n], fire [n], rating",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			args = []string{"map"}
+		}
+		if args[0] == "rating" {
+			fmt.Fprintf(conn, "arena rating: %d\n", arenaRating(conn.PlayerName()))
+			return
+		}
+		if args[0] == "join" {
+			if conn.arena != nil {
+				fmt.Fprintf(conn, "you're already in the arena.\n")
+				return
+			}
+			if conn.InTransit() || conn.capital != nil || (relic != nil && relic.carrier == conn) {
+				fmt.Fprintf(conn, "you can't enter the arena right now.\n")
+				return
+			}
+			arena.Join(conn)
+			return
+		}
+		if conn.arena == nil {
+			fmt.Fprintf(conn, "you're not in the arena.  use \"arena join\" to enter.\n")
+			return
+		}
+		a := conn.arena
+		switch args[0] {
+		case "leave":
+			a.Leave(conn)
+		case "map":
+			names := make([]string, 0, len(a.entries))
+			for other, _ := range a.entries {
+				names = append(names, other.PlayerName())
+			}
+			sort.Strings(names)
+			for i, s := range a.systems {
+				fmt.Fprintf(conn, "%-4d %-20s %d ships\n", i, s.name, s.NumInhabitants())
+			}
+			fmt.Fprintf(conn, "combatants: %v\n", names)
+			fmt.Fprintf(conn, "hull: %d\n", a.entries[conn].hull)
+		case "goto", "fire":
+			if len(args) != 2 || a.System(args[1]) == nil {
+				fmt.Fprintf(conn, "usage: arena %s [0-%d]\n", args[0], len(a.systems)-1)
+				return
+			}
+			if conn.InTransit() {
+				fmt.Fprintf(conn, "you're still in transit.\n")
+				return
+			}
+			to := a.System(args[1])
+			if args[0] == "fire" {
+				a.Fire(conn, to)
+				return
+			}
+			start := conn.System()
+			start.Leave(conn)
+			delay := start.TravelTimeTo(to)
+			fmt.Fprintf(conn, "moving to %s. ETA: %v\n", to.name, delay)
+			After(delay, func() {
+				if conn.arena == a {
+					to.Arrive(conn)
+				}
+			})
+		default:
+			fmt.Fprintf(conn, "no such arena subcommand: %s\n", args[0])
+		}
+	},
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// how long the blast residue of a bomb lingers for scanners to pick up.
+const residueTime = 15 * time.Minute
+
+// BombClass is a kind of bomb.  Fission bombs are the standard issue ones
+// every ship carries; the rest have to be bought and stored in the armory.
+type BombClass struct {
+	name  string
+	yield int
+	// multiplier on the time it takes the bomb to reach its target
+	speed float64
+	cost  int64
+	// resources it takes to build one, on top of the cost
+	materials Resources
+	about     string
+	// piercing bombs can't be intercepted by escorts or fighters
+	piercing bool
+	// emp bombs knock out shields before the blast hits
+	emp bool
+	// fallout is anything the bomb leaves behind in the system it hits
+	fallout func(*System)
+}
+
+var (
+	fission = &BombClass{
+		name:      "fission",
+		yield:     baseYield,
+		speed:     1,
+		cost:      500,
+		materials: Resources{"ore": 5},
+		about:     "the standard issue bomb",
+	}
+	fusion = &BombClass{
+		name:      "fusion",
+		yield:     150,
+		speed:     1.25,
+		cost:      1200,
+		materials: Resources{"ore": 5, "gas": 10},
+		about:     "a slower, heavier bomb that leaves the target system irradiated for a while",
+		fallout: func(s *System) {
+			s.Irradiate(10 * time.Minute)
+		},
+	}
+	antimatter = &BombClass{
+		name:      "antimatter",
+		yield:     250,
+		speed:     0.75,
+		cost:      3000,
+		materials: Resources{"ore": 5, "gas": 5, "crystal": 10},
+		about:     "a fast bomb that strips shields and punches through escorts and fighters",
+		piercing:  true,
+		emp:       true,
+	}
+)
+
+var bombClasses = map[string]*BombClass{
+	fission.name:    fission,
+	fusion.name:     fusion,
+	antimatter.name: antimatter,
+}
+
+var bombClassOrder = []*BombClass{fission, fusion, antimatter}
+
+func bombClass(name string) *BombClass {
+	if b, ok := bombClasses[name]; ok {
+		return b
+	}
+	return fission
+}
+
+func (b *BombClass) TimeTo(from, to *System) time.Duration {
+	return physics.Modified(from.DistanceTo(to), from.BombTimeTo(to), b.speed)
+}
+
+// The armory is kept per character along with the cargo (see SaveCargo), so
+// bombs bought there aren't lost on logout.
+func armoryTable() {
+	stmnt := `create table if not exists armory (
+        character integer not null,
+        class text not null,
+        quantity integer not null,
+        primary key (character, class)
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create armory table: %v", err)
+	}
+}
+
+// BombCost is what a bomb costs this pilot to build, after ordnance research.
+func (c *Connection) BombCost(b *BombClass) int64 {
+	return int64(float64(b.cost) * c.TechBonus("ordnance"))
+}
+
+func (c *Connection) BombCount(b *BombClass) int {
+	if b == fission {
+		return c.bombs
+	}
+	return c.armory[b.name]
+}
+
+func (c *Connection) AddBombs(b *BombClass, n int) {
+	if b == fission {
+		c.bombs += n
+		return
+	}
+	if c.armory == nil {
+		c.armory = make(map[string]int, len(bombClasses))
+	}
+	c.armory[b.name] += n
+}
+
+func (s *System) Irradiate(d time.Duration) {
+	s.hazard = &Hazard{kind: "irradiated", damage: 5, until: clock.Now().Add(d)}
+	s.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "fallout from the blast has left %s irradiated\n", s.name)
+	})
+}
+
+// Residue names the kind of bomb that last went off in the system, if it
+// was recent enough for a scan to tell.
+func (s *System) Residue() string {
+	if s.lastBomb == nil || clock.Now().Sub(s.lastBombAt) > residueTime {
+		return ""
+	}
+	return s.lastBomb.name
+}
+
+// parseBombArgs splits an optional bomb class off the front of a command's
+// arguments.
+func parseBombArgs(args []string) (*BombClass, []string) {
+	if len(args) > 1 {
+		if b, ok := bombClasses[args[0]]; ok {
+			return b, args[1:]
+		}
+	}
+	return fission, args
+}
+
+var armoryCommand = &Command{
+	name:   "armory",
+	help:   "lists the classes of bomb you can build and how many of each you have",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		for _, b := range bombClassOrder {
+			fmt.Fprintf(conn, "%-12s %3d in stock  yield %-4d %s\n", b.name, conn.BombCount(b), b.yield, b.about)
+			fmt.Fprintf(conn, "%-12s costs %d duckets and %s\n", "", conn.BombCost(b), b.materials)
+		}
+		fmt.Fprintf(conn, "build them with \"mkbomb [fission|fusion|antimatter]\"\n")
+	},
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var tractorCommand = &Command{
+	name: "tractor",
+	help: "locks a heavily damaged ship in your system in a tractor beam, disabling it.  usage: tractor [player-name]",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) != 1 {
+			fmt.Fprintf(conn, "usage: tractor [player-name]\n")
+			return
+		}
+		system := conn.System()
+		target := system.FindPlayer(args[0])
+		if target == nil || target == conn {
+			fmt.Fprintf(conn, "there's no ship named %s in %s\n", args[0], system.name)
+			return
+		}
+		if target.docked {
+			fmt.Fprintf(conn, "%s is docked and can't be reached\n", target.PlayerName())
+			return
+		}
+		if TreatyForbids(conn, system) != "" || AtPeace(conn, target) {
+			fmt.Fprintf(conn, "seizing %s would violate a peace treaty\n", target.PlayerName())
+			return
+		}
+		if target.hull > 25 {
+			fmt.Fprintf(conn, "%s is too healthy to hold.  hull: %d\n", target.PlayerName(), target.hull)
+			return
+		}
+		if target.duel != nil {
+			fmt.Fprintf(conn, "%s is in a duel.  the marshals won't allow it.\n", target.PlayerName())
+			return
+		}
+		if target.heldBy != nil {
+			fmt.Fprintf(conn, "%s is already held in a tractor beam\n", target.PlayerName())
+			return
+		}
+		target.heldBy = conn
+		fmt.Fprintf(conn, "%s is locked in your tractor beam.  use \"board %s\" to board it.\n", target.PlayerName(), target.PlayerName())
+		fmt.Fprintf(target, "your ship has been seized by a tractor beam from %s, piloted by %s!\n", conn.ShipLabel(), conn.PlayerName())
+		After(2*time.Minute, func() {
+			if target.heldBy == conn {
+				target.Release()
+			}
+		})
+	},
+}
+
+var boardCommand = &Command{
+	name: "board",
+	help: "boards a ship held in your tractor beam.  usage: board [player-name] [steal|capture]",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			fmt.Fprintf(conn, "usage: board [player-name] [steal|capture]\n")
+			return
+		}
+		target := conn.System().FindPlayer(args[0])
+		if target == nil || target.heldBy != conn {
+			fmt.Fprintf(conn, "you don't have a ship named %s in your tractor beam\n", args[0])
+			return
+		}
+		action := "steal"
+		if len(args) > 1 {
+			action = args[1]
+		}
+		if action != "steal" && action != "capture" {
+			fmt.Fprintf(conn, "you can either steal from a ship or capture it, not %s\n", action)
+			return
+		}
+		board(conn, target, action)
+	},
+}
+
+func (c *Connection) Release() {
+	if c.heldBy == nil {
+		return
+	}
+	fmt.Fprintf(c, "the tractor beam releases your ship\n")
+	c.heldBy = nil
+}
+
+func board(conn, target *Connection, action string) {
+	fmt.Fprintf(conn, "your crew boards %s, piloted by %s...\n", target.ShipLabel(), target.PlayerName())
+	fmt.Fprintf(target, "boarders from %s, piloted by %s, are storming your ship!  your crew fights back...\n", conn.ShipLabel(), conn.PlayerName())
+
+	out := ResolveBoarding(Boarding{
+		Crew:         conn.crew,
+		Grapple:      conn.HasUpgrade("grapple"),
+		DefenderCrew: target.crew,
+		Escorts:      target.escorts,
+		Defenders:    target.defenders,
+	}, dice)
+	losses := out.Losses
+	if !out.Success {
+		conn.LoseCrew(losses)
+		fmt.Fprintf(conn, "the boarding party is repelled.  you lost %d crew.\n", losses)
+		fmt.Fprintf(target, "you repelled the boarders from %s!\n", conn.PlayerName())
+		return
+	}
+
+	target.LoseCrew(losses)
+	target.Release()
+	conn.AdjustReputation(pirateClans, 5)
+	conn.AdjustReputation(minersGuild, -3)
+	switch action {
+	case "steal":
+		loot := target.money / 2
+		target.Withdraw(loot)
+		conn.bombs += target.bombs
+		stolen := target.bombs
+		target.bombs = 0
+		fmt.Fprintf(target, "boarders from %s made off with %d space duckets and %d bombs.\n", conn.PlayerName(), loot, stolen)
+		fmt.Fprintf(conn, "your crew made off with %d space duckets and %d bombs.\n", loot, stolen)
+		for name, n := range target.cargo {
+			if n = conn.Stow(goods[name], n); n > 0 {
+				fmt.Fprintf(conn, "your crew hauls away %d %s.\n", n, name)
+			}
+		}
+		target.cargo = nil
+		conn.Deposit(loot)
+	case "capture":
+		conn.bombs += target.bombs
+		target.bombs = 0
+		fmt.Fprintf(conn, "you captured the ship of %s and stripped it for parts.\n", target.PlayerName())
+		fmt.Fprintf(target, "your ship has been captured by %s.\n", conn.PlayerName())
+		target.Die()
+		conn.MadeKill(target, W_Boarding)
+	}
+}
+
+func (c *Connection) LoseCrew(n int) {
+	c.crew -= n
+	if c.crew < 1 {
+		c.crew = 1
+	}
+}
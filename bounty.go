@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounties are resources put up for killing a particular pilot.  The poster
+// hands the resources over when they place the bounty, and whoever kills
+// the target collects everything posted on them.  Anything that doesn't fit
+// in the killer's hold waits for them at any station, for "bounty collect".
+// A poster can call their bounty off, and gets it back the same way.
+// Bounties live in the database, since they're escrow and shouldn't vanish
+// with a restart.
+const (
+	// bounties worth at least this much are announced to everyone
+	bigBounty = 5000
+	// the smallest bounty worth posting
+	minBounty = 10
+)
+
+func bountiesTable() {
+	stmnt := `create table if not exists bounties (
+        id integer not null primary key autoincrement,
+        poster text not null,
+        target text not null,
+        resource text not null,
+        quantity integer not null,
+        posted integer not null,
+        claimant text not null default ''
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create bounties table: %v", err)
+	}
+}
+
+// bountyValue is what an amount of resources would fetch at base prices, for
+// deciding what counts as a big bounty.
+func bountyValue(r Resources) int64 {
+	var v int64
+	for name, n := range r {
+		v += goods[name].basePrice * int64(n)
+	}
+	return v
+}
+
+// BountyOn totals the open bounties on a pilot.
+func BountyOn(target string) (Resources, error) {
+	rows, err := db.Query(`
+        select resource, sum(quantity)
+        from bounties
+        where target = ? and claimant = ''
+        group by resource
+    ;`, target)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read bounties on %s: %v", target, err)
+	}
+	defer rows.Close()
+	r := make(Resources, len(resources))
+	for rows.Next() {
+		var name string
+		var n int
+		if err := rows.Scan(&name, &n); err != nil {
+			return nil, fmt.Errorf("unable to scan bounty row: %v", err)
+		}
+		r[name] = n
+	}
+	return r, rows.Err()
+}
+
+// bountyClaim is one row of the bounty board: so much of one resource.
+type bountyClaim struct {
+	id       int
+	resource string
+	quantity int
+}
+
+func readBounties(query string, args ...interface{}) ([]bountyClaim, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read bounties: %v", err)
+	}
+	defer rows.Close()
+	claims := make([]bountyClaim, 0, 4)
+	for rows.Next() {
+		var cl bountyClaim
+		if err := rows.Scan(&cl.id, &cl.resource, &cl.quantity); err != nil {
+			return nil, fmt.Errorf("unable to scan bounty row: %v", err)
+		}
+		claims = append(claims, cl)
+	}
+	return claims, rows.Err()
+}
+
+func placeBounty(conn *Connection, target, name string, n int) {
+	if _, err := db.Exec(`
+        insert into bounties
+        (poster, target, resource, quantity, posted)
+        values
+        (?, ?, ?, ?, ?)
+    ;`, conn.PlayerName(), target, name, n, time.Now().Unix()); err != nil {
+		log_error("unable to place bounty on %s: %v", target, err)
+		fmt.Fprintf(conn, "the bounty office couldn't take your bounty.  try again later.\n")
+		return
+	}
+	conn.AddCargo(goods[name], -n)
+	fmt.Fprintf(conn, "you put %d %s on the head of %s.\n", n, name, target)
+	log_info("%s placed a bounty of %d %s on %s", conn.PlayerName(), n, name, target)
+	if bountyValue(Resources{name: n}) >= bigBounty {
+		total, err := BountyOn(target)
+		if err != nil {
+			log_error("%v", err)
+			total = Resources{name: n}
+		}
+		for other, _ := range connected {
+			fmt.Fprintf(other, "a bounty of %d %s has been posted on %s.  the price on their head is now %s.\n", n, name, target, total)
+		}
+		publishNews("a bounty of %d %s has been posted on %s", n, name, target)
+	}
+	if victim := findConnection(target); victim != nil {
+		victim.Notice("someone has put %d %s on your head.\n", n, name)
+	}
+}
+
+// ClaimBounties pays out every bounty on the victim to the pilot who killed
+// them.  Pilots can't collect bounties they posted themselves, or on their
+// allies.
+func (c *Connection) ClaimBounties(victim *Connection) {
+	if victim == c || c.Allied(victim) {
+		return
+	}
+	target := victim.PlayerName()
+	claims, err := readBounties(`
+        select id, resource, quantity
+        from bounties
+        where target = ? and poster != ? and claimant = ''
+    ;`, target, c.PlayerName())
+	if err != nil {
+		log_error("%v", err)
+		return
+	}
+	if len(claims) == 0 {
+		return
+	}
+	won := make(Resources, len(resources))
+	for _, cl := range claims {
+		won[cl.resource] += cl.quantity
+		if _, err := db.Exec(`update bounties set claimant = ? where id = ?`, c.PlayerName(), cl.id); err != nil {
+			log_error("unable to claim bounty %d: %v", cl.id, err)
+		}
+	}
+	fmt.Fprintf(c, "you've claimed the bounty on %s: %s.\n", target, won)
+	c.CollectBounties()
+	log_info("%s claimed the bounty on %s: %s", c.PlayerName(), target, won)
+	if bountyValue(won) >= bigBounty {
+		for other, _ := range connected {
+			fmt.Fprintf(other, "%s has claimed the bounty of %s on %s!\n", c.PlayerName(), won, target)
+		}
+		publishNews("%s has claimed the bounty of %s on %s", c.PlayerName(), won, target)
+	}
+}
+
+// CancelBounties calls off the pilot's open bounties on the target.  What
+// they posted goes back to them through the bounty office, as though they'd
+// claimed it.
+func (c *Connection) CancelBounties(target string) {
+	res, err := db.Exec(`update bounties set claimant = poster where poster = ? and target = ? and claimant = ''`, c.PlayerName(), target)
+	if err != nil {
+		log_error("unable to cancel bounties on %s: %v", target, err)
+		fmt.Fprintf(c, "the bounty office couldn't cancel your bounty.  try again later.\n")
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		fmt.Fprintf(c, "you haven't put a bounty on %s.\n", target)
+		return
+	}
+	fmt.Fprintf(c, "you've called off your bounty on %s.\n", target)
+	log_info("%s cancelled their bounty on %s", c.PlayerName(), target)
+	if c.AtStation() {
+		c.CollectBounties()
+		return
+	}
+	fmt.Fprintf(c, "it's waiting for you at the bounty office.  use \"bounty collect\" at any station.\n")
+}
+
+// CollectBounties moves as much of the pilot's claimed bounties into their
+// hold as will fit.  The rest stays with the bounty office.
+func (c *Connection) CollectBounties() {
+	claims, err := readBounties(`select id, resource, quantity from bounties where claimant = ?`, c.PlayerName())
+	if err != nil {
+		log_error("%v", err)
+		return
+	}
+	got := make(Resources, len(resources))
+	left := make(Resources, len(resources))
+	for _, cl := range claims {
+		n := c.Stow(goods[cl.resource], cl.quantity)
+		got[cl.resource] += n
+		if n == cl.quantity {
+			_, err = db.Exec(`delete from bounties where id = ?`, cl.id)
+		} else {
+			left[cl.resource] += cl.quantity - n
+			_, err = db.Exec(`update bounties set quantity = ? where id = ?`, cl.quantity-n, cl.id)
+		}
+		if err != nil {
+			log_error("unable to pay out bounty %d: %v", cl.id, err)
+		}
+	}
+	if len(claims) == 0 {
+		fmt.Fprintf(c, "the bounty office has nothing for you.\n")
+		return
+	}
+	fmt.Fprintf(c, "collected %s from the bounty office.\n", got)
+	if len(left) > 0 {
+		fmt.Fprintf(c, "your hold is full.  %s is waiting for you; use \"bounty collect\" at a station once you've made room.\n", left)
+	}
+}
+
+var bountyCommand = &Command{
+	name: "bounty",
+	help: "the bounty board.  usage:\n" +
+		"\tbounty list\n" +
+		"\tbounty place [pilot] [ore|gas|crystal] [quantity]   (pays out to whoever kills them)\n" +
+		"\tbounty cancel [pilot]   (calls off your bounty and refunds it)\n" +
+		"\tbounty collect   (picks up claimed bounties that didn't fit in your hold)",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			args = []string{"list"}
+		}
+		switch args[0] {
+		case "list":
+			rows, err := db.Query(`
+                select target, resource, sum(quantity)
+                from bounties
+                where claimant = ''
+                group by target, resource
+                order by target
+            ;`)
+			if err != nil {
+				log_error("unable to read bounty board: %v", err)
+				return
+			}
+			defer rows.Close()
+			board := make(map[string]Resources, 8)
+			targets := make([]string, 0, 8)
+			for rows.Next() {
+				var target, name string
+				var n int
+				if err := rows.Scan(&target, &name, &n); err != nil {
+					log_error("unable to scan bounty row: %v", err)
+					continue
+				}
+				if board[target] == nil {
+					board[target] = make(Resources, len(resources))
+					targets = append(targets, target)
+				}
+				board[target][name] = n
+			}
+			if len(targets) == 0 {
+				fmt.Fprintf(conn, "the bounty board is empty.\n")
+				return
+			}
+			fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+			for _, target := range targets {
+				fmt.Fprintf(conn, "%-20s %s\n", target, board[target])
+			}
+			fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		case "place":
+			if len(args) != 4 {
+				fmt.Fprintf(conn, "usage: bounty place [pilot] [ore|gas|crystal] [quantity]\n")
+				return
+			}
+			target, name := args[1], args[2]
+			if !isResource(name) {
+				fmt.Fprintf(conn, "bounties are paid in ore, gas or crystal\n")
+				return
+			}
+			n, err := strconv.Atoi(args[3])
+			if err != nil || n < minBounty {
+				fmt.Fprintf(conn, "bounties start at %d units\n", minBounty)
+				return
+			}
+			if strings.EqualFold(target, conn.PlayerName()) {
+				fmt.Fprintf(conn, "you can't put a bounty on yourself.\n")
+				return
+			}
+			if !characterExists(target) {
+				fmt.Fprintf(conn, "no pilot called %s is on record.\n", target)
+				return
+			}
+			if conn.cargo[name] < n {
+				fmt.Fprintf(conn, "you only have %d %s in your hold\n", conn.cargo[name], name)
+				return
+			}
+			placeBounty(conn, target, name, n)
+		case "cancel":
+			if len(args) != 2 {
+				fmt.Fprintf(conn, "usage: bounty cancel [pilot]\n")
+				return
+			}
+			conn.CancelBounties(args[1])
+		case "collect":
+			if !conn.AtStation() {
+				fmt.Fprintf(conn, "you have to be at a station to collect bounties.\n")
+				return
+			}
+			conn.CollectBounties()
+		default:
+			fmt.Fprintf(conn, "no such bounty subcommand: %s\n", args[0])
+		}
+	},
+}
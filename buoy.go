@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+)
+
+var buoyCommand = &Command{
+	name: "buoy",
+	help: "deploys a sensor buoy in an uncolonized system that reports arrivals back to you.  Costs 200 space duckets",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if system.Colonizer() != nil {
+			fmt.Fprintf(conn, "%s is colonized.  buoys can only be deployed in uncolonized systems.\n", system.name)
+			return
+		}
+		if system.buoys[conn] {
+			fmt.Fprintf(conn, "you already have a buoy in %s\n", system.name)
+			return
+		}
+		if conn.money < 200 {
+			fmt.Fprintf(conn, "not enough money!  buoys cost 200 space duckets, you only have %d in the bank.\n", conn.money)
+			return
+		}
+		conn.Withdraw(200)
+		if system.buoys == nil {
+			system.buoys = make(map[*Connection]bool, 4)
+		}
+		system.buoys[conn] = true
+		fmt.Fprintf(conn, "deployed a sensor buoy in %s\n", system.name)
+	},
+}
+
+var buoysCommand = &Command{
+	name:   "buoys",
+	help:   "lists your sensor buoys",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		n := 0
+		for _, system := range allSystems() {
+			if system.buoys[conn] {
+				fmt.Fprintf(conn, "%-4d %s\n", system.id, system.name)
+				n++
+			}
+		}
+		if n == 0 {
+			fmt.Fprintf(conn, "you have no sensor buoys deployed.\n")
+		}
+	},
+}
+
+var sweepCommand = &Command{
+	name: "sweep",
+	help: "hunts down and destroys enemy sensor buoys in the current system",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		n := 0
+		for owner, _ := range system.buoys {
+			if owner == conn {
+				continue
+			}
+			system.LoseBuoy(owner)
+			n++
+		}
+		fmt.Fprintf(conn, "destroyed %d sensor buoys in %s\n", n, system.name)
+	},
+}
+
+func (s *System) LoseBuoy(owner *Connection) {
+	delete(s.buoys, owner)
+	if owner.InTransit() {
+		return
+	}
+	After(s.LightTimeTo(owner.System()), func() {
+		fmt.Fprintf(owner, "lost contact with your sensor buoy in %s\n", s.name)
+	})
+}
+
+func (s *System) BuoyReport(p *Connection) {
+	for owner, _ := range s.buoys {
+		if owner == p || owner.InTransit() {
+			continue
+		}
+		o := owner
+		desc := o.Describe(p)
+		After(s.LightTimeTo(o.System()), func() {
+			fmt.Fprintf(o, "sensor buoy in %s reports: %s has arrived\n", s.name, desc)
+		})
+	}
+}
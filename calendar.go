@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// event kinds.  these are stored in the events table, so they can't change.
+const (
+	EK_DoubleMining   = "double-mining"
+	EK_DragonInvasion = "dragon-invasion"
+)
+
+type Event struct {
+	id       int
+	kind     string
+	starts   time.Time
+	duration time.Duration
+	repeat   string
+}
+
+var (
+	calendar       = make(map[int]*Event, 16)
+	doubleMiningTo time.Time
+)
+
+var eventKinds = map[string]func(*Event){
+	EK_DoubleMining: func(e *Event) {
+		doubleMiningTo = clock.Now().Add(e.duration)
+		publishNews("double mining is in effect for the next %v", e.duration)
+	},
+	EK_DragonInvasion: func(e *Event) {
+		publishNews("dragons are invading the galaxy!")
+		for i := 0; i < 3; i++ {
+			respawnNest()
+			if s, err := randomSystem(); err == nil && s != nil {
+				s.Scorch(e.duration)
+			}
+		}
+	},
+}
+
+func eventsTable() {
+	stmnt := `create table if not exists events (
+        id integer not null primary key autoincrement,
+        kind text,
+        starts datetime,
+        duration integer,
+        repeat text
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create events table: %v", err)
+	}
+}
+
+func loadCalendar() {
+	rows, err := db.Query(`select id, kind, starts, duration, repeat from events`)
+	if err != nil {
+		log_error("unable to load events calendar: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Event
+		var seconds int64
+		if err := rows.Scan(&e.id, &e.kind, &e.starts, &seconds, &e.repeat); err != nil {
+			log_error("error unpacking row from events query: %v", err)
+			continue
+		}
+		if _, ok := eventKinds[e.kind]; !ok {
+			log_error("skipping event %d: unknown kind %q", e.id, e.kind)
+			continue
+		}
+		e.duration = time.Duration(seconds) * time.Second
+		e.schedule()
+	}
+}
+
+func (e *Event) Store() error {
+	res, err := db.Exec(`
+        insert into events
+        (kind, starts, duration, repeat)
+        values
+        (?, ?, ?, ?)
+    ;`, e.kind, e.starts, int64(e.duration/time.Second), e.repeat)
+	if err != nil {
+		return fmt.Errorf("unable to store event: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("unable to read event id: %v", err)
+	}
+	e.id = int(id)
+	return nil
+}
+
+func (e *Event) period() time.Duration {
+	switch e.repeat {
+	case "daily":
+		return 24 * time.Hour
+	case "weekly":
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+func (e *Event) Next() time.Time {
+	next := e.starts
+	if p := e.period(); p > 0 {
+		for next.Add(e.duration).Before(clock.Now()) {
+			next = next.Add(p)
+		}
+	}
+	return next
+}
+
+func (e *Event) schedule() {
+	next := e.Next()
+	if next.Add(e.duration).Before(clock.Now()) {
+		return
+	}
+	calendar[e.id] = e
+	AtNamed(e.kind, next, func() {
+		if calendar[e.id] != e {
+			return
+		}
+		start, ok := eventKinds[e.kind]
+		if !ok {
+			log_error("event %d has unknown kind %q", e.id, e.kind)
+			delete(calendar, e.id)
+			return
+		}
+		log_info("event %d (%s) is starting", e.id, e.kind)
+		start(e)
+		if e.period() == 0 {
+			delete(calendar, e.id)
+			return
+		}
+		e.starts = next.Add(e.period())
+		e.schedule()
+	})
+}
+
+func miningMultiplier() float64 {
+	if clock.Now().Before(doubleMiningTo) {
+		return 2
+	}
+	return 1
+}
+
+var eventsCommand = &Command{
+	name:   "events",
+	help:   "lists upcoming scheduled server events",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(calendar) == 0 {
+			fmt.Fprintf(conn, "nothing is scheduled.\n")
+			return
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		fmt.Fprintf(conn, "%-4s %-16s %-22s %-10s %s\n", "id", "event", "starts (UTC)", "duration", "repeats")
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		for _, e := range calendar {
+			fmt.Fprintf(conn, "%-4d %-16s %-22s %-10v %s\n", e.id, e.kind, e.Next().UTC().Format("2006-01-02 15:04"), e.duration, e.repeat)
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+	},
+}
+
+var eventCommand = &Command{
+	name:   "event",
+	help:   "admin only.  usage: event add [kind] [YYYY-MM-DDTHH:MM] [minutes] [daily|weekly] | event remove [id]",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can manage the events calendar.\n")
+			return
+		}
+		if len(args) >= 4 && args[0] == "add" {
+			if _, ok := eventKinds[args[1]]; !ok {
+				fmt.Fprintf(conn, "no such event kind: %s.  try %s or %s\n", args[1], EK_DoubleMining, EK_DragonInvasion)
+				return
+			}
+			starts, err := time.Parse("2006-01-02T15:04", args[2])
+			if err != nil {
+				fmt.Fprintf(conn, "bad start time: %v\n", err)
+				return
+			}
+			minutes, err := strconv.Atoi(args[3])
+			if err != nil || minutes < 1 {
+				fmt.Fprintf(conn, "bad duration: %s\n", args[3])
+				return
+			}
+			e := &Event{kind: args[1], starts: starts, duration: time.Duration(minutes) * time.Minute}
+			if len(args) > 4 {
+				e.repeat = args[4]
+				if e.period() == 0 {
+					fmt.Fprintf(conn, "events repeat daily or weekly, not %s\n", e.repeat)
+					return
+				}
+			}
+			if err := e.Store(); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "couldn't save the event.\n")
+				return
+			}
+			e.schedule()
+			log_info("admin %s scheduled event %d (%s)", conn.PlayerName(), e.id, e.kind)
+			fmt.Fprintf(conn, "scheduled event %d\n", e.id)
+			return
+		}
+		if len(args) == 2 && args[0] == "remove" {
+			id, err := strconv.Atoi(args[1])
+			if err != nil {
+				fmt.Fprintf(conn, "bad event id: %s\n", args[1])
+				return
+			}
+			if _, err := db.Exec(`delete from events where id = ?`, id); err != nil {
+				log_error("unable to delete event %d: %v", id, err)
+			}
+			delete(calendar, id)
+			log_info("admin %s removed event %d", conn.PlayerName(), id)
+			fmt.Fprintf(conn, "removed event %d\n", id)
+			return
+		}
+		fmt.Fprintf(conn, "usage: event add [kind] [YYYY-MM-DDTHH:MM] [minutes] [daily|weekly] | event remove [id]\n")
+	},
+}
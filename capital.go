@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	R_Helm        = "helm"
+	R_Weapons     = "weapons"
+	R_Sensors     = "sensors"
+	R_Engineering = "engineering"
+)
+
+var capitalRoles = []string{R_Helm, R_Weapons, R_Sensors, R_Engineering}
+
+type CapitalShip struct {
+	name       string
+	crew       map[string]*Connection
+	invites    map[*Connection]bool
+	hull       int
+	bombs      int
+	lastScan   time.Time
+	lastRepair time.Time
+	moving     bool
+}
+
+var capitalShips = make(map[string]*CapitalShip, 8)
+
+func (c *CapitalShip) System() *System {
+	for _, conn := range c.crew {
+		if !conn.InTransit() {
+			return conn.System()
+		}
+	}
+	return nil
+}
+
+func (c *CapitalShip) Role(conn *Connection) string {
+	for role, member := range c.crew {
+		if member == conn {
+			return role
+		}
+	}
+	return ""
+}
+
+func (c *CapitalShip) Notify(template string, args ...interface{}) {
+	for _, conn := range c.crew {
+		fmt.Fprintf(conn, "[%s] %s\n", c.name, fmt.Sprintf(template, args...))
+	}
+}
+
+func (c *CapitalShip) Remove(conn *Connection) {
+	role := c.Role(conn)
+	if role == "" {
+		return
+	}
+	delete(c.crew, role)
+	conn.capital = nil
+	c.Notify("%s has left the %s station", conn.PlayerName(), role)
+	if len(c.crew) == 0 {
+		delete(capitalShips, c.name)
+		log_info("capital ship %s has been abandoned", c.name)
+	}
+}
+
+func (c *CapitalShip) Damage(n int, attacker *Connection, weapon string) {
+	c.hull -= n
+	if c.hull > 0 {
+		c.Notify("the hull takes %d damage.  hull: %d", n, c.hull)
+		return
+	}
+	c.Notify("the hull has been breached.  abandon ship!")
+	for _, conn := range c.crew {
+		c.Remove(conn)
+		conn.Die()
+		if attacker != nil && attacker != conn {
+			attacker.MadeKill(conn, weapon)
+		}
+	}
+}
+
+var capitalCommand = &Command{
+	name: "capital",
+	help: "manages capital ships.  subcommands: commission [name], invite [player], join [name] [role], leave, info",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			args = []string{"info"}
+		}
+		switch args[0] {
+		case "commission":
+			name := strings.Join(args[1:], " ")
+			if !ValidName(name) {
+				fmt.Fprintf(conn, "that ship name is illegal.\n")
+				return
+			}
+			if conn.capital != nil {
+				fmt.Fprintf(conn, "you're already serving aboard the %s\n", conn.capital.name)
+				return
+			}
+			if _, ok := capitalShips[name]; ok {
+				fmt.Fprintf(conn, "there's already a capital ship called %s\n", name)
+				return
+			}
+			if !conn.System().station {
+				fmt.Fprintf(conn, "capital ships can only be commissioned at a station.\n")
+				return
+			}
+			if conn.money < 10000 {
+				fmt.Fprintf(conn, "not enough money!  capital ships cost 10000 space duckets.\n")
+				return
+			}
+			conn.Withdraw(10000)
+			ship := &CapitalShip{
+				name:    name,
+				crew:    map[string]*Connection{R_Helm: conn},
+				invites: make(map[*Connection]bool, 4),
+				hull:    400,
+				bombs:   5,
+			}
+			capitalShips[name] = ship
+			conn.capital = ship
+			fmt.Fprintf(conn, "commissioned the capital ship %s.  you're at the helm.  it needs at least one more crew member to operate.\n", name)
+			publishNews("the capital ship %s has been commissioned in %s", name, conn.System().name)
+		case "invite":
+			ship := conn.capital
+			if ship == nil || ship.Role(conn) != R_Helm {
+				fmt.Fprintf(conn, "only the helm can invite crew.\n")
+				return
+			}
+			if len(args) != 2 {
+				fmt.Fprintf(conn, "usage: capital invite [player-name]\n")
+				return
+			}
+			other := conn.System().FindPlayer(args[1])
+			if other == nil {
+				fmt.Fprintf(conn, "there's nobody named %s here\n", args[1])
+				return
+			}
+			ship.invites[other] = true
+			fmt.Fprintf(other, "you've been invited to crew the %s.  use \"capital join %s [role]\" to board.\n", ship.name, ship.name)
+			fmt.Fprintf(conn, "invited %s aboard\n", other.PlayerName())
+		case "join":
+			if len(args) != 3 {
+				fmt.Fprintf(conn, "usage: capital join [ship-name] [role]\n")
+				return
+			}
+			ship, ok := capitalShips[args[1]]
+			if !ok || !ship.invites[conn] {
+				fmt.Fprintf(conn, "you haven't been invited aboard %s\n", args[1])
+				return
+			}
+			if ship.System() != conn.System() {
+				fmt.Fprintf(conn, "the %s isn't in this system\n", ship.name)
+				return
+			}
+			role := args[2]
+			if !isCapitalRole(role) {
+				fmt.Fprintf(conn, "no such role: %s.  roles are %s\n", role, strings.Join(capitalRoles, ", "))
+				return
+			}
+			if _, taken := ship.crew[role]; taken {
+				fmt.Fprintf(conn, "the %s station is already crewed\n", role)
+				return
+			}
+			delete(ship.invites, conn)
+			ship.crew[role] = conn
+			conn.capital = ship
+			ship.Notify("%s has taken the %s station", conn.PlayerName(), role)
+		case "leave":
+			if conn.capital == nil {
+				fmt.Fprintf(conn, "you're not aboard a capital ship.\n")
+				return
+			}
+			if conn.capital.moving {
+				fmt.Fprintf(conn, "you can't leave the ship while it's underway.\n")
+				return
+			}
+			conn.capital.Remove(conn)
+			fmt.Fprintf(conn, "you've left the ship.\n")
+		case "info":
+			ship := conn.capital
+			if ship == nil {
+				fmt.Fprintf(conn, "you're not aboard a capital ship.\n")
+				return
+			}
+			fmt.Fprintf(conn, "capital ship: %s\n", ship.name)
+			fmt.Fprintf(conn, "hull: %d\n", ship.hull)
+			fmt.Fprintf(conn, "bombs: %d\n", ship.bombs)
+			roles := make([]string, 0, len(ship.crew))
+			for role, _ := range ship.crew {
+				roles = append(roles, role)
+			}
+			sort.Strings(roles)
+			for _, role := range roles {
+				fmt.Fprintf(conn, "\t%-12s %s\n", role, ship.crew[role].PlayerName())
+			}
+		default:
+			fmt.Fprintf(conn, "no such capital subcommand: %s\n", args[0])
+		}
+	},
+}
+
+func isCapitalRole(role string) bool {
+	for _, r := range capitalRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func crewStation(conn *Connection, role string) (*CapitalShip, bool) {
+	ship := conn.capital
+	if ship == nil || ship.Role(conn) != role {
+		fmt.Fprintf(conn, "you're not manning the %s station of a capital ship.\n", role)
+		return nil, false
+	}
+	if len(ship.crew) < 2 {
+		fmt.Fprintf(conn, "the %s needs at least two crew members to operate.\n", ship.name)
+		return nil, false
+	}
+	return ship, true
+}
+
+var helmCommand = &Command{
+	name: "helm",
+	help: "flies a capital ship.  usage: helm [system]",
+	handler: func(conn *Connection, args ...string) {
+		ship, ok := crewStation(conn, R_Helm)
+		if !ok {
+			return
+		}
+		to := lookupSystem(strings.Join(args, " "))
+		if to == nil {
+			fmt.Fprintf(conn, "hmm, I don't know that system, try something else\n")
+			return
+		}
+		start := ship.System()
+		delay := start.TravelTimeTo(to) * 3 / 2
+		ship.moving = true
+		for _, member := range ship.crew {
+			start.Leave(member)
+		}
+		ship.Notify("setting course for %s. ETA: %v", to.name, delay)
+		After(delay, func() {
+			ship.moving = false
+			for _, member := range ship.crew {
+				to.Arrive(member)
+			}
+			ship.Notify("arrived at %s", to.name)
+		})
+	},
+}
+
+var weaponsCommand = &Command{
+	name: "weapons",
+	help: "fires a capital ship's bombs.  usage: weapons [system]",
+	handler: func(conn *Connection, args ...string) {
+		ship, ok := crewStation(conn, R_Weapons)
+		if !ok {
+			return
+		}
+		to := lookupSystem(strings.Join(args, " "))
+		if to == nil {
+			fmt.Fprintf(conn, "hmm, I don't know that system, try something else\n")
+			return
+		}
+		if reason := TreatyForbids(conn, to); reason != "" {
+			fmt.Fprintf(conn, "bombing %s would violate a peace treaty: %s\n", to.name, reason)
+			return
+		}
+		if ship.bombs < 1 {
+			fmt.Fprintf(conn, "the magazine is empty.\n")
+			return
+		}
+		ship.bombs -= 1
+		delay := conn.System().BombTimeTo(to)
+		ship.Notify("bomb away to %s. ETA: %v", to.name, delay)
+		After(delay, func() {
+			to.Bombed(conn, baseYield)
+		})
+	},
+}
+
+var sensorsCommand = &Command{
+	name: "sensors",
+	help: "runs a capital ship's long-range sensors",
+	handler: func(conn *Connection, args ...string) {
+		ship, ok := crewStation(conn, R_Sensors)
+		if !ok {
+			return
+		}
+		if clock.Now().Sub(ship.lastScan) < 20*time.Second {
+			fmt.Fprintf(conn, "sensor array is still cycling.\n")
+			return
+		}
+		ship.lastScan = clock.Now()
+		ship.Notify("sensors sweeping known systems")
+		sendScan(conn.System(), closeScan)
+	},
+}
+
+var engineeringCommand = &Command{
+	name: "engineering",
+	help: "patches up a capital ship's hull",
+	handler: func(conn *Connection, args ...string) {
+		ship, ok := crewStation(conn, R_Engineering)
+		if !ok {
+			return
+		}
+		if clock.Now().Sub(ship.lastRepair) < 30*time.Second {
+			fmt.Fprintf(conn, "repair crews are still busy.\n")
+			return
+		}
+		ship.lastRepair = clock.Now()
+		ship.hull += 50
+		if ship.hull > 400 {
+			ship.hull = 400
+		}
+		ship.Notify("engineering patched the hull.  hull: %d", ship.hull)
+	},
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// cargo is kept per character, so whatever's in the hold is still there
+// when they log back in.
+func cargoTable() {
+	stmnt := `create table if not exists cargo (
+        character integer not null,
+        good text not null,
+        quantity integer not null,
+        primary key (character, good)
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create cargo table: %v", err)
+	}
+}
+
+func (c *Connection) SaveCargo() error {
+	ch := c.character
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to save cargo for %s: %v", ch.name, err)
+	}
+	if _, err := tx.Exec(`delete from cargo where character = ?`, ch.id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to save cargo for %s: %v", ch.name, err)
+	}
+	for name, n := range c.cargo {
+		if _, err := tx.Exec(`insert into cargo (character, good, quantity) values (?, ?, ?)`, ch.id, name, n); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to save cargo for %s: %v", ch.name, err)
+		}
+	}
+	if _, err := tx.Exec(`delete from armory where character = ?`, ch.id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to save armory for %s: %v", ch.name, err)
+	}
+	for name, n := range c.armory {
+		if n <= 0 {
+			continue
+		}
+		if _, err := tx.Exec(`insert into armory (character, class, quantity) values (?, ?, ?)`, ch.id, name, n); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to save armory for %s: %v", ch.name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to save cargo for %s: %v", ch.name, err)
+	}
+	return nil
+}
+
+func (c *Connection) LoadCargo() error {
+	rows, err := db.Query(`select good, quantity from cargo where character = ?`, c.character.id)
+	if err != nil {
+		return fmt.Errorf("unable to load cargo for %s: %v", c.character.name, err)
+	}
+	defer rows.Close()
+	c.cargo = nil
+	for rows.Next() {
+		var name string
+		var n int
+		if err := rows.Scan(&name, &n); err != nil {
+			return fmt.Errorf("unable to scan cargo row: %v", err)
+		}
+		if g, ok := goods[name]; ok {
+			c.AddCargo(g, n)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return c.loadArmory()
+}
+
+func (c *Connection) loadArmory() error {
+	rows, err := db.Query(`select class, quantity from armory where character = ?`, c.character.id)
+	if err != nil {
+		return fmt.Errorf("unable to load armory for %s: %v", c.character.name, err)
+	}
+	defer rows.Close()
+	c.armory = nil
+	for rows.Next() {
+		var name string
+		var n int
+		if err := rows.Scan(&name, &n); err != nil {
+			return fmt.Errorf("unable to scan armory row: %v", err)
+		}
+		if b, ok := bombClasses[name]; ok && b != fission {
+			c.AddBombs(b, n)
+		}
+	}
+	return rows.Err()
+}
+
+// CargoLoad is how much is in the ship's hold.  Every unit of every good
+// takes up the same room.
+func (c *Connection) CargoLoad() int {
+	load := 0
+	for _, n := range c.cargo {
+		load += n
+	}
+	return load
+}
+
+func (c *Connection) CargoSpace() int {
+	space := c.design.hold - c.CargoLoad()
+	if space < 0 {
+		return 0
+	}
+	return space
+}
+
+// Stow puts as much of a good in the hold as will fit, returning how much
+// made it in.
+func (c *Connection) Stow(g *Good, n int) int {
+	if space := c.CargoSpace(); n > space {
+		n = space
+	}
+	if n > 0 {
+		c.AddCargo(g, n)
+	}
+	return n
+}
+
+// a full hold slows a ship down by up to a quarter.
+func (c *Connection) CargoDrag() float64 {
+	if c.design.hold == 0 {
+		return 1
+	}
+	return 1 + 0.25*float64(c.CargoLoad())/float64(c.design.hold)
+}
+
+func parseResourceAmount(conn *Connection, verb string, args []string) (string, int, bool) {
+	if len(args) != 2 {
+		fmt.Fprintf(conn, "usage: %s [ore|gas|crystal] [quantity]\n", verb)
+		return "", 0, false
+	}
+	if _, ok := goods[args[0]]; !ok || !isResource(args[0]) {
+		fmt.Fprintf(conn, "colonies only store ore, gas and crystal\n")
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 {
+		fmt.Fprintf(conn, "that's not a quantity: %s\n", args[1])
+		return "", 0, false
+	}
+	if conn.System().Colonizer() != conn {
+		fmt.Fprintf(conn, "you don't have a colony on %s\n", conn.System().name)
+		return "", 0, false
+	}
+	return args[0], n, true
+}
+
+var loadCommand = &Command{
+	name: "load",
+	help: "loads resources from your colony's silos into your hold.  usage: load [ore|gas|crystal] [quantity]",
+	handler: func(conn *Connection, args ...string) {
+		name, n, ok := parseResourceAmount(conn, "load", args)
+		if !ok {
+			return
+		}
+		system := conn.System()
+		system.Accrue()
+		if have := int(system.accrued[name]); n > have {
+			n = have
+		}
+		n = conn.Stow(goods[name], n)
+		if n == 0 {
+			fmt.Fprintf(conn, "nothing loaded.  silo: %d %s, free space in hold: %d\n", int(system.accrued[name]), name, conn.CargoSpace())
+			return
+		}
+		system.accrued[name] -= float64(n)
+		system.SaveColony()
+		fmt.Fprintf(conn, "loaded %d %s.  hold: %d/%d\n", n, name, conn.CargoLoad(), conn.design.hold)
+	},
+}
+
+var unloadCommand = &Command{
+	name: "unload",
+	help: "unloads resources from your hold into your colony's silos.  usage: unload [ore|gas|crystal] [quantity]",
+	handler: func(conn *Connection, args ...string) {
+		name, n, ok := parseResourceAmount(conn, "unload", args)
+		if !ok {
+			return
+		}
+		system := conn.System()
+		system.Accrue()
+		if n > conn.cargo[name] {
+			n = conn.cargo[name]
+		}
+		if room := int(colonySiloSize - system.accrued[name]); n > room {
+			n = room
+		}
+		if n <= 0 {
+			fmt.Fprintf(conn, "nothing unloaded.  the %s silo on %s is full or your hold has none\n", name, system.name)
+			return
+		}
+		conn.AddCargo(goods[name], -n)
+		system.accrued[name] += float64(n)
+		system.SaveColony()
+		fmt.Fprintf(conn, "unloaded %d %s.  hold: %d/%d\n", n, name, conn.CargoLoad(), conn.design.hold)
+	},
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+var launchCommand = &Command{
+	name: "launch",
+	help: "launches fighters from your hangar.  usage: launch [count] [defend|harass player-name]",
+	handler: func(conn *Connection, args ...string) {
+		if conn.hangar == 0 {
+			fmt.Fprintf(conn, "your ship doesn't have a hangar.\n")
+			return
+		}
+		if len(args) < 2 {
+			fmt.Fprintf(conn, "usage: launch [count] [defend|harass player-name]\n")
+			return
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			fmt.Fprintf(conn, "that's not a count: %s\n", args[0])
+			return
+		}
+		if n > conn.fighters {
+			fmt.Fprintf(conn, "you only have %d fighters in the hangar\n", conn.fighters)
+			return
+		}
+		switch args[1] {
+		case "defend":
+			conn.fighters -= n
+			conn.defenders += n
+			fmt.Fprintf(conn, "launched %d fighters on defensive patrol.\n", n)
+		case "harass":
+			if len(args) != 3 {
+				fmt.Fprintf(conn, "usage: launch [count] harass [player-name]\n")
+				return
+			}
+			target := conn.System().FindPlayer(args[2])
+			if target == nil || target == conn {
+				fmt.Fprintf(conn, "there's no ship named %s here\n", args[2])
+				return
+			}
+			if target.docked {
+				fmt.Fprintf(conn, "%s is docked and out of reach\n", target.PlayerName())
+				return
+			}
+			if TreatyForbids(conn, conn.System()) != "" || AtPeace(conn, target) {
+				fmt.Fprintf(conn, "harassing %s would violate a peace treaty\n", target.PlayerName())
+				return
+			}
+			conn.fighters -= n
+			start := conn.harassers == 0
+			conn.harassers += n
+			conn.harassing = target
+			fmt.Fprintf(conn, "launched %d fighters to harass %s.\n", n, target.PlayerName())
+			fmt.Fprintf(target, "enemy fighters are closing in on your ship!\n")
+			if start {
+				After(10*time.Second, conn.Harass)
+			}
+		default:
+			fmt.Fprintf(conn, "fighters can either defend or harass, not %s\n", args[1])
+		}
+	},
+}
+
+var recallCommand = &Command{
+	name: "recall",
+	help: "recalls all of your launched fighters to the hangar",
+	handler: func(conn *Connection, args ...string) {
+		n := conn.defenders + conn.harassers
+		conn.fighters += n
+		conn.defenders = 0
+		conn.harassers = 0
+		conn.harassing = nil
+		fmt.Fprintf(conn, "recalled %d fighters.  hangar: %d/%d\n", n, conn.fighters, conn.hangar)
+	},
+}
+
+var hangarCommand = &Command{
+	name:   "hangar",
+	help:   "shows your hangar.  use \"hangar restock\" at a station to buy fighters for 150 space duckets each",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if conn.hangar == 0 {
+			fmt.Fprintf(conn, "your ship doesn't have a hangar.\n")
+			return
+		}
+		if len(args) > 0 && args[0] == "restock" {
+			if conn.InTransit() || !conn.System().station {
+				fmt.Fprintf(conn, "you can only restock fighters at a station.\n")
+				return
+			}
+			missing := conn.hangar - conn.fighters - conn.defenders - conn.harassers
+			if missing <= 0 {
+				fmt.Fprintf(conn, "your hangar is full.\n")
+				return
+			}
+			cost := int64(150 * missing)
+			if conn.money < cost {
+				fmt.Fprintf(conn, "not enough money!  restocking costs %d space duckets, you only have %d in the bank.\n", cost, conn.money)
+				return
+			}
+			conn.Withdraw(cost)
+			conn.fighters += missing
+			fmt.Fprintf(conn, "restocked %d fighters for %d space duckets.\n", missing, cost)
+		}
+		fmt.Fprintf(conn, "hangar capacity: %d\n", conn.hangar)
+		fmt.Fprintf(conn, "docked fighters: %d\n", conn.fighters)
+		fmt.Fprintf(conn, "defending: %d\n", conn.defenders)
+		fmt.Fprintf(conn, "harassing: %d\n", conn.harassers)
+	},
+}
+
+func (c *Connection) LoseFighters() {
+	lost := c.defenders + c.harassers
+	if lost == 0 {
+		return
+	}
+	c.defenders = 0
+	c.harassers = 0
+	c.harassing = nil
+	fmt.Fprintf(c, "%d launched fighters couldn't keep up and were lost.\n", lost)
+}
+
+func (c *Connection) FightersIntercept() bool {
+	out := ResolveFighters(c.defenders, dice)
+	if !out.ByFighters {
+		return false
+	}
+	c.defenders -= 1
+	fmt.Fprintf(c, "one of your fighters rams an incoming bomb, saving your ship!\n")
+	return true
+}
+
+func (c *Connection) Harass() {
+	target := c.harassing
+	if c.harassers == 0 || target == nil {
+		return
+	}
+	if c.dead || target.dead || target.docked || c.InTransit() || target.System() != c.System() {
+		fmt.Fprintf(c, "your fighters have lost their target and return to defensive patrol.\n")
+		c.defenders += c.harassers
+		c.harassers = 0
+		c.harassing = nil
+		return
+	}
+	for i := 0; i < target.defenders && c.harassers > 0; i++ {
+		if rand.Float64() < 0.3 {
+			c.harassers -= 1
+			fmt.Fprintf(c, "one of your fighters was shot down by %s's defenders.\n", target.PlayerName())
+		}
+	}
+	if c.harassers > 0 {
+		fmt.Fprintf(target, "fighters from %s strafe your ship!\n", c.ShipLabel())
+		target.Damage(5*c.harassers, c, W_Fighters)
+	}
+	After(10*time.Second, c.Harass)
+}
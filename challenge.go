@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	CH_Mine = "mine"
+	CH_Scan = "scan"
+	CH_Duel = "duel"
+	CH_Kill = "kill"
+)
+
+// ChallengeKind is one of the things a challenge can ask for.  Daily and
+// weekly challenges draw from the same pool; weekly goals are bigger and pay
+// more.
+type ChallengeKind struct {
+	kind   string
+	desc   string
+	daily  int
+	weekly int
+	reward int64
+}
+
+var challengePool = []ChallengeKind{
+	{CH_Mine, "mine %d loads of ore", 100, 500, 500},
+	{CH_Scan, "scan %d new systems", 10, 50, 400},
+	{CH_Duel, "win %d duels", 1, 5, 600},
+	{CH_Kill, "destroy %d ships", 2, 10, 800},
+}
+
+// Challenge is the challenge that's live for some period.  Periods are named
+// so that progress can be stored against them and forgotten once they roll
+// over.
+type Challenge struct {
+	ChallengeKind
+	period  string
+	goal    int
+	payout  int64
+	expires time.Time
+}
+
+func (c *Challenge) String() string {
+	return fmt.Sprintf(c.desc, c.goal)
+}
+
+func dailyChallenge(now time.Time) *Challenge {
+	day := now.UTC().Truncate(24 * time.Hour)
+	k := challengePool[int(day.Unix()/86400)%len(challengePool)]
+	return &Challenge{
+		ChallengeKind: k,
+		period:        "daily-" + day.Format("2006-01-02"),
+		goal:          k.daily,
+		payout:        k.reward,
+		expires:       day.Add(24 * time.Hour),
+	}
+}
+
+func weeklyChallenge(now time.Time) *Challenge {
+	year, week := now.UTC().ISOWeek()
+	// offset by one so the weekly challenge doesn't start out matching the
+	// daily one.
+	k := challengePool[(year*53+week+1)%len(challengePool)]
+	day := now.UTC().Truncate(24 * time.Hour)
+	for day.Weekday() != time.Monday {
+		day = day.Add(-24 * time.Hour)
+	}
+	return &Challenge{
+		ChallengeKind: k,
+		period:        fmt.Sprintf("weekly-%d-%02d", year, week),
+		goal:          k.weekly,
+		payout:        k.reward * 5,
+		expires:       day.Add(7 * 24 * time.Hour),
+	}
+}
+
+func currentChallenges() []*Challenge {
+	now := time.Now()
+	return []*Challenge{dailyChallenge(now), weeklyChallenge(now)}
+}
+
+func challengesTable() {
+	stmnt := `create table if not exists challenges (
+        account integer not null,
+        period text not null,
+        progress integer not null default 0,
+        done integer not null default 0,
+        unique (account, period)
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create challenges table: %v", err)
+	}
+}
+
+func (p *Player) ChallengeProgress(period string) (progress int, done bool, err error) {
+	row := db.QueryRow(`select progress, done from challenges where account = ? and period = ?`, p.id, period)
+	switch err = row.Scan(&progress, &done); err {
+	case nil:
+		return progress, done, nil
+	case sql.ErrNoRows:
+		return 0, false, nil
+	default:
+		return 0, false, fmt.Errorf("unable to read %s challenge for %s: %v", period, p.name, err)
+	}
+}
+
+func (p *Player) SetChallengeProgress(period string, progress int, done bool) error {
+	_, err := db.Exec(`
+        insert or replace into challenges
+        (account, period, progress, done)
+        values
+        (?, ?, ?, ?)
+    ;`, p.id, period, progress, done)
+	if err != nil {
+		return fmt.Errorf("unable to save %s challenge for %s: %v", period, p.name, err)
+	}
+	return nil
+}
+
+// Progress advances any live challenges of the given kind.  Challenges are
+// tracked against the account, but the reward goes to whichever character
+// finishes it.
+func (c *Connection) Progress(kind string, n int) {
+	if c.player == nil || c.player.id == 0 {
+		return
+	}
+	for _, ch := range currentChallenges() {
+		if ch.kind != kind {
+			continue
+		}
+		progress, done, err := c.player.ChallengeProgress(ch.period)
+		if err != nil {
+			log_error("%v", err)
+			continue
+		}
+		if done {
+			continue
+		}
+		progress += n
+		done = progress >= ch.goal
+		if err := c.player.SetChallengeProgress(ch.period, progress, done); err != nil {
+			log_error("%v", err)
+			continue
+		}
+		if done {
+			fmt.Fprintf(c, "challenge complete: %s!  you've earned %d space duckets.\n", ch, ch.payout)
+			c.Deposit(ch.payout)
+		}
+	}
+}
+
+// ScannedSystem counts a scan reply toward the scanning challenge, but only
+// the first time a given system turns up in the current period.
+func (c *Connection) ScannedSystem(s *System) {
+	period := dailyChallenge(time.Now()).period
+	if c.scannedPeriod != period {
+		c.scannedPeriod = period
+		c.scanned = make(map[int]bool, 16)
+	}
+	if c.scanned[s.id] {
+		return
+	}
+	c.scanned[s.id] = true
+	c.Progress(CH_Scan, 1)
+}
+
+var challengesCommand = &Command{
+	name:   "challenges",
+	help:   "lists the current daily and weekly challenges and your progress on them",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		for _, ch := range currentChallenges() {
+			progress, done, err := conn.player.ChallengeProgress(ch.period)
+			if err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "the challenge board is offline.  try again later.\n")
+				return
+			}
+			status := fmt.Sprintf("%d/%d", progress, ch.goal)
+			if done {
+				status = "complete"
+			}
+			left := time.Until(ch.expires).Truncate(time.Minute)
+			fmt.Fprintf(conn, "%-20s %-24s %-10s %6d duckets   (%v left)\n", ch.period, ch, status, ch.payout, left)
+		}
+	},
+}
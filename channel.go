@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Channels are out-of-character chat rooms.  Unlike broadcasts and tells,
+// which travel at the speed of light, channel chat reaches everyone in it
+// at once, wherever they are.  Everyone starts out in the public channel
+// and can join or leave any other.  Some channels are relayed to friendly
+// servers as well; see relay.go.
+const defaultChannel = "public"
+
+var channels = struct {
+	sync.Mutex
+	members map[string]map[*Connection]bool
+}{
+	members: make(map[string]map[*Connection]bool, 8),
+}
+
+func (c *Connection) JoinChannel(name string) {
+	channels.Lock()
+	defer channels.Unlock()
+	if channels.members[name] == nil {
+		channels.members[name] = make(map[*Connection]bool, 8)
+	}
+	channels.members[name][c] = true
+}
+
+func (c *Connection) LeaveChannel(name string) {
+	channels.Lock()
+	defer channels.Unlock()
+	delete(channels.members[name], c)
+	if len(channels.members[name]) == 0 {
+		delete(channels.members, name)
+	}
+}
+
+// LeaveChannels takes a player out of every channel, when they disconnect.
+func (c *Connection) LeaveChannels() {
+	for _, name := range c.Channels() {
+		c.LeaveChannel(name)
+	}
+}
+
+func (c *Connection) InChannel(name string) bool {
+	channels.Lock()
+	defer channels.Unlock()
+	return channels.members[name][c]
+}
+
+// Channels lists the channels a player is in.
+func (c *Connection) Channels() []string {
+	channels.Lock()
+	defer channels.Unlock()
+	names := make([]string, 0, 4)
+	for name, members := range channels.members {
+		if members[c] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// channelMembers is a snapshot of who's in a channel, so nothing is written
+// to players with the lock held.
+func channelMembers(name string) []*Connection {
+	channels.Lock()
+	defer channels.Unlock()
+	members := make([]*Connection, 0, len(channels.members[name]))
+	for conn, _ := range channels.members[name] {
+		members = append(members, conn)
+	}
+	return members
+}
+
+// deliverChannel shows a line of chat to everyone in the channel.  from is
+// already tagged with the server it came from if it came from elsewhere.
+func deliverChannel(name, from, text string) {
+	for _, conn := range channelMembers(name) {
+		fmt.Fprintf(conn, "[%s] %s: %s\n", name, from, text)
+	}
+}
+
+var channelCommand = &Command{
+	name: "channel",
+	help: "chat channels, which reach everyone in them instantly.  usage:\n" +
+		"\tchannel   (lists the channels you're in)\n" +
+		"\tchannel join [name]\n" +
+		"\tchannel leave [name]\n" +
+		"\tchannel [name] [message]",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			names := conn.Channels()
+			if len(names) == 0 {
+				fmt.Fprintf(conn, "you're not in any channels.\n")
+				return
+			}
+			for _, name := range names {
+				if relayed(name) {
+					fmt.Fprintf(conn, "\t%-20s relayed to %s\n", name, strings.Join(relayPeers(), ", "))
+				} else {
+					fmt.Fprintf(conn, "\t%s\n", name)
+				}
+			}
+			return
+		}
+		switch args[0] {
+		case "join", "leave":
+			if len(args) != 2 {
+				fmt.Fprintf(conn, "usage: channel %s [name]\n", args[0])
+				return
+			}
+			name := strings.ToLower(args[1])
+			if !ValidName(name) {
+				fmt.Fprintf(conn, "that's not a good name for a channel.\n")
+				return
+			}
+			if args[0] == "join" {
+				conn.JoinChannel(name)
+				fmt.Fprintf(conn, "joined %s.\n", name)
+			} else {
+				conn.LeaveChannel(name)
+				fmt.Fprintf(conn, "left %s.\n", name)
+			}
+		default:
+			if len(args) < 2 {
+				fmt.Fprintf(conn, "usage: channel [name] [message]\n")
+				return
+			}
+			name := strings.ToLower(args[0])
+			if !conn.InChannel(name) {
+				fmt.Fprintf(conn, "you're not in %s.  use \"channel join %s\" first.\n", name, name)
+				return
+			}
+			text := strings.Join(args[1:], " ")
+			recordChat(conn.PlayerName(), "#"+name, text)
+			if conn.ShadowMuted() {
+				fmt.Fprintf(conn, "[%s] %s: %s\n", name, conn.PlayerName(), text)
+				return
+			}
+			deliverChannel(name, conn.PlayerName(), text)
+			relayChat(name, conn.PlayerName(), text)
+		}
+	},
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const maxCharacters = 3
+
+// Character is a player's presence in the galaxy.  An account can have a few
+// of them; they share the account's login and security settings but nothing
+// else.
+type Character struct {
+	id      int
+	account int
+	name    string
+	home    int
+	homeSet time.Time
+
+	system     int
+	kills      int
+	money      int64
+	reputation int
+
+	hardcore      bool
+	hardcoreSince time.Time
+	dead          bool
+
+	title string
+	decal string
+
+	tamed     string
+	tamedKind string
+
+	// the region the character lives in, if it's moved to another server
+	region      string
+	transferred time.Time
+}
+
+func charactersTable() {
+	stmnt := `create table if not exists characters (
+        id integer not null primary key autoincrement,
+        account integer not null,
+        name text unique,
+        home integer not null default 0,
+        home_set integer not null default 0,
+        system integer not null default 0,
+        kills integer not null default 0,
+        money integer not null default 0
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create characters table: %v", err)
+	}
+	addColumn("characters", "hardcore", "integer not null default 0")
+	addColumn("characters", "hardcore_since", "integer not null default 0")
+	addColumn("characters", "dead", "integer not null default 0")
+	addColumn("characters", "tamed", "text not null default ''")
+	addColumn("characters", "tamed_kind", "text not null default ''")
+	addColumn("characters", "reputation", "integer not null default 0")
+}
+
+func (p *Player) Characters() ([]*Character, error) {
+	rows, err := db.Query(`
+        select id, account, name, home, home_set, system, kills, money, hardcore, hardcore_since, dead, title, decal, tamed, tamed_kind, region, transferred, reputation
+        from characters
+        where account = ?
+        order by id
+    ;`, p.id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read characters for %s: %v", p.name, err)
+	}
+	defer rows.Close()
+	chars := make([]*Character, 0, maxCharacters)
+	for rows.Next() {
+		var ch Character
+		var homeSet, hardcoreSince, transferred int64
+		if err := rows.Scan(&ch.id, &ch.account, &ch.name, &ch.home, &homeSet, &ch.system, &ch.kills, &ch.money, &ch.hardcore, &hardcoreSince, &ch.dead, &ch.title, &ch.decal, &ch.tamed, &ch.tamedKind, &ch.region, &transferred, &ch.reputation); err != nil {
+			return nil, fmt.Errorf("unable to scan character row: %v", err)
+		}
+		if homeSet > 0 {
+			ch.homeSet = time.Unix(homeSet, 0)
+		}
+		if hardcoreSince > 0 {
+			ch.hardcoreSince = time.Unix(hardcoreSince, 0)
+		}
+		if transferred > 0 {
+			ch.transferred = time.Unix(transferred, 0)
+		}
+		chars = append(chars, &ch)
+	}
+	return chars, rows.Err()
+}
+
+func characterExists(name string) bool {
+	row := db.QueryRow(`select count(*) from characters where name = ?`, name)
+	var n int
+	if err := row.Scan(&n); err != nil {
+		log_error("unable to look up character %s: %v", name, err)
+		return true
+	}
+	return n > 0
+}
+
+func (p *Player) NewCharacter(name string) (*Character, error) {
+	row := db.QueryRow(`select count(*) from players where name = ? and id != ?`, name, p.id)
+	var n int
+	if err := row.Scan(&n); err != nil {
+		return nil, fmt.Errorf("unable to check character name %s: %v", name, err)
+	}
+	if n > 0 {
+		return nil, fmt.Errorf("the name %s is taken", name)
+	}
+	res, err := db.Exec(`insert into characters (account, name) values (?, ?)`, p.id, name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create character %s: %v", name, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read id of new character: %v", err)
+	}
+	return &Character{id: int(id), account: p.id, name: name}, nil
+}
+
+// migrateCharacter turns the state stored on an account from before
+// characters existed into its first character.
+func (p *Player) migrateCharacter() error {
+	_, err := db.Exec(`
+        insert into characters
+        (account, name, home, home_set, system, kills, money)
+        select id, name, home, home_set, system, kills, money
+        from players
+        where id = ?
+    ;`, p.id)
+	if err != nil {
+		return fmt.Errorf("unable to migrate character for %s: %v", p.name, err)
+	}
+	return nil
+}
+
+// ChooseCharacter picks which of the account's characters to play, asking
+// if there's more than one.
+func (c *Connection) ChooseCharacter() bool {
+	chars, err := c.player.Characters()
+	if err == nil && len(chars) == 0 {
+		if err = c.player.migrateCharacter(); err == nil {
+			chars, err = c.player.Characters()
+		}
+	}
+	if err != nil || len(chars) == 0 {
+		log_error("no characters for %s: %v", c.player.name, err)
+		return false
+	}
+	alive := chars[:0]
+	away := 0
+	for _, ch := range chars {
+		switch {
+		case ch.region != "":
+			fmt.Fprintf(c, "%s lives in %s now.\n", ch.name, ch.region)
+			away++
+		case !ch.dead:
+			alive = append(alive, ch)
+		}
+	}
+	chars = alive
+	if len(chars) == 0 && away > 0 {
+		fmt.Fprintf(c, "connect to that server to play, or use \"characters new\" there to start afresh.\n")
+		return false
+	}
+	for len(chars) == 0 {
+		fmt.Fprintf(c, "all of your characters have perished.  name a new one:\n")
+		name, err := c.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		name = strings.TrimSpace(name)
+		if !ValidName(name) || characterExists(name) {
+			fmt.Fprintf(c, "you can't use that name.\n")
+			continue
+		}
+		ch, err := c.player.NewCharacter(name)
+		if err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(c, "you can't use that name.\n")
+			continue
+		}
+		chars = append(chars, ch)
+	}
+	if len(chars) == 1 {
+		c.character = chars[0]
+		return true
+	}
+	names := make([]string, 0, len(chars))
+	for _, ch := range chars {
+		names = append(names, ch.name)
+	}
+	for {
+		fmt.Fprintf(c, "choose a character: %s\n", strings.Join(names, ", "))
+		name, err := c.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		name = strings.TrimSpace(name)
+		for _, ch := range chars {
+			if ch.name == name {
+				c.character = ch
+				return true
+			}
+		}
+		fmt.Fprintf(c, "you don't have a character named %s\n", name)
+	}
+}
+
+var charactersCommand = &Command{
+	name:   "characters",
+	help:   "lists the characters on your account.  use \"characters new [name]\" to create another, then log in again to play it",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		chars, err := conn.player.Characters()
+		if err != nil {
+			log_error("%v", err)
+			return
+		}
+		if len(args) == 0 {
+			for _, ch := range chars {
+				marker := " "
+				if ch.id == conn.character.id {
+					marker = "*"
+				}
+				fmt.Fprintf(conn, "%s %s\n", marker, ch.name)
+			}
+			return
+		}
+		if args[0] != "new" || len(args) != 2 {
+			fmt.Fprintf(conn, "usage: characters new [name]\n")
+			return
+		}
+		if len(chars) >= maxCharacters {
+			fmt.Fprintf(conn, "your account already has %d characters.\n", maxCharacters)
+			return
+		}
+		if !ValidName(args[1]) {
+			fmt.Fprintf(conn, "that name is illegal.\n")
+			return
+		}
+		ch, err := conn.player.NewCharacter(args[1])
+		if err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(conn, "couldn't create %s.  the name may be taken.\n", args[1])
+			return
+		}
+		fmt.Fprintf(conn, "created %s.  log in again to play as them.\n", ch.name)
+	},
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Clock is where the game gets the time.  Game time normally keeps pace with
+// the wall clock, but it can run faster for simulations (EXO_TIME_SCALE=10
+// plays ten minutes of game in one real one), stand still while an admin has
+// the server paused, or be wound forward by hand under the test harness.
+//
+// Anything to do with play (travel, cooldowns, hazards, contracts, the
+// scheduler) goes by the game clock.  Things the outside world cares about
+// (network timeouts, login codes, mail and log timestamps) stay on the wall
+// clock.
+type Clock interface {
+	Now() time.Time
+	// Wall is how long to wait in real time for d to pass in game time.  It's
+	// negative if game time isn't passing at all.
+	Wall(d time.Duration) time.Duration
+}
+
+var clock Clock = newGameClock(timeScale())
+
+// setClock swaps in a different clock for the game and the scheduler both.
+func setClock(c Clock) {
+	clock = c
+	scheduler.clock = c
+	scheduler.Wake()
+}
+
+func timeScale() float64 {
+	v := os.Getenv("EXO_TIME_SCALE")
+	if v == "" {
+		return 1
+	}
+	scale, err := strconv.ParseFloat(v, 64)
+	if err != nil || scale <= 0 {
+		fmt.Fprintf(os.Stderr, "ignoring EXO_TIME_SCALE: %q isn't a positive number\n", v)
+		return 1
+	}
+	return scale
+}
+
+// gameClock runs at some multiple of the wall clock.  Every change of pace
+// starts a new leg measured from where the last one left off, so game time
+// never jumps.
+type gameClock struct {
+	sync.Mutex
+	wall   time.Time // when this leg started, by the wall clock
+	game   time.Time // the game time then
+	rate   float64   // game seconds per real second; zero when paused
+	paused float64   // the rate to go back to when resumed
+}
+
+func newGameClock(rate float64) *gameClock {
+	now := time.Now()
+	return &gameClock{wall: now, game: now, rate: rate}
+}
+
+func (c *gameClock) now() time.Time {
+	return c.game.Add(time.Duration(float64(time.Since(c.wall)) * c.rate))
+}
+
+func (c *gameClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now()
+}
+
+func (c *gameClock) Wall(d time.Duration) time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	if c.rate == 0 {
+		return -1
+	}
+	return time.Duration(float64(d) / c.rate)
+}
+
+func (c *gameClock) setRate(rate float64) {
+	c.game = c.now()
+	c.wall = time.Now()
+	c.rate = rate
+}
+
+// Pause stops game time, reporting whether it was running.
+func (c *gameClock) Pause() bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.rate == 0 {
+		return false
+	}
+	c.paused = c.rate
+	c.setRate(0)
+	return true
+}
+
+// Resume starts game time again, reporting whether it was stopped.
+func (c *gameClock) Resume() bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.rate != 0 {
+		return false
+	}
+	c.setRate(c.paused)
+	return true
+}
+
+// SetRate changes how fast game time runs.  A paused clock stays paused and
+// picks up the new rate when it's resumed.
+func (c *gameClock) SetRate(rate float64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.rate == 0 {
+		c.paused = rate
+		return
+	}
+	c.setRate(rate)
+}
+
+// Rate reports how fast game time is running and whether it's paused.
+func (c *gameClock) Rate() (float64, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if c.rate == 0 {
+		return c.paused, true
+	}
+	return c.rate, false
+}
+
+// the range admins can set the timescale to.  Much faster than this and the
+// dispatch loop can't keep up.
+const (
+	minTimeScale = 0.05
+	maxTimeScale = 100.0
+)
+
+var pauseCommand = &Command{
+	name: "pause",
+	help: "admin only.  stops game time for the whole server: nothing travels, reloads or comes due until it's resumed.  usage:\n" +
+		"\tpause\n" +
+		"\tpause resume",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can pause the server.\n")
+			return
+		}
+		c, ok := clock.(*gameClock)
+		if !ok {
+			fmt.Fprintf(conn, "the game clock can't be paused right now.\n")
+			return
+		}
+		var msg string
+		switch {
+		case len(args) == 0:
+			if !c.Pause() {
+				fmt.Fprintf(conn, "the server is already paused.  \"pause resume\" to start it again.\n")
+				return
+			}
+			audit(conn.PlayerName(), "pause", "server", "")
+			msg = "an admin has paused the galaxy.  time stands still."
+		case args[0] == "resume":
+			if !c.Resume() {
+				fmt.Fprintf(conn, "the server isn't paused.\n")
+				return
+			}
+			audit(conn.PlayerName(), "resume", "server", "")
+			msg = "the galaxy has been unpaused.  time flows again."
+		default:
+			fmt.Fprintf(conn, "usage: pause [resume]\n")
+			return
+		}
+		scheduler.Wake()
+		log_info("%s: %s", conn.PlayerName(), msg)
+		for other, _ := range connected {
+			fmt.Fprintf(other, "%s\n", msg)
+		}
+	},
+}
+
+var timescaleCommand = &Command{
+	name: "timescale",
+	help: "admin only.  shows or changes how fast game time runs compared to real time.  below 1 is slow motion.  usage:\n" +
+		"\ttimescale\n" +
+		"\ttimescale [rate]   (e.g. 0.5, 2)",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can change the timescale.\n")
+			return
+		}
+		c, ok := clock.(*gameClock)
+		if !ok {
+			fmt.Fprintf(conn, "the game clock can't be changed right now.\n")
+			return
+		}
+		if len(args) == 0 {
+			rate, paused := c.Rate()
+			if paused {
+				fmt.Fprintf(conn, "game time is paused.  it will run at %gx when resumed.\n", rate)
+			} else {
+				fmt.Fprintf(conn, "game time is running at %gx.\n", rate)
+			}
+			return
+		}
+		rate, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || rate < minTimeScale || rate > maxTimeScale {
+			fmt.Fprintf(conn, "the timescale has to be a number from %g to %g\n", minTimeScale, maxTimeScale)
+			return
+		}
+		c.SetRate(rate)
+		scheduler.Wake()
+		audit(conn.PlayerName(), "timescale", "server", args[0])
+		log_info("%s set the timescale to %gx", conn.PlayerName(), rate)
+		for other, _ := range connected {
+			switch {
+			case rate < 1:
+				fmt.Fprintf(other, "time in the galaxy slows to %gx.\n", rate)
+			case rate > 1:
+				fmt.Fprintf(other, "time in the galaxy speeds up to %gx.\n", rate)
+			default:
+				fmt.Fprintf(other, "time in the galaxy returns to normal.\n")
+			}
+		}
+	},
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+func coloniesTable() {
+	stmnt := `create table if not exists colonies (
+        system integer not null primary key,
+        player text not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create colonies table: %v", err)
+	}
+	addColumn("colonies", "reserve", "integer not null default 0")
+	addColumn("colonies", "shields", "integer not null default 0")
+	addColumn("colonies", "turrets", "integer not null default 0")
+	addColumn("colonies", "accrued", "real not null default 0")
+	addColumn("colonies", "accrued_gas", "real not null default 0")
+	addColumn("colonies", "accrued_crystal", "real not null default 0")
+	addColumn("colonies", "accrued_at", "integer not null default 0")
+	addColumn("colonies", "egg_hatches", "integer not null default 0")
+}
+
+// colonies dig up resources whether or not anybody is around.  They pile up
+// on the planet until the colonizer comes by to collect them, up to what the
+// colony's silos can hold.
+const (
+	colonyOrePerHour = 10.0
+	colonySiloSize   = 200.0
+)
+
+// YieldRate is how much of a resource the colony digs up in an hour.
+func (s *System) YieldRate(resource string) float64 {
+	return colonyOrePerHour * s.miningRate * float64(1+s.planets) * s.Abundance(resource)
+}
+
+// Accrue brings the colony's resources up to date.
+func (s *System) Accrue() {
+	now := clock.Now()
+	if s.accrued == nil {
+		s.accrued = make(map[string]float64, len(resources))
+	}
+	if !s.accruedAt.IsZero() {
+		for _, name := range resources {
+			s.accrued[name] = math.Min(colonySiloSize, s.accrued[name]+s.YieldRate(name)*now.Sub(s.accruedAt).Hours())
+		}
+	}
+	s.accruedAt = now
+}
+
+// offlineConnection stands in for a colony owner who isn't connected.  It
+// swallows anything written to it; Restore swaps in the real connection when
+// the owner logs back in.
+func offlineConnection(name string) *Connection {
+	return &Connection{character: &Character{name: name}, design: starterDesign}
+}
+
+func (c *Connection) Offline() bool {
+	return c.rw == nil
+}
+
+func (s *System) SaveColony() {
+	owner := s.Colonizer()
+	if owner == nil {
+		return
+	}
+	s.Accrue()
+	var hatches int64
+	if !s.eggHatches.IsZero() {
+		hatches = s.eggHatches.Unix()
+	}
+	_, err := db.Exec(`
+        insert or replace into colonies
+        (system, player, reserve, shields, turrets, accrued, accrued_gas, accrued_crystal, accrued_at, egg_hatches)
+        values
+        (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    ;`, s.id, owner.PlayerName(), s.reserve, s.colonyShields, s.turrets,
+		s.accrued["ore"], s.accrued["gas"], s.accrued["crystal"], s.accruedAt.Unix(), hatches)
+	if err != nil {
+		log_error("unable to save colony on %s: %v", s.name, err)
+	}
+}
+
+func (s *System) DeleteColony() {
+	if _, err := db.Exec(`delete from colonies where system = ?`, s.id); err != nil {
+		log_error("unable to delete colony on %s: %v", s.name, err)
+	}
+}
+
+func loadColonies() {
+	rows, err := db.Query(`select system, player, reserve, shields, turrets, accrued, accrued_gas, accrued_crystal, accrued_at, egg_hatches from colonies`)
+	if err != nil {
+		log_error("unable to load colonies: %v", err)
+		return
+	}
+	defer rows.Close()
+	owners := make(map[string]*Connection, 16)
+	for rows.Next() {
+		var id, shields, turrets int
+		var name string
+		var reserve, accruedAt, eggHatches int64
+		var ore, gas, crystal float64
+		if err := rows.Scan(&id, &name, &reserve, &shields, &turrets, &ore, &gas, &crystal, &accruedAt, &eggHatches); err != nil {
+			log_error("unable to scan colony row: %v", err)
+			continue
+		}
+		s := systemById(id)
+		if s == nil {
+			continue
+		}
+		if owners[name] == nil {
+			owners[name] = offlineConnection(name)
+		}
+		s.SetColonizer(owners[name])
+		s.reserve, s.colonyShields, s.turrets = reserve, shields, turrets
+		s.accrued = map[string]float64{"ore": ore, "gas": gas, "crystal": crystal}
+		if accruedAt > 0 {
+			s.accruedAt = time.Unix(accruedAt, 0)
+		}
+		if eggHatches > 0 {
+			s.eggHatches = time.Unix(eggHatches, 0)
+		}
+		s.RunColony()
+	}
+}
+
+// RunColony starts the colony's mining loop if it isn't running already.  The
+// loop winds down by itself once the colony is destroyed.
+func (s *System) RunColony() {
+	if s.colonyRunning {
+		return
+	}
+	s.colonyRunning = true
+	var fn func()
+	fn = func() {
+		owner := s.Colonizer()
+		if owner == nil {
+			s.colonyRunning = false
+			return
+		}
+		if !s.eggHatches.IsZero() && !clock.Now().Before(s.eggHatches) {
+			s.Hatch(owner)
+		}
+		reward := int64(rand.NormFloat64()*5.0 + 100.0*s.MiningRate())
+		s.reserve += reward / colonyReserveShare
+		if s.hub != nil {
+			s.stockpile += int(reward / 20)
+		} else if s.corp != nil {
+			s.Supply(goods["ore"], float64(reward)/20)
+			s.corp.Deposit(reward)
+		} else if !owner.Offline() {
+			s.Supply(goods["ore"], float64(reward)/20)
+			owner.Deposit(reward)
+			fmt.Fprintf(owner, "mining colony on %s pays you %d space duckets. total: %d space duckets.\n", s.name, reward, owner.money)
+		}
+		After(5*time.Second, fn)
+	}
+	After(5*time.Second, fn)
+}
+
+var collectCommand = &Command{
+	name: "collect",
+	help: "loads the resources your colony has dug up into your cargo hold.  you have to be at the colony",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if system.Colonizer() != conn {
+			fmt.Fprintf(conn, "you don't have a colony on %s\n", system.name)
+			return
+		}
+		system.Accrue()
+		collected := make(Resources, len(resources))
+		for _, name := range resources {
+			n := conn.Stow(goods[name], int(system.accrued[name]))
+			if n < 1 {
+				continue
+			}
+			system.accrued[name] -= float64(n)
+			collected[name] = n
+		}
+		if len(collected) == 0 && conn.CargoSpace() == 0 {
+			fmt.Fprintf(conn, "your hold is full.\n")
+			return
+		}
+		if len(collected) == 0 {
+			fmt.Fprintf(conn, "there's nothing waiting on %s yet.  the colony digs up %.1f ore, %.1f gas and %.1f crystal an hour\n",
+				system.name, system.YieldRate("ore"), system.YieldRate("gas"), system.YieldRate("crystal"))
+			return
+		}
+		system.SaveColony()
+		fmt.Fprintf(conn, "collected %s from your colony on %s\n", collected, system.name)
+	},
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"math/rand"
+)
+
+// Combat resolution.  Everything here works out what happens when ships and
+// bombs meet, from plain numbers in and plain numbers out: it never touches
+// a connection, a system or the database, and never writes to a player.  The
+// callers (Damage, BombedWith, Defend, board, intercept) gather the inputs,
+// call in here, and then apply and announce the outcome.  All the luck comes
+// from the Dice passed in, so an outcome can be reproduced by passing dice
+// that roll the same way twice.
+type Dice interface {
+	Float64() float64
+	Intn(n int) int
+}
+
+// liveDice rolls with math/rand, for the game itself.
+type liveDice struct{}
+
+func (liveDice) Float64() float64 { return rand.Float64() }
+func (liveDice) Intn(n int) int   { return rand.Intn(n) }
+
+var dice Dice = liveDice{}
+
+const (
+	// odds of one escort shooting down a bomb.  it's a coin flip whether the
+	// escort survives the blast.
+	escortHitChance = 0.2
+	// odds of one defending fighter ramming a bomb.  the fighter is always lost.
+	fighterHitChance = 0.3
+	// boarding defenders count escorts and fighters as extra crew, and fight
+	// this much harder than the boarders
+	boardingEscortCrew = 2
+	boardingHomeEdge   = 1.25
+	grappleEdge        = 1.5
+)
+
+// Hit is a ship taking damage.
+type Hit struct {
+	Damage  int
+	Painted bool
+	Shield  int
+	Hull    int
+}
+
+type HitOutcome struct {
+	// what the shields soaked up and what got through to the hull
+	Absorbed int
+	Taken    int
+	Shield   int
+	Hull     int
+	// the damage actually dealt, after target painting
+	Damage    int
+	Destroyed bool
+}
+
+func ResolveHit(h Hit) HitOutcome {
+	n := h.Damage
+	if h.Painted {
+		n = n * 3 / 2
+	}
+	out := HitOutcome{Damage: n, Shield: h.Shield, Hull: h.Hull}
+	switch {
+	case h.Shield <= 0:
+		out.Taken = n
+	case n <= h.Shield:
+		out.Absorbed = n
+	default:
+		out.Absorbed = h.Shield
+		out.Taken = n - h.Shield
+	}
+	out.Shield -= out.Absorbed
+	out.Hull -= out.Taken
+	out.Destroyed = out.Hull <= 0
+	return out
+}
+
+// PointDefenseOutcome is how a ship's escorts or fighters fared against an
+// incoming bomb.
+type PointDefenseOutcome struct {
+	ByEscorts  bool
+	ByFighters bool
+	EscortLost bool
+	// fighters are lost ramming the bomb
+	FighterLost bool
+}
+
+// ResolveEscorts gives each escort a shot at the bomb.
+func ResolveEscorts(escorts int, d Dice) PointDefenseOutcome {
+	var out PointDefenseOutcome
+	for i := 0; i < escorts; i++ {
+		if d.Float64() >= escortHitChance {
+			continue
+		}
+		out.ByEscorts = true
+		out.EscortLost = d.Intn(2) == 0
+		return out
+	}
+	return out
+}
+
+// ResolveFighters gives each defending fighter a chance to ram the bomb.
+func ResolveFighters(defenders int, d Dice) PointDefenseOutcome {
+	var out PointDefenseOutcome
+	for i := 0; i < defenders; i++ {
+		if d.Float64() >= fighterHitChance {
+			continue
+		}
+		out.ByFighters, out.FighterLost = true, true
+		return out
+	}
+	return out
+}
+
+// PointDefenseApplies is whether escorts and fighters get a chance against a
+// bomb at all.  Piercing bombs and anything heavier than standard can't be
+// stopped.
+func PointDefenseApplies(class *BombClass, yield int) bool {
+	return !class.piercing && yield <= baseYield
+}
+
+// Interception is a pilot taking a shot at a bomb inbound to their system.
+type Interception struct {
+	TechLevel int
+	// the bomb class's speed, which makes faster bombs harder to hit
+	BombSpeed float64
+}
+
+func (i Interception) Chance() float64 {
+	chance := 0.15 + 0.1*float64(i.TechLevel)
+	if chance > 0.85 {
+		chance = 0.85
+	}
+	return chance * i.BombSpeed
+}
+
+func ResolveInterception(i Interception, d Dice) bool {
+	return d.Float64() < i.Chance()
+}
+
+// ColonyDefense is a colony's turrets and shield charges against a bomb.
+type ColonyDefense struct {
+	Turrets  int
+	Shields  int
+	Piercing bool
+	EMP      bool
+	Yield    int
+}
+
+type ColonyDefenseOutcome struct {
+	ShotDown bool
+	// the shield charges left, and whether they absorbed the bomb, were
+	// knocked out by a pulse or buckled under it
+	Shields  int
+	Absorbed bool
+	Pulsed   bool
+	Buckled  bool
+}
+
+func (o ColonyDefenseOutcome) Survived() bool {
+	return o.ShotDown || o.Absorbed
+}
+
+func ResolveColonyDefense(c ColonyDefense, d Dice) ColonyDefenseOutcome {
+	out := ColonyDefenseOutcome{Shields: c.Shields}
+	if !c.Piercing {
+		for i := 0; i < c.Turrets; i++ {
+			if d.Float64() < turretHitChance {
+				out.ShotDown = true
+				return out
+			}
+		}
+	}
+	if c.Shields == 0 {
+		return out
+	}
+	if c.EMP {
+		out.Shields, out.Pulsed = 0, true
+		return out
+	}
+	// heavier bombs take more charge to absorb
+	cost := (c.Yield + baseYield - 1) / baseYield
+	if cost > c.Shields {
+		out.Shields, out.Buckled = 0, true
+		return out
+	}
+	out.Shields -= cost
+	out.Absorbed = true
+	return out
+}
+
+// Boarding is one crew storming another ship.
+type Boarding struct {
+	Crew    int
+	Grapple bool
+	// the defending ship
+	DefenderCrew int
+	Escorts      int
+	Defenders    int
+}
+
+type BoardingOutcome struct {
+	Success bool
+	// crew lost by whichever side lost the fight
+	Losses int
+}
+
+func ResolveBoarding(b Boarding, d Dice) BoardingOutcome {
+	attack := d.Float64() * float64(b.Crew)
+	if b.Grapple {
+		attack *= grappleEdge
+	}
+	defense := d.Float64() * float64(b.DefenderCrew+boardingEscortCrew*b.Escorts+b.Defenders) * boardingHomeEdge
+	return BoardingOutcome{
+		Success: attack > defense,
+		Losses:  1 + d.Intn(3),
+	}
+}
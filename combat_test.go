@@ -0,0 +1,158 @@
+package main
+
+import (
+	"testing"
+)
+
+// fixedDice rolls the given numbers in order, so a test can put a roll just
+// either side of the odds it's checking.
+type fixedDice struct {
+	floats []float64
+	ints   []int
+}
+
+func (d *fixedDice) Float64() float64 {
+	if len(d.floats) == 0 {
+		panic("fixedDice: out of floats")
+	}
+	f := d.floats[0]
+	d.floats = d.floats[1:]
+	return f
+}
+
+func (d *fixedDice) Intn(n int) int {
+	if len(d.ints) == 0 {
+		panic("fixedDice: out of ints")
+	}
+	i := d.ints[0]
+	d.ints = d.ints[1:]
+	if i >= n {
+		panic("fixedDice: roll out of range")
+	}
+	return i
+}
+
+func TestResolveHit(t *testing.T) {
+	tests := []struct {
+		name string
+		hit  Hit
+		want HitOutcome
+	}{
+		{"no shield", Hit{Damage: 10, Shield: 0, Hull: 50},
+			HitOutcome{Taken: 10, Shield: 0, Hull: 40, Damage: 10}},
+		{"shield absorbs", Hit{Damage: 10, Shield: 30, Hull: 50},
+			HitOutcome{Absorbed: 10, Shield: 20, Hull: 50, Damage: 10}},
+		{"shield absorbs exactly", Hit{Damage: 30, Shield: 30, Hull: 50},
+			HitOutcome{Absorbed: 30, Shield: 0, Hull: 50, Damage: 30}},
+		{"overflow to hull", Hit{Damage: 40, Shield: 30, Hull: 50},
+			HitOutcome{Absorbed: 30, Taken: 10, Shield: 0, Hull: 40, Damage: 40}},
+		{"painted", Hit{Damage: 20, Painted: true, Shield: 10, Hull: 50},
+			HitOutcome{Absorbed: 10, Taken: 20, Shield: 0, Hull: 30, Damage: 30}},
+		{"hull at zero", Hit{Damage: 40, Shield: 10, Hull: 30},
+			HitOutcome{Absorbed: 10, Taken: 30, Shield: 0, Hull: 0, Damage: 40, Destroyed: true}},
+		{"hull overkill", Hit{Damage: 100, Shield: 0, Hull: 30},
+			HitOutcome{Taken: 100, Shield: 0, Hull: -70, Damage: 100, Destroyed: true}},
+	}
+	for _, tt := range tests {
+		if got := ResolveHit(tt.hit); got != tt.want {
+			t.Errorf("%s: ResolveHit(%+v) = %+v, want %+v", tt.name, tt.hit, got, tt.want)
+		}
+	}
+}
+
+func TestResolveInterception(t *testing.T) {
+	tests := []struct {
+		name string
+		i    Interception
+		roll float64
+		want bool
+	}{
+		{"untrained just under", Interception{TechLevel: 0, BombSpeed: 1}, 0.1499, true},
+		{"untrained at odds", Interception{TechLevel: 0, BombSpeed: 1}, 0.15, false},
+		{"capped just under", Interception{TechLevel: 10, BombSpeed: 1}, 0.8499, true},
+		{"capped at odds", Interception{TechLevel: 10, BombSpeed: 1}, 0.85, false},
+		{"fast bomb just under", Interception{TechLevel: 10, BombSpeed: 0.5}, 0.4249, true},
+		{"fast bomb at odds", Interception{TechLevel: 10, BombSpeed: 0.5}, 0.425, false},
+		{"lucky roll", Interception{TechLevel: 0, BombSpeed: 1}, 0, true},
+	}
+	for _, tt := range tests {
+		d := &fixedDice{floats: []float64{tt.roll}}
+		if got := ResolveInterception(tt.i, d); got != tt.want {
+			t.Errorf("%s: ResolveInterception(%+v) rolling %v = %v, want %v", tt.name, tt.i, tt.roll, got, tt.want)
+		}
+	}
+}
+
+func TestResolveColonyDefense(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     ColonyDefense
+		rolls []float64
+		want  ColonyDefenseOutcome
+	}{
+		{"turret just under", ColonyDefense{Turrets: 1, Yield: baseYield}, []float64{0.1999},
+			ColonyDefenseOutcome{ShotDown: true}},
+		{"turret at odds", ColonyDefense{Turrets: 1, Yield: baseYield}, []float64{0.2},
+			ColonyDefenseOutcome{}},
+		{"second turret hits", ColonyDefense{Turrets: 2, Shields: 3, Yield: baseYield}, []float64{0.5, 0.1},
+			ColonyDefenseOutcome{ShotDown: true, Shields: 3}},
+		{"piercing skips turrets", ColonyDefense{Turrets: 5, Shields: 1, Piercing: true, Yield: baseYield}, nil,
+			ColonyDefenseOutcome{Shields: 0, Absorbed: true}},
+		{"shields absorb", ColonyDefense{Shields: 3, Yield: baseYield}, nil,
+			ColonyDefenseOutcome{Shields: 2, Absorbed: true}},
+		{"heavy bomb costs more", ColonyDefense{Shields: 3, Yield: baseYield + 1}, nil,
+			ColonyDefenseOutcome{Shields: 1, Absorbed: true}},
+		{"shields just hold", ColonyDefense{Shields: 2, Yield: 2 * baseYield}, nil,
+			ColonyDefenseOutcome{Shields: 0, Absorbed: true}},
+		{"shields buckle", ColonyDefense{Shields: 1, Yield: baseYield + 1}, nil,
+			ColonyDefenseOutcome{Shields: 0, Buckled: true}},
+		{"pulse", ColonyDefense{Shields: 3, EMP: true, Yield: baseYield}, nil,
+			ColonyDefenseOutcome{Shields: 0, Pulsed: true}},
+		{"undefended", ColonyDefense{Yield: baseYield}, nil,
+			ColonyDefenseOutcome{}},
+	}
+	for _, tt := range tests {
+		d := &fixedDice{floats: tt.rolls}
+		got := ResolveColonyDefense(tt.c, d)
+		if got != tt.want {
+			t.Errorf("%s: ResolveColonyDefense(%+v) = %+v, want %+v", tt.name, tt.c, got, tt.want)
+		}
+		if got.Survived() != (tt.want.ShotDown || tt.want.Absorbed) {
+			t.Errorf("%s: Survived() = %v", tt.name, got.Survived())
+		}
+	}
+}
+
+func TestResolveBoarding(t *testing.T) {
+	tests := []struct {
+		name  string
+		b     Boarding
+		rolls []float64
+		loss  int
+		want  BoardingOutcome
+	}{
+		// the defenders' home edge makes 4 crew hold off 5
+		{"tie goes to defenders", Boarding{Crew: 5, DefenderCrew: 4}, []float64{1, 1}, 0,
+			BoardingOutcome{Success: false, Losses: 1}},
+		{"one more boarder", Boarding{Crew: 6, DefenderCrew: 4}, []float64{1, 1}, 0,
+			BoardingOutcome{Success: true, Losses: 1}},
+		{"grapple tie", Boarding{Crew: 5, Grapple: true, DefenderCrew: 6}, []float64{1, 1}, 2,
+			BoardingOutcome{Success: false, Losses: 3}},
+		{"grapple", Boarding{Crew: 5, Grapple: true, DefenderCrew: 5}, []float64{1, 1}, 2,
+			BoardingOutcome{Success: true, Losses: 3}},
+		{"escorts count double", Boarding{Crew: 5, Escorts: 2}, []float64{1, 1}, 0,
+			BoardingOutcome{Success: false, Losses: 1}},
+		{"fighters count once", Boarding{Crew: 5, Defenders: 3}, []float64{1, 1}, 0,
+			BoardingOutcome{Success: true, Losses: 1}},
+		{"boarders roll nothing", Boarding{Crew: 100, DefenderCrew: 1}, []float64{0, 0.01}, 1,
+			BoardingOutcome{Success: false, Losses: 2}},
+		{"defenders roll nothing", Boarding{Crew: 1, DefenderCrew: 100}, []float64{0.01, 0}, 1,
+			BoardingOutcome{Success: true, Losses: 2}},
+	}
+	for _, tt := range tests {
+		d := &fixedDice{floats: tt.rolls, ints: []int{tt.loss}}
+		if got := ResolveBoarding(tt.b, d); got != tt.want {
+			t.Errorf("%s: ResolveBoarding(%+v) = %+v, want %+v", tt.name, tt.b, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,15 +15,26 @@ type Command struct {
 	help    string
 	handler func(*Connection, ...string)
 	mobile  bool
+	arena   bool
+	// station services and the like, which can be used while docked
+	docked bool
 }
 
 var infoCommand = &Command{
-	name: "info",
-	help: "gives you some info about your current position",
+	name:   "info",
+	help:   "gives you some info about your current position",
+	docked: true,
 	handler: func(conn *Connection, args ...string) {
+		fmt.Fprintf(conn, "pilot: %s\n", conn.DisplayName())
 		fmt.Fprintf(conn, "current planet: %s\n", conn.System().name)
+		fmt.Fprintf(conn, "ship: %s\n", conn.ShipLabel())
+		fmt.Fprintf(conn, "hull: %d/%d\n", conn.hull, conn.MaxHull())
+		fmt.Fprintf(conn, "shields: %d/%d\n", conn.shield, conn.MaxShield())
+		fmt.Fprintf(conn, "crew: %d\n", conn.crew)
+		fmt.Fprintf(conn, "escorts: %d\n", conn.escorts)
 		fmt.Fprintf(conn, "bombs: %d\n", conn.bombs)
 		fmt.Fprintf(conn, "money: %d space duckets\n", conn.money)
+		fmt.Fprintf(conn, "reputation: %s (%d)\n", reputeTier(conn.repute), conn.repute)
 	},
 }
 
@@ -39,19 +49,25 @@ var nearbyCommand = &Command{
 			return
 		}
 		fmt.Fprintf(conn, "--------------------------------------------------------------------------------\n")
-		fmt.Fprintf(conn, "%-4s %-20s %s\n", "id", "name", "travel time")
+		fmt.Fprintf(conn, "%-4s %-20s %-20s %s\n", "id", "name", "travel time", "hazard")
 		fmt.Fprintf(conn, "--------------------------------------------------------------------------------\n")
 		for _, neighbor := range neighbors {
-			other := index[neighbor.id]
-			fmt.Fprintf(conn, "%-4d %-20s %v\n", other.id, other.name, system.TravelTimeTo(other))
+			other := systemById(neighbor.id)
+			hazard := ""
+			if h := other.Hazard(); h != nil {
+				hazard = h.kind
+			}
+			fmt.Fprintf(conn, "%-4d %-20s %-20v %s\n", other.id, other.name, system.TravelTimeTo(other), hazard)
 		}
 		fmt.Fprintf(conn, "--------------------------------------------------------------------------------\n")
 	},
 }
 
 var helpCommand = &Command{
-	name: "help",
-	help: "helpful things to help you",
+	name:   "help",
+	help:   "helpful things to help you",
+	arena:  true,
+	docked: true,
 	handler: func(conn *Connection, args ...string) {
 		msg := `
 Star Dragons is a stupid name, but it's the name that Brian suggested.  It has
@@ -95,8 +111,10 @@ systems.  Star systems that are farther away take longer to communicate with.
 }
 
 var commandsCommand = &Command{
-	name: "commands",
-	help: "gives you a handy list of commands",
+	name:   "commands",
+	help:   "gives you a handy list of commands",
+	arena:  true,
+	docked: true,
 	handler: func(conn *Connection, args ...string) {
 		names := make([]string, 0, len(commandRegistry))
 		for name, _ := range commandRegistry {
@@ -116,26 +134,44 @@ var scanCommand = &Command{
 	name: "scan",
 	help: "super duper scan",
 	handler: func(conn *Connection, args ...string) {
+		if conn.BurntOut("scanner") {
+			return
+		}
 		if !conn.CanScan() {
+			if conn.Tamed("seer") && clock.Now().Sub(conn.lastSeerScan) > seerRecharge {
+				conn.lastSeerScan = clock.Now()
+				fmt.Fprintf(conn, "your seer dragon %s scans for you\n", conn.character.tamed)
+				sendScan(conn.System(), conn.ScanReach())
+				return
+			}
 			fmt.Fprintf(conn, "scanners are still recharging.  Can scan again in %v\n", conn.NextScan())
 			return
 		}
 		conn.RecordScan()
-		system := conn.System()
-		log_info("scan sent from %s", system.name)
-		for id, _ := range index {
-			if id == system.id {
-				continue
-			}
-			delay := system.LightTimeTo(index[id])
-			id2 := id
-			After(delay, func() {
-				scanSystem(id2, system.id)
-			})
+		sendScan(conn.System(), conn.ScanReach())
+		if conn.Hot("scanner") {
+			conn.lastScan = conn.lastScan.Add(-30 * time.Second)
+			conn.Strain("scanner")
 		}
 	},
 }
 
+// sendScan pings every system from this one.  Ships in systems within reach
+// are identified down to their hulls and decals.
+func sendScan(system *System, reach float64) {
+	log_info("scan sent from %s", system.name)
+	eachSystem(func(other *System) {
+		if other == system {
+			return
+		}
+		delay := system.LightTimeTo(other)
+		id2 := other.id
+		AfterData(EV_Scan, delay, encodeEvent(scanEvent{System: id2, Reply: system.id, Reach: reach}), func() {
+			scanSystem(id2, system.id, reach)
+		}).Describe("scan from %s reaching %s", system.name, other.name)
+	})
+}
+
 var broadcastCommand = &Command{
 	name: "broadcast",
 	help: "broadcast a message for all systems to hear",
@@ -143,16 +179,62 @@ var broadcastCommand = &Command{
 		msg := strings.Join(args, " ")
 		system := conn.System()
 		log_info("broadcast sent from %s: %v\n", system.name, msg)
-		for id, _ := range index {
-			if id == system.id {
-				continue
+		recordChat(conn.PlayerName(), "", msg)
+		if conn.ShadowMuted() {
+			return
+		}
+		eachSystem(func(other *System) {
+			if other == system {
+				return
 			}
-			delay := system.LightTimeTo(index[id])
-			id2 := id
-			After(delay, func() {
-				deliverMessage(id2, system.id, msg)
-			})
+			delay := system.LightTimeTo(other)
+			id2 := other.id
+			AfterNamed(EV_Message, delay, func() {
+				deliverMessage(id2, system.id, conn, msg)
+			}).Describe("broadcast from %s reaching %s", conn.PlayerName(), other.name)
+		})
+	},
+}
+
+var tellCommand = &Command{
+	name: "tell",
+	help: "sends a message to a single player.  it travels at light speed to the system they're in when you send it.  usage: tell [player] [message]",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) < 2 {
+			fmt.Fprintf(conn, "usage: tell [player] [message]\n")
+			return
+		}
+		target := findConnection(args[0])
+		if target == conn || (target == nil && !characterExists(args[0])) {
+			fmt.Fprintf(conn, "there's nobody by the name %s to talk to\n", args[0])
+			return
+		}
+		recordChat(conn.PlayerName(), args[0], strings.Join(args[1:], " "))
+		if conn.ShadowMuted() {
+			fmt.Fprintf(conn, "message to %s sent\n", args[0])
+			return
+		}
+		if target == nil {
+			if err := sendMail(args[0], conn.PlayerName(), strings.Join(args[1:], " ")); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "the mail service is down.  try again later.\n")
+				return
+			}
+			fmt.Fprintf(conn, "%s isn't around.  your message has been left in their mailbox.\n", args[0])
+			return
+		}
+		to := target.System()
+		if to == nil {
+			fmt.Fprintf(conn, "%s is between systems and can't be reached\n", target.PlayerName())
+			return
 		}
+		msg := strings.Join(args[1:], " ")
+		from := conn.System()
+		log_info("tell sent from %s to %s at %s: %v", conn.PlayerName(), target.PlayerName(), to.name, msg)
+		fmt.Fprintf(conn, "message to %s sent\n", target.PlayerName())
+		AfterNamed(EV_Message, from.LightTimeTo(to), func() {
+			deliverTell(target, to, from, conn, msg)
+		}).Describe("tell from %s to %s", conn.PlayerName(), target.PlayerName())
 	},
 }
 
@@ -161,7 +243,7 @@ var gotoCommand = &Command{
 	help: "moves to a different system, specified by either name or ID",
 	handler: func(conn *Connection, args ...string) {
 		dest_name := strings.Join(args, " ")
-		to, ok := nameIndex[dest_name]
+		to, ok := systemByName(dest_name)
 		if ok {
 			move(conn, to)
 			return
@@ -173,8 +255,8 @@ var gotoCommand = &Command{
 			return
 		}
 
-		to, ok = index[id_n]
-		if !ok {
+		to = systemById(id_n)
+		if to == nil {
 			fmt.Fprintf(conn, `oh dear, there doesn't seem to be a system with id %d`, id_n)
 			return
 		}
@@ -204,103 +286,217 @@ var colonizeCommand = &Command{
 	help: "establishes a mining colony on the current system",
 	handler: func(conn *Connection, arg ...string) {
 		system := conn.System()
-		var fn func()
-		fn = func() {
-			reward := int64(rand.NormFloat64()*5.0 + 100.0*system.miningRate)
-			if system.colonizedBy != nil {
-				system.colonizedBy.Deposit(reward)
-				fmt.Fprintf(system.colonizedBy, "mining colony on %s pays you %d space duckets. total: %d space duckets.\n", system.name, reward, system.colonizedBy.money)
-			}
-			After(5*time.Second, fn)
-		}
-
-		if system.colonizedBy != nil {
-			system.colonizedBy = conn
-			After(5*time.Second, fn)
+		if system.Colonizer() != nil {
+			system.SetColonizer(conn)
+			system.SaveColony()
+			system.RunColony()
 			return
 		}
 
 		if conn.money > 2000 {
 			conn.Withdraw(2000)
-			system.colonizedBy = conn
+			system.SetColonizer(conn)
+			system.SaveColony()
+			conn.AdjustReputation(minersGuild, 5)
 			fmt.Fprintf(conn, "set up a mining colony on %s\n", conn.System().name)
-			After(5*time.Second, fn)
+			system.RunColony()
 		} else {
 			fmt.Fprintf(conn, "not enough money!  it costs 2000 duckets to start a mining colony\n")
 		}
 	},
 }
 
+var dockCommand = &Command{
+	name: "dock",
+	help: "docks at a station or at one of your colonies.  Docked ships can't be bombed, but can only use the station's services",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if !system.station && system.Colonizer() != conn {
+			fmt.Fprintf(conn, "there's nowhere to dock in %s.  you need a station or one of your own colonies.\n", system.name)
+			return
+		}
+		conn.docked = true
+		fmt.Fprintf(conn, "docked at %s.  you are safe from bombardment.  use \"undock\" to leave.\n", system.name)
+	},
+}
+
+var undockCommand = &Command{
+	name:   "undock",
+	help:   "undocks your ship so that you can act again",
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.docked {
+			fmt.Fprintf(conn, "you're not docked.\n")
+			return
+		}
+		conn.docked = false
+		fmt.Fprintf(conn, "undocked from %s\n", conn.System().name)
+	},
+}
+
+var silentCommand = &Command{
+	name: "silent",
+	help: "toggles silent running.  Arrivals go unannounced, but travel is slower",
+	handler: func(conn *Connection, args ...string) {
+		conn.silent = !conn.silent
+		if conn.silent {
+			fmt.Fprintf(conn, "running silent.  your arrivals will go unnoticed, but your engines are throttled\n")
+		} else {
+			fmt.Fprintf(conn, "silent running disengaged.  engines at full power\n")
+		}
+	},
+}
+
 func move(conn *Connection, to *System) {
+	if conn.capital != nil {
+		fmt.Fprintf(conn, "you're aboard the %s.  the helm decides where it goes.\n", conn.capital.name)
+		return
+	}
+	if conn.BurntOut("engines") {
+		return
+	}
 	start := conn.System()
 	start.Leave(conn)
 
-	delay := start.TravelTimeTo(to)
+	delay := conn.TravelTime(start, to)
+	if conn.Hot("engines") {
+		conn.Strain("engines")
+	}
 	fmt.Fprintf(conn, "moving to %s. ETA: %v\n", to.name, delay)
-	After(delay, func() {
+	conn.Departed(start, to, delay)
+	arrive := func() {
 		to.Arrive(conn)
 		fmt.Fprintf(conn, "You have arrived at the %s system after a total travel time of %v.\n", to.name, delay)
+		if physics.Relativistic() {
+			fmt.Fprintf(conn, "ship's clocks show %v.\n", physics.ShipTime(start.DistanceTo(to), delay).Round(time.Second))
+		}
+	}
+	travel := encodeEvent(travelEvent{Player: conn.PlayerName(), To: to.id})
+	trap := Interdicts(conn, start, to)
+	if trap == nil {
+		AfterData(EV_Travel, delay, travel, arrive).Describe("%s travelling from %s to %s", conn.PlayerName(), start.name, to.name)
+		return
+	}
+	caught := conn.TravelTime(start, trap)
+	AfterData(EV_Travel, caught, encodeEvent(travelEvent{Player: conn.PlayerName(), To: trap.id}), func() {
+		if trap.interdictor == nil {
+			AfterData(EV_Travel, delay-caught, travel, arrive)
+			return
+		}
+		fmt.Fprintf(conn, "your warp field collapses!  an interdictor has pulled you out of transit.\n")
+		trap.Arrive(conn)
+		owner := trap.interdictor.owner
+		if !owner.InTransit() {
+			desc := owner.Describe(conn)
+			After(trap.LightTimeTo(owner.System()), func() {
+				fmt.Fprintf(owner, "your interdictor in %s caught %s\n", trap.name, desc)
+			})
+		}
 	})
 }
 
 var bombCommand = &Command{
 	name: "bomb",
-	help: "bombs a system, with a big space bomb",
+	help: "bombs a system, with a big space bomb.  usage: bomb [fission|fusion|antimatter] [system]",
 	handler: func(conn *Connection, args ...string) {
-		if conn.bombs < 1 {
-			fmt.Fprintf(conn, "no more bombs left! build more bombs!\n")
+		class, args := parseBombArgs(args)
+		if conn.BombCount(class) < 1 {
+			fmt.Fprintf(conn, "no more %s bombs left! build more bombs!\n", class.name)
 			return
 		}
 
 		dest_name := strings.Join(args, " ")
-		to, ok := nameIndex[dest_name]
-		if ok {
-			bomb(conn, to)
-			return
-		}
-
-		id_n, err := strconv.Atoi(dest_name)
-		if err != nil {
-			fmt.Fprintf(conn, `hmm, I don't know a system by the name "%s", try something else\n`, dest_name)
-			return
-		}
-
-		to, ok = index[id_n]
+		to, ok := systemByName(dest_name)
 		if !ok {
-			fmt.Fprintf(conn, `oh dear, there doesn't seem to be a system with id %d\n`, id_n)
+			id_n, err := strconv.Atoi(dest_name)
+			if err != nil {
+				fmt.Fprintf(conn, `hmm, I don't know a system by the name "%s", try something else\n`, dest_name)
+				return
+			}
+			to = systemById(id_n)
+			if to == nil {
+				fmt.Fprintf(conn, `oh dear, there doesn't seem to be a system with id %d\n`, id_n)
+				return
+			}
+		}
+		if conn.design.weapons == 0 {
+			fmt.Fprintf(conn, "your %s has no bomb launchers.\n", conn.design.name)
 			return
 		}
 		if !conn.CanBomb() {
 			fmt.Fprintf(conn, "weapons are still reloading.  Can bomb again in %v\n", conn.NextBomb())
 			return
 		}
-		bomb(conn, to)
+		bomb(conn, to, class)
 	},
 }
 
 var mkBombCommand = &Command{
 	name: "mkbomb",
-	help: "make a bomb.  Costs 500 space duckets",
+	help: "make a bomb.  usage: mkbomb [fission|fusion|antimatter].  see \"armory\" for prices",
 	handler: func(conn *Connection, args ...string) {
-		if conn.money < 500 {
-			fmt.Fprintf(conn, "not enough money!  Bombs cost 500 space duckets to build, you only have %d in the bank.\n", conn.money)
+		class := fission
+		if len(args) > 0 {
+			b, ok := bombClasses[args[0]]
+			if !ok {
+				fmt.Fprintf(conn, "there's no such thing as a %s bomb\n", args[0])
+				return
+			}
+			class = b
+		}
+		cost := conn.BombCost(class)
+		if conn.money < cost {
+			fmt.Fprintf(conn, "not enough money!  %s bombs cost %d space duckets to build, you only have %d in the bank.\n", class.name, cost, conn.money)
 			return
 		}
-		conn.Withdraw(500)
-		conn.bombs += 1
-		fmt.Fprintf(conn, "built a bomb!\n")
-		fmt.Fprintf(conn, "bombs: %d\n", conn.bombs)
+		if !conn.HasResources(class.materials) {
+			fmt.Fprintf(conn, "not enough materials!  %s bombs take %s to build.\n", class.name, class.materials)
+			return
+		}
+		conn.Withdraw(cost)
+		conn.TakeResources(class.materials)
+		conn.AddBombs(class, 1)
+		fmt.Fprintf(conn, "built a %s bomb!\n", class.name)
+		fmt.Fprintf(conn, "%s bombs: %d\n", class.name, conn.BombCount(class))
 		fmt.Fprintf(conn, "money: %d space duckets\n", conn.money)
 	},
 }
 
-func bomb(conn *Connection, to *System) {
-	conn.bombs -= 1
-	delay := conn.System().BombTimeTo(to)
-	fmt.Fprintf(conn, "sending bomb to %s. ETA: %v\n", to.name, delay)
-	After(delay, func() {
-		to.Bombed(conn)
+func bomb(conn *Connection, to *System, class *BombClass) {
+	if reason := TreatyForbids(conn, to); reason != "" {
+		fmt.Fprintf(conn, "bombing %s would violate a peace treaty: %s\n", to.name, reason)
+		return
+	}
+	if conn.BurntOut("launcher") {
+		return
+	}
+	conn.AddBombs(class, -1)
+	conn.AdjustReputation(pirateClans, 2)
+	conn.AdjustReputation(dragonCultists, 3)
+	delay := class.TimeTo(conn.System(), to)
+	yield := class.yield
+	if conn.Hot("launcher") {
+		yield = yield * heavyYield / baseYield
+		conn.Strain("launcher")
+	}
+	fmt.Fprintf(conn, "sending %s bomb to %s. ETA: %v\n", class.name, to.name, delay)
+	b := &InboundBomb{
+		bomber:   conn,
+		class:    class,
+		from:     conn.System(),
+		to:       to,
+		arrives:  clock.Now().Add(delay),
+		attempts: make(map[*Connection]bool, 2),
+	}
+	trackBomb(b)
+	future := AfterData(EV_Bomb, delay, encodeEvent(bombEvent{Bomber: conn.PlayerName(), To: to.id, Yield: yield, Class: class.name}), func() {
+		untrackBomb(b)
+		to.BombedWith(conn, class, yield)
 	})
+	future.Describe("%s bomb from %s to %s, yield %d", class.name, conn.PlayerName(), to.name, yield)
+	inbound.Lock()
+	b.id = future.id
+	inbound.Unlock()
 }
 
 func isCommand(name string) bool {
@@ -320,6 +516,21 @@ func runCommand(conn *Connection, name string, args ...string) {
 		return
 	}
 
+	if conn.arena != nil && !cmd.arena {
+		fmt.Fprintf(conn, "you can't do that in the arena.  use \"arena leave\" to go back.\n")
+		return
+	}
+
+	if conn.heldBy != nil && cmd != selfDestructCommand {
+		fmt.Fprintf(conn, "your ship is held in a tractor beam.  you can't do anything.\n")
+		return
+	}
+
+	if conn.docked && !cmd.docked {
+		fmt.Fprintf(conn, "you can't do that while docked.  undock first.\n")
+		return
+	}
+
 	if conn.InTransit() && !cmd.mobile {
 		fmt.Fprintf(conn, "command %s can not be used while in transit", name)
 		return
@@ -333,15 +544,117 @@ func registerCommand(c *Command) {
 
 func init() {
 	commandRegistry = make(map[string]*Command, 16)
+	registerCommand(allianceCommand)
+	registerCommand(anomalyCommand)
+	registerCommand(arenaCommand)
+	registerCommand(armoryCommand)
+	registerCommand(assaultCommand)
+	registerCommand(boardCommand)
 	registerCommand(bombCommand)
+	registerCommand(bountyCommand)
 	registerCommand(broadcastCommand)
+	registerCommand(buoyCommand)
+	registerCommand(buoysCommand)
+	registerCommand(buildCommand)
+	registerCommand(buyCommand)
+	registerCommand(capitalCommand)
+	registerCommand(cargoCommand)
+	registerCommand(challengesCommand)
+	registerCommand(channelCommand)
+	registerCommand(charactersCommand)
+	registerCommand(collectCommand)
 	registerCommand(colonizeCommand)
 	registerCommand(commandsCommand)
+	registerCommand(contractCommand)
+	registerCommand(corpCommand)
+	registerCommand(decalCommand)
+	registerCommand(dismissCommand)
+	registerCommand(dockCommand)
+	registerCommand(duelCommand)
+	registerCommand(economyCommand)
+	registerCommand(engineeringCommand)
+	registerCommand(eventCommand)
+	registerCommand(eventsCommand)
+	registerCommand(expandCommand)
+	registerCommand(fitCommand)
+	registerCommand(fleetCommand)
+	registerCommand(fortifyCommand)
 	registerCommand(gotoCommand)
+	registerCommand(hailCommand)
+	registerCommand(hangarCommand)
+	registerCommand(hardcoreCommand)
+	registerCommand(hatcheryCommand)
+	registerCommand(helmCommand)
 	registerCommand(helpCommand)
+	registerCommand(hireCommand)
+	registerCommand(homeCommand)
 	registerCommand(infoCommand)
+	registerCommand(interceptCommand)
+	registerCommand(interdictorCommand)
+	registerCommand(inviteCommand)
+	registerCommand(jamCommand)
+	registerCommand(jumpCommand)
+	registerCommand(killsCommand)
+	registerCommand(launchCommand)
+	registerCommand(linkCommand)
+	registerCommand(loadCommand)
+	registerCommand(loadoutCommand)
+	registerCommand(logisticsCommand)
+	registerCommand(logoutCommand)
+	registerCommand(mailCommand)
+	registerCommand(marketCommand)
+	registerCommand(memorialCommand)
+	registerCommand(mentorCommand)
+	registerCommand(merchantCommand)
 	registerCommand(mineCommand)
+	registerCommand(missionCommand)
+	registerCommand(muteCommand)
+	registerCommand(nameCommand)
 	registerCommand(nearbyCommand)
+	registerCommand(newsCommand)
+	registerCommand(overheatCommand)
+	registerCommand(paintCommand)
+	registerCommand(pauseCommand)
+	registerCommand(pingCommand)
+	registerCommand(probeCommand)
+	registerCommand(profileCommand)
+	registerCommand(protocolCommand)
+	registerCommand(raidCommand)
+	registerCommand(recallCommand)
+	registerCommand(registryCommand)
+	registerCommand(relicCommand)
+	registerCommand(reportCommand)
+	registerCommand(reportsCommand)
+	registerCommand(researchCommand)
+	registerCommand(resourcesCommand)
+	registerCommand(rulesCommand)
 	registerCommand(scanCommand)
+	registerCommand(schedulerCommand)
+	registerCommand(securityCommand)
+	registerCommand(selfDestructCommand)
+	registerCommand(sellCommand)
+	registerCommand(sensorsCommand)
+	registerCommand(sessionsCommand)
+	registerCommand(shieldsCommand)
+	registerCommand(shipsCommand)
+	registerCommand(shipyardCommand)
+	registerCommand(silentCommand)
+	registerCommand(standingCommand)
+	registerCommand(sweepCommand)
+	registerCommand(switchCommand)
+	registerCommand(tellCommand)
+	registerCommand(timeCommand)
+	registerCommand(timescaleCommand)
+	registerCommand(titleCommand)
+	registerCommand(tractorCommand)
+	registerCommand(tradeCommand)
+	registerCommand(transferCommand)
+	registerCommand(twoFactorCommand)
+	registerCommand(undockCommand)
+	registerCommand(unfitCommand)
+	registerCommand(unloadCommand)
+	registerCommand(upgradeCommand)
+	registerCommand(weaponsCommand)
+	registerCommand(whoCommand)
 	registerCommand(mkBombCommand)
 }
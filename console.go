@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The diagnostic console is a unix socket that lets whoever runs the server
+// poke at the live world without attaching a debugger:
+//
+//	nc -U exo-console.sock
+//
+// Anyone who can open the socket can read everything, so it's only created
+// when EXO_CONSOLE_SOCKET names a path, and only the server's user can
+// connect to it.
+//
+// The world belongs to the game, not the console, so each command runs on the
+// scheduler between game events and its output is sent once it's done.
+type consoleCommand struct {
+	help string
+	run  func(w io.Writer, args []string)
+}
+
+var consoleCommands map[string]consoleCommand
+
+func init() {
+	consoleCommands = map[string]consoleCommand{
+		"help":    {"lists console commands", consoleHelp},
+		"events":  {"lists pending scheduler events.  usage: events [name]", consoleEvents},
+		"players": {"lists connected players", consolePlayers},
+		"system":  {"dumps a system.  usage: system [name|id]", consoleSystem},
+		"conn":    {"dumps a player's connection.  usage: conn [player]", consoleConn},
+		"dragons": {"lists the dragons roaming the galaxy", consoleDragons},
+		"fsck":    {"checks the world for broken references.  usage: fsck [repair]", consoleFsck},
+	}
+}
+
+func startConsole() {
+	path := os.Getenv("EXO_CONSOLE_SOCKET")
+	if path == "" {
+		return
+	}
+	listener, err := listenPrivate(path)
+	if err != nil {
+		log_error("unable to open console socket: %v", err)
+		return
+	}
+	log_info("diagnostic console listening on %s", path)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log_error("console listener failed: %v", err)
+				return
+			}
+			go runConsole(conn)
+		}
+	}()
+}
+
+// listenPrivate opens a unix socket that only the server's user can connect
+// to.  It's bound inside a fresh directory that nobody else can enter, made
+// private there and only then moved into place, so there's never a moment
+// when it's open to anyone else.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".console-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "sock")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unable to restrict console socket: %v", err)
+	}
+	os.Remove(path)
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	// the listener would otherwise try to remove the name it was bound to,
+	// which is gone
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	return listener, nil
+}
+
+func runConsole(conn net.Conn) {
+	defer conn.Close()
+	log_info("console session opened")
+	r := bufio.NewReader(conn)
+	for {
+		fmt.Fprintf(conn, "exo> ")
+		line, err := r.ReadString('\n')
+		if err != nil {
+			log_info("console session closed")
+			return
+		}
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if parts[0] == "quit" || parts[0] == "exit" {
+			return
+		}
+		cmd, ok := consoleCommands[parts[0]]
+		if !ok {
+			fmt.Fprintf(conn, "no such command: %s.  try \"help\"\n", parts[0])
+			continue
+		}
+		var out bytes.Buffer
+		done := make(chan struct{})
+		After(0, func() {
+			cmd.run(&out, parts[1:])
+			close(done)
+		})
+		<-done
+		conn.Write(out.Bytes())
+	}
+}
+
+func consoleHelp(w io.Writer, args []string) {
+	names := make([]string, 0, len(consoleCommands))
+	for name, _ := range consoleCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%-10s %s\n", name, consoleCommands[name].help)
+	}
+	fmt.Fprintf(w, "%-10s %s\n", "quit", "closes the console")
+}
+
+func consoleEvents(w io.Writer, args []string) {
+	pending := scheduler.Pending()
+	shown := 0
+	for _, f := range pending {
+		if len(args) > 0 && f.name != args[0] {
+			continue
+		}
+		shown++
+		fmt.Fprintf(w, "#%-6d %-14s in %-12v %s\n", f.id, f.name, f.ts.Sub(clock.Now()).Truncate(time.Millisecond), f.data)
+	}
+	fmt.Fprintf(w, "%d of %d pending events\n", shown, len(pending))
+}
+
+func consolePlayers(w io.Writer, args []string) {
+	all := connections()
+	names := make([]string, 0, len(all))
+	conns := make(map[string]*Connection, len(all))
+	for _, conn := range all {
+		names = append(names, conn.PlayerName())
+		conns[conn.PlayerName()] = conn
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conn := conns[name]
+		location := "in transit"
+		if s := conn.System(); s != nil {
+			location = s.name
+		}
+		fmt.Fprintf(w, "%-20s %-8s %-16s %s\n", name, conn.Transport(), conn.RemoteIP(), location)
+	}
+	fmt.Fprintf(w, "%d connected\n", len(names))
+}
+
+func consoleSystem(w io.Writer, args []string) {
+	name := strings.Join(args, " ")
+	s, ok := systemByName(name)
+	if !ok {
+		id, err := strconv.Atoi(name)
+		if err == nil {
+			s = systemById(id)
+		}
+	}
+	if s == nil {
+		fmt.Fprintf(w, "no such system: %s\n", name)
+		return
+	}
+	fmt.Fprintf(w, "%s (id %d) at %.1f, %.1f, %.1f\n", s.name, s.id, s.x, s.y, s.z)
+	fmt.Fprintf(w, "planets: %d  station: %v  security: %.2f  mining rate: %.2f\n", s.planets, s.station, s.Security(), s.miningRate)
+	if owner := s.Colonizer(); owner != nil {
+		fmt.Fprintf(w, "colonized by %s  reserve: %d  shields: %d  turrets: %d\n", owner.PlayerName(), s.reserve, s.colonyShields, s.turrets)
+	}
+	if s.hazard.Active() {
+		fmt.Fprintf(w, "hazard: %s until %v\n", s.hazard.kind, s.hazard.until)
+	}
+	if d := s.dragon; d != nil {
+		fmt.Fprintf(w, "dragon: %s  hp: %d/%d  leaving in %v\n", d.name, d.hp, d.maxHp, d.leaving.Sub(clock.Now()).Truncate(time.Second))
+	}
+	if residue := s.Residue(); residue != "" {
+		fmt.Fprintf(w, "bombed with %s at %v\n", residue, s.lastBombAt)
+	}
+	occupants := s.Occupants()
+	fmt.Fprintf(w, "%d players:\n", len(occupants))
+	for conn, _ := range occupants {
+		fmt.Fprintf(w, "\t%-20s hull %d/%d  shield %d  docked %v\n", conn.PlayerName(), conn.hull, conn.MaxHull(), conn.shield, conn.docked)
+	}
+}
+
+func consoleConn(w io.Writer, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(w, "usage: conn [player]\n")
+		return
+	}
+	conn := findConnection(args[0])
+	if conn == nil {
+		fmt.Fprintf(w, "%s isn't connected\n", args[0])
+		return
+	}
+	fmt.Fprintf(w, "%s: %s client from %s, connected %v ago\n", conn.PlayerName(), conn.Transport(), conn.RemoteIP(), time.Since(conn.connectedAt).Truncate(time.Second))
+	protocol := conn.protocol
+	if protocol == "" {
+		protocol = P_Text
+	}
+	fmt.Fprintf(w, "protocol: %s  leaving: %v\n", protocol, conn.leaving)
+	fmt.Fprintf(w, "input buffered: %d bytes\n", conn.Reader.Buffered())
+	if conn.outbox != nil {
+		depth, peak, latency := conn.outbox.Stats()
+		fmt.Fprintf(w, "outbox: %d queued, %d peak, %v latency\n", depth, peak, latency)
+	}
+	location := "in transit"
+	if s := conn.System(); s != nil {
+		location = s.name
+	}
+	fmt.Fprintf(w, "location: %s  money: %d  hull: %d  shield: %d  bombs: %d\n", location, conn.money, conn.hull, conn.shield, conn.bombs)
+	if len(conn.cargo) > 0 {
+		fmt.Fprintf(w, "cargo: %v\n", conn.cargo)
+	}
+}
+
+func consoleDragons(w io.Writer, args []string) {
+	for d, _ := range dragons {
+		location := "in flight"
+		if d.system != nil {
+			location = d.system.name
+		}
+		fmt.Fprintf(w, "%-12s hp %d/%d  breath %d  %s\n", d.name, d.hp, d.maxHp, d.breath, location)
+	}
+	fmt.Fprintf(w, "%d dragons\n", len(dragons))
+}
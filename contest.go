@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type Contest struct {
+	system       *System
+	ends         time.Time
+	shipMinutes  map[*Corporation]int
+	participants map[*Connection]bool
+}
+
+var (
+	contest     *Contest
+	nextContest time.Time
+)
+
+func startContests() {
+	scheduleContest(2 * time.Hour)
+}
+
+func scheduleContest(delay time.Duration) {
+	nextContest = clock.Now().Add(delay)
+	AfterNamed(EV_Contest, delay, beginContest)
+}
+
+func beginContest() {
+	s, err := randomSystem()
+	if err != nil || s == nil {
+		log_error("unable to pick a contested system: %v", err)
+		scheduleContest(2 * time.Hour)
+		return
+	}
+	contest = &Contest{
+		system:       s,
+		ends:         clock.Now().Add(time.Hour),
+		shipMinutes:  make(map[*Corporation]int, 8),
+		participants: make(map[*Connection]bool, 16),
+	}
+	publishNews("%s has been declared a contested system for the next hour.  the corporation with the strongest presence wins a galaxy-wide bonus", s.name)
+	for conn, _ := range connected {
+		fmt.Fprintf(conn, "%s is now a contested system!\n", s.name)
+	}
+	After(time.Minute, contest.Tick)
+}
+
+func (c *Contest) Tick() {
+	c.system.EachConn(func(conn *Connection) {
+		c.participants[conn] = true
+		if corp := memberships[conn.PlayerName()]; corp != nil {
+			c.shipMinutes[corp]++
+		}
+	})
+	standings := c.Standings()
+	for conn, _ := range c.participants {
+		fmt.Fprintf(conn, "[contest] %s standings: %s\n", c.system.name, standings)
+	}
+	if clock.Now().Before(c.ends) {
+		After(time.Minute, c.Tick)
+		return
+	}
+	c.End()
+}
+
+func (c *Contest) Ranked() []*Corporation {
+	corps := make([]*Corporation, 0, len(c.shipMinutes))
+	for corp, _ := range c.shipMinutes {
+		corps = append(corps, corp)
+	}
+	sort.Slice(corps, func(i, j int) bool { return c.shipMinutes[corps[i]] > c.shipMinutes[corps[j]] })
+	return corps
+}
+
+func (c *Contest) Standings() string {
+	corps := c.Ranked()
+	if len(corps) == 0 {
+		return "(nobody)"
+	}
+	standings := ""
+	for i, corp := range corps {
+		if i > 0 {
+			standings += ", "
+		}
+		standings += fmt.Sprintf("%s %d", corp.name, c.shipMinutes[corp])
+	}
+	return standings
+}
+
+func (c *Contest) End() {
+	contest = nil
+	defer scheduleContest(2 * time.Hour)
+	corps := c.Ranked()
+	if len(corps) == 0 {
+		publishNews("nobody held %s.  the contest ends without a victor", c.system.name)
+		return
+	}
+	winner := corps[0]
+	winner.buffUntil = clock.Now().Add(2 * time.Hour)
+	publishNews("%s has won the contest for %s.  its members enjoy a 25%% mining bonus for 2 hours", winner.name, c.system.name)
+	winner.Notify("you've won the contest for %s!  mining pays 25%% more for the next 2 hours", c.system.name)
+	for conn, _ := range connected {
+		if memberships[conn.PlayerName()] == winner {
+			conn.Award(K_Title, "Baron of "+c.system.name)
+			conn.Award(K_Decal, "crown")
+		}
+	}
+}
+
+func (c *Corporation) Buffed() bool {
+	return clock.Now().Before(c.buffUntil)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	C_Defend  = "defend"
+	C_Destroy = "destroy"
+)
+
+type Contract struct {
+	id   int
+	kind string
+	// the pilots on either side, by name, since either may log off or be
+	// reconnected before the contract is settled
+	poster   string
+	taker    string
+	target   *System
+	reward   int64
+	hours    int
+	accepted time.Time
+	deadline time.Time
+}
+
+var (
+	contracts      = make(map[int]*Contract, 16)
+	nextContractId = 1
+)
+
+func (c *Contract) Job() string {
+	if c.kind == C_Defend {
+		return fmt.Sprintf("defend the colony on %s for %d hours", c.target.name, c.hours)
+	}
+	return fmt.Sprintf("destroy the colony on %s", c.target.name)
+}
+
+func (c *Contract) String() string {
+	status := "open"
+	if c.taker != "" {
+		status = "taken by " + c.taker
+	}
+	return fmt.Sprintf("#%-3d %-50s %6d duckets  posted by %s (%s)", c.id, c.Job(), c.reward, c.poster, status)
+}
+
+// pilot finds the live connection for a pilot, or a stand-in for one who's
+// offline, whose notices go to the mail.
+func pilot(name string) *Connection {
+	if conn := findConnection(name); conn != nil {
+		return conn
+	}
+	return offlineConnection(name)
+}
+
+// payOut pays a pilot out of escrow, whether or not they're online.  An
+// offline pilot's character is credited directly, and picks the money up
+// when they next log in.
+func payOut(name string, n int64) {
+	if conn := findConnection(name); conn != nil {
+		conn.Deposit(n)
+		return
+	}
+	if _, err := db.Exec(`update characters set money = money + ? where name = ?`, n, name); err != nil {
+		log_error("unable to pay %d space duckets to %s: %v", n, name, err)
+		return
+	}
+	recordMinted(n)
+}
+
+func (c *Contract) Complete() {
+	delete(contracts, c.id)
+	payOut(c.taker, c.reward)
+	taker := pilot(c.taker)
+	taker.Notice("contract #%d complete!  you've been paid %d space duckets.\n", c.id, c.reward)
+	if !taker.Offline() {
+		taker.AdjustRepute(10, "completing a contract")
+	}
+	pilot(c.poster).Notice("contract #%d has been fulfilled by %s\n", c.id, c.taker)
+	log_info("contract %d completed by %s", c.id, c.taker)
+}
+
+func (c *Contract) Fail(reason string) {
+	delete(contracts, c.id)
+	payOut(c.poster, c.reward)
+	pilot(c.poster).Notice("contract #%d failed: %s.  %d space duckets were returned from escrow.\n", c.id, reason, c.reward)
+	if c.taker != "" {
+		pilot(c.taker).Notice("contract #%d failed: %s\n", c.id, reason)
+	}
+}
+
+// checkContracts looks for destroy contracts fulfilled by a new activity.
+func checkContracts(a Activity) {
+	if a.kind != A_ColonyDestroyed {
+		return
+	}
+	for _, c := range contracts {
+		if c.kind == C_Destroy && c.target == a.system && c.taker != "" && c.taker == a.actor {
+			c.Complete()
+		}
+	}
+}
+
+var contractCommand = &Command{
+	name: "contract",
+	help: "mercenary contracts board.  usage:\n" +
+		"\tcontract list\n" +
+		"\tcontract post defend [system] [hours] [reward]\n" +
+		"\tcontract post destroy [system] [reward]\n" +
+		"\tcontract accept [id]\n" +
+		"\tcontract cancel [id]",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			args = []string{"list"}
+		}
+		switch args[0] {
+		case "list":
+			if len(contracts) == 0 {
+				fmt.Fprintf(conn, "the contracts board is empty.\n")
+				return
+			}
+			for id := 1; id < nextContractId; id++ {
+				if c, ok := contracts[id]; ok {
+					fmt.Fprintf(conn, "%v\n", c)
+				}
+			}
+		case "post":
+			postContract(conn, args[1:]...)
+		case "accept":
+			c := findContract(conn, args[1:])
+			if c == nil {
+				return
+			}
+			if c.taker != "" {
+				fmt.Fprintf(conn, "contract #%d has already been taken\n", c.id)
+				return
+			}
+			if c.poster == conn.PlayerName() {
+				fmt.Fprintf(conn, "you can't take your own contract.\n")
+				return
+			}
+			c.taker = conn.PlayerName()
+			c.accepted = clock.Now()
+			fmt.Fprintf(conn, "accepted contract #%d\n", c.id)
+			pilot(c.poster).Notice("%s has accepted contract #%d\n", c.taker, c.id)
+			if c.kind == C_Defend {
+				c.deadline = c.accepted.Add(time.Duration(c.hours) * time.Hour)
+			}
+			At(c.deadline, func() {
+				if contracts[c.id] != c {
+					return
+				}
+				if c.kind == C_Destroy || c.taker == "" {
+					c.Fail("the deadline passed")
+					return
+				}
+				if findActivity(A_ColonyDestroyed, c.target, c.accepted) != nil {
+					c.Fail(fmt.Sprintf("the colony on %s was destroyed", c.target.name))
+					return
+				}
+				c.Complete()
+			})
+		case "cancel":
+			c := findContract(conn, args[1:])
+			if c == nil {
+				return
+			}
+			if c.poster != conn.PlayerName() {
+				fmt.Fprintf(conn, "contract #%d isn't yours to cancel\n", c.id)
+				return
+			}
+			if c.taker != "" {
+				fmt.Fprintf(conn, "contract #%d has already been taken by %s\n", c.id, c.taker)
+				return
+			}
+			c.Fail("cancelled")
+		default:
+			fmt.Fprintf(conn, "no such contract subcommand: %s\n", args[0])
+		}
+	},
+}
+
+func findContract(conn *Connection, args []string) *Contract {
+	if len(args) != 1 {
+		fmt.Fprintf(conn, "you need to specify a contract id\n")
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(conn, "that's not a contract id: %s\n", args[0])
+		return nil
+	}
+	c, ok := contracts[id]
+	if !ok {
+		fmt.Fprintf(conn, "there's no contract #%d\n", id)
+		return nil
+	}
+	return c
+}
+
+func postContract(conn *Connection, args ...string) {
+	if len(args) < 3 {
+		fmt.Fprintf(conn, "usage: contract post defend [system] [hours] [reward] | contract post destroy [system] [reward]\n")
+		return
+	}
+	c := &Contract{kind: args[0], poster: conn.PlayerName()}
+	var amount []string
+	switch c.kind {
+	case C_Defend:
+		if len(args) != 4 {
+			fmt.Fprintf(conn, "usage: contract post defend [system] [hours] [reward]\n")
+			return
+		}
+		hours, err := strconv.Atoi(args[2])
+		if err != nil || hours < 1 || hours > 24 {
+			fmt.Fprintf(conn, "defense contracts last between 1 and 24 hours\n")
+			return
+		}
+		c.hours = hours
+		amount = args[3:]
+	case C_Destroy:
+		amount = args[2:]
+	default:
+		fmt.Fprintf(conn, "contracts are either defend or destroy jobs, not %s\n", c.kind)
+		return
+	}
+	c.target = lookupSystem(args[1])
+	if c.target == nil {
+		fmt.Fprintf(conn, "no such system: %s\n", args[1])
+		return
+	}
+	if c.target.Colonizer() == nil {
+		fmt.Fprintf(conn, "there's no colony on %s\n", c.target.name)
+		return
+	}
+	n, ok := parseAmount(conn, amount)
+	if !ok {
+		return
+	}
+	if conn.money < n {
+		fmt.Fprintf(conn, "you only have %d space duckets to put in escrow\n", conn.money)
+		return
+	}
+	conn.Withdraw(n)
+	c.reward = n
+	c.id = nextContractId
+	nextContractId++
+	c.deadline = clock.Now().Add(24 * time.Hour)
+	contracts[c.id] = c
+	fmt.Fprintf(conn, "posted contract #%d.  %d space duckets are held in escrow.\n", c.id, n)
+	publishNews("%s is offering %d space duckets to %s", conn.PlayerName(), n, c.Job())
+	At(c.deadline, func() {
+		if contracts[c.id] == c && c.taker == "" {
+			c.Fail("nobody took the job")
+		}
+	})
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Permission uint
+
+const (
+	P_Deposit Permission = 1 << iota
+	P_Withdraw
+	P_Invite
+	P_Kick
+	P_Promote
+	P_Colony
+)
+
+var permissionNames = map[string]Permission{
+	"deposit":  P_Deposit,
+	"withdraw": P_Withdraw,
+	"invite":   P_Invite,
+	"kick":     P_Kick,
+	"promote":  P_Promote,
+	"colony":   P_Colony,
+}
+
+const (
+	R_Member   = "member"
+	R_Director = "director"
+	R_CEO      = "ceo"
+)
+
+type Corporation struct {
+	name     string
+	treasury int64
+	members  map[string]string
+	invites  map[string]bool
+	roles    map[string]Permission
+
+	buffUntil time.Time
+}
+
+var (
+	corporations = make(map[string]*Corporation, 16)
+	memberships  = make(map[string]*Corporation, 64)
+)
+
+func NewCorporation(name string, founder *Connection) *Corporation {
+	corp := &Corporation{
+		name:    name,
+		members: map[string]string{founder.PlayerName(): R_CEO},
+		invites: make(map[string]bool, 4),
+		roles: map[string]Permission{
+			R_Member:   P_Deposit,
+			R_Director: P_Deposit | P_Withdraw | P_Invite | P_Kick | P_Colony,
+			R_CEO:      P_Deposit | P_Withdraw | P_Invite | P_Kick | P_Promote | P_Colony,
+		},
+	}
+	corporations[name] = corp
+	memberships[founder.PlayerName()] = corp
+	return corp
+}
+
+func (c *Corporation) Can(name string, p Permission) bool {
+	role, ok := c.members[name]
+	if !ok {
+		return false
+	}
+	return c.roles[role]&p != 0
+}
+
+func (c *Corporation) Notify(template string, args ...interface{}) {
+	for conn, _ := range connected {
+		if _, ok := c.members[conn.PlayerName()]; ok {
+			fmt.Fprintf(conn, "[%s] %s\n", c.name, fmt.Sprintf(template, args...))
+		}
+	}
+}
+
+func (c *Corporation) Remove(name string) {
+	delete(c.members, name)
+	delete(memberships, name)
+	if len(c.members) > 0 {
+		return
+	}
+	for _, system := range allSystems() {
+		if system.corp == c {
+			system.corp = nil
+		}
+	}
+	for c.AtWar() {
+		for _, w := range wars {
+			if w.Involves(c) {
+				endWar(w)
+				break
+			}
+		}
+	}
+	delete(corporations, c.name)
+}
+
+func (c *Corporation) Deposit(n int64) {
+	c.treasury += n
+}
+
+type corpSubcommand func(*Connection, *Corporation, ...string)
+
+var corpSubcommands map[string]corpSubcommand
+
+var corpCommand = &Command{
+	name:   "corp",
+	help:   "manages corporations.  subcommands: create, info, invite, join, leave, kick, promote, deposit, withdraw, colony, grant, revoke, war, supply, peace",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			args = []string{"info"}
+		}
+		corp := memberships[conn.PlayerName()]
+		switch args[0] {
+		case "create":
+			corpCreate(conn, args[1:]...)
+			return
+		case "join":
+			corpJoin(conn, args[1:]...)
+			return
+		}
+		fn, ok := corpSubcommands[args[0]]
+		if !ok {
+			fmt.Fprintf(conn, "no such corp subcommand: %s\n", args[0])
+			return
+		}
+		if corp == nil {
+			fmt.Fprintf(conn, "you're not in a corporation.\n")
+			return
+		}
+		fn(conn, corp, args[1:]...)
+	},
+}
+
+func corpCreate(conn *Connection, args ...string) {
+	name := strings.Join(args, " ")
+	if !ValidName(name) {
+		fmt.Fprintf(conn, "that corporation name is illegal.\n")
+		return
+	}
+	if memberships[conn.PlayerName()] != nil {
+		fmt.Fprintf(conn, "you're already in a corporation.\n")
+		return
+	}
+	if _, ok := corporations[name]; ok {
+		fmt.Fprintf(conn, "there's already a corporation called %s\n", name)
+		return
+	}
+	if conn.money < 5000 {
+		fmt.Fprintf(conn, "not enough money!  it costs 5000 duckets to charter a corporation\n")
+		return
+	}
+	conn.Withdraw(5000)
+	NewCorporation(name, conn)
+	fmt.Fprintf(conn, "chartered the corporation %s.  you are its ceo.\n", name)
+	publishNews("a new corporation, %s, has been chartered by %s", name, conn.PlayerName())
+}
+
+func corpJoin(conn *Connection, args ...string) {
+	name := strings.Join(args, " ")
+	corp, ok := corporations[name]
+	if !ok {
+		fmt.Fprintf(conn, "no such corporation: %s\n", name)
+		return
+	}
+	if memberships[conn.PlayerName()] != nil {
+		fmt.Fprintf(conn, "you're already in a corporation.\n")
+		return
+	}
+	if !corp.invites[conn.PlayerName()] {
+		fmt.Fprintf(conn, "you haven't been invited to %s\n", name)
+		return
+	}
+	delete(corp.invites, conn.PlayerName())
+	corp.members[conn.PlayerName()] = R_Member
+	memberships[conn.PlayerName()] = corp
+	corp.Notify("%s has joined the corporation", conn.PlayerName())
+}
+
+func corpInfo(conn *Connection, corp *Corporation, args ...string) {
+	fmt.Fprintf(conn, "corporation: %s\n", corp.name)
+	fmt.Fprintf(conn, "treasury: %d space duckets\n", corp.treasury)
+	names := make([]string, 0, len(corp.members))
+	for name, _ := range corp.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(conn, "\t%-20s %s\n", name, corp.members[name])
+	}
+	atWar := corp.AtWar()
+	for _, system := range allSystems() {
+		if system.corp != corp {
+			continue
+		}
+		if atWar {
+			fmt.Fprintf(conn, "\tcolony on %s (supply %d)\n", system.name, system.supply)
+		} else {
+			fmt.Fprintf(conn, "\tcolony on %s\n", system.name)
+		}
+	}
+}
+
+func corpInvite(conn *Connection, corp *Corporation, args ...string) {
+	if !corp.Can(conn.PlayerName(), P_Invite) {
+		fmt.Fprintf(conn, "you don't have permission to invite members.\n")
+		return
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(conn, "usage: corp invite [player-name]\n")
+		return
+	}
+	corp.invites[args[0]] = true
+	corp.Notify("%s has invited %s", conn.PlayerName(), args[0])
+	if other := findConnection(args[0]); other != nil {
+		fmt.Fprintf(other, "you have been invited to join %s.  use \"corp join %s\" to accept.\n", corp.name, corp.name)
+	}
+}
+
+func corpLeave(conn *Connection, corp *Corporation, args ...string) {
+	if corp.members[conn.PlayerName()] == R_CEO && len(corp.members) > 1 {
+		fmt.Fprintf(conn, "you're the ceo.  hand the corporation over with \"corp promote [player-name] ceo\" before you leave.\n")
+		return
+	}
+	corp.Notify("%s has left the corporation", conn.PlayerName())
+	corp.Remove(conn.PlayerName())
+}
+
+func corpKick(conn *Connection, corp *Corporation, args ...string) {
+	if !corp.Can(conn.PlayerName(), P_Kick) {
+		fmt.Fprintf(conn, "you don't have permission to kick members.\n")
+		return
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(conn, "usage: corp kick [player-name]\n")
+		return
+	}
+	role, ok := corp.members[args[0]]
+	if !ok {
+		fmt.Fprintf(conn, "%s isn't a member of %s\n", args[0], corp.name)
+		return
+	}
+	if role == R_CEO {
+		fmt.Fprintf(conn, "you can't kick the ceo.\n")
+		return
+	}
+	corp.Notify("%s has been kicked out by %s", args[0], conn.PlayerName())
+	corp.Remove(args[0])
+}
+
+func corpPromote(conn *Connection, corp *Corporation, args ...string) {
+	if !corp.Can(conn.PlayerName(), P_Promote) {
+		fmt.Fprintf(conn, "you don't have permission to change roles.\n")
+		return
+	}
+	if len(args) != 2 {
+		fmt.Fprintf(conn, "usage: corp promote [player-name] [member|director|ceo]\n")
+		return
+	}
+	role, ok := corp.members[args[0]]
+	if !ok {
+		fmt.Fprintf(conn, "%s isn't a member of %s\n", args[0], corp.name)
+		return
+	}
+	if _, ok := corp.roles[args[1]]; !ok {
+		fmt.Fprintf(conn, "no such role: %s\n", args[1])
+		return
+	}
+	// there's always exactly one ceo, and the only way to stop being it is
+	// to hand it to someone else
+	if role == R_CEO {
+		fmt.Fprintf(conn, "the ceo stays the ceo until they hand the corporation over.\n")
+		return
+	}
+	if args[1] == R_CEO {
+		if corp.members[conn.PlayerName()] != R_CEO {
+			fmt.Fprintf(conn, "only the ceo can name a new ceo.\n")
+			return
+		}
+		corp.members[conn.PlayerName()] = R_Director
+	}
+	corp.members[args[0]] = args[1]
+	corp.Notify("%s is now a %s", args[0], args[1])
+}
+
+func corpDeposit(conn *Connection, corp *Corporation, args ...string) {
+	if !corp.Can(conn.PlayerName(), P_Deposit) {
+		fmt.Fprintf(conn, "you don't have permission to make deposits.\n")
+		return
+	}
+	n, ok := parseAmount(conn, args)
+	if !ok {
+		return
+	}
+	if conn.money < n {
+		fmt.Fprintf(conn, "you only have %d space duckets\n", conn.money)
+		return
+	}
+	conn.Withdraw(n)
+	corp.Deposit(n)
+	corp.Notify("%s deposited %d space duckets.  treasury: %d", conn.PlayerName(), n, corp.treasury)
+}
+
+func corpWithdraw(conn *Connection, corp *Corporation, args ...string) {
+	if !corp.Can(conn.PlayerName(), P_Withdraw) {
+		fmt.Fprintf(conn, "you don't have permission to make withdrawals.\n")
+		return
+	}
+	n, ok := parseAmount(conn, args)
+	if !ok {
+		return
+	}
+	if corp.treasury < n {
+		fmt.Fprintf(conn, "the treasury only holds %d space duckets\n", corp.treasury)
+		return
+	}
+	corp.treasury -= n
+	corp.Notify("%s withdrew %d space duckets.  treasury: %d", conn.PlayerName(), n, corp.treasury)
+	conn.Deposit(n)
+}
+
+func corpColony(conn *Connection, corp *Corporation, args ...string) {
+	if !corp.Can(conn.PlayerName(), P_Colony) {
+		fmt.Fprintf(conn, "you don't have permission to manage corporate colonies.\n")
+		return
+	}
+	system := conn.System()
+	if system == nil || system.Colonizer() != conn {
+		fmt.Fprintf(conn, "you need to be at one of your own colonies to sign it over.\n")
+		return
+	}
+	system.corp = corp
+	corp.Notify("%s signed over the colony on %s", conn.PlayerName(), system.name)
+}
+
+func corpGrant(conn *Connection, corp *Corporation, args ...string) {
+	corpSetPermission(conn, corp, true, args...)
+}
+
+func corpRevoke(conn *Connection, corp *Corporation, args ...string) {
+	corpSetPermission(conn, corp, false, args...)
+}
+
+func corpSetPermission(conn *Connection, corp *Corporation, grant bool, args ...string) {
+	if corp.members[conn.PlayerName()] != R_CEO {
+		fmt.Fprintf(conn, "only the ceo can change role permissions.\n")
+		return
+	}
+	if len(args) != 2 {
+		fmt.Fprintf(conn, "usage: corp grant|revoke [role] [permission]\n")
+		return
+	}
+	perms, ok := corp.roles[args[0]]
+	if !ok || args[0] == R_CEO {
+		fmt.Fprintf(conn, "can't change permissions for role: %s\n", args[0])
+		return
+	}
+	p, ok := permissionNames[args[1]]
+	if !ok {
+		fmt.Fprintf(conn, "no such permission: %s\n", args[1])
+		return
+	}
+	if grant {
+		corp.roles[args[0]] = perms | p
+		corp.Notify("the %s role can now %s", args[0], args[1])
+	} else {
+		corp.roles[args[0]] = perms &^ p
+		corp.Notify("the %s role can no longer %s", args[0], args[1])
+	}
+}
+
+func parseAmount(conn *Connection, args []string) (int64, bool) {
+	if len(args) != 1 {
+		fmt.Fprintf(conn, "you need to specify an amount\n")
+		return 0, false
+	}
+	n, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || n < 1 {
+		fmt.Fprintf(conn, "that's not an amount: %s\n", args[0])
+		return 0, false
+	}
+	return n, true
+}
+
+func init() {
+	corpSubcommands = map[string]corpSubcommand{
+		"info":     corpInfo,
+		"invite":   corpInvite,
+		"leave":    corpLeave,
+		"kick":     corpKick,
+		"promote":  corpPromote,
+		"deposit":  corpDeposit,
+		"withdraw": corpWithdraw,
+		"colony":   corpColony,
+		"grant":    corpGrant,
+		"revoke":   corpRevoke,
+		"war":      corpWar,
+		"supply":   corpSupply,
+		"peace":    corpPeace,
+	}
+}
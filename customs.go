@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+type Sector struct {
+	x, y, z int
+}
+
+var sectorLaws = make(map[Sector]map[string]bool, 64)
+
+func (s *System) Sector() Sector {
+	return Sector{
+		x: int(math.Floor(s.x / 100)),
+		y: int(math.Floor(s.y / 100)),
+		z: int(math.Floor(s.z / 100)),
+	}
+}
+
+func (s *System) Prohibits(g *Good) bool {
+	if !g.contraband {
+		return false
+	}
+	sector := s.Sector()
+	laws, ok := sectorLaws[sector]
+	if !ok {
+		laws = make(map[string]bool, len(goods))
+		for name, good := range goods {
+			laws[name] = good.contraband && rand.Float64() < 0.5
+		}
+		sectorLaws[sector] = laws
+	}
+	return laws[g.name]
+}
+
+func (s *System) CustomsCheck(p *Connection) {
+	if s.arena {
+		return
+	}
+	chance := 0.3
+	if p.silent {
+		chance = 0.1
+	}
+	if rand.Float64() >= chance {
+		return
+	}
+	for name, n := range p.cargo {
+		g := goods[name]
+		if !s.Prohibits(g) {
+			continue
+		}
+		if rand.Intn(2) == 0 {
+			fine := s.Price(g) * int64(n) / 2
+			if fine > p.money {
+				fine = p.money
+			}
+			p.Withdraw(fine)
+			fmt.Fprintf(p, "customs agents in %s find %d %s in your hold and fine you %d space duckets.\n", s.name, n, g.name, fine)
+		} else {
+			p.AddCargo(g, -n)
+			fmt.Fprintf(p, "customs agents in %s confiscate %d %s from your hold.\n", s.name, n, g.name)
+		}
+		log_info("customs caught player %s with %d %s in %s", p.PlayerName(), n, g.name, s.name)
+	}
+}
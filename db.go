@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"os"
 )
@@ -30,6 +31,9 @@ func planetsTable() {
 	if _, err := db.Exec(stmnt); err != nil {
 		log_error("couldn't create planets table: %v", err)
 	}
+	addColumn("planets", "ore", "real not null default -1")
+	addColumn("planets", "gas", "real not null default -1")
+	addColumn("planets", "crystal", "real not null default -1")
 }
 
 func planetsData() {
@@ -43,13 +47,14 @@ func planetsData() {
 		if err != nil {
 			bail(E_No_Data, "unable to open data path: %v", err)
 		}
-		c := make(chan System)
+		c := make(chan *System)
 		go speckStream(fi, c)
 		for planet := range c {
 			planet.Store(db)
 		}
 	}
 	indexSystems()
+	seedHazards()
 }
 
 func edgesTable() {
@@ -63,11 +68,54 @@ func edgesTable() {
 	}
 }
 
+func addColumn(table, column, def string) {
+	rows, err := db.Query(`select name from pragma_table_info(?)`, table)
+	if err != nil {
+		log_error("couldn't read columns of %s: %v", table, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil && name == column {
+			return
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf(`alter table %s add column %s %s;`, table, column, def)); err != nil {
+		log_error("couldn't add column %s to %s: %v", column, table, err)
+	}
+}
+
 func setupDb() {
 	planetsTable()
+	coloniesTable()
 	planetsData()
 	edgesTable()
 	playersTable()
+	charactersTable()
+	memorialTable()
+	titlesTable()
+	alliancesTable()
+	challengesTable()
+	pendingEventsTable()
+	promoteAdmins()
+	recoveryTable()
+	mailTable()
+	reportsTable()
+	auditTable()
+	signupsTable()
+	tradesTable()
+	cargoTable()
+	armoryTable()
+	bountiesTable()
+	missionsTable()
+	researchTable()
+	oauthTable()
+	federationTable()
+	registryTable()
+	killsTable()
+	arenaTable()
+	eventsTable()
 	fillEdges()
 }
 
@@ -81,21 +129,22 @@ func fillEdges() {
 	if n > 0 {
 		return
 	}
-	for i := 0; i < len(index); i++ {
-		for j := 0; j < len(index); j++ {
+	n = systemCount()
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
 			if i == j {
 				continue
 			}
-			if index[i] == nil {
+			if systemById(i) == nil {
 				log_error("wtf there's nil shit in here for id %d", i)
 				continue
 			}
-			if index[j] == nil {
+			if systemById(j) == nil {
 				log_error("wtf there's nil shit in here 2 for id %d", j)
 				continue
 			}
-			dist := index[i].DistanceTo(index[j])
-			log_info("distance from %s to %s: %v", index[i].name, index[j].name, dist)
+			dist := systemById(i).DistanceTo(systemById(j))
+			log_info("distance from %s to %s: %v", systemById(i).name, systemById(j).name, dist)
 			_, err := db.Exec(`
                 insert into edges
                 (id_1, id_2, distance)
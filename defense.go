@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Colonies keep a share of what they mine in a reserve on the planet.  The
+// reserve pays for defenses: shield charges that soak up bomb strikes and
+// turrets that try to shoot bombs down before they land.
+const (
+	colonyReserveShare = 10
+	colonyShieldCost   = 400
+	colonyTurretCost   = 600
+	maxColonyShields   = 3
+	maxColonyTurrets   = 3
+	turretHitChance    = 0.2
+)
+
+// Defend gives a colony's defenses a chance to stop a bomb.  It reports
+// whether the colony survived.
+func (s *System) Defend(class *BombClass, yield int) bool {
+	owner := s.Colonizer()
+	out := ResolveColonyDefense(ColonyDefense{
+		Turrets:  s.turrets,
+		Shields:  s.colonyShields,
+		Piercing: class.piercing,
+		EMP:      class.emp,
+		Yield:    yield,
+	}, dice)
+	if out.ShotDown {
+		owner.Notice("turrets on your colony at %s shot down an incoming %s bomb!\n", s.name, class.name)
+		return true
+	}
+	if !out.Absorbed && !out.Pulsed && !out.Buckled {
+		return false
+	}
+	s.colonyShields = out.Shields
+	switch {
+	case out.Pulsed:
+		owner.Notice("an electromagnetic pulse knocked out the planetary shields on %s!\n", s.name)
+	case out.Buckled:
+		owner.Notice("the planetary shields on %s buckled under a %s bomb!\n", s.name, class.name)
+	default:
+		owner.Notice("the planetary shields on %s absorbed a %s bomb.  shield charges left: %d\n", s.name, class.name, s.colonyShields)
+	}
+	s.SaveColony()
+	return out.Survived()
+}
+
+var fortifyCommand = &Command{
+	name: "fortify",
+	help: "spends your colony's mining reserve on defenses.  you have to be at the colony.  usage:\n" +
+		"\tfortify          (shows the colony's defenses)\n" +
+		"\tfortify shield   (a planetary shield charge, absorbs a bomb strike)\n" +
+		"\tfortify turret   (a defense turret, may shoot down incoming bombs)",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if system.Colonizer() != conn {
+			fmt.Fprintf(conn, "you don't have a colony on %s\n", system.name)
+			return
+		}
+		if len(args) == 0 {
+			fmt.Fprintf(conn, "colony on %s\n", system.name)
+			fmt.Fprintf(conn, "\treserve: %d duckets\n", system.reserve)
+			fmt.Fprintf(conn, "\tshield charges: %d/%d (%d each)\n", system.colonyShields, maxColonyShields, colonyShieldCost)
+			fmt.Fprintf(conn, "\tturrets: %d/%d (%d each)\n", system.turrets, maxColonyTurrets, colonyTurretCost)
+			return
+		}
+		var cost int64
+		switch args[0] {
+		case "shield":
+			if system.colonyShields >= maxColonyShields {
+				fmt.Fprintf(conn, "the planetary shields on %s are fully charged\n", system.name)
+				return
+			}
+			cost = colonyShieldCost
+		case "turret":
+			if system.turrets >= maxColonyTurrets {
+				fmt.Fprintf(conn, "there's no room for more turrets on %s\n", system.name)
+				return
+			}
+			cost = colonyTurretCost
+		default:
+			fmt.Fprintf(conn, "no such defense: %s\n", args[0])
+			return
+		}
+		if system.reserve < cost {
+			fmt.Fprintf(conn, "not enough in the colony reserve!  a %s costs %d, the reserve has %d\n", args[0], cost, system.reserve)
+			return
+		}
+		system.reserve -= cost
+		if args[0] == "shield" {
+			system.colonyShields++
+		} else {
+			system.turrets++
+		}
+		system.SaveColony()
+		fmt.Fprintf(conn, "built a %s on %s.  reserve: %d duckets\n", args[0], system.name, system.reserve)
+	},
+}
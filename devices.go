@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Transport names the kind of client on the other end of the connection.
+func (c *Connection) Transport() string {
+	switch c.rw.(type) {
+	case *WebSocket:
+		return "web"
+	default:
+		return "terminal"
+	}
+}
+
+// Sessions lists every live connection signed in to the account, oldest
+// first.
+func (p *Player) Sessions() []*Connection {
+	sessions := make([]*Connection, 0, 2)
+	for conn, _ := range connected {
+		if conn.player != nil && conn.player.id == p.id {
+			sessions = append(sessions, conn)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].connectedAt.Before(sessions[j].connectedAt) })
+	return sessions
+}
+
+// Kick forces a session off the server once it has been told why.  Its read
+// loop sees the connection drop and cleans up after it.
+func (c *Connection) Kick(reason string) {
+	fmt.Fprintf(c, "%s\n", reason)
+	c.leaving = true
+	c.closeOutbox()
+	if closer, ok := c.rw.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+var sessionsCommand = &Command{
+	name: "sessions",
+	help: "lists the devices signed in to your account and lets you sign them out.  usage:\n" +
+		"\tsessions\n" +
+		"\tsessions logout [number|others]",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		sessions := conn.player.Sessions()
+		if len(args) == 0 {
+			for i, other := range sessions {
+				this := ""
+				if other == conn {
+					this = "  (this session)"
+				}
+				ip := other.RemoteIP()
+				if ip == "" {
+					ip = "unknown address"
+				}
+				fmt.Fprintf(conn, "%d. %-20s %-8s %-16s connected %v ago%s\n", i+1, other.PlayerName(), other.Transport(), ip, time.Since(other.connectedAt).Truncate(time.Second), this)
+			}
+			return
+		}
+		if len(args) != 2 || args[0] != "logout" {
+			fmt.Fprintf(conn, "usage: sessions logout [number|others]\n")
+			return
+		}
+		var targets []*Connection
+		if args[1] == "others" {
+			for _, other := range sessions {
+				if other != conn {
+					targets = append(targets, other)
+				}
+			}
+		} else {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 || n > len(sessions) {
+				fmt.Fprintf(conn, "there's no session %s.  see \"sessions\" for the list\n", args[1])
+				return
+			}
+			if sessions[n-1] == conn {
+				fmt.Fprintf(conn, "that's this session.  use \"logout\" instead\n")
+				return
+			}
+			targets = append(targets, sessions[n-1])
+		}
+		for _, other := range targets {
+			log_info("%s signed out session for %s from %s", conn.PlayerName(), other.PlayerName(), other.RemoteIP())
+			other.Kick("this session was signed out from another device.")
+		}
+		switch len(targets) {
+		case 0:
+			fmt.Fprintf(conn, "there are no other sessions.\n")
+		case 1:
+			fmt.Fprintf(conn, "signed out 1 session.\n")
+		default:
+			fmt.Fprintf(conn, "signed out %d sessions.\n", len(targets))
+		}
+	},
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Dragons roam the galaxy on their own, a few systems at a time.  They
+// linger wherever they land, breathing fire on any ship that isn't docked
+// and on any colony that can't keep them off, then move on.  Unlike the
+// guardians of a nest they don't wait to be provoked.
+type Dragon struct {
+	name   string
+	elder  bool
+	hp     int
+	maxHp  int
+	breath int
+
+	system  *System
+	leaving time.Time
+	damage  map[*Connection]int
+	hits    map[*Connection]time.Time
+}
+
+func (d *Dragon) String() string {
+	if d.elder {
+		return "the elder dragon " + d.name
+	}
+	return "the dragon " + d.name
+}
+
+var dragonNames = []string{
+	"Vermithrax", "Smaug", "Ancalagon", "Glaurung", "Bahamut", "Tiamat",
+	"Fafnir", "Nidhogg", "Jormungandr", "Balerion", "Vhagar", "Meraxes",
+}
+
+var dragons = make(map[*Dragon]bool, 4)
+
+const (
+	// how long a dragon stays in a system before moving on
+	dragonMinStay = 2 * time.Minute
+	dragonMaxStay = 5 * time.Minute
+	// how often it breathes fire while it's there
+	dragonAttackRate = 15 * time.Second
+	// dragons are slower than ships
+	dragonSlowness = 3
+	// how far a dragon will fly in one hop, as the nth nearest system
+	dragonRange = 6
+)
+
+var dragonCount = envInt("EXO_DRAGONS", 3)
+
+func startDragons() {
+	for i := 0; i < dragonCount; i++ {
+		spawnDragon()
+	}
+	spawnElder()
+}
+
+func spawnDragon() {
+	hatch(false)
+}
+
+func hatch(elder bool) {
+	for i := 0; i < 20; i++ {
+		s, err := randomSystem()
+		if err != nil || s == nil || s.arena || s.dragon != nil || s.HighSec() {
+			continue
+		}
+		hp := int(200 + 100*s.ThreatLevel())
+		breath := int(15 + 5*s.ThreatLevel())
+		if elder {
+			hp, breath = hp*elderToughness, breath*2
+		}
+		d := &Dragon{
+			name:   dragonNames[rand.Intn(len(dragonNames))],
+			elder:  elder,
+			hp:     hp,
+			maxHp:  hp,
+			breath: breath,
+			damage: make(map[*Connection]int, 4),
+			hits:   make(map[*Connection]time.Time, 4),
+		}
+		dragons[d] = true
+		log_info("%s has hatched in %s", d, s.name)
+		d.Land(s)
+		return
+	}
+}
+
+func (d *Dragon) Alive() bool {
+	return d.hp > 0
+}
+
+// Land brings the dragon into a system and starts it rampaging.
+func (d *Dragon) Land(s *System) {
+	if s.dragon != nil {
+		// somebody's already here; keep flying
+		d.system = s
+		d.Migrate()
+		return
+	}
+	d.system = s
+	s.dragon = d
+	d.leaving = clock.Now().Add(dragonMinStay + time.Duration(rand.Int63n(int64(dragonMaxStay-dragonMinStay))))
+	s.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "%s descends on %s!\n", d, s.name)
+	})
+	AfterNamed(EV_Dragon, dragonAttackRate/3, d.Rampage).Describe("dragon %s attacks %s", d.name, s.name)
+}
+
+// Rampage is the dragon's turn in the system it's in: fire on every ship
+// that's out in the open and on the colony, if there is one.
+func (d *Dragon) Rampage() {
+	s := d.system
+	if !d.Alive() || s == nil || s.dragon != d {
+		return
+	}
+	if !clock.Now().Before(d.leaving) {
+		d.Migrate()
+		return
+	}
+	if d.elder {
+		d.Regenerate()
+	}
+	s.EachConn(func(conn *Connection) {
+		if conn.docked || conn.dead {
+			return
+		}
+		fmt.Fprintf(conn, "%s breathes fire on you!\n", d.name)
+		conn.Damage(d.breath, nil, W_Dragon)
+	})
+	if s.Colonizer() != nil {
+		d.AttackColony()
+	}
+	AfterNamed(EV_Dragon, dragonAttackRate, d.Rampage).Describe("dragon %s attacks %s", d.name, s.name)
+}
+
+// AttackColony lets the colony's turrets have a go at the dragon, then its
+// shields soak up the fire if they can.  An undefended colony burns.
+func (d *Dragon) AttackColony() {
+	s := d.system
+	owner := s.Colonizer()
+	for i := 0; i < s.turrets; i++ {
+		if rand.Float64() < turretHitChance {
+			d.hp -= 25
+		}
+	}
+	if !d.Alive() {
+		owner.Notice("turrets on your colony at %s brought down %s!\n", s.name, d)
+		d.Slain()
+		return
+	}
+	if s.colonyShields > 0 {
+		s.colonyShields--
+		owner.Notice("the planetary shields on %s held off %s.  shield charges left: %d\n", s.name, d, s.colonyShields)
+		s.SaveColony()
+		return
+	}
+	log_info("%s destroyed the colony on %s", d, s.name)
+	s.DestroyColony()
+	s.Scorch(20 * time.Minute)
+}
+
+// Migrate sends the dragon off toward one of the systems near the one it's
+// in.  It's nowhere while it's flying.
+func (d *Dragon) Migrate() {
+	from := d.system
+	neighbors, err := from.Nearby(dragonRange)
+	if err != nil || len(neighbors) == 0 {
+		d.leaving = clock.Now().Add(dragonMinStay)
+		AfterNamed(EV_Dragon, dragonAttackRate, d.Rampage).Describe("dragon %s attacks %s", d.name, from.name)
+		return
+	}
+	to := systemById(neighbors[rand.Intn(len(neighbors))].id)
+	if from.dragon == d {
+		from.dragon = nil
+		from.EachConn(func(conn *Connection) {
+			fmt.Fprintf(conn, "%s spreads its wings and leaves %s.\n", d, from.name)
+		})
+	}
+	d.system = nil
+	d.damage = make(map[*Connection]int, 4)
+	d.hits = make(map[*Connection]time.Time, 4)
+	delay := from.TravelTimeTo(to) * dragonSlowness
+	log_info("%s is flying from %s to %s", d, from.name, to.name)
+	AfterNamed(EV_Dragon, delay, func() { d.Land(to) }).Describe("dragon %s flying from %s to %s", d.name, from.name, to.name)
+}
+
+// Slain takes the dragon out of the galaxy and pays whoever hurt it.  A new
+// one hatches somewhere else after a while.  Elders share out their hoard
+// instead; see elder.go.
+func (d *Dragon) Slain() {
+	s := d.system
+	if s != nil && s.dragon == d {
+		s.dragon = nil
+	}
+	delete(dragons, d)
+	log_info("%s was slain in %s", d, s.name)
+	for conn, _ := range d.damage {
+		conn.MissionDragonSlain()
+	}
+	if d.elder {
+		d.ShareHoard()
+		After(elderRespawn, spawnElder)
+		return
+	}
+	publishNews("the dragon %s has been slain in %s", d.name, s.name)
+	if top := d.TopAttacker(); top != nil && rand.Float64() < eggChance {
+		dropEgg(top, d)
+	}
+	for conn, dmg := range d.damage {
+		if conn.dead || conn.System() != s {
+			continue
+		}
+		bones := conn.Stow(goods["dragonbone"], 1+dmg/40)
+		loot := int64(5 * dmg)
+		fmt.Fprintf(conn, "you carve %d dragonbone from %s and collect a %d ducket bounty.\n", bones, d.name, loot)
+		conn.Deposit(loot)
+		conn.AdjustReputation(dragonCultists, -10)
+		conn.AdjustRepute(5, "slaying "+d.name)
+		conn.Award(K_Title, "Dragonslayer")
+	}
+	After(30*time.Minute, spawnDragon)
+}
+
+// TopAttacker is whoever did the dragon the most harm and is still around.
+func (d *Dragon) TopAttacker() *Connection {
+	var top *Connection
+	for conn, dmg := range d.damage {
+		if conn.dead || conn.System() != d.system {
+			continue
+		}
+		if top == nil || dmg > d.damage[top] {
+			top = conn
+		}
+	}
+	return top
+}
+
+// Wound is a player's attack on the dragon in their system.
+func (d *Dragon) Wound(conn *Connection, dmg int) {
+	if d.elder {
+		d.hits[conn] = clock.Now()
+		if n := d.Attackers(); n < elderQuorum {
+			fmt.Fprintf(conn, "your shots glance off %s's ancient scales.  it takes %d ships striking within %v of each other to wound an elder dragon; %d are attacking.\n", d.name, elderQuorum, elderWindow, n)
+			return
+		}
+	}
+	d.hp -= dmg
+	d.damage[conn] += dmg
+	if !d.Alive() {
+		d.system.EachConn(func(other *Connection) {
+			fmt.Fprintf(other, "%s has slain %s!\n", other.Describe(conn), d)
+		})
+		d.Slain()
+		return
+	}
+	fmt.Fprintf(conn, "you hit %s for %d damage.  it has %d/%d left.\n", d.name, dmg, d.hp, d.maxHp)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+type Duel struct {
+	challenger *Connection
+	defender   *Connection
+	stakes     int64
+	started    bool
+	lastShot   map[*Connection]time.Time
+}
+
+func (d *Duel) Opponent(c *Connection) *Connection {
+	if c == d.challenger {
+		return d.defender
+	}
+	return d.challenger
+}
+
+func (d *Duel) Notify(template string, args ...interface{}) {
+	msg := fmt.Sprintf(template, args...)
+	fmt.Fprintf(d.challenger, "[duel] %s\n", msg)
+	fmt.Fprintf(d.defender, "[duel] %s\n", msg)
+}
+
+func (d *Duel) Start() {
+	d.challenger.Withdraw(d.stakes)
+	d.defender.Withdraw(d.stakes)
+	d.started = true
+	d.lastShot = make(map[*Connection]time.Time, 2)
+	d.challenger.duel = d
+	d.defender.duel = d
+	d.Notify("the duel between %s and %s has begun!  %d space duckets are held in escrow.  use \"duel fire\" to attack.", d.challenger.PlayerName(), d.defender.PlayerName(), 2*d.stakes)
+	After(5*time.Minute, func() {
+		if d.challenger.duel == d {
+			d.Draw()
+		}
+	})
+}
+
+func (d *Duel) End() {
+	d.challenger.duel = nil
+	d.defender.duel = nil
+	d.challenger.challenge = nil
+	d.defender.challenge = nil
+}
+
+func (d *Duel) Draw() {
+	d.End()
+	d.challenger.Deposit(d.stakes)
+	d.defender.Deposit(d.stakes)
+	d.Notify("the duel has ended in a draw.  stakes have been returned.")
+}
+
+func (d *Duel) Resolve(loser *Connection) {
+	winner := d.Opponent(loser)
+	d.End()
+	loser.hull = 10
+	d.Notify("%s has yielded.  %s wins %d space duckets.", loser.PlayerName(), winner.PlayerName(), 2*d.stakes)
+	publishNews("%s defeated %s in a duel", winner.PlayerName(), loser.PlayerName())
+	winner.Deposit(2 * d.stakes)
+	winner.Award(K_Title, "Duelist")
+	winner.Award(K_Decal, "crossed swords")
+	winner.Progress(CH_Duel, 1)
+}
+
+var duelCommand = &Command{
+	name: "duel",
+	help: "formal one on one combat with agreed stakes.  subcommands: challenge [player] [stakes], accept, decline, fire, yield",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			fmt.Fprintf(conn, "usage: duel challenge [player] [stakes] | accept | decline | fire | yield\n")
+			return
+		}
+		switch args[0] {
+		case "challenge":
+			if conn.duel != nil || conn.challenge != nil {
+				fmt.Fprintf(conn, "you're already involved in a duel.\n")
+				return
+			}
+			if len(args) != 3 {
+				fmt.Fprintf(conn, "usage: duel challenge [player] [stakes]\n")
+				return
+			}
+			other := conn.System().FindPlayer(args[1])
+			if other == nil || other == conn {
+				fmt.Fprintf(conn, "there's nobody named %s here\n", args[1])
+				return
+			}
+			if other.duel != nil || other.challenge != nil {
+				fmt.Fprintf(conn, "%s is already involved in a duel.\n", other.PlayerName())
+				return
+			}
+			if TreatyForbids(conn, conn.System()) != "" || AtPeace(conn, other) {
+				fmt.Fprintf(conn, "dueling %s would violate a peace treaty\n", other.PlayerName())
+				return
+			}
+			stakes, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil || stakes < 0 {
+				fmt.Fprintf(conn, "that's not a valid stake: %s\n", args[2])
+				return
+			}
+			if conn.money < stakes {
+				fmt.Fprintf(conn, "you can't cover a stake of %d space duckets\n", stakes)
+				return
+			}
+			d := &Duel{challenger: conn, defender: other, stakes: stakes}
+			conn.challenge = d
+			other.challenge = d
+			fmt.Fprintf(conn, "you've challenged %s to a duel for %d space duckets.\n", other.PlayerName(), stakes)
+			fmt.Fprintf(other, "%s challenges you to a duel for %d space duckets!  use \"duel accept\" or \"duel decline\".\n", conn.PlayerName(), stakes)
+		case "accept":
+			d := conn.challenge
+			if d == nil || d.defender != conn || d.started {
+				fmt.Fprintf(conn, "nobody has challenged you.\n")
+				return
+			}
+			if d.challenger.System() != conn.System() {
+				fmt.Fprintf(conn, "%s is no longer here.\n", d.challenger.PlayerName())
+				d.End()
+				return
+			}
+			if conn.money < d.stakes || d.challenger.money < d.stakes {
+				d.Notify("one of you can no longer cover the stakes.  the challenge is off.")
+				d.End()
+				return
+			}
+			d.Start()
+		case "decline":
+			d := conn.challenge
+			if d == nil || d.started {
+				fmt.Fprintf(conn, "there's no challenge to decline.\n")
+				return
+			}
+			d.Notify("%s has declined the duel.", conn.PlayerName())
+			d.End()
+		case "fire":
+			d := conn.duel
+			if d == nil {
+				fmt.Fprintf(conn, "you're not in a duel.\n")
+				return
+			}
+			other := d.Opponent(conn)
+			if other.System() != conn.System() {
+				fmt.Fprintf(conn, "%s is out of range.\n", other.PlayerName())
+				return
+			}
+			if clock.Now().Sub(d.lastShot[conn]) < 5*time.Second {
+				fmt.Fprintf(conn, "your guns are still cycling.\n")
+				return
+			}
+			d.lastShot[conn] = clock.Now()
+			dmg := 10 + rand.Intn(20)
+			fmt.Fprintf(conn, "you hit %s for %d damage.\n", other.PlayerName(), dmg)
+			other.Damage(dmg, conn, "duel")
+		case "yield":
+			d := conn.duel
+			if d == nil {
+				fmt.Fprintf(conn, "you're not in a duel.\n")
+				return
+			}
+			d.Resolve(conn)
+		default:
+			fmt.Fprintf(conn, "no such duel subcommand: %s\n", args[0])
+		}
+	},
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const equilibriumStock = 100.0
+
+var lastPriceIndex = make(map[string]float64, 8)
+
+// galactic supply and demand.  Every purchase and sale anywhere feeds into
+// the flow for that good, and once a minute the flow nudges the good's
+// galaxy-wide price level up or down.  Left alone, price levels relax back
+// to normal.
+var market = struct {
+	sync.Mutex
+	flow  map[string]float64
+	level map[string]float64
+}{
+	flow:  make(map[string]float64, 8),
+	level: make(map[string]float64, 8),
+}
+
+const (
+	// how much a unit of net demand moves the price level
+	demandSensitivity = 0.0005
+	minPriceLevel     = 0.5
+	maxPriceLevel     = 2.5
+)
+
+// Traded records that n units of a good were bought (positive) or sold
+// (negative) on the market.
+func Traded(g *Good, n float64) {
+	market.Lock()
+	market.flow[g.name] += n
+	market.Unlock()
+}
+
+func PriceLevel(g *Good) float64 {
+	market.Lock()
+	defer market.Unlock()
+	if level, ok := market.level[g.name]; ok {
+		return level
+	}
+	return 1
+}
+
+func adjustPriceLevels() {
+	market.Lock()
+	defer market.Unlock()
+	for _, name := range goodNames() {
+		level, ok := market.level[name]
+		if !ok {
+			level = 1
+		}
+		level += (1 - level) * 0.02
+		level *= 1 + demandSensitivity*market.flow[name]
+		market.level[name] = math.Min(maxPriceLevel, math.Max(minPriceLevel, level))
+		market.flow[name] = 0
+	}
+}
+
+func startEconomy() {
+	After(time.Minute, economyTick)
+}
+
+func economyTick() {
+	defer After(time.Minute, economyTick)
+	adjustPriceLevels()
+	for _, system := range allSystems() {
+		if system.stock == nil {
+			continue
+		}
+		for name, n := range system.stock {
+			eq := system.Equilibrium(goods[name])
+			system.stock[name] = n + (eq-n)*0.1
+		}
+	}
+
+	for _, name := range goodNames() {
+		g := goods[name]
+		var total float64
+		var count int
+		for _, system := range allSystems() {
+			if !system.station {
+				continue
+			}
+			total += float64(system.Price(g))
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+		avg := total / float64(count)
+		last, ok := lastPriceIndex[name]
+		lastPriceIndex[name] = avg
+		if !ok || last == 0 {
+			continue
+		}
+		change := (avg - last) / last
+		if math.Abs(change) < 0.05 {
+			continue
+		}
+		if change > 0 {
+			publishNews("%s prices are up %.0f%% across the galaxy, averaging %.0f space duckets", name, change*100, avg)
+		} else {
+			publishNews("%s prices are down %.0f%% across the galaxy, averaging %.0f space duckets", name, -change*100, avg)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Elder dragons are too old and too big for any one pilot.  Their scales
+// close over a wound from a lone attacker, so it takes a group striking
+// together to bring one down, and they heal whenever the pressure lets up.
+// The hoard of a slain elder is split between everybody who drew blood.
+const (
+	// how many ships have to be hitting an elder at once to hurt it
+	elderQuorum = 3
+	// how close together their hits have to land
+	elderWindow = 30 * time.Second
+	// elders have this many times the hit points of an ordinary dragon
+	elderToughness = 15
+	// how much of its health an elder gets back each turn it's left alone
+	elderRegen = 0.1
+	// how long before another elder wakes up
+	elderRespawn = 2 * time.Hour
+	// the bounty on an elder, split by damage dealt
+	elderBounty = 25000
+)
+
+// the resources in an elder's hoard, split by damage dealt.  Every
+// participant also gets an elderscale, whatever they did.
+var elderHoard = Resources{"ore": 300, "gas": 200, "crystal": 100}
+
+func spawnElder() {
+	hatch(true)
+}
+
+// Attackers counts the ships in the elder's system that have hit it within
+// the window.
+func (d *Dragon) Attackers() int {
+	n := 0
+	for conn, t := range d.hits {
+		if clock.Now().Sub(t) <= elderWindow && conn.System() == d.system && !conn.dead {
+			n++
+		}
+	}
+	return n
+}
+
+// Regenerate heals the elder if it isn't being pressed hard enough.
+func (d *Dragon) Regenerate() {
+	if d.hp >= d.maxHp || d.Attackers() >= elderQuorum {
+		return
+	}
+	d.hp += int(elderRegen * float64(d.maxHp))
+	if d.hp > d.maxHp {
+		d.hp = d.maxHp
+	}
+	d.system.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "the wounds of %s close over.  it has %d/%d left.\n", d, d.hp, d.maxHp)
+	})
+}
+
+// ShareHoard pays out a slain elder's hoard to the pilots who fought it and
+// tells the whole galaxy who they were.
+func (d *Dragon) ShareHoard() {
+	s := d.system
+	total := 0
+	victors := make([]*Connection, 0, len(d.damage))
+	for conn, dmg := range d.damage {
+		if conn.dead || conn.System() != s {
+			continue
+		}
+		victors = append(victors, conn)
+		total += dmg
+	}
+	sort.Slice(victors, func(i, j int) bool { return d.damage[victors[i]] > d.damage[victors[j]] })
+	names := make([]string, len(victors))
+	for i, conn := range victors {
+		names[i] = conn.PlayerName()
+		share := float64(d.damage[conn]) / float64(total)
+		got := make(Resources, len(elderHoard))
+		for name, n := range elderHoard {
+			got[name] = conn.Stow(goods[name], int(share*float64(n)))
+		}
+		conn.Stow(goods["elderscale"], 1)
+		bounty := int64(share * elderBounty)
+		conn.Deposit(bounty)
+		fmt.Fprintf(conn, "your share of the hoard of %s: %s, an elderscale and %d space duckets.\n", d, got, bounty)
+		conn.AdjustReputation(dragonCultists, -25)
+		conn.AdjustRepute(20, "slaying "+d.name)
+		conn.Award(K_Title, "Elderbane")
+		if i == 0 {
+			conn.Award(K_Decal, "elder dragon skull")
+			dropEgg(conn, d)
+		}
+	}
+	msg := fmt.Sprintf("%s has been slain in %s", d, s.name)
+	if len(names) > 0 {
+		msg += " by " + strings.Join(names, ", ")
+	}
+	publishNews("%s", msg)
+	for conn, _ := range connected {
+		fmt.Fprintf(conn, "%s!\n", msg)
+	}
+}
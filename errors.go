@@ -9,12 +9,14 @@ const (
 	E_No_Data
 	E_No_DB
 	E_No_Port
+	E_Bad_Config
+	E_Inconsistent
 )
 
 type errorGroup []error
 
 func (e errorGroup) Error() string {
-	messages := make([]string, 0, len(e))
+	messages := make([]string, len(e))
 	for i, _ := range e {
 		messages[i] = e[i].Error()
 	}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var hireCommand = &Command{
+	name: "hire",
+	help: "hires an NPC escort ship at a station.  Costs 300 space duckets, plus 25 space duckets a minute in upkeep",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if !system.station {
+			fmt.Fprintf(conn, "there are no escorts for hire in %s.  try a station.\n", system.name)
+			return
+		}
+		if conn.escorts >= conn.Rank() {
+			fmt.Fprintf(conn, "at rank %d you can command at most %d escorts.\n", conn.Rank(), conn.Rank())
+			return
+		}
+		if conn.money < 300 {
+			fmt.Fprintf(conn, "not enough money!  escorts cost 300 space duckets to hire, you only have %d in the bank.\n", conn.money)
+			return
+		}
+		conn.Withdraw(300)
+		conn.escorts += 1
+		fmt.Fprintf(conn, "hired an escort.  escorts: %d\n", conn.escorts)
+		if !conn.upkeep {
+			conn.upkeep = true
+			After(time.Minute, conn.PayEscorts)
+		}
+	},
+}
+
+var dismissCommand = &Command{
+	name:   "dismiss",
+	help:   "dismisses one of your NPC escorts",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if conn.escorts == 0 {
+			fmt.Fprintf(conn, "you don't have any escorts.\n")
+			return
+		}
+		conn.escorts -= 1
+		fmt.Fprintf(conn, "dismissed an escort.  escorts: %d\n", conn.escorts)
+	},
+}
+
+func (c *Connection) PayEscorts() {
+	if c.escorts == 0 {
+		c.upkeep = false
+		return
+	}
+	cost := int64(25 * c.escorts)
+	for c.escorts > 0 && c.money < cost {
+		c.escorts -= 1
+		cost = int64(25 * c.escorts)
+		fmt.Fprintf(c, "you couldn't pay your escorts.  one of them has left.  escorts: %d\n", c.escorts)
+	}
+	if c.escorts == 0 {
+		c.upkeep = false
+		return
+	}
+	c.Withdraw(cost)
+	fmt.Fprintf(c, "paid %d space duckets in escort upkeep.\n", cost)
+	After(time.Minute, c.PayEscorts)
+}
+
+func (c *Connection) EscortsIntercept() bool {
+	out := ResolveEscorts(c.escorts, dice)
+	if !out.ByEscorts {
+		return false
+	}
+	fmt.Fprintf(c, "your escorts open fire and shoot down an incoming bomb!\n")
+	if out.EscortLost {
+		c.escorts -= 1
+		fmt.Fprintf(c, "one of your escorts was lost in the blast.  escorts: %d\n", c.escorts)
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func (c *Connection) Painted() bool {
+	return clock.Now().Before(c.paintedUntil)
+}
+
+// Dampened ships show up in scans as unresolved contacts unless a target
+// painter has lit them up.
+func (c *Connection) Dampened() bool {
+	return c.HasUpgrade("dampener") && !c.Painted()
+}
+
+func (c *Connection) DropLock() {
+	if c.harassing == nil {
+		return
+	}
+	fmt.Fprintf(c, "your fighters have lost their lock on %s and return to defensive patrol.\n", c.harassing.PlayerName())
+	c.defenders += c.harassers
+	c.harassers = 0
+	c.harassing = nil
+}
+
+var jamCommand = &Command{
+	name: "jam",
+	help: "fires your ECM burst, breaking every tractor beam and fighter lock on your ship.  requires the ecm module",
+	handler: func(conn *Connection, args ...string) {
+		if !conn.HasUpgrade("ecm") {
+			fmt.Fprintf(conn, "you don't have an ecm module fitted.\n")
+			return
+		}
+		if wait := conn.lastJam.Add(time.Minute).Sub(clock.Now()); wait > 0 {
+			fmt.Fprintf(conn, "ecm capacitors are recharging.  can jam again in %v\n", wait)
+			return
+		}
+		conn.lastJam = clock.Now()
+		system := conn.System()
+		fmt.Fprintf(conn, "ecm burst away!\n")
+		if holder := conn.heldBy; holder != nil {
+			fmt.Fprintf(holder, "your tractor beam on %s is jammed!\n", conn.PlayerName())
+			conn.Release()
+		}
+		system.EachConn(func(other *Connection) {
+			if other.harassing == conn {
+				other.DropLock()
+			}
+		})
+	},
+}
+
+var paintCommand = &Command{
+	name: "paint",
+	help: "lights up a ship with your target painter for 1 minute.  painted ships take 50% more damage and can't hide from scans.  usage: paint [player-name]",
+	handler: func(conn *Connection, args ...string) {
+		if !conn.HasUpgrade("painter") {
+			fmt.Fprintf(conn, "you don't have a target painter fitted.\n")
+			return
+		}
+		if len(args) != 1 {
+			fmt.Fprintf(conn, "usage: paint [player-name]\n")
+			return
+		}
+		system := conn.System()
+		target := system.FindPlayer(args[0])
+		if target == nil || target == conn {
+			fmt.Fprintf(conn, "there's no ship named %s in %s\n", args[0], system.name)
+			return
+		}
+		target.paintedUntil = clock.Now().Add(time.Minute)
+		fmt.Fprintf(conn, "target painter locked on %s\n", target.PlayerName())
+		fmt.Fprintf(target, "warning: your ship is being painted by %s\n", conn.Describe(target))
+		if conn.fleet != nil {
+			conn.fleet.Notify("%s has painted %s", conn.PlayerName(), target.PlayerName())
+		}
+	},
+}
+
+func init() {
+	registerUpgrade(nil, &Upgrade{
+		name:      "ecm",
+		help:      "the \"jam\" command breaks tractor beams and fighter locks on your ship",
+		cost:      1200,
+		materials: Resources{"gas": 5, "crystal": 5},
+	})
+	registerUpgrade(nil, &Upgrade{
+		name:      "dampener",
+		help:      "your ship shows up on enemy scans as an unresolved contact",
+		cost:      1000,
+		materials: Resources{"gas": 10},
+	})
+	registerUpgrade(nil, &Upgrade{
+		name:      "painter",
+		help:      "the \"paint\" command marks a ship to take extra damage",
+		cost:      900,
+		materials: Resources{"crystal": 5},
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+)
+
+func (s *System) Insert() error {
+	res, err := db.Exec(`
+    insert into planets
+    (name, x, y, z, planets)
+    values
+    (?, ?, ?, ?, ?)
+    ;`, s.name, s.x, s.y, s.z, s.planets)
+	if err != nil {
+		return fmt.Errorf("unable to insert system %s: %v", s.name, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("unable to read id of system %s: %v", s.name, err)
+	}
+	s.id = int(id)
+	return nil
+}
+
+func expandGalaxy(systems []*System) int {
+	added := 0
+	for _, s := range systems {
+		if _, ok := systemByName(s.name); ok {
+			log_error("not expanding galaxy with %s: a system by that name already exists", s.name)
+			continue
+		}
+		if err := s.Insert(); err != nil {
+			log_error("%v", err)
+			continue
+		}
+		for _, other := range allSystems() {
+			dist := s.DistanceTo(other)
+			_, err := db.Exec(`
+                insert into edges
+                (id_1, id_2, distance)
+                values
+                (?, ?, ?), (?, ?, ?)
+            ;`, s.id, other.id, dist, other.id, s.id, dist)
+			if err != nil {
+				log_error("unable to write edge to db: %v", err)
+			}
+		}
+		s.miningRate = rand.Float64()
+		s.station = s.planets >= 3
+		s.rollAbundance()
+		s.StoreAbundance()
+		indexLock.Lock()
+		index[s.id] = s
+		nameIndex[s.name] = s
+		indexLock.Unlock()
+		added++
+	}
+	indexLock.Lock()
+	indexTree()
+	indexLock.Unlock()
+	log_info("galaxy expanded with %d new systems", added)
+	return added
+}
+
+func randomSector(n int) []*System {
+	cx := rand.NormFloat64() * 200
+	cy := rand.NormFloat64() * 200
+	cz := rand.NormFloat64() * 200
+	systems := make([]*System, 0, n)
+	for i := 0; i < n; i++ {
+		systems = append(systems, &System{
+			name:    fmt.Sprintf("Frontier %d-%d", systemCount(), i),
+			x:       cx + rand.NormFloat64()*20,
+			y:       cy + rand.NormFloat64()*20,
+			z:       cz + rand.NormFloat64()*20,
+			planets: 1 + rand.Intn(4),
+		})
+	}
+	return systems
+}
+
+func speckSystems(path string) ([]*System, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *System)
+	go speckStream(fi, c)
+	systems := make([]*System, 0, 32)
+	for s := range c {
+		systems = append(systems, s)
+	}
+	return systems, nil
+}
+
+var expandCommand = &Command{
+	name:   "expand",
+	help:   "admin only.  adds new systems to the galaxy.  usage: expand random [count] | expand speck [path]",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can expand the galaxy.\n")
+			return
+		}
+		if len(args) != 2 {
+			fmt.Fprintf(conn, "usage: expand random [count] | expand speck [path]\n")
+			return
+		}
+		var systems []*System
+		switch args[0] {
+		case "random":
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 || n > 100 {
+				fmt.Fprintf(conn, "count must be between 1 and 100\n")
+				return
+			}
+			systems = randomSector(n)
+		case "speck":
+			var err error
+			systems, err = speckSystems(args[1])
+			if err != nil {
+				fmt.Fprintf(conn, "unable to read speck file: %v\n", err)
+				return
+			}
+		default:
+			fmt.Fprintf(conn, "usage: expand random [count] | expand speck [path]\n")
+			return
+		}
+		added := expandGalaxy(systems)
+		fmt.Fprintf(conn, "added %d systems to the galaxy\n", added)
+		if added > 0 {
+			publishNews("%d new systems have been charted at the edge of known space", added)
+		}
+	},
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The exploit detector watches for things no honest pilot can do: money
+// turning up that was never paid through Deposit, arriving somewhere sooner
+// than any engine could get there, or typing faster than a person can type.
+// It doesn't act on what it sees.  Each finding is filed in the moderation
+// queue (see moderation.go) for an admin to look over, since a bug of ours
+// looks the same as a cheat from here.
+const (
+	// the reporter name on flags the detector files
+	exploitReporter = "exploit detector"
+	// how long before the same thing is flagged again for the same pilot
+	exploitQuiet = time.Hour
+	// more duckets than this earned in an income window is worth a look
+	incomeAlarm  = 10000
+	incomeWindow = 10 * time.Minute
+	// more commands than this inside a rate window is beyond a person
+	commandAlarm  = 75
+	commandWindow = 5 * time.Second
+	// how early an arrival can be before it counts, for scheduler slop
+	arrivalSlop = time.Second
+)
+
+// exploitWatch is what the detector keeps on each connection.  The audit
+// runs on the scheduler while money changes on the pilot's own goroutine, so
+// money is only changed with the lock held (see Credited) and the audit takes
+// the same lock to compare it with the ledger.
+type exploitWatch struct {
+	sync.Mutex
+	// the balance money should have, going by Deposit and Withdraw
+	ledger int64
+	// duckets deposited since earnedSince
+	earned      int64
+	earnedSince time.Time
+	// the trip in progress, if any
+	bound    *System
+	departed time.Time
+	eta      time.Duration
+	// when recent commands came in, oldest first
+	commands []time.Time
+	// when each kind of finding was last flagged
+	flagged map[string]time.Time
+}
+
+// Flag files a finding against a pilot for review, unless the same kind of
+// thing was flagged for them recently.
+func (c *Connection) Flag(kind, format string, args ...interface{}) {
+	if c.IsAdmin() {
+		return
+	}
+	c.watch.Lock()
+	if c.watch.flagged == nil {
+		c.watch.flagged = make(map[string]time.Time, 4)
+	}
+	if last, ok := c.watch.flagged[kind]; ok && time.Since(last) < exploitQuiet {
+		c.watch.Unlock()
+		return
+	}
+	c.watch.flagged[kind] = time.Now()
+	c.watch.Unlock()
+	detail := fmt.Sprintf(format, args...)
+	log_error("exploit detector: %s: %s: %s", c.PlayerName(), kind, detail)
+	r := &Report{
+		reporter: exploitReporter,
+		target:   c.PlayerName(),
+		reason:   kind,
+		context:  detail,
+		filed:    time.Now(),
+	}
+	if err := r.Store(); err != nil {
+		log_error("%v", err)
+		return
+	}
+	for other, _ := range connected {
+		if other.IsAdmin() {
+			fmt.Fprintf(other, "[mod] new report #%d: %s flagged %s for %s\n", r.id, r.reporter, r.target, kind)
+		}
+	}
+}
+
+// Credited changes a pilot's money the proper way, for Deposit and Withdraw,
+// keeping the detector's books in step with it.
+func (c *Connection) Credited(n int64) {
+	c.watch.Lock()
+	c.money += n
+	c.watch.ledger += n
+	var earned int64
+	if n > 0 {
+		if time.Since(c.watch.earnedSince) > incomeWindow {
+			c.watch.earned, c.watch.earnedSince = 0, time.Now()
+		}
+		c.watch.earned += n
+		earned = c.watch.earned
+	}
+	c.watch.Unlock()
+	if earned > incomeAlarm {
+		c.Flag("income", "earned %d duckets in under %v", earned, incomeWindow)
+	}
+}
+
+// Rebalanced sets a pilot's money outright, as when it's loaded, and starts
+// the detector's books over from there.
+func (c *Connection) Rebalanced(money int64) {
+	c.watch.Lock()
+	c.money, c.watch.ledger = money, money
+	c.watch.Unlock()
+}
+
+// Audit compares a pilot's money with what Deposit and Withdraw say it
+// should be.  A difference means duckets came from, or went to, nowhere.
+func (c *Connection) Audit() {
+	if c.character == nil {
+		return
+	}
+	c.watch.Lock()
+	money, ledger := c.money, c.watch.ledger
+	c.watch.ledger = money
+	c.watch.Unlock()
+	if diff := money - ledger; diff != 0 {
+		c.Flag("credits", "balance is %d duckets but deposits and withdrawals account for %d (%+d)", money, ledger, diff)
+	}
+}
+
+// Departed records a trip as it starts, and checks the ETA against the
+// fastest any ship could make the trip.
+func (c *Connection) Departed(from, to *System, eta time.Duration) {
+	c.watch.Lock()
+	c.watch.bound, c.watch.departed, c.watch.eta = to, clock.Now(), eta
+	c.watch.Unlock()
+	floor := time.Duration(float64(from.TravelTimeTo(to)) * swiftTravel * 2 / 3 * fastestEngines * fastestHull())
+	if eta < floor-arrivalSlop {
+		c.Flag("travel", "given an ETA of %v from %s to %s, under the physical minimum of %v", eta, from.name, to.name, floor)
+	}
+}
+
+// Arrived checks that a pilot who reached the end of their trip didn't get
+// there sooner than their ETA.  Arrivals anywhere else (interdiction,
+// wormholes, respawning) end the trip without a check.
+func (c *Connection) Arrived(s *System) {
+	c.watch.Lock()
+	bound, departed, eta := c.watch.bound, c.watch.departed, c.watch.eta
+	c.watch.bound = nil
+	c.watch.Unlock()
+	if bound != s {
+		return
+	}
+	if took := clock.Now().Sub(departed); took < eta-arrivalSlop {
+		c.Flag("travel", "reached %s in %v with an ETA of %v", s.name, took.Round(time.Millisecond), eta)
+	}
+}
+
+// Commanded counts a command toward the pilot's command rate.
+func (c *Connection) Commanded() {
+	now := time.Now()
+	c.watch.Lock()
+	recent := c.watch.commands[:0]
+	for _, t := range c.watch.commands {
+		if now.Sub(t) < commandWindow {
+			recent = append(recent, t)
+		}
+	}
+	c.watch.commands = append(recent, now)
+	n := len(c.watch.commands)
+	c.watch.Unlock()
+	if n > commandAlarm {
+		c.Flag("command rate", "sent %d commands in %v", n, commandWindow)
+	}
+}
+
+func startExploitChecks() {
+	After(time.Minute, exploitTick)
+}
+
+func exploitTick() {
+	defer After(time.Minute, exploitTick)
+	for conn, _ := range connected {
+		conn.Audit()
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Faction struct {
+	name string
+}
+
+type Upgrade struct {
+	name    string
+	help    string
+	cost    int64
+	minRep  int
+	faction *Faction
+	apply   func(*Connection)
+	remove  func(*Connection)
+
+	// resources it takes to build, on top of the cost
+	materials Resources
+}
+
+var (
+	minersGuild    = &Faction{name: "miners' guild"}
+	pirateClans    = &Faction{name: "pirate clans"}
+	dragonCultists = &Faction{name: "dragon cultists"}
+	factions       = []*Faction{minersGuild, pirateClans, dragonCultists}
+	upgrades       = make(map[string]*Upgrade, 16)
+)
+
+func (c *Connection) Reputation(f *Faction) int {
+	return c.reputation[f]
+}
+
+func (c *Connection) AdjustReputation(f *Faction, delta int) {
+	if c.reputation == nil {
+		c.reputation = make(map[*Faction]int, len(factions))
+	}
+	before := c.reputation[f]
+	after := before + delta
+	if after > 100 {
+		after = 100
+	}
+	if after < -100 {
+		after = -100
+	}
+	c.reputation[f] = after
+	if before/25 != after/25 {
+		fmt.Fprintf(c, "your standing with the %s is now %d\n", f.name, after)
+	}
+}
+
+func (c *Connection) HasUpgrade(name string) bool {
+	return c.upgrades[name]
+}
+
+var standingCommand = &Command{
+	name:   "standing",
+	help:   "shows your reputation with the NPC factions",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		for _, f := range factions {
+			fmt.Fprintf(conn, "%-20s %d\n", f.name, conn.Reputation(f))
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+	},
+}
+
+var upgradeCommand = &Command{
+	name: "upgrade",
+	help: "buys a faction upgrade at a station.  use \"upgrade\" alone for a list",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+			fmt.Fprintf(conn, "%-10s %-20s %-6s %-6s %-24s %s\n", "name", "faction", "rep", "cost", "materials", "effect")
+			fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+			names := make([]string, 0, len(upgrades))
+			for name, _ := range upgrades {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				u := upgrades[name]
+				faction := "-"
+				if u.faction != nil {
+					faction = u.faction.name
+				}
+				fmt.Fprintf(conn, "%-10s %-20s %-6d %-6d %-24s %s\n", u.name, faction, u.minRep, u.cost, u.materials, u.help)
+			}
+			fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+			return
+		}
+		u, ok := upgrades[args[0]]
+		if !ok {
+			fmt.Fprintf(conn, "no such upgrade: %s\n", args[0])
+			return
+		}
+		if !conn.System().station {
+			fmt.Fprintf(conn, "you can only buy upgrades at a station.\n")
+			return
+		}
+		if conn.OwnsModule(u.name) {
+			fmt.Fprintf(conn, "you already have the %s upgrade.\n", u.name)
+			return
+		}
+		if u.faction != nil && conn.Reputation(u.faction) < u.minRep {
+			fmt.Fprintf(conn, "the %s won't deal with you.  you need a standing of %d, you have %d.\n", u.faction.name, u.minRep, conn.Reputation(u.faction))
+			return
+		}
+		if conn.money < u.cost {
+			fmt.Fprintf(conn, "not enough money!  the %s upgrade costs %d space duckets, you only have %d in the bank.\n", u.name, u.cost, conn.money)
+			return
+		}
+		if !conn.HasResources(u.materials) {
+			fmt.Fprintf(conn, "not enough materials!  the %s upgrade takes %s.\n", u.name, u.materials)
+			return
+		}
+		conn.Withdraw(u.cost)
+		conn.TakeResources(u.materials)
+		if conn.modules == nil {
+			conn.modules = make(map[string]bool, len(upgrades))
+		}
+		conn.modules[u.name] = true
+		if conn.FreeSlots() < 1 {
+			fmt.Fprintf(conn, "bought the %s upgrade, but your ship has no free slots.  use \"unfit\" to make room.\n", u.name)
+			return
+		}
+		conn.Fit(u)
+		fmt.Fprintf(conn, "installed the %s upgrade.\n", u.name)
+	},
+}
+
+func registerUpgrade(f *Faction, u *Upgrade) {
+	u.faction = f
+	upgrades[u.name] = u
+}
+
+func init() {
+	registerUpgrade(minersGuild, &Upgrade{
+		name:      "drill",
+		help:      "mining pays out 25% more",
+		cost:      1000,
+		materials: Resources{"ore": 10},
+		minRep:    25,
+	})
+	registerUpgrade(pirateClans, &Upgrade{
+		name:      "grapple",
+		help:      "your boarding parties fight harder",
+		cost:      800,
+		materials: Resources{"ore": 10},
+		minRep:    25,
+	})
+	registerUpgrade(dragonCultists, &Upgrade{
+		name:      "plating",
+		help:      "dragonscale plating adds 50 to your hull",
+		cost:      1200,
+		materials: Resources{"ore": 20, "crystal": 5},
+		minRep:    25,
+		apply: func(c *Connection) {
+			c.hull += 50
+		},
+		remove: func(c *Connection) {
+			c.hull -= 50
+			if c.hull < 1 {
+				c.hull = 1
+			}
+		},
+	})
+	registerUpgrade(pirateClans, &Upgrade{
+		name:      "sigint",
+		help:      "intercepts transmissions relayed through your system",
+		cost:      1500,
+		materials: Resources{"crystal": 10},
+		minRep:    10,
+	})
+	registerUpgrade(nil, &Upgrade{
+		name:      "encryption",
+		help:      "your transmissions can't be read when intercepted",
+		cost:      1000,
+		materials: Resources{"crystal": 5},
+	})
+	registerUpgrade(nil, &Upgrade{
+		name:      "hangar",
+		help:      "turns your ship into a carrier with room for 4 fighters",
+		cost:      3000,
+		materials: Resources{"ore": 30, "gas": 10},
+		apply: func(c *Connection) {
+			c.hangar = 4
+			c.fighters = 4
+		},
+		remove: func(c *Connection) {
+			c.hangar = 0
+			c.fighters = 0
+		},
+	})
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Federation lets a handful of servers, usually one per part of the world,
+// share one account namespace and pass characters between them.  Each server
+// names its own region and lists its peers:
+//
+//	EXO_REGION=eu
+//	EXO_PEERS=us=https://us.example.com,asia=https://asia.example.com
+//	EXO_FEDERATION_SECRET=...
+//
+// A transfer exports the character as a packet signed with the shared
+// secret, and posts it to the peer's web listener, which checks it and
+// imports it.  The character stays on the books here, marked as living in
+// the other region, so the name can't be taken while it's away and it can
+// come back later.
+var (
+	region           = os.Getenv("EXO_REGION")
+	peers            = parsePeers(os.Getenv("EXO_PEERS"))
+	federationSecret = secret("EXO_FEDERATION_SECRET")
+)
+
+const (
+	transferVersion = 1
+	// how long a character has to stay put after moving
+	transferCooldown = 24 * time.Hour
+	// how long a signed packet is good for
+	transferTTL = 5 * time.Minute
+)
+
+func parsePeers(s string) map[string]string {
+	peers := make(map[string]string, 4)
+	for _, peer := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(peer), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		peers[parts[0]] = strings.TrimRight(parts[1], "/")
+	}
+	return peers
+}
+
+func federated() bool {
+	return region != "" && federationSecret != "" && len(peers) > 0
+}
+
+func federationTable() {
+	addColumn("characters", "region", "text not null default ''")
+	addColumn("characters", "transferred", "integer not null default 0")
+}
+
+// transferPacket is everything about a character that travels between
+// regions.  Colonies, ships in space and anything else tied to this galaxy
+// stay behind.
+type transferPacket struct {
+	Version       int            `json:"version"`
+	From          string         `json:"from"`
+	To            string         `json:"to"`
+	Issued        int64          `json:"issued"`
+	Account       string         `json:"account"`
+	TOTPSecret    string         `json:"totp_secret,omitempty"`
+	Character     string         `json:"character"`
+	Kills         int            `json:"kills"`
+	Reputation    int            `json:"reputation"`
+	Money         int64          `json:"money"`
+	Cargo         map[string]int `json:"cargo,omitempty"`
+	Armory        map[string]int `json:"armory,omitempty"`
+	Title         string         `json:"title,omitempty"`
+	Decal         string         `json:"decal,omitempty"`
+	Tamed         string         `json:"tamed,omitempty"`
+	TamedKind     string         `json:"tamed_kind,omitempty"`
+	Hardcore      bool           `json:"hardcore,omitempty"`
+	HardcoreSince int64          `json:"hardcore_since,omitempty"`
+}
+
+type signedTransfer struct {
+	Packet    json.RawMessage `json:"packet"`
+	Signature string          `json:"signature"`
+}
+
+// what a federated signature is for.  It's signed along with the payload, so
+// that a signature lifted from one kind of request can't be replayed as
+// another (an account name passed off as a relayed message, say).
+const (
+	SP_Transfer = "transfer"
+	SP_Account  = "account"
+	SP_Relay    = "relay"
+)
+
+// signFederated signs anything one peer sends another with the shared
+// secret.
+func signFederated(purpose string, packet []byte) string {
+	mac := hmac.New(sha256.New, []byte(federationSecret))
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write(packet)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Export packs up the connection's character for the given region.
+func (c *Connection) Export(to string) *transferPacket {
+	ch := c.character
+	p := &transferPacket{
+		Version:    transferVersion,
+		From:       region,
+		To:         to,
+		Issued:     time.Now().Unix(),
+		Account:    c.player.name,
+		TOTPSecret: c.player.totpSecret,
+		Character:  ch.name,
+		Kills:      c.kills,
+		Reputation: c.repute,
+		Money:      c.money,
+		Cargo:      c.cargo,
+		Armory:     c.armory,
+		Title:      ch.title,
+		Decal:      ch.decal,
+		Tamed:      ch.tamed,
+		TamedKind:  ch.tamedKind,
+		Hardcore:   ch.hardcore,
+	}
+	if !ch.hardcoreSince.IsZero() {
+		p.HardcoreSince = ch.hardcoreSince.Unix()
+	}
+	return p
+}
+
+// Validate checks a packet that's arrived from a peer before anything is
+// written.
+func (p *transferPacket) Validate() error {
+	if p.Version != transferVersion {
+		return fmt.Errorf("unsupported transfer version %d", p.Version)
+	}
+	if p.To != region {
+		return fmt.Errorf("packet is addressed to %s, not %s", p.To, region)
+	}
+	if _, ok := peers[p.From]; !ok {
+		return fmt.Errorf("%s isn't a peer", p.From)
+	}
+	issued := time.Unix(p.Issued, 0)
+	if time.Since(issued) > transferTTL || time.Until(issued) > time.Minute {
+		return fmt.Errorf("packet issued at %v has expired", issued)
+	}
+	if !ValidName(p.Account) || !ValidName(p.Character) {
+		return fmt.Errorf("bad account or character name")
+	}
+	if p.Money < 0 || p.Kills < 0 {
+		return fmt.Errorf("negative money or kills")
+	}
+	if p.Reputation < minRepute || p.Reputation > maxRepute {
+		return fmt.Errorf("reputation out of range: %d", p.Reputation)
+	}
+	for name, n := range p.Cargo {
+		if _, ok := goods[name]; !ok || n <= 0 {
+			return fmt.Errorf("bad cargo: %d %s", n, name)
+		}
+	}
+	for name, n := range p.Armory {
+		if b, ok := bombClasses[name]; !ok || b == fission || n < 0 {
+			return fmt.Errorf("bad armory: %d %s", n, name)
+		}
+	}
+	if p.Tamed != "" {
+		if _, ok := tamedKinds[p.TamedKind]; !ok {
+			return fmt.Errorf("unknown kind of tamed dragon: %s", p.TamedKind)
+		}
+	}
+	return nil
+}
+
+// Import writes an arriving character into this region's database, creating
+// the account if it's never played here.  A character coming home is
+// updated in place.
+func (p *transferPacket) Import() error {
+	player, err := loadPlayer(p.Account)
+	if err != nil {
+		player = &Player{name: p.Account}
+		if err := player.Create(); err != nil {
+			return err
+		}
+		if p.TOTPSecret != "" {
+			if _, err := db.Exec(`update players set totp_secret = ? where id = ?`, p.TOTPSecret, player.id); err != nil {
+				return fmt.Errorf("unable to copy 2fa secret for %s: %v", player.name, err)
+			}
+		}
+	}
+
+	var id, account int
+	var away string
+	var transferred int64
+	// a character made for this import is removed again if the import
+	// fails, or it would hold the name against every retry
+	var created bool
+	row := db.QueryRow(`select id, account, region, transferred from characters where name = ?`, p.Character)
+	switch err := row.Scan(&id, &account, &away, &transferred); {
+	case err == nil:
+		if account != player.id || away == "" {
+			return fmt.Errorf("the name %s is taken in %s", p.Character, region)
+		}
+		if transferred >= p.Issued {
+			return fmt.Errorf("%s has already been imported", p.Character)
+		}
+	case err != sql.ErrNoRows:
+		return fmt.Errorf("unable to look up %s: %v", p.Character, err)
+	default:
+		chars, err := player.Characters()
+		if err != nil {
+			return err
+		}
+		if len(chars) >= maxCharacters {
+			return fmt.Errorf("%s already has %d characters in %s", player.name, maxCharacters, region)
+		}
+		ch, err := player.NewCharacter(p.Character)
+		if err != nil {
+			return err
+		}
+		id, created = ch.id, true
+	}
+	abandon := func() {
+		if !created {
+			return
+		}
+		if _, err := db.Exec(`delete from characters where id = ?`, id); err != nil {
+			log_error("unable to remove %s after a failed import: %v", p.Character, err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		abandon()
+		return fmt.Errorf("unable to import %s: %v", p.Character, err)
+	}
+	_, err = tx.Exec(`
+        update characters
+        set system = 0, kills = ?, reputation = ?, money = ?, title = ?, decal = ?, tamed = ?, tamed_kind = ?,
+            hardcore = ?, hardcore_since = ?, region = '', transferred = ?
+        where id = ?
+    ;`, p.Kills, p.Reputation, p.Money, p.Title, p.Decal, p.Tamed, p.TamedKind, p.Hardcore, p.HardcoreSince, p.Issued, id)
+	if err == nil {
+		_, err = tx.Exec(`delete from cargo where character = ?`, id)
+	}
+	for name, n := range p.Cargo {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec(`insert into cargo (character, good, quantity) values (?, ?, ?)`, id, name, n)
+	}
+	if err == nil {
+		_, err = tx.Exec(`delete from armory where character = ?`, id)
+	}
+	for name, n := range p.Armory {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec(`insert into armory (character, class, quantity) values (?, ?, ?)`, id, name, n)
+	}
+	if err != nil {
+		tx.Rollback()
+		abandon()
+		return fmt.Errorf("unable to import %s: %v", p.Character, err)
+	}
+	if err := tx.Commit(); err != nil {
+		abandon()
+		return fmt.Errorf("unable to import %s: %v", p.Character, err)
+	}
+	log_info("imported %s (account %s) from %s", p.Character, p.Account, p.From)
+	return nil
+}
+
+// Send posts the packet to the peer and reports whether it was accepted.
+func (p *transferPacket) Send() error {
+	packet, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(signedTransfer{Packet: packet, Signature: signFederated(SP_Transfer, packet)})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	res, err := client.Post(peers[p.To]+"/federation/import", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("couldn't reach %s: %v", p.To, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s refused the transfer: %s", p.To, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func federationImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !federated() {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "transfers are posted", http.StatusMethodNotAllowed)
+		return
+	}
+	var signed signedTransfer
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&signed); err != nil {
+		http.Error(w, "bad transfer", http.StatusBadRequest)
+		return
+	}
+	if !hmac.Equal([]byte(signed.Signature), []byte(signFederated(SP_Transfer, signed.Packet))) {
+		log_error("rejected a transfer with a bad signature from %s", r.RemoteAddr)
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	var p transferPacket
+	if err := json.Unmarshal(signed.Packet, &p); err != nil {
+		http.Error(w, "bad transfer", http.StatusBadRequest)
+		return
+	}
+	if err := p.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := p.Import(); err != nil {
+		log_error("%v", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	fmt.Fprintf(w, "ok\n")
+}
+
+// federationAccountHandler tells a peer whether an account name is in use
+// here, so that nobody can sign up in one region with a name that belongs to
+// someone in another.
+func federationAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if !federated() {
+		http.NotFound(w, r)
+		return
+	}
+	name := r.FormValue("name")
+	if !hmac.Equal([]byte(r.FormValue("signature")), []byte(signFederated(SP_Account, []byte(name)))) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	if _, err := loadPlayer(name); err != nil && !characterExists(name) {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, "taken\n")
+}
+
+// takenElsewhere asks the peers whether a name is already in use in another
+// region.  A peer that can't be reached is assumed to have it, since letting
+// two people share a name is the worse mistake.
+func takenElsewhere(name string) bool {
+	if !federated() {
+		return false
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	v := url.Values{"name": {name}, "signature": {signFederated(SP_Account, []byte(name))}}
+	for peer, base := range peers {
+		res, err := client.Get(base + "/federation/account?" + v.Encode())
+		if err != nil {
+			log_error("couldn't ask %s about the name %s: %v", peer, name, err)
+			return true
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	http.HandleFunc("/federation/import", federationImportHandler)
+	http.HandleFunc("/federation/account", federationAccountHandler)
+}
+
+// SetRegion records that a character now lives somewhere else.
+func (ch *Character) SetRegion(name string, at time.Time) error {
+	_, err := db.Exec(`update characters set region = ?, transferred = ? where id = ?`, name, at.Unix(), ch.id)
+	if err != nil {
+		return fmt.Errorf("unable to move %s to %s: %v", ch.name, name, err)
+	}
+	ch.region = name
+	ch.transferred = at
+	return nil
+}
+
+var transferCommand = &Command{
+	name: "transfer",
+	help: "moves your character to another region's server.  usage: transfer [region]\n" +
+		"\tyour money, cargo, kills, reputation, title and tamed dragon go with you.  you have to be at a station, with no colonies, " +
+		"and you can only move once a day.",
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		if !federated() {
+			fmt.Fprintf(conn, "this server isn't part of a federation.\n")
+			return
+		}
+		if len(args) != 1 {
+			names := make([]string, 0, len(peers))
+			for name, _ := range peers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fmt.Fprintf(conn, "you're in %s.  other regions: %s\n", region, strings.Join(names, ", "))
+			fmt.Fprintf(conn, "usage: transfer [region]\n")
+			return
+		}
+		to := args[0]
+		if _, ok := peers[to]; !ok {
+			fmt.Fprintf(conn, "no such region: %s\n", to)
+			return
+		}
+		ch := conn.character
+		if wait := transferCooldown - time.Since(ch.transferred); wait > 0 {
+			fmt.Fprintf(conn, "you moved here too recently.  you can transfer again in %v.\n", wait.Round(time.Minute))
+			return
+		}
+		if conn.InTransit() || !conn.System().station {
+			fmt.Fprintf(conn, "you have to be at a station to transfer.\n")
+			return
+		}
+		if len(conn.colonies) > 0 {
+			fmt.Fprintf(conn, "you can't take colonies with you.  abandon them first.\n")
+			return
+		}
+		if conn.fleet != nil || conn.capital != nil || conn.duel != nil {
+			fmt.Fprintf(conn, "leave your fleet, capital ship and duels behind first.\n")
+			return
+		}
+		if err := conn.Save(); err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(conn, "couldn't save your character.  try again later.\n")
+			return
+		}
+		// the character is marked as gone before it's sent, so that it can
+		// never be live in two regions at once
+		was, wasAt := ch.region, ch.transferred
+		if err := ch.SetRegion(to, time.Now()); err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(conn, "couldn't transfer your character.  try again later.\n")
+			return
+		}
+		fmt.Fprintf(conn, "transferring %s to %s...\n", ch.name, to)
+		if err := conn.Export(to).Send(); err != nil {
+			log_error("transfer of %s to %s failed: %v", ch.name, to, err)
+			if err := ch.SetRegion(was, wasAt); err != nil {
+				log_error("%v", err)
+			}
+			fmt.Fprintf(conn, "the transfer failed: %v\n", err)
+			return
+		}
+		log_info("transferred %s to %s", ch.name, to)
+		conn.Kick(fmt.Sprintf("%s now lives in %s.  connect to that server to carry on playing.", ch.name, to))
+	},
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Fleet struct {
+	leader  *Connection
+	members map[*Connection]bool
+	invites map[*Connection]bool
+}
+
+func (f *Fleet) Notify(template string, args ...interface{}) {
+	for conn, _ := range f.members {
+		fmt.Fprintf(conn, "[fleet] %s\n", fmt.Sprintf(template, args...))
+	}
+}
+
+func (f *Fleet) Remove(conn *Connection) {
+	delete(f.members, conn)
+	conn.fleet = nil
+	if len(f.members) == 0 {
+		return
+	}
+	f.Notify("%s has left the fleet", conn.PlayerName())
+	if f.leader == conn {
+		for member, _ := range f.members {
+			f.leader = member
+			break
+		}
+		f.Notify("%s now leads the fleet", f.leader.PlayerName())
+	}
+}
+
+func (f *Fleet) Disband() {
+	f.Notify("the fleet has been disbanded")
+	for member, _ := range f.members {
+		member.fleet = nil
+	}
+	f.members = nil
+}
+
+func (f *Fleet) Present(s *System) []*Connection {
+	present := make([]*Connection, 0, len(f.members))
+	for member, _ := range f.members {
+		if member.System() == s {
+			present = append(present, member)
+		}
+	}
+	return present
+}
+
+var fleetCommand = &Command{
+	name: "fleet",
+	help: "organizes ships into a fleet.  subcommands: create, invite [player], join [player], leave, disband, info, goto [system], fire [system]",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			args = []string{"info"}
+		}
+		f := conn.fleet
+		switch args[0] {
+		case "create":
+			if f != nil {
+				fmt.Fprintf(conn, "you're already in a fleet.\n")
+				return
+			}
+			conn.fleet = &Fleet{
+				leader:  conn,
+				members: map[*Connection]bool{conn: true},
+				invites: make(map[*Connection]bool, 4),
+			}
+			fmt.Fprintf(conn, "you've formed a fleet.  use \"fleet invite [player]\" to add ships.\n")
+			return
+		case "join":
+			if f != nil {
+				fmt.Fprintf(conn, "you're already in a fleet.\n")
+				return
+			}
+			if len(args) != 2 {
+				fmt.Fprintf(conn, "usage: fleet join [leader-name]\n")
+				return
+			}
+			leader := findConnection(args[1])
+			if leader == nil || leader.fleet == nil || !leader.fleet.invites[conn] {
+				fmt.Fprintf(conn, "%s hasn't invited you to a fleet\n", args[1])
+				return
+			}
+			f = leader.fleet
+			delete(f.invites, conn)
+			f.members[conn] = true
+			conn.fleet = f
+			f.Notify("%s has joined the fleet", conn.PlayerName())
+			return
+		}
+		if f == nil {
+			fmt.Fprintf(conn, "you're not in a fleet.\n")
+			return
+		}
+		switch args[0] {
+		case "info":
+			fmt.Fprintf(conn, "fleet led by %s\n", f.leader.PlayerName())
+			for member, _ := range f.members {
+				where := "in transit"
+				if !member.InTransit() {
+					where = member.System().name
+				}
+				fmt.Fprintf(conn, "\t%-20s %s\n", member.PlayerName(), where)
+			}
+		case "leave":
+			f.Remove(conn)
+			fmt.Fprintf(conn, "you've left the fleet.\n")
+		case "invite", "disband", "goto", "fire":
+			if f.leader != conn {
+				fmt.Fprintf(conn, "only the fleet leader can do that.\n")
+				return
+			}
+			fleetOrder(conn, f, args[0], args[1:]...)
+		default:
+			fmt.Fprintf(conn, "no such fleet subcommand: %s\n", args[0])
+		}
+	},
+}
+
+func fleetOrder(conn *Connection, f *Fleet, order string, args ...string) {
+	switch order {
+	case "invite":
+		if len(args) != 1 {
+			fmt.Fprintf(conn, "usage: fleet invite [player-name]\n")
+			return
+		}
+		other := findConnection(args[0])
+		if other == nil {
+			fmt.Fprintf(conn, "nobody named %s is online\n", args[0])
+			return
+		}
+		f.invites[other] = true
+		fmt.Fprintf(other, "%s has invited you to join their fleet.  use \"fleet join %s\" to accept.\n", conn.PlayerName(), conn.PlayerName())
+		fmt.Fprintf(conn, "invited %s to the fleet\n", other.PlayerName())
+	case "disband":
+		f.Disband()
+	case "goto":
+		if conn.InTransit() {
+			fmt.Fprintf(conn, "the fleet is already underway.\n")
+			return
+		}
+		to := lookupSystem(strings.Join(args, " "))
+		if to == nil {
+			fmt.Fprintf(conn, "hmm, I don't know that system, try something else\n")
+			return
+		}
+		fleetMove(f, conn.System(), to)
+	case "fire":
+		if conn.InTransit() {
+			fmt.Fprintf(conn, "the fleet can't fire while underway.\n")
+			return
+		}
+		to := lookupSystem(strings.Join(args, " "))
+		if to == nil {
+			fmt.Fprintf(conn, "hmm, I don't know that system, try something else\n")
+			return
+		}
+		if reason := TreatyForbids(conn, to); reason != "" {
+			fmt.Fprintf(conn, "bombing %s would violate a peace treaty: %s\n", to.name, reason)
+			return
+		}
+		fleetFire(f, conn, to)
+	}
+}
+
+func fleetMove(f *Fleet, start, to *System) {
+	ships := make([]*Connection, 0, len(f.members))
+	var delay time.Duration
+	for _, member := range f.Present(start) {
+		if member.docked || member.heldBy != nil || member.capital != nil || member.dead {
+			fmt.Fprintf(member, "you can't follow the fleet right now.\n")
+			continue
+		}
+		if d := member.TravelTime(start, to); d > delay {
+			delay = d
+		}
+		ships = append(ships, member)
+	}
+	for _, member := range ships {
+		start.Leave(member)
+	}
+	f.Notify("fleet moving from %s to %s with %d ships. ETA: %v", start.name, to.name, len(ships), delay)
+	After(delay, func() {
+		for _, member := range ships {
+			if member.dead {
+				continue
+			}
+			to.Arrive(member)
+		}
+		f.Notify("fleet has arrived at %s", to.name)
+	})
+}
+
+func fleetFire(f *Fleet, leader *Connection, to *System) {
+	start := leader.System()
+	delay := start.BombTimeTo(to)
+	shooters := make([]*Connection, 0, len(f.members))
+	for _, member := range f.Present(start) {
+		if member.bombs < 1 || !member.CanBomb() || member.docked {
+			continue
+		}
+		member.bombs -= 1
+		member.RecordBomb()
+		shooters = append(shooters, member)
+	}
+	if len(shooters) == 0 {
+		fmt.Fprintf(leader, "nobody in the fleet is ready to fire.\n")
+		return
+	}
+	f.Notify("concentrated fire: %d bombs away to %s. ETA: %v", len(shooters), to.name, delay)
+	After(delay, func() {
+		for _, shooter := range shooters {
+			to.Bombed(shooter, baseYield)
+		}
+	})
+}
+
+func shareScan(receivers map[*Connection]bool, system, source *System, results *scanResults) {
+	forwarded := make(map[*Connection]bool, 8)
+	for conn, _ := range receivers {
+		if conn.fleet == nil {
+			continue
+		}
+		for member, _ := range conn.fleet.members {
+			if receivers[member] || forwarded[member] || member.InTransit() {
+				continue
+			}
+			forwarded[member] = true
+			m := member
+			After(system.LightTimeTo(m.System()), func() {
+				m.EmitScan(source, system, source.LightTimeTo(system), results)
+				for _, ship := range results.ships {
+					m.Identify(ship)
+				}
+			})
+		}
+	}
+}
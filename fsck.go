@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// fsck checks that the things the world refers to actually exist: colonies
+// sit on real systems and belong to real characters, characters are parked
+// in real systems, the edges table is symmetric, and every connected player
+// is in exactly one system.  It can be run against the database with
+//
+//	exo fsck [repair]
+//
+// while the server is stopped, or against the live world from the
+// diagnostic console.
+type fsckProblem struct {
+	desc   string
+	repair func() error
+}
+
+type fsckReport []fsckProblem
+
+func (r *fsckReport) add(repair func() error, template string, args ...interface{}) {
+	*r = append(*r, fsckProblem{desc: fmt.Sprintf(template, args...), repair: repair})
+}
+
+func init() {
+	subcommands["fsck"] = runFsck
+}
+
+// runFsck is the "fsck" subcommand.  It exits non-zero if it finds problems
+// it wasn't asked to repair, or couldn't repair them.
+func runFsck(args []string) int {
+	dbconnect()
+	info_log = log.New(ioutil.Discard, "[INFO] ", 0)
+	error_log = log.New(os.Stderr, "[ERROR] ", 0)
+	setupDb()
+	repair := len(args) > 0 && args[0] == "repair"
+	found, failed := fsck(os.Stdout, repair)
+	if failed > 0 || found > 0 && !repair {
+		return E_Inconsistent
+	}
+	return 0
+}
+
+// fsck runs every check, writing what it finds to w, and repairs what it
+// found if asked to.  It returns the number of problems found and the number
+// that couldn't be repaired.
+func fsck(w io.Writer, repair bool) (int, int) {
+	var report fsckReport
+	fsckColonies(&report)
+	fsckCharacters(&report)
+	fsckEdges(&report)
+	fsckOccupants(&report)
+	failed := 0
+	for _, p := range report {
+		fmt.Fprintf(w, "%s\n", p.desc)
+		if !repair {
+			continue
+		}
+		if err := p.repair(); err != nil {
+			failed++
+			fmt.Fprintf(w, "\tunable to repair: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "\trepaired\n")
+		}
+	}
+	fmt.Fprintf(w, "%d problems found", len(report))
+	if repair {
+		fmt.Fprintf(w, ", %d repaired", len(report)-failed)
+	}
+	fmt.Fprintf(w, "\n")
+	return len(report), failed
+}
+
+func fsckExec(query string, args ...interface{}) func() error {
+	return func() error {
+		_, err := db.Exec(query, args...)
+		return err
+	}
+}
+
+func fsckColonies(report *fsckReport) {
+	rows, err := db.Query(`
+        select system, player,
+            exists (select 1 from planets where id = system),
+            exists (select 1 from characters where name = player)
+        from colonies
+    ;`)
+	if err != nil {
+		log_error("fsck: unable to read colonies: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var owner string
+		var systemOk, ownerOk bool
+		if err := rows.Scan(&id, &owner, &systemOk, &ownerOk); err != nil {
+			log_error("fsck: unable to scan colony row: %v", err)
+			continue
+		}
+		switch {
+		case !systemOk:
+			report.add(fsckExec(`delete from colonies where system = ?`, id),
+				"colony owned by %s is on system %d, which doesn't exist", owner, id)
+		case !ownerOk:
+			s := systemById(id)
+			report.add(func() error {
+				if s != nil && s.Colonizer() != nil && s.Colonizer().PlayerName() == owner {
+					// not DestroyColony: there's nobody to tell
+					s.SetColonizer(nil)
+				}
+				_, err := db.Exec(`delete from colonies where system = ? and player = ?`, id, owner)
+				return err
+			}, "colony on %s belongs to %s, who doesn't exist", systemName(id), owner)
+		}
+	}
+}
+
+func fsckCharacters(report *fsckReport) {
+	rows, err := db.Query(`
+        select id, name, system, home,
+            system = 0 or exists (select 1 from planets where planets.id = characters.system),
+            home = 0 or exists (select 1 from planets where planets.id = characters.home)
+        from characters
+    ;`)
+	if err != nil {
+		log_error("fsck: unable to read characters: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, system, home int
+		var name string
+		var systemOk, homeOk bool
+		if err := rows.Scan(&id, &name, &system, &home, &systemOk, &homeOk); err != nil {
+			log_error("fsck: unable to scan character row: %v", err)
+			continue
+		}
+		// a character with no system starts at home next time they log in
+		if !systemOk {
+			report.add(fsckExec(`update characters set system = 0 where id = ?`, id),
+				"%s is parked in system %d, which doesn't exist", name, system)
+		}
+		if !homeOk {
+			report.add(fsckExec(`update characters set home = 0, home_set = 0 where id = ?`, id),
+				"%s's home is system %d, which doesn't exist", name, home)
+		}
+	}
+}
+
+func fsckEdges(report *fsckReport) {
+	var dangling int
+	row := db.QueryRow(`
+        select count(*) from edges
+        where id_1 not in (select id from planets)
+        or id_2 not in (select id from planets)
+    ;`)
+	if err := row.Scan(&dangling); err != nil {
+		log_error("fsck: unable to count dangling edges: %v", err)
+	} else if dangling > 0 {
+		report.add(fsckExec(`
+            delete from edges
+            where id_1 not in (select id from planets)
+            or id_2 not in (select id from planets)
+        ;`), "%d edges lead to systems that don't exist", dangling)
+	}
+
+	rows, err := db.Query(`
+        select e.id_1, e.id_2, e.distance
+        from edges e
+        where not exists (
+            select 1 from edges f
+            where f.id_1 = e.id_2 and f.id_2 = e.id_1
+        )
+        and e.id_1 in (select id from planets)
+        and e.id_2 in (select id from planets)
+    ;`)
+	if err != nil {
+		log_error("fsck: unable to read edges: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var from, to int
+		var dist float64
+		if err := rows.Scan(&from, &to, &dist); err != nil {
+			log_error("fsck: unable to scan edge row: %v", err)
+			continue
+		}
+		report.add(fsckExec(`insert into edges (id_1, id_2, distance) values (?, ?, ?)`, to, from, dist),
+			"there's an edge from %s to %s but not back", systemName(from), systemName(to))
+	}
+}
+
+// fsckOccupants checks the live world: every connected player should be
+// listed in the system they think they're in and in no other.  Players in
+// transit aren't anywhere.
+func fsckOccupants(report *fsckReport) {
+	seen := make(map[*Connection][]*System, len(connected))
+	eachSystem(func(s *System) {
+		for conn, _ := range s.Occupants() {
+			seen[conn] = append(seen[conn], s)
+		}
+	})
+	for conn, systems := range seen {
+		conn, systems := conn, systems
+		if !connected[conn] {
+			report.add(func() error {
+				for _, s := range systems {
+					s.mu.Lock()
+					delete(s.players, conn)
+					s.mu.Unlock()
+				}
+				return nil
+			}, "%s isn't connected but is still listed in %s", conn.PlayerName(), systemNames(systems))
+			continue
+		}
+		location := conn.System()
+		stray := make([]*System, 0, len(systems))
+		for _, s := range systems {
+			if s != location {
+				stray = append(stray, s)
+			}
+		}
+		if len(stray) == 0 {
+			continue
+		}
+		report.add(func() error {
+			for _, s := range stray {
+				s.mu.Lock()
+				delete(s.players, conn)
+				s.mu.Unlock()
+			}
+			return nil
+		}, "%s is listed in %s but is actually in %s", conn.PlayerName(), systemNames(stray), locationName(location))
+	}
+	for conn, _ := range connected {
+		conn := conn
+		location := conn.System()
+		if location == nil || location.arena || hasSystem(seen[conn], location) {
+			continue
+		}
+		report.add(func() error {
+			location.mu.Lock()
+			if location.players == nil {
+				location.players = make(map[*Connection]bool, 8)
+			}
+			location.players[conn] = true
+			location.mu.Unlock()
+			return nil
+		}, "%s is in %s but isn't listed there", conn.PlayerName(), location.name)
+	}
+}
+
+func hasSystem(systems []*System, s *System) bool {
+	for _, other := range systems {
+		if other == s {
+			return true
+		}
+	}
+	return false
+}
+
+func systemName(id int) string {
+	if s := systemById(id); s != nil {
+		return s.name
+	}
+	return fmt.Sprintf("system %d", id)
+}
+
+func systemNames(systems []*System) string {
+	names := make([]string, len(systems))
+	for i, s := range systems {
+		names[i] = s.name
+	}
+	return fmt.Sprintf("%v", names)
+}
+
+func locationName(s *System) string {
+	if s == nil {
+		return "transit"
+	}
+	return s.name
+}
+
+func consoleFsck(w io.Writer, args []string) {
+	fsck(w, len(args) > 0 && args[0] == "repair")
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+type Good struct {
+	name       string
+	basePrice  int64
+	contraband bool
+}
+
+var goods = map[string]*Good{
+	"ore":        {name: "ore", basePrice: 20},
+	"gas":        {name: "gas", basePrice: 30},
+	"crystal":    {name: "crystal", basePrice: 120},
+	"water":      {name: "water", basePrice: 10},
+	"machinery":  {name: "machinery", basePrice: 80},
+	"spice":      {name: "spice", basePrice: 150, contraband: true},
+	"dragonbone": {name: "dragonbone", basePrice: 400, contraband: true},
+	"elderscale": {name: "elderscale", basePrice: 2500},
+	"dragonegg":  {name: "dragonegg", basePrice: 5000},
+}
+
+func goodNames() []string {
+	names := make([]string, 0, len(goods))
+	for name, _ := range goods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *System) Stock(g *Good) float64 {
+	if s.stock == nil {
+		s.stock = make(map[string]float64, len(goods))
+	}
+	n, ok := s.stock[g.name]
+	if !ok {
+		n = s.Equilibrium(g) * (0.6 + 0.8*rand.Float64())
+		s.stock[g.name] = n
+	}
+	return n
+}
+
+// Equilibrium is the stock of a good a station's market settles at.  Systems
+// rich in a resource have plenty of it and sell it cheap; everything else
+// varies from station to station, which is what makes hauling pay.
+func (s *System) Equilibrium(g *Good) float64 {
+	if _, ok := s.abundance[g.name]; ok {
+		return equilibriumStock * (0.4 + 1.6*s.Abundance(g.name))
+	}
+	if s.demand == nil {
+		s.demand = make(map[string]float64, len(goods))
+	}
+	eq, ok := s.demand[g.name]
+	if !ok {
+		eq = equilibriumStock * (0.5 + rand.Float64())
+		s.demand[g.name] = eq
+	}
+	return eq
+}
+
+func (s *System) Price(g *Good) int64 {
+	factor := math.Sqrt(equilibriumStock / math.Max(1, s.Stock(g)))
+	factor = math.Min(4, math.Max(0.25, factor))
+	return int64(math.Max(1, float64(g.basePrice)*factor*PriceLevel(g)))
+}
+
+func (s *System) Supply(g *Good, n float64) {
+	stock := s.Stock(g) + n
+	s.stock[g.name] = math.Max(0, stock)
+}
+
+func (c *Connection) AddCargo(g *Good, n int) {
+	if c.cargo == nil {
+		c.cargo = make(map[string]int, len(goods))
+	}
+	c.cargo[g.name] += n
+	if c.cargo[g.name] <= 0 {
+		delete(c.cargo, g.name)
+	}
+}
+
+func parseTrade(conn *Connection, args []string) (*Good, int, bool) {
+	if len(args) != 2 {
+		fmt.Fprintf(conn, "usage: [good] [quantity]\n")
+		return nil, 0, false
+	}
+	g, ok := goods[args[0]]
+	if !ok {
+		fmt.Fprintf(conn, "nobody trades in %s around here\n", args[0])
+		return nil, 0, false
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 {
+		fmt.Fprintf(conn, "that's not a quantity: %s\n", args[1])
+		return nil, 0, false
+	}
+	if !conn.System().station {
+		fmt.Fprintf(conn, "there's no market here.  try a station.\n")
+		return nil, 0, false
+	}
+	if !conn.System().TradesWith(conn) {
+		return nil, 0, false
+	}
+	return g, n, true
+}
+
+var marketCommand = &Command{
+	name:   "market",
+	help:   "lists the prices of goods at the current station, or of one good at the nearest stations.  usage: market [good]",
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if len(args) == 1 {
+			surveyMarkets(conn, args[0])
+			return
+		}
+		if !system.station {
+			fmt.Fprintf(conn, "there's no market here.  try a station.\n")
+			return
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		fmt.Fprintf(conn, "%-12s %-8s %s\n", "good", "price", "legal")
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		for _, name := range goodNames() {
+			g := goods[name]
+			legal := "yes"
+			if system.Prohibits(g) {
+				legal = "no"
+			}
+			fmt.Fprintf(conn, "%-12s %-8d %s\n", g.name, system.Price(g), legal)
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+	},
+}
+
+// surveyMarkets compares what a good sells for at the stations near the
+// player, for anyone looking for a haul.
+func surveyMarkets(conn *Connection, name string) {
+	g, ok := goods[name]
+	if !ok {
+		fmt.Fprintf(conn, "nobody trades in %s around here\n", name)
+		return
+	}
+	system := conn.System()
+	neighbors, err := system.Nearby(40)
+	if err != nil {
+		log_error("unable to survey markets near %s: %v", system.name, err)
+		return
+	}
+	fmt.Fprintf(conn, "%s is trading at %.0f%% of its usual price across the galaxy\n", g.name, 100*PriceLevel(g))
+	fmt.Fprintf(conn, "%-20s %-10s %s\n", "station", "distance", "price")
+	if system.station {
+		fmt.Fprintf(conn, "%-20s %-10s %d\n", system.name, "here", system.Price(g))
+	}
+	shown := 0
+	for _, n := range neighbors {
+		other := systemById(n.id)
+		if other == nil || !other.station || other.Prohibits(g) {
+			continue
+		}
+		fmt.Fprintf(conn, "%-20s %-10.1f %d\n", other.name, n.distance, other.Price(g))
+		if shown++; shown == 8 {
+			break
+		}
+	}
+}
+
+var buyCommand = &Command{
+	name:   "buy",
+	help:   "buys goods at a station.  usage: buy [good] [quantity]",
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		g, n, ok := parseTrade(conn, args)
+		if !ok {
+			return
+		}
+		if n > conn.CargoSpace() {
+			fmt.Fprintf(conn, "not enough room!  your hold has space for %d more\n", conn.CargoSpace())
+			return
+		}
+		cost := conn.System().Price(g) * int64(n)
+		if conn.money < cost {
+			fmt.Fprintf(conn, "not enough money!  %d %s costs %d space duckets, you only have %d in the bank.\n", n, g.name, cost, conn.money)
+			return
+		}
+		conn.Withdraw(cost)
+		conn.AddCargo(g, n)
+		conn.System().Supply(g, -float64(n))
+		Traded(g, float64(n))
+		recordVolume(conn.System(), cost)
+		fmt.Fprintf(conn, "bought %d %s for %d space duckets\n", n, g.name, cost)
+	},
+}
+
+var sellCommand = &Command{
+	name:   "sell",
+	help:   "sells goods at a station.  usage: sell [good] [quantity]",
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		g, n, ok := parseTrade(conn, args)
+		if !ok {
+			return
+		}
+		if conn.cargo[g.name] < n {
+			fmt.Fprintf(conn, "you only have %d %s\n", conn.cargo[g.name], g.name)
+			return
+		}
+		earned := conn.System().Price(g) * int64(n)
+		conn.AddCargo(g, -n)
+		conn.System().Supply(g, float64(n))
+		Traded(g, -float64(n))
+		recordVolume(conn.System(), earned)
+		fmt.Fprintf(conn, "sold %d %s for %d space duckets\n", n, g.name, earned)
+		conn.Deposit(earned)
+	},
+}
+
+var cargoCommand = &Command{
+	name:   "cargo",
+	help:   "lists the goods in your cargo hold",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(conn.cargo) == 0 {
+			fmt.Fprintf(conn, "your cargo hold is empty.  capacity: %d\n", conn.design.hold)
+			return
+		}
+		fmt.Fprintf(conn, "hold: %d/%d\n", conn.CargoLoad(), conn.design.hold)
+		for _, name := range goodNames() {
+			if n := conn.cargo[name]; n > 0 {
+				fmt.Fprintf(conn, "%-12s %d\n", name, n)
+			}
+		}
+	},
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The handshake lets bots and richer clients find out what the server speaks
+// before they log in, so the protocol can change without breaking them.  The
+// server opens every connection with a line like
+//
+//	exo protocol 1: json gmcp compress
+//
+// and a client that wants more than plain text answers, in place of its
+// name, with
+//
+//	hello 1 json compress
+//
+// naming the protocol version it was written for and the capabilities it
+// wants.  The server answers "ok" with the version it'll speak and the
+// capabilities it turned on, or "error" if it can't speak that version at
+// all, and then carries on asking for a name.  Clients that never say hello
+// get version 1 in plain text, which is what everyone got before there was a
+// handshake.
+//
+// When something incompatible changes, bump protocolVersion and check
+// ProtocolVersion() wherever the old behavior has to be kept for older
+// clients.
+const (
+	protocolVersion    = 1
+	minProtocolVersion = 1
+)
+
+const (
+	// every line of output is a json object; see protocol.go
+	CAP_JSON = "json"
+	// structured output goes out as telnet GMCP messages alongside the text
+	CAP_GMCP = "gmcp"
+	// output is a zlib stream, flushed after every write
+	CAP_Compress = "compress"
+)
+
+// telnet bytes for GMCP framing
+const (
+	telnetIAC  = 255
+	telnetSB   = 250
+	telnetSE   = 240
+	telnetGMCP = 201
+)
+
+// Capabilities lists what this connection's transport can support.
+// Websockets already frame and compress their own messages, so they only
+// get json.
+func (c *Connection) Capabilities() []string {
+	if _, ok := c.rw.(net.Conn); ok {
+		return []string{CAP_JSON, CAP_GMCP, CAP_Compress}
+	}
+	return []string{CAP_JSON}
+}
+
+func (c *Connection) Offers(capability string) bool {
+	for _, offered := range c.Capabilities() {
+		if offered == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Connection) ProtocolVersion() int {
+	if c.version == 0 {
+		return minProtocolVersion
+	}
+	return c.version
+}
+
+// Greet sends the banner advertising the protocol version and capabilities.
+func (c *Connection) Greet() {
+	c.send([]byte(fmt.Sprintf("exo protocol %d: %s\n", protocolVersion, strings.Join(c.Capabilities(), " "))))
+}
+
+// Negotiate handles a client's hello.  The answer always goes out as a plain
+// line, before any of the capabilities it turns on take effect.
+func (c *Connection) Negotiate(args []string) {
+	if c.version != 0 {
+		c.send([]byte("error already negotiated\n"))
+		return
+	}
+	if len(args) == 0 {
+		c.send([]byte("error usage: hello [version] [capabilities]\n"))
+		return
+	}
+	version, err := strconv.Atoi(args[0])
+	if err != nil {
+		c.send([]byte(fmt.Sprintf("error not a version: %s\n", args[0])))
+		return
+	}
+	if version < minProtocolVersion {
+		c.send([]byte(fmt.Sprintf("error unsupported version %d; this server speaks %d to %d\n", version, minProtocolVersion, protocolVersion)))
+		return
+	}
+	if version > protocolVersion {
+		// the client is newer than we are.  it's up to the client to decide
+		// whether it can talk down to us.
+		version = protocolVersion
+	}
+	c.version = version
+
+	enabled := make([]string, 0, len(args)-1)
+	seen := make(map[string]bool, len(args)-1)
+	for _, capability := range args[1:] {
+		capability = strings.ToLower(capability)
+		if seen[capability] || !c.Offers(capability) {
+			continue
+		}
+		seen[capability] = true
+		enabled = append(enabled, capability)
+	}
+	reply := []byte(strings.TrimSpace(fmt.Sprintf("ok %d %s", version, strings.Join(enabled, " "))) + "\n")
+	if seen[CAP_Compress] {
+		c.sendThenCompress(reply)
+	} else {
+		c.send(reply)
+	}
+	if seen[CAP_JSON] {
+		c.protocol = P_JSON
+	}
+	c.gmcp = seen[CAP_GMCP]
+	log_info("client at %s negotiated protocol %d with %v", c.RemoteIP(), version, enabled)
+}
+
+// sendThenCompress sends p in the clear and compresses everything after it.
+func (c *Connection) sendThenCompress(p []byte) {
+	if c.rw == nil {
+		return
+	}
+	if c.outbox == nil {
+		c.write(p)
+		c.startCompression()
+		return
+	}
+	c.enqueue(outgoing{p: append([]byte(nil), p...), queued: time.Now(), compress: true})
+}
+
+// startCompression is only ever called from whichever goroutine is writing
+// to the client, so the stream never sees two writers.
+func (c *Connection) startCompression() {
+	if c.deflate == nil {
+		c.deflate = zlib.NewWriter(c.rw)
+	}
+}
+
+// write puts bytes on the wire, through the compressor if there is one.
+func (c *Connection) write(p []byte) (int, error) {
+	if c.deflate == nil {
+		return c.rw.Write(p)
+	}
+	if _, err := c.deflate.Write(p); err != nil {
+		return 0, err
+	}
+	return len(p), c.deflate.Flush()
+}
+
+// sendGMCP sends structured data as a telnet GMCP message, for clients that
+// asked for it.  The package is named after the kind of message, so a scan
+// arrives as Exo.Scan.
+func (c *Connection) sendGMCP(kind string, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		log_error("unable to encode %s gmcp message for %s: %v", kind, c.PlayerName(), err)
+		return
+	}
+	pkg := "Exo." + strings.ToUpper(kind[:1]) + kind[1:]
+	frame := make([]byte, 0, len(pkg)+len(b)+6)
+	frame = append(frame, telnetIAC, telnetSB, telnetGMCP)
+	frame = append(frame, pkg...)
+	frame = append(frame, ' ')
+	frame = append(frame, b...)
+	frame = append(frame, telnetIAC, telnetSE)
+	c.send(frame)
+}
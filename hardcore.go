@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Memorial struct {
+	name    string
+	kills   int
+	money   int64
+	started time.Time
+	died    time.Time
+	system  string
+	killer  string
+}
+
+func memorialTable() {
+	stmnt := `create table if not exists memorial (
+        id integer not null primary key autoincrement,
+        character integer not null,
+        name text not null,
+        kills integer not null,
+        money integer not null,
+        started integer not null,
+        died integer not null,
+        system text not null,
+        killer text not null default ''
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create memorial table: %v", err)
+	}
+}
+
+func (m *Memorial) Survived() time.Duration {
+	return m.died.Sub(m.started)
+}
+
+// ironTitle is the cosmetic recognition for surviving a long hardcore run.
+func ironTitle(survived time.Duration) string {
+	switch {
+	case survived >= 7*24*time.Hour:
+		return "adamant"
+	case survived >= 24*time.Hour:
+		return "iron"
+	default:
+		return "hardcore"
+	}
+}
+
+func (c *Connection) Hardcore() bool {
+	return c.character != nil && c.character.hardcore
+}
+
+// DisplayName is the player's name with their chosen title, any hardcore
+// recognition and their alliance attached.
+func (c *Connection) DisplayName() string {
+	name := c.PlayerName()
+	if c.character != nil && c.character.title != "" {
+		name = fmt.Sprintf("%s the %s", name, c.character.title)
+	}
+	if c.Hardcore() {
+		name = fmt.Sprintf("%s [%s]", name, ironTitle(time.Since(c.character.hardcoreSince)))
+	}
+	if a := c.Alliance(); a != nil {
+		name = fmt.Sprintf("%s <%s>", name, a.name)
+	}
+	return name
+}
+
+func (ch *Character) EnableHardcore() error {
+	now := time.Now()
+	_, err := db.Exec(`update characters set hardcore = 1, hardcore_since = ? where id = ?`, now.Unix(), ch.id)
+	if err != nil {
+		return fmt.Errorf("unable to make %s hardcore: %v", ch.name, err)
+	}
+	ch.hardcore = true
+	ch.hardcoreSince = now
+	return nil
+}
+
+// Perish ends a hardcore character for good and carves their name on the
+// memorial.
+func (c *Connection) Perish() {
+	ch := c.character
+	system := "deep space"
+	if c.lastLoss.system != nil {
+		system = c.lastLoss.system.name
+	}
+	now := time.Now()
+	_, err := db.Exec(`
+        insert into memorial
+        (character, name, kills, money, started, died, system)
+        values
+        (?, ?, ?, ?, ?, ?, ?)
+    ;`, ch.id, ch.name, c.kills, c.money, ch.hardcoreSince.Unix(), now.Unix(), system)
+	if err != nil {
+		log_error("unable to record %s on the memorial: %v", ch.name, err)
+	}
+	if _, err := db.Exec(`update characters set dead = 1 where id = ?`, ch.id); err != nil {
+		log_error("unable to retire hardcore character %s: %v", ch.name, err)
+	}
+	ch.dead = true
+	survived := now.Sub(ch.hardcoreSince)
+	publishNews("the %s pilot %s has perished in %s after %v", ironTitle(survived), ch.name, system, survived)
+	fmt.Fprintf(c, "your hardcore run is over.  %s survived for %v and has been added to the memorial.\n", ch.name, survived)
+	After(5*time.Second, func() {
+		c.Close()
+	})
+}
+
+func noteMemorialKiller(victim, attacker *Connection) {
+	if !victim.Hardcore() {
+		return
+	}
+	_, err := db.Exec(`
+        update memorial set killer = ?
+        where id = (select max(id) from memorial where character = ?)
+    ;`, attacker.PlayerName(), victim.character.id)
+	if err != nil {
+		log_error("unable to note killer on memorial: %v", err)
+	}
+}
+
+func memorialEntries(n int) ([]Memorial, error) {
+	rows, err := db.Query(`
+        select name, kills, money, started, died, system, killer
+        from memorial
+        order by died - started desc
+        limit ?
+    ;`, n)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read memorial: %v", err)
+	}
+	defer rows.Close()
+	entries := make([]Memorial, 0, n)
+	for rows.Next() {
+		var m Memorial
+		var started, died int64
+		if err := rows.Scan(&m.name, &m.kills, &m.money, &started, &died, &m.system, &m.killer); err != nil {
+			return nil, fmt.Errorf("unable to scan memorial row: %v", err)
+		}
+		m.started = time.Unix(started, 0)
+		m.died = time.Unix(died, 0)
+		entries = append(entries, m)
+	}
+	return entries, rows.Err()
+}
+
+var hardcoreCommand = &Command{
+	name:   "hardcore",
+	help:   "shows your hardcore status.  use \"hardcore enable\" on a brand new character to make its death permanent",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		ch := conn.character
+		if len(args) == 0 {
+			if !ch.hardcore {
+				fmt.Fprintf(conn, "%s is not a hardcore character.\n", ch.name)
+				return
+			}
+			fmt.Fprintf(conn, "%s has survived hardcore for %v.  title: %s\n", ch.name, time.Since(ch.hardcoreSince), ironTitle(time.Since(ch.hardcoreSince)))
+			return
+		}
+		if args[0] != "enable" {
+			fmt.Fprintf(conn, "usage: hardcore [enable]\n")
+			return
+		}
+		if ch.hardcore {
+			fmt.Fprintf(conn, "%s is already hardcore.\n", ch.name)
+			return
+		}
+		if conn.Rank() > 1 || len(conn.ships) > 0 {
+			fmt.Fprintf(conn, "only brand new characters can go hardcore.\n")
+			return
+		}
+		if err := ch.EnableHardcore(); err != nil {
+			log_error("%v", err)
+			return
+		}
+		fmt.Fprintf(conn, "%s is now hardcore.  if your ship is destroyed, %s is gone for good.\n", ch.name, ch.name)
+	},
+}
+
+var memorialCommand = &Command{
+	name:   "memorial",
+	help:   "lists the longest hardcore runs that have ended",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		entries, err := memorialEntries(20)
+		if err != nil {
+			log_error("%v", err)
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Fprintf(conn, "the memorial is empty.\n")
+			return
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		for _, m := range entries {
+			cause := "lost in " + m.system
+			if m.killer != "" {
+				cause = fmt.Sprintf("killed by %s in %s", m.killer, m.system)
+			}
+			fmt.Fprintf(conn, "%-20s %-9s %-14v %3d kills  %s\n", m.name, ironTitle(m.Survived()), m.Survived().Truncate(time.Minute), m.kills, cause)
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+	},
+}
@@ -0,0 +1,373 @@
+//go:build harness
+// +build harness
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The harness boots the game against a tiny fixed galaxy and a throwaway
+// database, with the scheduler on a fake clock, and plays a script against
+// it through in-process connections.  Nothing waits on the wall clock: the
+// script winds the clock forward and whatever comes due runs right away, in
+// order, so things like scan echoes and bombs in flight play out the same
+// way every time.  It's only built with the harness tag:
+//
+//	go build -tags harness -o exo-harness
+//	./exo-harness harness scripts/scan-echo.script
+//
+// A script is one step per line:
+//
+//	# a comment
+//	join alice            connects a new player called alice
+//	place alice Sol       puts alice in a system without traveling there
+//	alice: scan           sends alice's next command and waits for it to run
+//	wait 1500ms           winds the clock forward, running whatever comes due
+//	expect alice text     fails unless alice has been sent text; output up
+//	                      to the match is consumed
+//	reject alice text     fails if alice's unconsumed output contains text
+//
+// The harness exits 0 if every step passes.
+func init() {
+	subcommands["harness"] = runHarness
+}
+
+// the whole galaxy, as far as the harness is concerned.  One unit of
+// distance is a tenth of a second of light time.
+var harnessGalaxy = []*System{
+	{name: "Sol", x: 0, y: 0, z: 0, planets: 8},
+	{name: "Alpha", x: 10, y: 0, z: 0, planets: 3},
+	{name: "Bravo", x: 0, y: 20, z: 0, planets: 1},
+	{name: "Charlie", x: 30, y: 30, z: 0, planets: 4},
+}
+
+// how long to give the game's own goroutines to catch up.  This is real
+// time, but it's only ever a ceiling: the harness moves on as soon as
+// they're done.
+const harnessPatience = 5 * time.Second
+
+type Harness struct {
+	now     time.Time
+	players map[string]*scriptConn
+	dbPath  string
+}
+
+func runHarness(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: exo harness [script]\n")
+		return E_Bad_Config
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to open script: %v\n", err)
+		return E_Bad_Config
+	}
+	defer f.Close()
+	h, err := bootHarness()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to boot harness: %v\n", err)
+		return E_No_DB
+	}
+	defer os.Remove(h.dbPath)
+	if err := h.Run(f); err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%v\n", args[0], err)
+		return 1
+	}
+	fmt.Printf("%s: ok\n", args[0])
+	return E_Ok
+}
+
+func bootHarness() (*Harness, error) {
+	info_log = log.New(ioutil.Discard, "[INFO] ", 0)
+	if os.Getenv("EXO_HARNESS_VERBOSE") != "" {
+		info_log = log.New(os.Stderr, "[INFO] ", 0)
+	}
+	error_log = log.New(os.Stderr, "[ERROR] ", 0)
+	rand.Seed(1)
+	signupPuzzle = false
+	signupVerify = ""
+
+	f, err := ioutil.TempFile("", "exo-harness-*.db")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	h := &Harness{
+		now:     time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC),
+		players: make(map[string]*scriptConn, 4),
+		dbPath:  f.Name(),
+	}
+	setClock(h)
+
+	db, err = sql.Open("sqlite3", h.dbPath)
+	if err != nil {
+		return nil, err
+	}
+	planetsTable()
+	for _, s := range harnessGalaxy {
+		s.Store(db)
+	}
+	setupDb()
+	return h, nil
+}
+
+// The harness is its own clock.  Time only passes when a script waits.
+func (h *Harness) Now() time.Time {
+	return h.now
+}
+
+func (h *Harness) Wall(d time.Duration) time.Duration {
+	return -1
+}
+
+func (h *Harness) Run(script io.Reader) error {
+	scanner := bufio.NewScanner(script)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := h.Step(line); err != nil {
+			return fmt.Errorf("%d: %s: %v", n, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (h *Harness) Step(line string) error {
+	if i := strings.Index(line, ":"); i > 0 && !strings.Contains(line[:i], " ") {
+		p, err := h.player(line[:i])
+		if err != nil {
+			return err
+		}
+		return h.send(p, strings.TrimSpace(line[i+1:]))
+	}
+	parts := strings.SplitN(line, " ", 3)
+	switch parts[0] {
+	case "join":
+		if len(parts) != 2 {
+			return fmt.Errorf("usage: join [name]")
+		}
+		return h.join(parts[1])
+	case "place":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: place [name] [system]")
+		}
+		return h.place(parts[1], parts[2])
+	case "wait":
+		if len(parts) != 2 {
+			return fmt.Errorf("usage: wait [duration]")
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return err
+		}
+		return h.wait(d)
+	case "expect", "reject":
+		if len(parts) != 3 {
+			return fmt.Errorf("usage: %s [name] [text]", parts[0])
+		}
+		p, err := h.player(parts[1])
+		if err != nil {
+			return err
+		}
+		if err := h.settle(); err != nil {
+			return err
+		}
+		if parts[0] == "expect" {
+			return p.expect(parts[2])
+		}
+		return p.reject(parts[2])
+	}
+	return fmt.Errorf("unknown step")
+}
+
+func (h *Harness) player(name string) (*scriptConn, error) {
+	p, ok := h.players[name]
+	if !ok {
+		return nil, fmt.Errorf("nobody called %s has joined", name)
+	}
+	return p, nil
+}
+
+func (h *Harness) join(name string) error {
+	if _, ok := h.players[name]; ok {
+		return fmt.Errorf("%s has already joined", name)
+	}
+	p := &scriptConn{
+		name: name,
+		in:   make(chan string),
+		idle: make(chan struct{}),
+	}
+	p.conn = NewConnection(p)
+	h.players[name] = p
+	go handleConnection(p.conn)
+	if err := h.send(p, name); err != nil {
+		return err
+	}
+	if p.pending(`type "accept"`) {
+		if err := h.send(p, "accept"); err != nil {
+			return err
+		}
+	}
+	if p.conn.System() == nil {
+		return fmt.Errorf("%s didn't make it into the game:\n%s", name, p.unread())
+	}
+	return nil
+}
+
+func (h *Harness) place(name, system string) error {
+	p, err := h.player(name)
+	if err != nil {
+		return err
+	}
+	s, ok := systemByName(system)
+	if !ok {
+		return fmt.Errorf("no such system: %s", system)
+	}
+	p.conn.silent = true
+	if here := p.conn.System(); here != nil {
+		here.Leave(p.conn)
+	}
+	s.Arrive(p.conn)
+	p.conn.silent = false
+	return h.settle()
+}
+
+// send hands a player their next line of input and waits for the game to
+// come back asking for another, which is when it's done with this one.
+func (h *Harness) send(p *scriptConn, line string) error {
+	select {
+	case p.in <- line + "\n":
+	case <-time.After(harnessPatience):
+		return fmt.Errorf("%s isn't reading input", p.name)
+	}
+	select {
+	case <-p.idle:
+	case <-time.After(harnessPatience):
+		return fmt.Errorf("%s is stuck on %q", p.name, line)
+	}
+	return h.settle()
+}
+
+// wait winds the clock forward, stopping at each pending event that comes
+// due along the way so they all run at the time they were scheduled for.
+func (h *Harness) wait(d time.Duration) error {
+	until := h.now.Add(d)
+	for {
+		pending := scheduler.Pending()
+		if len(pending) == 0 || pending[0].ts.After(until) {
+			break
+		}
+		if pending[0].ts.After(h.now) {
+			h.now = pending[0].ts
+		}
+		h.runDue()
+		if err := h.settle(); err != nil {
+			return err
+		}
+	}
+	h.now = until
+	return h.settle()
+}
+
+// runDue runs every event that's due, in order, on the harness's own
+// goroutine.  It stands in for RunQueue.
+func (h *Harness) runDue() {
+	for {
+		future, _ := scheduler.next()
+		if future == nil {
+			return
+		}
+		future.work()
+	}
+}
+
+// settle waits for everything the game has written to reach the players.
+func (h *Harness) settle() error {
+	deadline := time.Now().Add(harnessPatience)
+	for _, p := range h.players {
+		if p.conn.outbox == nil {
+			continue
+		}
+		for {
+			if depth, _, _ := p.conn.outbox.Stats(); depth == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("output to %s is backed up", p.name)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// scriptConn is a player's end of an in-process connection.
+type scriptConn struct {
+	name    string
+	conn    *Connection
+	in      chan string
+	idle    chan struct{}
+	started bool
+
+	mu   sync.Mutex
+	out  bytes.Buffer
+	read int
+}
+
+func (p *scriptConn) Read(b []byte) (int, error) {
+	if p.started {
+		p.idle <- struct{}{}
+	}
+	p.started = true
+	line := <-p.in
+	return copy(b, line), nil
+}
+
+func (p *scriptConn) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.out.Write(b)
+}
+
+func (p *scriptConn) unread() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return string(p.out.Bytes()[p.read:])
+}
+
+func (p *scriptConn) pending(text string) bool {
+	return strings.Contains(p.unread(), text)
+}
+
+func (p *scriptConn) expect(text string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	unread := p.out.Bytes()[p.read:]
+	i := bytes.Index(unread, []byte(text))
+	if i < 0 {
+		return fmt.Errorf("%s wasn't sent %q.  unread output:\n%s", p.name, text, unread)
+	}
+	p.read += i + len(text)
+	return nil
+}
+
+func (p *scriptConn) reject(text string) error {
+	if unread := p.unread(); strings.Contains(unread, text) {
+		return fmt.Errorf("%s was sent %q.  unread output:\n%s", p.name, text, unread)
+	}
+	return nil
+}
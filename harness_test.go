@@ -0,0 +1,41 @@
+//go:build harness
+// +build harness
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestHarnessScripts plays every script under scripts/ and fails if any step
+// does.  The game keeps its world in globals, so each script gets a fresh
+// process: the test binary runs itself again with EXO_HARNESS_SCRIPT set,
+// which makes it play that one script and exit.
+//
+//	go test -tags harness -run HarnessScripts
+func TestHarnessScripts(t *testing.T) {
+	if script := os.Getenv("EXO_HARNESS_SCRIPT"); script != "" {
+		os.Exit(runHarness([]string{script}))
+	}
+	scripts, err := filepath.Glob("scripts/*.script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("no scripts found")
+	}
+	for _, script := range scripts {
+		script := script
+		t.Run(filepath.Base(script), func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestHarnessScripts$")
+			cmd.Env = append(os.Environ(), "EXO_HARNESS_SCRIPT="+script)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Errorf("%v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Slain dragons sometimes leave an egg behind.  An egg rides in the hold
+// like any other cargo until it's put in a colony's hatchery, and a long
+// while later it hatches into a dragon that answers to the colony's owner.
+// A pilot only ever has one tamed dragon; hatching another sends the old one
+// off into the wild.
+const (
+	// the chance an ordinary dragon drops an egg.  Elders always do.
+	eggChance = 0.2
+	// how long an egg takes to hatch
+	incubationTime = 12 * time.Hour
+	// how often a seer dragon will scan for you
+	seerRecharge = time.Minute
+	// how much quicker a swift dragon gets you places
+	swiftTravel = 0.8
+)
+
+// the kinds of tamed dragon, and what they do for their pilot
+var tamedKinds = map[string]string{
+	"swift": "guides your ship through the void; travel takes 20% less time",
+	"seer":  "scans for you when your own scanners are recharging, once a minute",
+}
+
+// dropEgg gives a pilot a dragon egg if there's room for it in their hold.
+func dropEgg(conn *Connection, d *Dragon) {
+	if conn.Stow(goods["dragonegg"], 1) == 0 {
+		fmt.Fprintf(conn, "%s left an egg behind, but there's no room for it in your hold.\n", d)
+		return
+	}
+	fmt.Fprintf(conn, "you found a dragon egg in the remains of %s!  incubate it at one of your colonies.\n", d)
+	log_info("%s dropped an egg for %s", d, conn.PlayerName())
+}
+
+func (c *Connection) Tamed(kind string) bool {
+	return c.character != nil && c.character.tamedKind == kind
+}
+
+// Hatch turns the colony's egg into a tamed dragon for its owner, whether
+// or not they're around to see it.
+func (s *System) Hatch(owner *Connection) {
+	s.eggHatches = time.Time{}
+	s.SaveColony()
+	name := dragonNames[rand.Intn(len(dragonNames))]
+	kinds := make([]string, 0, len(tamedKinds))
+	for kind, _ := range tamedKinds {
+		kinds = append(kinds, kind)
+	}
+	kind := kinds[rand.Intn(len(kinds))]
+	_, err := db.Exec(`update characters set tamed = ?, tamed_kind = ? where name = ?`, name, kind, owner.PlayerName())
+	if err != nil {
+		log_error("unable to save tamed dragon for %s: %v", owner.PlayerName(), err)
+		return
+	}
+	if owner.character != nil {
+		owner.character.tamed = name
+		owner.character.tamedKind = kind
+	}
+	log_info("a %s dragon hatched for %s on %s", kind, owner.PlayerName(), s.name)
+	owner.Notice("the egg in your hatchery on %s has hatched!  %s the %s dragon %s.\n", s.name, name, kind, tamedKinds[kind])
+}
+
+var hatcheryCommand = &Command{
+	name: "hatchery",
+	help: "hatches dragon eggs at your colonies.  usage:\n" +
+		"\thatchery             (shows your tamed dragon and your incubating eggs)\n" +
+		"\thatchery incubate    (puts a dragon egg from your hold in this colony's hatchery)",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			if ch := conn.character; ch.tamed != "" {
+				fmt.Fprintf(conn, "your tamed dragon: %s the %s dragon.  it %s.\n", ch.tamed, ch.tamedKind, tamedKinds[ch.tamedKind])
+			} else {
+				fmt.Fprintf(conn, "you don't have a tamed dragon.\n")
+			}
+			incubating := 0
+			eachSystem(func(s *System) {
+				if s.Colonizer() == conn && !s.eggHatches.IsZero() {
+					incubating++
+					fmt.Fprintf(conn, "an egg on %s hatches in %v\n", s.name, s.eggHatches.Sub(clock.Now()).Truncate(time.Minute))
+				}
+			})
+			if incubating == 0 {
+				fmt.Fprintf(conn, "none of your colonies are incubating an egg.\n")
+			}
+			return
+		}
+		if args[0] != "incubate" {
+			fmt.Fprintf(conn, "usage: hatchery [incubate]\n")
+			return
+		}
+		system := conn.System()
+		if system == nil || system.Colonizer() != conn {
+			fmt.Fprintf(conn, "you need to be at one of your colonies to incubate an egg.\n")
+			return
+		}
+		if !system.eggHatches.IsZero() {
+			fmt.Fprintf(conn, "the hatchery on %s already has an egg in it.\n", system.name)
+			return
+		}
+		if conn.cargo["dragonegg"] < 1 {
+			fmt.Fprintf(conn, "you don't have a dragon egg.\n")
+			return
+		}
+		conn.AddCargo(goods["dragonegg"], -1)
+		system.eggHatches = clock.Now().Add(incubationTime)
+		system.SaveColony()
+		if err := conn.Save(); err != nil {
+			log_error("%v", err)
+		}
+		fmt.Fprintf(conn, "the egg is warm in the hatchery on %s.  it will hatch in %v.  keep the colony safe until then.\n", system.name, incubationTime)
+		if conn.character.tamed != "" {
+			fmt.Fprintf(conn, "when it hatches, %s will return to the wild.\n", conn.character.tamed)
+		}
+	},
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+type Hazard struct {
+	kind   string
+	damage int
+	until  time.Time
+}
+
+func (h *Hazard) Active() bool {
+	return h != nil && (h.until.IsZero() || clock.Now().Before(h.until))
+}
+
+func (s *System) Hazard() *Hazard {
+	if !s.hazard.Active() {
+		return nil
+	}
+	return s.hazard
+}
+
+func (s *System) Scorch(d time.Duration) {
+	if s.hazard.Active() && s.hazard.until.IsZero() {
+		return
+	}
+	s.hazard = &Hazard{kind: "dragon-scorched", damage: 5, until: clock.Now().Add(d)}
+	s.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "dragon fire has left %s a scorched, burning wasteland\n", s.name)
+	})
+}
+
+func seedHazards() {
+	for _, s := range allSystems() {
+		if rand.Float64() < 0.05 {
+			s.hazard = &Hazard{kind: "radiation belt", damage: 3}
+		}
+	}
+}
+
+func startHazards() {
+	After(10*time.Second, hazardTick)
+}
+
+func hazardTick() {
+	defer After(10*time.Second, hazardTick)
+	for _, s := range allSystems() {
+		h := s.Hazard()
+		if h == nil {
+			continue
+		}
+		s.EachConn(func(conn *Connection) {
+			if conn.docked || conn.dead {
+				return
+			}
+			fmt.Fprintf(conn, "the %s of %s eats at your hull\n", h.kind, s.name)
+			conn.Damage(h.damage, nil, h.kind)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	baseYield   = 100
+	heavyYield  = 150
+	heatWindow  = 30 * time.Second
+	burnoutTime = 2 * time.Minute
+)
+
+var heatModules = map[string]string{
+	"scanner":  "halves the scanner recharge time",
+	"launcher": "bombs hit 50% harder and punch through escorts and fighters",
+	"engines":  "cuts travel time by a third",
+}
+
+func (c *Connection) Hot(module string) bool {
+	return clock.Now().Before(c.overheated[module])
+}
+
+func (c *Connection) Burnt(module string) bool {
+	return clock.Now().Before(c.burnt[module])
+}
+
+// Strain is called every time an overheated module is used.  There's a one
+// in four chance that it burns out, taking it offline and scorching the hull.
+func (c *Connection) Strain(module string) {
+	if rand.Intn(4) != 0 {
+		return
+	}
+	delete(c.overheated, module)
+	if c.burnt == nil {
+		c.burnt = make(map[string]time.Time, len(heatModules))
+	}
+	c.burnt[module] = clock.Now().Add(burnoutTime)
+	fmt.Fprintf(c, "your %s burns out!  it will be offline for %v.\n", module, burnoutTime)
+	c.Damage(10, nil, "")
+	After(burnoutTime, func() {
+		fmt.Fprintf(c, "your %s is back online.\n", module)
+	})
+}
+
+func (c *Connection) BurntOut(module string) bool {
+	if !c.Burnt(module) {
+		return false
+	}
+	fmt.Fprintf(c, "your %s is burnt out.  it will be back online in %v\n", module, c.burnt[module].Sub(clock.Now()))
+	return true
+}
+
+var overheatCommand = &Command{
+	name:   "overheat",
+	help:   "pushes a module past its limits for 30 seconds, at the risk of burning it out.  usage: overheat [scanner|launcher|engines]",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) != 1 {
+			for name, effect := range heatModules {
+				fmt.Fprintf(conn, "%-10s %s\n", name, effect)
+			}
+			return
+		}
+		module := args[0]
+		if _, ok := heatModules[module]; !ok {
+			fmt.Fprintf(conn, "you can't overheat %s\n", module)
+			return
+		}
+		if conn.BurntOut(module) {
+			return
+		}
+		if conn.overheated == nil {
+			conn.overheated = make(map[string]time.Time, len(heatModules))
+		}
+		conn.overheated[module] = clock.Now().Add(heatWindow)
+		fmt.Fprintf(conn, "overheating your %s for %v: %s\n", module, heatWindow, heatModules[module])
+	},
+}
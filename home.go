@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const homeCooldown = 24 * time.Hour
+
+// randomHome picks a starting home system for a new player.  Players start out
+// at a station in high security space if there is one to be found.
+func randomHome() *System {
+	var fallback *System
+	for _, s := range allSystems() {
+		if s.arena || !s.station {
+			continue
+		}
+		if s.HighSec() {
+			return s
+		}
+		fallback = s
+	}
+	if fallback == nil {
+		fallback, _ = randomSystem()
+	}
+	return fallback
+}
+
+func (ch *Character) Home() *System {
+	return systemById(ch.home)
+}
+
+func (ch *Character) SetHome(s *System) error {
+	now := time.Now()
+	_, err := db.Exec(`update characters set home = ?, home_set = ? where id = ?`, s.id, now.Unix(), ch.id)
+	if err != nil {
+		return fmt.Errorf("unable to set home for character %s: %v", ch.name, err)
+	}
+	ch.home = s.id
+	ch.homeSet = now
+	return nil
+}
+
+// HomeSystem is where the player spawns and respawns.
+func (c *Connection) HomeSystem() (*System, error) {
+	if c.character != nil {
+		if home := c.character.Home(); home != nil {
+			return home, nil
+		}
+	}
+	return randomSystem()
+}
+
+var homeCommand = &Command{
+	name: "home",
+	help: "shows your home system, where you respawn.  usage:\n" +
+		"\thome\n" +
+		"\thome set   (at one of your colonies, once a day)\n" +
+		"\thome repair   (free basic repairs at your home system)",
+	handler: func(conn *Connection, args ...string) {
+		home := conn.character.Home()
+		system := conn.System()
+		if len(args) == 0 {
+			if home == nil {
+				fmt.Fprintf(conn, "you don't have a home system.\n")
+				return
+			}
+			fmt.Fprintf(conn, "your home system is %s (%v away)\n", home.name, system.TravelTimeTo(home))
+			return
+		}
+		switch args[0] {
+		case "set":
+			if system.Colonizer() != conn && (system.corp == nil || system.corp != memberships[conn.PlayerName()]) {
+				fmt.Fprintf(conn, "you can only make your home at one of your colonies.\n")
+				return
+			}
+			if wait := -time.Since(conn.character.homeSet.Add(homeCooldown)); wait > 0 {
+				fmt.Fprintf(conn, "you moved recently.  you can change your home again in %v\n", wait)
+				return
+			}
+			if err := conn.character.SetHome(system); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "the registry office is closed.  try again later.\n")
+				return
+			}
+			fmt.Fprintf(conn, "%s is now your home system.\n", system.name)
+		case "repair":
+			if system != home {
+				fmt.Fprintf(conn, "free repairs are only available at your home system.\n")
+				return
+			}
+			if conn.hull >= conn.MaxHull() {
+				fmt.Fprintf(conn, "your hull is in perfect condition.\n")
+				return
+			}
+			conn.hull = conn.MaxHull()
+			fmt.Fprintf(conn, "the home yard patches up your ship.  hull: %d\n", conn.hull)
+		default:
+			fmt.Fprintf(conn, "no such home subcommand: %s\n", args[0])
+		}
+	},
+}
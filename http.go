@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"os"
+)
+
+// httpBase is the externally visible address of the web listener, used to
+// build redirect urls.
+var httpBase = os.Getenv("EXO_HTTP_BASE")
+
+func startHTTP() {
+	addr := os.Getenv("EXO_HTTP_ADDR")
+	if addr == "" {
+		return
+	}
+	if httpBase == "" {
+		httpBase = "http://localhost" + addr
+	}
+	go func() {
+		log_info("web listener starting on %s", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log_error("web listener failed: %v", err)
+		}
+	}()
+}
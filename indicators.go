@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Economic indicators are taken every analytics tick, so operators can see
+// inflation or an exploit coming before it wrecks the game: how many
+// credits are out there and how fast they're being made and spent, what
+// goods cost against their base prices, and where the trading is happening.
+// The last day of them is kept in memory, for the "economy" command and
+// /admin/economy.
+type Indicators struct {
+	Taken time.Time `json:"taken"`
+	// duckets held by pilots, online or not, and by corporations
+	Credits  int64 `json:"credits"`
+	Treasury int64 `json:"treasury"`
+	// duckets paid to and taken from pilots since the last reading
+	Minted int64 `json:"minted"`
+	Burned int64 `json:"burned"`
+	// average station price over base price, by good and overall
+	Prices     map[string]float64 `json:"prices"`
+	PriceIndex float64            `json:"price_index"`
+	// duckets of goods traded at stations since the last reading, by sector
+	Volume []sectorVolume `json:"volume"`
+}
+
+type sectorVolume struct {
+	Sector string `json:"sector"`
+	Volume int64  `json:"volume"`
+}
+
+const (
+	// a day of readings at one every five minutes
+	indicatorHistory = 288
+	// how many readings back to compare against when looking for trouble
+	indicatorWindow = 12
+	// growth in credits over the window that's worth a warning
+	creditAlarm = 0.25
+	// how far the price index can drift from 1 before it's worth a warning
+	priceAlarm = 0.5
+)
+
+// ledger collects money and trade flows between readings.
+var ledger = struct {
+	sync.Mutex
+	minted int64
+	burned int64
+	volume map[Sector]int64
+	// past readings, oldest first
+	history []*Indicators
+}{
+	volume: make(map[Sector]int64, 16),
+}
+
+func recordMinted(n int64) {
+	ledger.Lock()
+	ledger.minted += n
+	ledger.Unlock()
+}
+
+func recordBurned(n int64) {
+	ledger.Lock()
+	ledger.burned += n
+	ledger.Unlock()
+}
+
+func recordVolume(s *System, value int64) {
+	ledger.Lock()
+	ledger.volume[s.Sector()] += value
+	ledger.Unlock()
+}
+
+// pilotCredits totals the duckets held by every character.  Online pilots'
+// money is ahead of what's saved, so it's swapped in for theirs.
+func pilotCredits() (int64, error) {
+	var saved int64
+	row := db.QueryRow(`select coalesce(sum(money), 0) from characters where region = '' and dead = 0`)
+	if err := row.Scan(&saved); err != nil {
+		return 0, fmt.Errorf("unable to total pilot credits: %v", err)
+	}
+	for conn, _ := range connected {
+		if conn.character != nil {
+			saved += conn.money - conn.character.money
+		}
+	}
+	return saved, nil
+}
+
+func takeIndicators() *Indicators {
+	ind := &Indicators{
+		Taken:  time.Now(),
+		Prices: make(map[string]float64, len(goods)),
+	}
+	credits, err := pilotCredits()
+	if err != nil {
+		log_error("%v", err)
+	}
+	ind.Credits = credits
+	for _, corp := range corporations {
+		ind.Treasury += corp.treasury
+	}
+
+	for _, name := range goodNames() {
+		g := goods[name]
+		var total float64
+		var count int
+		for _, s := range allSystems() {
+			if s.station && !s.arena {
+				total += float64(s.Price(g)) / float64(g.basePrice)
+				count++
+			}
+		}
+		if count > 0 {
+			ind.Prices[name] = total / float64(count)
+			ind.PriceIndex += ind.Prices[name]
+		}
+	}
+	if len(ind.Prices) > 0 {
+		ind.PriceIndex /= float64(len(ind.Prices))
+	}
+
+	ledger.Lock()
+	defer ledger.Unlock()
+	ind.Minted, ind.Burned = ledger.minted, ledger.burned
+	ledger.minted, ledger.burned = 0, 0
+	for sector, v := range ledger.volume {
+		ind.Volume = append(ind.Volume, sectorVolume{Sector: sector.String(), Volume: v})
+	}
+	ledger.volume = make(map[Sector]int64, len(ledger.volume))
+	sort.Slice(ind.Volume, func(i, j int) bool { return ind.Volume[i].Volume > ind.Volume[j].Volume })
+	ledger.history = append(ledger.history, ind)
+	if len(ledger.history) > indicatorHistory {
+		ledger.history = ledger.history[len(ledger.history)-indicatorHistory:]
+	}
+	return ind
+}
+
+func (s Sector) String() string {
+	return fmt.Sprintf("%d,%d,%d", s.x, s.y, s.z)
+}
+
+// readIndicators returns the readings taken so far, oldest first.
+func readIndicators() []*Indicators {
+	ledger.Lock()
+	defer ledger.Unlock()
+	return append([]*Indicators(nil), ledger.history...)
+}
+
+// checkIndicators warns the admins when credits are piling up faster than
+// they should or prices have come loose.
+func checkIndicators(ind *Indicators) {
+	history := readIndicators()
+	warnings := make([]string, 0, 2)
+	if len(history) > indicatorWindow {
+		then := history[len(history)-1-indicatorWindow]
+		if then.Credits > 0 {
+			if growth := float64(ind.Credits-then.Credits) / float64(then.Credits); growth > creditAlarm {
+				warnings = append(warnings, fmt.Sprintf("pilot credits are up %.0f%% in the last %v", 100*growth, ind.Taken.Sub(then.Taken).Round(time.Minute)))
+			}
+		}
+	}
+	if ind.PriceIndex > 1+priceAlarm || ind.PriceIndex < 1-priceAlarm {
+		warnings = append(warnings, fmt.Sprintf("the price index is at %.2f", ind.PriceIndex))
+	}
+	for _, w := range warnings {
+		log_error("economy: %s", w)
+		for conn, _ := range connected {
+			if conn.IsAdmin() {
+				fmt.Fprintf(conn, "[economy] %s\n", w)
+			}
+		}
+	}
+}
+
+func economyHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "not authorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(readIndicators()); err != nil {
+		log_error("unable to write economic indicators: %v", err)
+	}
+}
+
+func init() {
+	http.HandleFunc("/admin/economy", economyHandler)
+}
+
+var economyCommand = &Command{
+	name:   "economy",
+	help:   "reports the latest economic indicators, and how they've moved over the last hour.  admins only.",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can read the economic indicators.\n")
+			return
+		}
+		history := readIndicators()
+		if len(history) == 0 {
+			fmt.Fprintf(conn, "no indicators have been taken yet.\n")
+			return
+		}
+		now := history[len(history)-1]
+		then := history[0]
+		if len(history) > indicatorWindow {
+			then = history[len(history)-1-indicatorWindow]
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		fmt.Fprintf(conn, "as of %s, compared with %s\n", now.Taken.Format("15:04"), then.Taken.Format("15:04"))
+		fmt.Fprintf(conn, "%-20s %-14d %+d\n", "pilot credits", now.Credits, now.Credits-then.Credits)
+		fmt.Fprintf(conn, "%-20s %-14d %+d\n", "corp treasuries", now.Treasury, now.Treasury-then.Treasury)
+		fmt.Fprintf(conn, "%-20s %d minted, %d burned\n", "last 5 minutes", now.Minted, now.Burned)
+		fmt.Fprintf(conn, "%-20s %-14.2f %+.2f\n", "price index", now.PriceIndex, now.PriceIndex-then.PriceIndex)
+		for _, name := range goodNames() {
+			fmt.Fprintf(conn, "  %-18s %-14.2f %+.2f\n", name, now.Prices[name], now.Prices[name]-then.Prices[name])
+		}
+		fmt.Fprintf(conn, "trade volume by sector, last 5 minutes:\n")
+		if len(now.Volume) == 0 {
+			fmt.Fprintf(conn, "  none\n")
+		}
+		for i, v := range now.Volume {
+			if i == 8 {
+				break
+			}
+			fmt.Fprintf(conn, "  %-18s %d\n", v.Sector, v.Volume)
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+	},
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// in-flight events are stored with enough data to rebuild them after a
+// restart.  each kind of event has its own payload.
+
+type travelEvent struct {
+	Player string
+	To     int
+}
+
+type bombEvent struct {
+	Bomber string
+	To     int
+	Yield  int
+	Class  string
+}
+
+type scanEvent struct {
+	System int
+	Reply  int
+	Reach  float64
+}
+
+type replyEvent struct {
+	Source      int
+	System      int
+	Life        bool
+	Owner       string
+	Corp        string
+	Buoys       int
+	Interdictor bool
+	Contacts    int
+	Wormhole    int
+	Close       bool
+	Hazard      string
+	Weapon      string
+	Dragon      bool
+	Ships       []string
+}
+
+var replayers = map[string]func(data []byte) (func(), error){
+	EV_Travel: func(data []byte) (func(), error) {
+		var e travelEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		return func() { replayTravel(e) }, nil
+	},
+	EV_Bomb: func(data []byte) (func(), error) {
+		var e bombEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		return func() {
+			if to := systemById(e.To); to != nil {
+				to.BombedWith(connectionFor(e.Bomber), bombClass(e.Class), e.Yield)
+			}
+		}, nil
+	},
+	EV_Scan: func(data []byte) (func(), error) {
+		var e scanEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		if e.Reach == 0 {
+			e.Reach = closeScan
+		}
+		return func() { scanSystem(e.System, e.Reply, e.Reach) }, nil
+	},
+	EV_ScanReply: func(data []byte) (func(), error) {
+		var e replyEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		return func() { deliverReply(e.Source, e.System, e.Results()) }, nil
+	},
+}
+
+func encodeEvent(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log_error("unable to encode event: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// connectionFor finds the named player, standing in for them if they're not
+// around.
+func connectionFor(name string) *Connection {
+	if conn := findConnection(name); conn != nil {
+		return conn
+	}
+	return offlineConnection(name)
+}
+
+func replayTravel(e travelEvent) {
+	to := systemById(e.To)
+	if to == nil {
+		return
+	}
+	conn := findConnection(e.Player)
+	if conn == nil {
+		if _, err := db.Exec(`update characters set system = ? where name = ?`, to.id, e.Player); err != nil {
+			log_error("unable to complete interrupted travel for %s: %v", e.Player, err)
+		}
+		return
+	}
+	if conn.dead || conn.capital != nil {
+		return
+	}
+	if !conn.InTransit() {
+		conn.System().Leave(conn)
+	}
+	to.Arrive(conn)
+	fmt.Fprintf(conn, "your interrupted jump completes.  you have arrived at the %s system.\n", to.name)
+}
+
+func newReplyEvent(source, system int, r *scanResults) replyEvent {
+	e := replyEvent{
+		Source:      source,
+		System:      system,
+		Life:        r.life,
+		Buoys:       r.buoys,
+		Interdictor: r.interdictor,
+		Contacts:    r.contacts,
+		Close:       r.close,
+		Hazard:      r.hazard,
+		Weapon:      r.weapon,
+		Dragon:      r.dragon,
+	}
+	if r.colonizedBy != nil {
+		e.Owner = r.colonizedBy.PlayerName()
+	}
+	if r.corp != nil {
+		e.Corp = r.corp.name
+	}
+	if r.wormhole != nil {
+		e.Wormhole = r.wormhole.id
+	}
+	for _, ship := range r.ships {
+		e.Ships = append(e.Ships, ship.PlayerName())
+	}
+	return e
+}
+
+func (e replyEvent) Results() *scanResults {
+	r := &scanResults{
+		life:        e.Life,
+		corp:        corporations[e.Corp],
+		buoys:       e.Buoys,
+		interdictor: e.Interdictor,
+		contacts:    e.Contacts,
+		wormhole:    systemById(e.Wormhole),
+		close:       e.Close,
+		hazard:      e.Hazard,
+		weapon:      e.Weapon,
+		dragon:      e.Dragon,
+	}
+	if e.Owner != "" {
+		r.colonizedBy = connectionFor(e.Owner)
+	}
+	for _, name := range e.Ships {
+		r.ships = append(r.ships, connectionFor(name))
+	}
+	return r
+}
+
+func pendingEventsTable() {
+	stmnt := `create table if not exists pending_events (
+        id integer not null primary key autoincrement,
+        name text not null,
+        remaining integer not null,
+        data text not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create pending events table: %v", err)
+	}
+}
+
+// saveEvents snapshots every pending event that can be rebuilt, along with
+// how long it had left to wait.
+func saveEvents() {
+	tx, err := db.Begin()
+	if err != nil {
+		log_error("unable to save pending events: %v", err)
+		return
+	}
+	if _, err := tx.Exec(`delete from pending_events`); err != nil {
+		log_error("unable to clear pending events: %v", err)
+		tx.Rollback()
+		return
+	}
+	now := clock.Now()
+	for _, future := range scheduler.Pending() {
+		if future.data == "" {
+			continue
+		}
+		remaining := future.ts.Sub(now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		_, err := tx.Exec(`
+            insert into pending_events
+            (name, remaining, data)
+            values
+            (?, ?, ?)
+        ;`, future.name, int64(remaining/time.Millisecond), future.data)
+		if err != nil {
+			log_error("unable to save pending %s event: %v", future.name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log_error("unable to save pending events: %v", err)
+	}
+}
+
+// replayEvents puts events that were in flight when the server went down
+// back on the scheduler, with the time they had left.
+func replayEvents() {
+	rows, err := db.Query(`select name, remaining, data from pending_events`)
+	if err != nil {
+		log_error("unable to load pending events: %v", err)
+		return
+	}
+	n := 0
+	for rows.Next() {
+		var name, data string
+		var remaining int64
+		if err := rows.Scan(&name, &remaining, &data); err != nil {
+			log_error("unable to scan pending event: %v", err)
+			continue
+		}
+		replay, ok := replayers[name]
+		if !ok {
+			continue
+		}
+		work, err := replay([]byte(data))
+		if err != nil {
+			log_error("unable to rebuild pending %s event: %v", name, err)
+			continue
+		}
+		AfterData(name, time.Duration(remaining)*time.Millisecond, data, work)
+		n++
+	}
+	rows.Close()
+	if _, err := db.Exec(`delete from pending_events`); err != nil {
+		log_error("unable to clear pending events: %v", err)
+	}
+	log_info("replayed %d in-flight events", n)
+}
+
+func startEventSnapshots() {
+	After(10*time.Second, snapshotEvents)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		shutdown(sig.String())
+	}()
+}
+
+// shutdown saves everything that needs to survive a restart and exits.
+func shutdown(reason string) {
+	log_info("shutting down (%s), saving state", reason)
+	saveEvents()
+	for conn, _ := range connected {
+		if err := conn.Save(); err != nil {
+			log_error("%v", err)
+		}
+	}
+	os.Exit(0)
+}
+
+func snapshotEvents() {
+	defer After(10*time.Second, snapshotEvents)
+	saveEvents()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// InboundBomb is a bomb on its way to a system.  Anyone in the target system
+// gets one shot at intercepting it before it lands.
+type InboundBomb struct {
+	id       uint64
+	bomber   *Connection
+	class    *BombClass
+	from     *System
+	to       *System
+	arrives  time.Time
+	attempts map[*Connection]bool
+}
+
+var inbound = struct {
+	sync.Mutex
+	bombs map[*System][]*InboundBomb
+}{bombs: make(map[*System][]*InboundBomb, 8)}
+
+func trackBomb(b *InboundBomb) {
+	inbound.Lock()
+	inbound.bombs[b.to] = append(inbound.bombs[b.to], b)
+	inbound.Unlock()
+}
+
+func untrackBomb(b *InboundBomb) {
+	inbound.Lock()
+	defer inbound.Unlock()
+	bombs := inbound.bombs[b.to]
+	for i, other := range bombs {
+		if other == b {
+			bombs = append(bombs[:i], bombs[i+1:]...)
+			break
+		}
+	}
+	if len(bombs) == 0 {
+		delete(inbound.bombs, b.to)
+	} else {
+		inbound.bombs[b.to] = bombs
+	}
+}
+
+func inboundById(id uint64) *InboundBomb {
+	for _, bombs := range inbound.bombs {
+		for _, b := range bombs {
+			if b.id == id {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// forgetInbound stops tracking a bomb whose event was cancelled.
+func forgetInbound(id uint64) {
+	inbound.Lock()
+	b := inboundById(id)
+	inbound.Unlock()
+	if b != nil {
+		untrackBomb(b)
+	}
+}
+
+func rescheduleInbound(id uint64, ts time.Time) {
+	inbound.Lock()
+	defer inbound.Unlock()
+	if b := inboundById(id); b != nil {
+		b.arrives = ts
+	}
+}
+
+// nextInbound is the soonest bomb headed for the system that the player
+// hasn't already taken a shot at.
+func nextInbound(s *System, conn *Connection) *InboundBomb {
+	inbound.Lock()
+	defer inbound.Unlock()
+	var next *InboundBomb
+	for _, b := range inbound.bombs[s] {
+		if b.attempts[conn] {
+			continue
+		}
+		if next == nil || b.arrives.Before(next.arrives) {
+			next = b
+		}
+	}
+	if next == nil || next.id == 0 {
+		return nil
+	}
+	next.attempts[conn] = true
+	return next
+}
+
+// TechLevel is a rough measure of how advanced a ship is: one for the hull
+// and one for every upgrade fitted to it.
+func (c *Connection) TechLevel() int {
+	return 1 + len(c.upgrades)
+}
+
+// InterceptChance is the odds of a ship shooting down a bomb.  Faster bombs
+// are harder to hit.
+func (c *Connection) InterceptChance(b *InboundBomb) float64 {
+	return c.Interception(b).Chance()
+}
+
+func (c *Connection) Interception(b *InboundBomb) Interception {
+	return Interception{TechLevel: c.TechLevel(), BombSpeed: b.class.speed}
+}
+
+var interceptCommand = &Command{
+	name: "intercept",
+	help: "tries to shoot down the next bomb headed for the system you're in.  the better your ship's tech, the better your odds.  you only get one shot at each bomb",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		b := nextInbound(system, conn)
+		if b == nil {
+			fmt.Fprintf(conn, "there are no bombs inbound to %s that you can intercept\n", system.name)
+			return
+		}
+		eta := b.arrives.Sub(clock.Now()).Truncate(time.Second)
+		if !ResolveInterception(conn.Interception(b), dice) {
+			fmt.Fprintf(conn, "you fire on a %s bomb inbound from %s, %v out, and miss!\n", b.class.name, b.from.name, eta)
+			b.bomber.Notice("%s tried to intercept your %s bomb headed for %s, but missed\n", conn.PlayerName(), b.class.name, b.to.name)
+			return
+		}
+		if !scheduler.Cancel(b.id) {
+			untrackBomb(b)
+			fmt.Fprintf(conn, "too late!  the bomb has already hit.\n")
+			return
+		}
+		untrackBomb(b)
+		fmt.Fprintf(conn, "direct hit!  you destroyed a %s bomb inbound from %s, %v out\n", b.class.name, b.from.name, eta)
+		b.bomber.Notice("your %s bomb headed for %s was intercepted by %s\n", b.class.name, b.to.name, conn.PlayerName())
+		log_info("%s intercepted a %s bomb from %s headed for %s", conn.PlayerName(), b.class.name, b.bomber.PlayerName(), b.to.name)
+	},
+}
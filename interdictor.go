@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const interdictorRadius = 15.0
+
+type Interdictor struct {
+	owner *Connection
+	hp    int
+}
+
+// Interdicts returns the first system with a hostile interdictor whose field
+// the straight line between start and to passes through, or nil.
+func Interdicts(p *Connection, start, to *System) *System {
+	var best *System
+	bestT := math.Inf(1)
+	dx, dy, dz := to.x-start.x, to.y-start.y, to.z-start.z
+	length := dx*dx + dy*dy + dz*dz
+	if length == 0 {
+		return nil
+	}
+	for _, s := range allSystems() {
+		if s == start || s == to || s.interdictor == nil || s.interdictor.owner == p {
+			continue
+		}
+		t := ((s.x-start.x)*dx + (s.y-start.y)*dy + (s.z-start.z)*dz) / length
+		if t <= 0 || t >= 1 {
+			continue
+		}
+		d := dist3d(start.x+t*dx, start.y+t*dy, start.z+t*dz, s.x, s.y, s.z)
+		if d < interdictorRadius && t < bestT {
+			best, bestT = s, t
+		}
+	}
+	return best
+}
+
+func (s *System) LoseInterdictor() {
+	i := s.interdictor
+	if i == nil {
+		return
+	}
+	s.interdictor = nil
+	if i.owner.InTransit() {
+		return
+	}
+	After(s.LightTimeTo(i.owner.System()), func() {
+		fmt.Fprintf(i.owner, "lost contact with your interdictor in %s\n", s.name)
+	})
+}
+
+var interdictorCommand = &Command{
+	name: "interdictor",
+	help: "deploy: builds a warp interdictor that pulls passing ships out of transit (costs 2500 space duckets)\n" +
+		"destroy: attacks the interdictor in the current system\n" +
+		"list: lists your interdictors",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			fmt.Fprintf(conn, "usage: interdictor [deploy|destroy|list]\n")
+			return
+		}
+		if args[0] != "list" && conn.InTransit() {
+			fmt.Fprintf(conn, "you can't do that while in transit.\n")
+			return
+		}
+		system := conn.System()
+		switch args[0] {
+		case "deploy":
+			if system.arena {
+				fmt.Fprintf(conn, "interdictors can't be deployed in the arena.\n")
+				return
+			}
+			if system.interdictor != nil {
+				fmt.Fprintf(conn, "there's already an interdictor in %s\n", system.name)
+				return
+			}
+			if conn.money < 2500 {
+				fmt.Fprintf(conn, "not enough money!  interdictors cost 2500 space duckets, you only have %d in the bank.\n", conn.money)
+				return
+			}
+			conn.Withdraw(2500)
+			system.interdictor = &Interdictor{owner: conn, hp: 100}
+			fmt.Fprintf(conn, "deployed a warp interdictor in %s.  ships passing within %v light years will be pulled out of transit.\n", system.name, interdictorRadius)
+		case "destroy":
+			i := system.interdictor
+			if i == nil {
+				fmt.Fprintf(conn, "there's no interdictor in %s\n", system.name)
+				return
+			}
+			if i.owner == conn {
+				system.interdictor = nil
+				fmt.Fprintf(conn, "scuttled your interdictor in %s\n", system.name)
+				return
+			}
+			i.hp -= 25
+			if i.hp > 0 {
+				fmt.Fprintf(conn, "you hit the interdictor.  its integrity is at %d\n", i.hp)
+				return
+			}
+			system.LoseInterdictor()
+			fmt.Fprintf(conn, "destroyed the interdictor in %s\n", system.name)
+		case "list":
+			n := 0
+			for _, s := range allSystems() {
+				if s.interdictor != nil && s.interdictor.owner == conn {
+					fmt.Fprintf(conn, "%-4d %s (integrity %d)\n", s.id, s.name, s.interdictor.hp)
+					n++
+				}
+			}
+			if n == 0 {
+				fmt.Fprintf(conn, "you have no interdictors deployed.\n")
+			}
+		default:
+			fmt.Fprintf(conn, "usage: interdictor [deploy|destroy|list]\n")
+		}
+	},
+}
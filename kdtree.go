@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sort"
+)
+
+// kdNode is a node in a 3d tree of systems.  Each level of the tree splits
+// space along the next axis in turn.
+type kdNode struct {
+	system      *System
+	axis        int
+	left, right *kdNode
+}
+
+// galaxyTree is the spatial index used for neighbor lookups.  It's built
+// once the galaxy is loaded and rebuilt whenever it grows; it's guarded by
+// indexLock along with the index itself.
+var galaxyTree *kdNode
+
+func coord(s *System, axis int) float64 {
+	switch axis {
+	case 0:
+		return s.x
+	case 1:
+		return s.y
+	default:
+		return s.z
+	}
+}
+
+func buildTree(systems []*System, depth int) *kdNode {
+	if len(systems) == 0 {
+		return nil
+	}
+	axis := depth % 3
+	sort.Slice(systems, func(i, j int) bool {
+		return coord(systems[i], axis) < coord(systems[j], axis)
+	})
+	mid := len(systems) / 2
+	return &kdNode{
+		system: systems[mid],
+		axis:   axis,
+		left:   buildTree(systems[:mid], depth+1),
+		right:  buildTree(systems[mid+1:], depth+1),
+	}
+}
+
+// indexTree rebuilds the spatial index from the galaxy index.  The caller
+// must hold indexLock, or be running before anything else can see the index.
+func indexTree() {
+	systems := make([]*System, 0, len(index))
+	for _, s := range index {
+		systems = append(systems, s)
+	}
+	galaxyTree = buildTree(systems, 0)
+}
+
+// nearest collects the n closest systems to s, excluding s itself.  found is
+// kept sorted by distance.
+func (t *kdNode) nearest(s *System, n int, found []Neighbor) []Neighbor {
+	if t == nil {
+		return found
+	}
+	if t.system != s {
+		d := s.DistanceTo(t.system)
+		if len(found) < n || d < found[len(found)-1].distance {
+			i := sort.Search(len(found), func(i int) bool { return found[i].distance > d })
+			found = append(found, Neighbor{})
+			copy(found[i+1:], found[i:])
+			found[i] = Neighbor{id: t.system.id, distance: d}
+			if len(found) > n {
+				found = found[:n]
+			}
+		}
+	}
+	diff := coord(s, t.axis) - coord(t.system, t.axis)
+	near, far := t.left, t.right
+	if diff > 0 {
+		near, far = far, near
+	}
+	found = near.nearest(s, n, found)
+	if len(found) < n || diff*diff < sq(found[len(found)-1].distance) {
+		found = far.nearest(s, n, found)
+	}
+	return found
+}
+
+// within collects every system within radius of s, excluding s itself.
+func (t *kdNode) within(s *System, radius float64, found []Neighbor) []Neighbor {
+	if t == nil {
+		return found
+	}
+	if t.system != s {
+		if d := s.DistanceTo(t.system); d <= radius {
+			found = append(found, Neighbor{id: t.system.id, distance: d})
+		}
+	}
+	diff := coord(s, t.axis) - coord(t.system, t.axis)
+	if diff <= radius {
+		found = t.left.within(s, radius, found)
+	}
+	if diff >= -radius {
+		found = t.right.within(s, radius, found)
+	}
+	return found
+}
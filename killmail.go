@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	W_Bomb         = "bomb"
+	W_SelfDestruct = "self-destruct"
+	W_Fighters     = "fighters"
+	W_Boarding     = "boarding party"
+	W_Dragon       = "dragon fire"
+)
+
+type KillMail struct {
+	ts       time.Time
+	attacker string
+	victim   string
+	ship     string
+	weapon   string
+	system   string
+	value    int64
+}
+
+func killsTable() {
+	stmnt := `create table if not exists kills (
+        id integer not null primary key autoincrement,
+        ts datetime,
+        attacker text,
+        victim text,
+        ship text,
+        weapon text,
+        system text,
+        value integer
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create kills table: %v", err)
+	}
+}
+
+func (k *KillMail) Store() error {
+	_, err := db.Exec(`
+        insert into kills
+        (ts, attacker, victim, ship, weapon, system, value)
+        values
+        (?, ?, ?, ?, ?, ?, ?)
+    ;`, k.ts, k.attacker, k.victim, k.ship, k.weapon, k.system, k.value)
+	if err != nil {
+		return fmt.Errorf("unable to store kill mail: %v", err)
+	}
+	return nil
+}
+
+func (k *KillMail) String() string {
+	return fmt.Sprintf("%s destroyed %s's %s with a %s in %s.  value destroyed: %d space duckets",
+		k.attacker, k.victim, k.ship, k.weapon, k.system, k.value)
+}
+
+func (c *Connection) ShipValue() int64 {
+	value := c.design.cost + int64(500*c.bombs) + int64(300*c.escorts) + int64(150*(c.fighters+c.defenders+c.harassers))
+	for name, n := range c.cargo {
+		value += goods[name].basePrice * int64(n)
+	}
+	return value
+}
+
+func recordKill(attacker, victim *Connection, weapon string) {
+	k := &KillMail{
+		ts:       time.Now(),
+		attacker: attacker.PlayerName(),
+		victim:   victim.PlayerName(),
+		ship:     victim.lastLoss.ship,
+		weapon:   weapon,
+		system:   "deep space",
+		value:    victim.lastLoss.value,
+	}
+	if victim.lastLoss.system != nil {
+		k.system = victim.lastLoss.system.name
+	}
+	if err := k.Store(); err != nil {
+		log_error("%v", err)
+	}
+	noteMemorialKiller(victim, attacker)
+	fmt.Fprintf(attacker, "kill confirmed: %v\n", k)
+	fmt.Fprintf(victim, "loss report: %v\n", k)
+}
+
+var killsCommand = &Command{
+	name:   "kills",
+	help:   "lists recent kill reports.  usage: kills [player-name]",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		name := conn.PlayerName()
+		if len(args) > 0 {
+			name = args[0]
+		}
+		rows, err := db.Query(`
+            select ts, attacker, victim, ship, weapon, system, value
+            from kills
+            where attacker = ? or victim = ?
+            order by ts desc
+            limit 10
+        ;`, name, name)
+		if err != nil {
+			log_error("unable to query kills: %v", err)
+			return
+		}
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			var k KillMail
+			if err := rows.Scan(&k.ts, &k.attacker, &k.victim, &k.ship, &k.weapon, &k.system, &k.value); err != nil {
+				log_error("error unpacking row from kills query: %v", err)
+				continue
+			}
+			fmt.Fprintf(conn, "%s  %v\n", k.ts.Format("2006-01-02 15:04"), &k)
+			n++
+		}
+		if n == 0 {
+			fmt.Fprintf(conn, "no kills on record for %s\n", name)
+		}
+	},
+}
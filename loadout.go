@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func (c *Connection) OwnsModule(name string) bool {
+	return c.modules[name]
+}
+
+func (c *Connection) FreeSlots() int {
+	return c.design.slots - len(c.upgrades)
+}
+
+func (c *Connection) Fit(u *Upgrade) {
+	if c.upgrades == nil {
+		c.upgrades = make(map[string]bool, len(upgrades))
+	}
+	c.upgrades[u.name] = true
+	if u.apply != nil {
+		u.apply(c)
+	}
+}
+
+func (c *Connection) Unfit(u *Upgrade) {
+	delete(c.upgrades, u.name)
+	if u.remove != nil {
+		u.remove(c)
+	}
+}
+
+// canUnfit reports why a module can't be pulled out right now, if at all.
+func (c *Connection) canUnfit(u *Upgrade) string {
+	if u.name == "hangar" && c.fighters < c.hangar {
+		return "recall your fighters before removing the hangar"
+	}
+	return ""
+}
+
+func fittingStation(conn *Connection) bool {
+	if !conn.System().station {
+		fmt.Fprintf(conn, "you can only refit your ship at a station.\n")
+		return false
+	}
+	return true
+}
+
+var fitCommand = &Command{
+	name: "fit",
+	help: "fits a module you own to your ship at a station.  usage: fit [module]",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) != 1 {
+			fmt.Fprintf(conn, "usage: fit [module]\n")
+			return
+		}
+		u, ok := upgrades[args[0]]
+		if !ok || !conn.OwnsModule(u.name) {
+			fmt.Fprintf(conn, "you don't own a %s module\n", args[0])
+			return
+		}
+		if !fittingStation(conn) {
+			return
+		}
+		if conn.HasUpgrade(u.name) {
+			fmt.Fprintf(conn, "the %s module is already fitted.\n", u.name)
+			return
+		}
+		if conn.FreeSlots() < 1 {
+			fmt.Fprintf(conn, "your %s has no free module slots.\n", conn.design.name)
+			return
+		}
+		conn.Fit(u)
+		fmt.Fprintf(conn, "fitted the %s module.\n", u.name)
+	},
+}
+
+var unfitCommand = &Command{
+	name: "unfit",
+	help: "removes a fitted module from your ship at a station.  usage: unfit [module]",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) != 1 {
+			fmt.Fprintf(conn, "usage: unfit [module]\n")
+			return
+		}
+		u, ok := upgrades[args[0]]
+		if !ok || !conn.HasUpgrade(u.name) {
+			fmt.Fprintf(conn, "you don't have a %s module fitted\n", args[0])
+			return
+		}
+		if !fittingStation(conn) {
+			return
+		}
+		if reason := conn.canUnfit(u); reason != "" {
+			fmt.Fprintf(conn, "%s\n", reason)
+			return
+		}
+		conn.Unfit(u)
+		fmt.Fprintf(conn, "removed the %s module.\n", u.name)
+	},
+}
+
+var loadoutCommand = &Command{
+	name: "loadout",
+	help: "manages saved module loadouts.  usage:\n" +
+		"\tloadout list\n" +
+		"\tloadout save [name]\n" +
+		"\tloadout apply [name]\n" +
+		"\tloadout delete [name]",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			args = []string{"list"}
+		}
+		if args[0] == "list" {
+			fmt.Fprintf(conn, "fitted (%d/%d slots): %s\n", len(conn.upgrades), conn.design.slots, strings.Join(conn.Fitted(), ", "))
+			names := make([]string, 0, len(conn.loadouts))
+			for name, _ := range conn.loadouts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(conn, "\t%-12s %s\n", name, strings.Join(conn.loadouts[name], ", "))
+			}
+			return
+		}
+		if len(args) != 2 {
+			fmt.Fprintf(conn, "usage: loadout [save|apply|delete] [name]\n")
+			return
+		}
+		name := args[1]
+		switch args[0] {
+		case "save":
+			if conn.loadouts == nil {
+				conn.loadouts = make(map[string][]string, 4)
+			}
+			conn.loadouts[name] = conn.Fitted()
+			fmt.Fprintf(conn, "saved loadout %s: %s\n", name, strings.Join(conn.loadouts[name], ", "))
+		case "delete":
+			if _, ok := conn.loadouts[name]; !ok {
+				fmt.Fprintf(conn, "no such loadout: %s\n", name)
+				return
+			}
+			delete(conn.loadouts, name)
+			fmt.Fprintf(conn, "deleted loadout %s\n", name)
+		case "apply":
+			applyLoadout(conn, name)
+		default:
+			fmt.Fprintf(conn, "usage: loadout [save|apply|delete] [name]\n")
+		}
+	},
+}
+
+func (c *Connection) Fitted() []string {
+	names := make([]string, 0, len(c.upgrades))
+	for name, _ := range c.upgrades {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func applyLoadout(conn *Connection, name string) {
+	modules, ok := conn.loadouts[name]
+	if !ok {
+		fmt.Fprintf(conn, "no such loadout: %s\n", name)
+		return
+	}
+	if conn.InTransit() {
+		fmt.Fprintf(conn, "you can't refit your ship while in transit.\n")
+		return
+	}
+	if !fittingStation(conn) {
+		return
+	}
+	if len(modules) > conn.design.slots {
+		fmt.Fprintf(conn, "your %s only has %d module slots.\n", conn.design.name, conn.design.slots)
+		return
+	}
+	want := make(map[string]bool, len(modules))
+	for _, m := range modules {
+		if !conn.OwnsModule(m) {
+			fmt.Fprintf(conn, "you no longer own a %s module\n", m)
+			return
+		}
+		want[m] = true
+	}
+	for _, m := range conn.Fitted() {
+		if want[m] {
+			continue
+		}
+		if reason := conn.canUnfit(upgrades[m]); reason != "" {
+			fmt.Fprintf(conn, "%s\n", reason)
+			return
+		}
+	}
+	for _, m := range conn.Fitted() {
+		if !want[m] {
+			conn.Unfit(upgrades[m])
+		}
+	}
+	for _, m := range modules {
+		if !conn.HasUpgrade(m) {
+			conn.Fit(upgrades[m])
+		}
+	}
+	fmt.Fprintf(conn, "applied loadout %s: %s\n", name, strings.Join(modules, ", "))
+}
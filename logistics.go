@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Freighter struct {
+	owner  *Connection
+	corp   *Corporation
+	origin *System
+	hub    *System
+	ore    int
+}
+
+func lookupSystem(name string) *System {
+	if s, ok := systemByName(name); ok {
+		return s
+	}
+	id, err := strconv.Atoi(name)
+	if err != nil {
+		return nil
+	}
+	return systemById(id)
+}
+
+var logisticsCommand = &Command{
+	name: "logistics",
+	help: "ships the output of the colony you're at to a hub system by freighter.  usage: logistics [hub-system|off]",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if system.Colonizer() != conn {
+			fmt.Fprintf(conn, "you need to be at one of your own colonies to set up logistics.\n")
+			return
+		}
+		dest := strings.Join(args, " ")
+		if dest == "off" {
+			system.hub = nil
+			if system.dispatch != nil {
+				scheduler.Cancel(system.dispatch.id)
+				system.dispatch = nil
+			}
+			fmt.Fprintf(conn, "freighter service from %s has been cancelled.\n", system.name)
+			return
+		}
+		hub := lookupSystem(dest)
+		if hub == nil || hub == system {
+			fmt.Fprintf(conn, "hmm, I don't know a system by the name \"%s\", try something else\n", dest)
+			return
+		}
+		system.hub = hub
+		fmt.Fprintf(conn, "colony output from %s will be shipped to %s every 2 minutes.\n", system.name, hub.name)
+		if system.dispatch == nil {
+			system.dispatch = AfterNamed(EV_Freighter, 2*time.Minute, system.DispatchFreighter)
+		}
+	},
+}
+
+var raidCommand = &Command{
+	name: "raid",
+	help: "raids a freighter that's stopped in your system, stealing its cargo",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		for f, _ := range system.freighters {
+			if f.owner == conn {
+				continue
+			}
+			if rand.Float64() < 0.3 {
+				fmt.Fprintf(conn, "the freighter's crew fights you off!\n")
+				return
+			}
+			delete(system.freighters, f)
+			taken := conn.Stow(goods["ore"], f.ore)
+			fmt.Fprintf(conn, "you raided a freighter and hauled away %d ore.\n", taken)
+			fmt.Fprintf(f.owner, "your freighter from %s was raided in %s!\n", f.origin.name, system.name)
+			conn.AdjustReputation(pirateClans, 3)
+			conn.AdjustReputation(minersGuild, -5)
+			f.ore = 0
+			return
+		}
+		fmt.Fprintf(conn, "there are no freighters here to raid.\n")
+	},
+}
+
+func (s *System) DispatchFreighter() {
+	if s.hub == nil || s.Colonizer() == nil {
+		s.hub, s.dispatch = nil, nil
+		return
+	}
+	defer func() {
+		s.dispatch = AfterNamed(EV_Freighter, 2*time.Minute, s.DispatchFreighter)
+	}()
+	if s.stockpile < 1 {
+		return
+	}
+	f := &Freighter{
+		owner:  s.Colonizer(),
+		corp:   s.corp,
+		origin: s,
+		hub:    s.hub,
+		ore:    s.stockpile,
+	}
+	s.stockpile = 0
+	waypoint := waypointBetween(s, s.hub)
+	if waypoint == nil {
+		After(s.TravelTimeTo(f.hub), f.Deliver)
+		return
+	}
+	After(s.TravelTimeTo(waypoint), func() {
+		waypoint.Stopover(f, func() {
+			After(waypoint.TravelTimeTo(f.hub), f.Deliver)
+		})
+	})
+}
+
+func (s *System) Stopover(f *Freighter, then func()) {
+	if s.freighters == nil {
+		s.freighters = make(map[*Freighter]bool, 4)
+	}
+	s.freighters[f] = true
+	s.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "a freighter bound for %s is refueling in %s\n", f.hub.name, s.name)
+	})
+	After(30*time.Second, func() {
+		if !s.freighters[f] {
+			return
+		}
+		delete(s.freighters, f)
+		then()
+	})
+}
+
+func (f *Freighter) Deliver() {
+	if f.ore == 0 {
+		return
+	}
+	ore := goods["ore"]
+	earned := f.hub.Price(ore) * int64(f.ore)
+	f.hub.Supply(ore, float64(f.ore))
+	if f.corp != nil {
+		f.corp.Deposit(earned)
+		f.corp.Notify("freighter from %s delivered %d ore to %s for %d space duckets", f.origin.name, f.ore, f.hub.name, earned)
+		return
+	}
+	fmt.Fprintf(f.owner, "your freighter from %s delivered %d ore to %s for %d space duckets.\n", f.origin.name, f.ore, f.hub.name, earned)
+	f.owner.Deposit(earned)
+}
+
+func waypointBetween(a, b *System) *System {
+	mx, my, mz := (a.x+b.x)/2, (a.y+b.y)/2, (a.z+b.z)/2
+	var best *System
+	bestDist := math.Inf(1)
+	for _, s := range allSystems() {
+		if s == a || s == b {
+			continue
+		}
+		d := dist3d(mx, my, mz, s.x, s.y, s.z)
+		if d < bestDist {
+			best, bestDist = s, d
+		}
+	}
+	if best == nil || bestDist > a.DistanceTo(b)/2 {
+		return nil
+	}
+	return best
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// how long a ship that was left somewhere unsafe stays in space after its
+// pilot disconnects.
+const emergencyWarpDelay = 2 * time.Minute
+
+// ships of disconnected players that are still out in space, by name.
+var stranded = make(map[string]*Connection, 8)
+
+func (c *Connection) SafeToPark() bool {
+	if c.docked {
+		return true
+	}
+	s := c.System()
+	return s != nil && s.HighSec()
+}
+
+// Park takes a disconnected player's ship out of space.  Ships that are
+// docked or in high security space vanish right away; anywhere else the ship
+// hangs around, exposed, until its emergency warp drive kicks in.
+func (c *Connection) Park() {
+	if c.dead || c.character == nil {
+		return
+	}
+	if c.SafeToPark() {
+		if c.location != nil {
+			c.location.Leave(c)
+		}
+		return
+	}
+	log_info("%s disconnected in unsafe space; emergency warp in %v", c.PlayerName(), emergencyWarpDelay)
+	stranded[c.PlayerName()] = c
+	After(emergencyWarpDelay, c.EmergencyWarp)
+}
+
+func (c *Connection) EmergencyWarp() {
+	if stranded[c.PlayerName()] != c {
+		return
+	}
+	if c.InTransit() {
+		After(5*time.Second, c.EmergencyWarp)
+		return
+	}
+	delete(stranded, c.PlayerName())
+	if c.location != nil && !c.dead {
+		c.location.Leave(c)
+	}
+}
+
+// Reclaim pulls any ship the player left stranded out of space when they log
+// back in, so they don't show up twice.
+func (c *Connection) Reclaim() {
+	ghost := stranded[c.PlayerName()]
+	if ghost == nil {
+		return
+	}
+	delete(stranded, c.PlayerName())
+	if ghost.location != nil && !ghost.dead {
+		ghost.silent = true
+		ghost.location.Leave(ghost)
+	}
+}
+
+var logoutCommand = &Command{
+	name: "logout",
+	help: "parks your ship and disconnects.  ships that are docked or in high security space are taken out of space immediately; " +
+		"anywhere else your ship stays behind for a couple of minutes before making an emergency warp.",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		if conn.SafeToPark() {
+			fmt.Fprintf(conn, "your ship is parked safely.  fly safe.\n")
+		} else {
+			fmt.Fprintf(conn, "you're not docked or in high security space.  your ship will stay exposed for %v until its emergency warp completes.\n", emergencyWarpDelay)
+		}
+		conn.leaving = true
+	},
+}
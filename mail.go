@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Mail struct {
+	id   int
+	from string
+	body string
+	sent time.Time
+	read bool
+}
+
+func mailTable() {
+	stmnt := `create table if not exists mailbox (
+        id integer not null primary key autoincrement,
+        recipient text not null,
+        sender text not null,
+        body text not null,
+        sent integer not null,
+        read integer not null default 0
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create mailbox table: %v", err)
+	}
+}
+
+// sendMail leaves a message in a character's mailbox.  Mail from the game
+// itself has no sender.
+func sendMail(to, from, body string) error {
+	_, err := db.Exec(`
+        insert into mailbox
+        (recipient, sender, body, sent)
+        values
+        (?, ?, ?, ?)
+    ;`, to, from, strings.TrimSpace(body), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("unable to deliver mail to %s: %v", to, err)
+	}
+	return nil
+}
+
+func loadMail(name string) ([]Mail, error) {
+	rows, err := db.Query(`
+        select id, sender, body, sent, read
+        from mailbox
+        where recipient = ?
+        order by id
+    ;`, name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mail for %s: %v", name, err)
+	}
+	defer rows.Close()
+	mail := make([]Mail, 0, 8)
+	for rows.Next() {
+		var m Mail
+		var sent int64
+		if err := rows.Scan(&m.id, &m.from, &m.body, &sent, &m.read); err != nil {
+			return nil, err
+		}
+		m.sent = time.Unix(sent, 0)
+		mail = append(mail, m)
+	}
+	return mail, rows.Err()
+}
+
+// Notice tells a player about something important.  If they aren't around to
+// hear it, it goes in their mailbox instead.
+func (c *Connection) Notice(template string, args ...interface{}) {
+	if connected[c] {
+		fmt.Fprintf(c, template, args...)
+		return
+	}
+	if err := sendMail(c.PlayerName(), "", fmt.Sprintf(template, args...)); err != nil {
+		log_error("%v", err)
+	}
+}
+
+// CheckMail lets a player know about mail that came in while they were away.
+func (c *Connection) CheckMail() {
+	mail, err := loadMail(c.PlayerName())
+	if err != nil {
+		log_error("%v", err)
+		return
+	}
+	unread := 0
+	for _, m := range mail {
+		if !m.read {
+			unread++
+		}
+	}
+	switch unread {
+	case 0:
+	case 1:
+		fmt.Fprintf(c, "you have 1 unread message.  type \"mail\" to see it.\n")
+	default:
+		fmt.Fprintf(c, "you have %d unread messages.  type \"mail\" to see them.\n", unread)
+	}
+}
+
+func (m *Mail) Sender() string {
+	if m.from == "" {
+		return "(notice)"
+	}
+	return m.from
+}
+
+var mailCommand = &Command{
+	name: "mail",
+	help: "messages and notices that arrived while you were away.  usage:\n" +
+		"\tmail\n" +
+		"\tmail read [id]\n" +
+		"\tmail delete [id|all]",
+	mobile: true,
+	arena:  true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		name := conn.PlayerName()
+		if len(args) == 0 {
+			mail, err := loadMail(name)
+			if err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "the mail service is down.  try again later.\n")
+				return
+			}
+			if len(mail) == 0 {
+				fmt.Fprintf(conn, "your mailbox is empty.\n")
+				return
+			}
+			for _, m := range mail {
+				flag := " "
+				if !m.read {
+					flag = "*"
+				}
+				preview := m.body
+				if len(preview) > 40 {
+					preview = preview[:37] + "..."
+				}
+				fmt.Fprintf(conn, "%s #%-4d %-20s %s  %s\n", flag, m.id, m.Sender(), m.sent.Format("Jan 2 15:04"), preview)
+			}
+			return
+		}
+		if len(args) != 2 {
+			fmt.Fprintf(conn, "usage: mail read|delete [id]\n")
+			return
+		}
+		switch args[0] {
+		case "read":
+			id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+			if err != nil {
+				fmt.Fprintf(conn, "that's not a message id: %s\n", args[1])
+				return
+			}
+			row := db.QueryRow(`select id, sender, body, sent, read from mailbox where id = ? and recipient = ?`, id, name)
+			var m Mail
+			var sent int64
+			if err := row.Scan(&m.id, &m.from, &m.body, &sent, &m.read); err != nil {
+				fmt.Fprintf(conn, "there's no message #%d in your mailbox\n", id)
+				return
+			}
+			m.sent = time.Unix(sent, 0)
+			fmt.Fprintf(conn, "from: %s\nsent: %s\n\n%s\n", m.Sender(), m.sent.Format(time.RFC1123), m.body)
+			if _, err := db.Exec(`update mailbox set read = 1 where id = ?`, id); err != nil {
+				log_error("unable to mark mail %d read: %v", id, err)
+			}
+		case "delete":
+			if args[1] == "all" {
+				if _, err := db.Exec(`delete from mailbox where recipient = ?`, name); err != nil {
+					log_error("unable to clear mailbox for %s: %v", name, err)
+					fmt.Fprintf(conn, "the mail service is down.  try again later.\n")
+					return
+				}
+				fmt.Fprintf(conn, "your mailbox is empty.\n")
+				return
+			}
+			id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+			if err != nil {
+				fmt.Fprintf(conn, "that's not a message id: %s\n", args[1])
+				return
+			}
+			res, err := db.Exec(`delete from mailbox where id = ? and recipient = ?`, id, name)
+			if err != nil {
+				log_error("unable to delete mail %d: %v", id, err)
+				fmt.Fprintf(conn, "the mail service is down.  try again later.\n")
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				fmt.Fprintf(conn, "there's no message #%d in your mailbox\n", id)
+				return
+			}
+			fmt.Fprintf(conn, "deleted message #%d\n", id)
+		default:
+			fmt.Fprintf(conn, "no such mail subcommand: %s\n", args[0])
+		}
+	},
+}
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -34,13 +35,49 @@ func bail(status int, template string, args ...interface{}) {
 	os.Exit(status)
 }
 
+// envInt reads an integer setting from the environment, falling back to def
+// if it's missing or malformed.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ignoring %s: %v\n", name, err)
+		return def
+	}
+	return n
+}
+
+// envFloat is envInt for settings that can be fractional.
+func envFloat(name string, def float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ignoring %s: %v\n", name, err)
+		return def
+	}
+	return f
+}
+
+// subcommands register themselves here from their own files, as "exo fsck"
+// does in fsck.go.  Some only exist in some builds; see harness.go.
+var subcommands = make(map[string]func(args []string) int)
+
 func handleConnection(conn *Connection) {
 	defer conn.Close()
 	conn.Login()
+	if conn.character == nil {
+		return
+	}
 
-	system, err := randomSystem()
+	system, err := conn.StartSystem()
 	if err != nil {
-		log_error("player %s failed to get random system: %v", conn.PlayerName(), err)
+		log_error("player %s failed to get starting system: %v", conn.PlayerName(), err)
 		return
 	}
 	system.Arrive(conn)
@@ -58,6 +95,9 @@ READING:
 		case nil:
 			break
 		default:
+			if conn.leaving {
+				return
+			}
 			log_error("failed to read line from player %s: %v", conn.PlayerName(), err)
 			time.Sleep(time.Second)
 			continue READING
@@ -74,7 +114,11 @@ READING:
 		parts := strings.Split(line, " ")
 
 		if isCommand(parts[0]) {
+			conn.Commanded()
 			runCommand(conn, parts[0], parts[1:]...)
+			if conn.leaving {
+				return
+			}
 			continue
 		}
 
@@ -88,6 +132,12 @@ READING:
 }
 
 func main() {
+	if len(os.Args) > 1 && subcommands[os.Args[1]] != nil {
+		os.Exit(subcommands[os.Args[1]](os.Args[2:]))
+	}
+	if err := checkConfig(); err != nil {
+		bail(E_Bad_Config, "bad configuration: %v\n", err)
+	}
 	dbconnect()
 	rand.Seed(time.Now().UnixNano())
 	info_log = log.New(os.Stdout, "[INFO] ", 0)
@@ -98,6 +148,28 @@ func main() {
 	if err != nil {
 		bail(E_No_Port, "unable to start server: %v", err)
 	}
+	startEconomy()
+	startWormholes()
+	startHazards()
+	startRelic()
+	startDragons()
+	startTraders()
+	startContests()
+	loadCalendar()
+	loadAlliances()
+	startAnalytics()
+	startSecurity()
+	startExploitChecks()
+	startResearch()
+	startShields()
+	startWars()
+	startMentoring()
+	startAutosave()
+	startHTTP()
+	startWebSockets()
+	startConsole()
+	replayEvents()
+	startEventSnapshots()
 	go RunQueue()
 	for {
 		conn, err := listener.Accept()
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	mentorMinRank   = 3
+	missionGoal     = 500
+	missionReward   = 500
+	milestoneReward = 250
+)
+
+var milestoneRanks = []int{2, 3, 5}
+
+type Mentorship struct {
+	mentor   string
+	student  string
+	progress int64
+	complete bool
+	reached  map[int]bool
+}
+
+var (
+	mentors     = make(map[string]bool, 16)
+	mentorships = make(map[string]*Mentorship, 16)
+)
+
+func (m *Mentorship) Partner(name string) string {
+	if name == m.mentor {
+		return m.student
+	}
+	return m.mentor
+}
+
+func (m *Mentorship) Notify(template string, args ...interface{}) {
+	for _, name := range []string{m.mentor, m.student} {
+		if conn := findConnection(name); conn != nil {
+			fmt.Fprintf(conn, "[mentor] %s\n", fmt.Sprintf(template, args...))
+		}
+	}
+}
+
+// Reward pays both sides of the mentorship, if they're online.
+func (m *Mentorship) Reward(amount int64, reason string) {
+	m.Notify("%s!  you've both earned %d space duckets.", reason, amount)
+	for _, name := range []string{m.mentor, m.student} {
+		if conn := findConnection(name); conn != nil {
+			conn.Deposit(amount)
+		}
+	}
+}
+
+func (m *Mentorship) End() {
+	delete(mentorships, m.mentor)
+	delete(mentorships, m.student)
+}
+
+// MinedTogether advances the shared mission when the student mines while
+// their mentor is in the same system.
+func (c *Connection) MinedTogether(reward int64) {
+	m := mentorships[c.PlayerName()]
+	if m == nil || m.complete || m.student != c.PlayerName() {
+		return
+	}
+	mentor := findConnection(m.mentor)
+	if mentor == nil || mentor.System() != c.System() {
+		return
+	}
+	m.progress += reward
+	if m.progress >= missionGoal {
+		m.complete = true
+		m.Reward(missionReward, "shared mission complete")
+	}
+}
+
+func startMentoring() {
+	After(time.Minute, mentorTick)
+}
+
+func mentorTick() {
+	defer After(time.Minute, mentorTick)
+	for name, m := range mentorships {
+		if name != m.student {
+			continue
+		}
+		student := findConnection(m.student)
+		if student == nil {
+			continue
+		}
+		rank := student.Rank()
+		for _, milestone := range milestoneRanks {
+			if rank >= milestone && !m.reached[milestone] {
+				m.reached[milestone] = true
+				m.Reward(milestoneReward, fmt.Sprintf("%s has reached rank %d", m.student, milestone))
+			}
+		}
+		if m.reached[milestoneRanks[len(milestoneRanks)-1]] {
+			m.Notify("%s has graduated.  the mentorship is complete.", m.student)
+			m.End()
+		}
+	}
+}
+
+var mentorCommand = &Command{
+	name: "mentor",
+	help: "the mentor program.  usage:\n" +
+		"\tmentor   (shows your mentorship)\n" +
+		"\tmentor register|unregister   (veterans only)\n" +
+		"\tmentor request   (new players only)\n" +
+		"\tmentor say [message]\n" +
+		"\tmentor end",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		name := conn.PlayerName()
+		m := mentorships[name]
+		if len(args) == 0 {
+			if m == nil {
+				fmt.Fprintf(conn, "you're not in a mentorship.\n")
+				return
+			}
+			fmt.Fprintf(conn, "mentor: %s\nstudent: %s\n", m.mentor, m.student)
+			if m.complete {
+				fmt.Fprintf(conn, "shared mission: complete\n")
+			} else {
+				fmt.Fprintf(conn, "shared mission: mine %d space duckets together in the same system (%d so far)\n", missionGoal, m.progress)
+			}
+			return
+		}
+		switch args[0] {
+		case "register":
+			if conn.Rank() < mentorMinRank {
+				fmt.Fprintf(conn, "you need to be rank %d to become a mentor.\n", mentorMinRank)
+				return
+			}
+			mentors[name] = true
+			fmt.Fprintf(conn, "you're registered as a mentor.  new players may be paired with you.\n")
+		case "unregister":
+			delete(mentors, name)
+			fmt.Fprintf(conn, "you're no longer taking new students.\n")
+		case "request":
+			if m != nil {
+				fmt.Fprintf(conn, "you're already in a mentorship.\n")
+				return
+			}
+			if conn.Rank() > 1 {
+				fmt.Fprintf(conn, "mentors are for new players.\n")
+				return
+			}
+			for mentorName, _ := range mentors {
+				if mentorships[mentorName] != nil || findConnection(mentorName) == nil {
+					continue
+				}
+				m = &Mentorship{mentor: mentorName, student: name, reached: make(map[int]bool, len(milestoneRanks))}
+				mentorships[mentorName] = m
+				mentorships[name] = m
+				m.Notify("%s is now mentoring %s.  use \"mentor say\" to talk privately.", mentorName, name)
+				return
+			}
+			fmt.Fprintf(conn, "no mentors are available right now.  try again later.\n")
+		case "say":
+			if m == nil {
+				fmt.Fprintf(conn, "you're not in a mentorship.\n")
+				return
+			}
+			m.Notify("%s: %s", name, strings.Join(args[1:], " "))
+		case "end":
+			if m == nil {
+				fmt.Fprintf(conn, "you're not in a mentorship.\n")
+				return
+			}
+			m.Notify("%s has ended the mentorship.", name)
+			m.End()
+		default:
+			fmt.Fprintf(conn, "no such mentor subcommand: %s\n", args[0])
+		}
+	},
+}
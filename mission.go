@@ -0,0 +1,443 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// Missions are odd jobs posted by the colonists of a system: hauling goods
+// to another station, scanning systems the pilot hasn't charted, or putting
+// down a dragon.  Each colonized system has a few on offer at a time, drawn
+// fresh every hour, and they pay in resources.  Accepted missions are kept in
+// the database against the character, and stay there once they're completed
+// so that the same offer can't be taken twice.
+const (
+	M_Deliver = "deliver"
+	M_Scan    = "scan"
+	M_Dragon  = "dragon"
+)
+
+const (
+	missionOffers = 3
+	maxMissions   = 3
+	missionTime   = 24 * time.Hour
+	// how often the offers at a system change
+	missionRotation = time.Hour
+)
+
+var missionGoods = []string{"ore", "gas", "crystal", "water", "machinery"}
+
+type Mission struct {
+	id     int
+	offer  string
+	kind   string
+	origin *System
+	target *System
+	good   string
+	goal   int
+	// how far along the mission is: systems scanned or dragons slain
+	progress int
+	// what it pays: so much of one resource
+	pays     string
+	pay      int
+	deadline time.Time
+}
+
+func missionsTable() {
+	stmnt := `create table if not exists missions (
+        id integer not null primary key autoincrement,
+        character integer not null,
+        offer text not null,
+        kind text not null,
+        origin integer not null,
+        target integer not null default 0,
+        good text not null default '',
+        goal integer not null,
+        progress integer not null default 0,
+        reward_resource text not null,
+        reward_quantity integer not null,
+        deadline integer not null,
+        unique (character, offer)
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create missions table: %v", err)
+	}
+	addColumn("missions", "completed", "integer not null default 0")
+	stmnt = `create table if not exists mission_scans (
+        mission integer not null,
+        system integer not null,
+        unique (mission, system)
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create mission_scans table: %v", err)
+	}
+}
+
+func (m *Mission) String() string {
+	switch m.kind {
+	case M_Deliver:
+		return fmt.Sprintf("deliver %d %s to %s", m.goal, m.good, m.target.name)
+	case M_Scan:
+		return fmt.Sprintf("scan %d systems you haven't charted (%d/%d)", m.goal, m.progress, m.goal)
+	default:
+		return "slay a dragon"
+	}
+}
+
+// MissionOffers are the missions on offer at a colonized system right now.
+// They're the same for every pilot who asks within the hour.
+func (s *System) MissionOffers() []*Mission {
+	if s.Colonizer() == nil || s.arena {
+		return nil
+	}
+	slot := clock.Now().Truncate(missionRotation)
+	rng := rand.New(rand.NewSource(int64(s.id)*1000003 + slot.Unix()))
+	neighbors, err := s.Nearby(20)
+	if err != nil {
+		log_error("unable to find mission targets near %s: %v", s.name, err)
+	}
+	stations := make([]*System, 0, len(neighbors))
+	for _, n := range neighbors {
+		if other := systemById(n.id); other != nil && other.station && !other.arena {
+			stations = append(stations, other)
+		}
+	}
+	offers := make([]*Mission, 0, missionOffers)
+	for i := 0; i < missionOffers; i++ {
+		m := &Mission{
+			offer:  fmt.Sprintf("%d-%d-%d", s.id, slot.Unix(), i),
+			origin: s,
+			goal:   1,
+		}
+		m.pays = resources[rng.Intn(len(resources))]
+		switch kind := rng.Intn(3); {
+		case kind == 0 && len(stations) > 0:
+			m.kind = M_Deliver
+			m.target = stations[rng.Intn(len(stations))]
+			m.good = missionGoods[rng.Intn(len(missionGoods))]
+			m.goal = 10 + rng.Intn(31)
+			m.pay = m.goal/2 + 5
+		case kind == 1:
+			m.kind = M_Scan
+			m.goal = 3 + rng.Intn(6)
+			m.pay = 5 * m.goal
+		default:
+			m.kind = M_Dragon
+			m.pay = 40 + rng.Intn(41)
+		}
+		if m.pays == "crystal" {
+			// crystal is scarce; the colonists can't spare as much of it
+			m.pay = m.pay/4 + 1
+		}
+		offers = append(offers, m)
+	}
+	return offers
+}
+
+// Missions reads the character's accepted missions.
+func (c *Connection) Missions() ([]*Mission, error) {
+	rows, err := db.Query(`
+        select id, offer, kind, origin, target, good, goal, progress, reward_resource, reward_quantity, deadline
+        from missions
+        where character = ? and completed = 0
+        order by id
+    ;`, c.character.id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read missions for %s: %v", c.PlayerName(), err)
+	}
+	defer rows.Close()
+	missions := make([]*Mission, 0, maxMissions)
+	for rows.Next() {
+		var m Mission
+		var origin, target int
+		var deadline int64
+		if err := rows.Scan(&m.id, &m.offer, &m.kind, &origin, &target, &m.good, &m.goal, &m.progress, &m.pays, &m.pay, &deadline); err != nil {
+			return nil, fmt.Errorf("unable to scan mission row: %v", err)
+		}
+		m.origin = systemById(origin)
+		m.target = systemById(target)
+		if m.origin == nil || (m.kind == M_Deliver && m.target == nil) {
+			continue
+		}
+		m.deadline = time.Unix(deadline, 0)
+		missions = append(missions, &m)
+	}
+	return missions, rows.Err()
+}
+
+func (c *Connection) AcceptMission(m *Mission) error {
+	m.deadline = clock.Now().Add(missionTime)
+	target := 0
+	if m.target != nil {
+		target = m.target.id
+	}
+	res, err := db.Exec(`
+        insert into missions
+        (character, offer, kind, origin, target, good, goal, reward_resource, reward_quantity, deadline)
+        values
+        (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    ;`, c.character.id, m.offer, m.kind, m.origin.id, target, m.good, m.goal, m.pays, m.pay, m.deadline.Unix())
+	if err != nil {
+		return fmt.Errorf("unable to accept mission for %s: %v", c.PlayerName(), err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("unable to read id of new mission: %v", err)
+	}
+	m.id = int(id)
+	return nil
+}
+
+func (m *Mission) Drop() error {
+	if _, err := db.Exec(`delete from missions where id = ?`, m.id); err != nil {
+		return fmt.Errorf("unable to drop mission %d: %v", m.id, err)
+	}
+	if _, err := db.Exec(`delete from mission_scans where mission = ?`, m.id); err != nil {
+		return fmt.Errorf("unable to drop scans for mission %d: %v", m.id, err)
+	}
+	return nil
+}
+
+// Finish marks a mission completed.  It reports false if it already was, so
+// that nobody is paid twice.
+func (m *Mission) Finish() (bool, error) {
+	res, err := db.Exec(`update missions set completed = 1 where id = ? and completed = 0`, m.id)
+	if err != nil {
+		return false, fmt.Errorf("unable to complete mission %d: %v", m.id, err)
+	}
+	if _, err := db.Exec(`delete from mission_scans where mission = ?`, m.id); err != nil {
+		log_error("unable to clear scans for mission %d: %v", m.id, err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (m *Mission) Advance(n int) error {
+	m.progress += n
+	if _, err := db.Exec(`update missions set progress = ? where id = ?`, m.progress, m.id); err != nil {
+		return fmt.Errorf("unable to update mission %d: %v", m.id, err)
+	}
+	return nil
+}
+
+// advanceMissions moves along every live mission of a kind.  The test picks
+// out which ones count.
+func (c *Connection) advanceMissions(kind string, counts func(*Mission) bool) {
+	if c.character == nil {
+		return
+	}
+	missions, err := c.Missions()
+	if err != nil {
+		log_error("%v", err)
+		return
+	}
+	for _, m := range missions {
+		if m.kind != kind || m.progress >= m.goal || clock.Now().After(m.deadline) || !counts(m) {
+			continue
+		}
+		if err := m.Advance(1); err != nil {
+			log_error("%v", err)
+			continue
+		}
+		if m.progress >= m.goal {
+			fmt.Fprintf(c, "mission #%d is done: %s.  return to %s for your reward.\n", m.id, m, m.origin.name)
+		}
+	}
+}
+
+// MissionScanned counts a scan reply toward scanning missions, once for each
+// system per mission.  The systems counted are kept with the mission, so
+// logging out and back in doesn't let the same ones count again.
+func (c *Connection) MissionScanned(s *System) {
+	c.advanceMissions(M_Scan, func(m *Mission) bool {
+		res, err := db.Exec(`insert or ignore into mission_scans (mission, system) values (?, ?)`, m.id, s.id)
+		if err != nil {
+			log_error("unable to record scan of %s for mission %d: %v", s.name, m.id, err)
+			return false
+		}
+		n, err := res.RowsAffected()
+		return err == nil && n > 0
+	})
+}
+
+func (c *Connection) MissionDragonSlain() {
+	c.advanceMissions(M_Dragon, func(m *Mission) bool { return true })
+}
+
+// Complete hands in a mission at the system that offered it, or for
+// deliveries, at the station they were bound for.
+func (m *Mission) Complete(conn *Connection) {
+	here := conn.System()
+	switch m.kind {
+	case M_Deliver:
+		if here != m.target || !here.station {
+			fmt.Fprintf(conn, "the %s has to be delivered to the station on %s.\n", m.good, m.target.name)
+			return
+		}
+		if conn.cargo[m.good] < m.goal {
+			fmt.Fprintf(conn, "you only have %d of the %d %s.\n", conn.cargo[m.good], m.goal, m.good)
+			return
+		}
+	default:
+		if m.progress < m.goal {
+			fmt.Fprintf(conn, "mission #%d isn't done yet: %s.\n", m.id, m)
+			return
+		}
+		if here != m.origin {
+			fmt.Fprintf(conn, "return to %s for your reward.\n", m.origin.name)
+			return
+		}
+	}
+	room := conn.CargoSpace()
+	if m.kind == M_Deliver {
+		room += m.goal
+	}
+	if m.pay > room {
+		fmt.Fprintf(conn, "you need %d free in your hold for the reward.  make some room first.\n", m.pay)
+		return
+	}
+	ok, err := m.Finish()
+	if err != nil {
+		log_error("%v", err)
+		fmt.Fprintf(conn, "the mission board is down.  try again later.\n")
+		return
+	}
+	if !ok {
+		fmt.Fprintf(conn, "mission #%d has already been completed.\n", m.id)
+		return
+	}
+	if m.kind == M_Deliver {
+		conn.AddCargo(goods[m.good], -m.goal)
+	}
+	conn.Stow(goods[m.pays], m.pay)
+	fmt.Fprintf(conn, "mission #%d complete!  you've been paid %d %s.\n", m.id, m.pay, m.pays)
+	conn.AdjustRepute(5, "completing a mission")
+	log_info("%s completed mission %d: %s", conn.PlayerName(), m.id, m)
+}
+
+func findMission(conn *Connection, args []string) *Mission {
+	if len(args) != 1 {
+		fmt.Fprintf(conn, "you need to specify a mission id\n")
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(conn, "that's not a mission id: %s\n", args[0])
+		return nil
+	}
+	missions, err := conn.Missions()
+	if err != nil {
+		log_error("%v", err)
+		fmt.Fprintf(conn, "the mission board is down.  try again later.\n")
+		return nil
+	}
+	for _, m := range missions {
+		if m.id == id {
+			return m
+		}
+	}
+	fmt.Fprintf(conn, "you don't have a mission #%d\n", id)
+	return nil
+}
+
+var missionCommand = &Command{
+	name: "mission",
+	help: "odd jobs for the colonists of colonized systems, paid in resources.  usage:\n" +
+		"\tmission   (lists the missions on offer here and the ones you've taken)\n" +
+		"\tmission accept [n]   (takes the nth mission on offer here)\n" +
+		"\tmission abandon [id]\n" +
+		"\tmission complete [id]",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			args = []string{"list"}
+		}
+		switch args[0] {
+		case "list":
+			// missions are offered at systems, so there's nothing on offer
+			// in transit, but the pilot's own are still worth listing
+			if conn.InTransit() {
+				fmt.Fprintf(conn, "you're in transit.  there are no missions on offer out here.\n")
+			} else if offers := conn.System().MissionOffers(); len(offers) == 0 {
+				fmt.Fprintf(conn, "nobody is offering missions in %s.  try a colonized system.\n", conn.System().name)
+			} else {
+				fmt.Fprintf(conn, "on offer in %s:\n", conn.System().name)
+				for i, m := range offers {
+					fmt.Fprintf(conn, "\t%d. %-50s pays %d %s\n", i+1, m, m.pay, m.pays)
+				}
+			}
+			missions, err := conn.Missions()
+			if err != nil {
+				log_error("%v", err)
+				return
+			}
+			if len(missions) > 0 {
+				fmt.Fprintf(conn, "your missions:\n")
+			}
+			for _, m := range missions {
+				left := m.deadline.Sub(clock.Now()).Truncate(time.Minute)
+				status := fmt.Sprintf("%v left", left)
+				if left <= 0 {
+					status = "expired"
+				}
+				fmt.Fprintf(conn, "\t#%-4d %-50s from %s, pays %d %s (%s)\n", m.id, m, m.origin.name, m.pay, m.pays, status)
+			}
+		case "accept":
+			if conn.InTransit() {
+				fmt.Fprintf(conn, "you're in transit.  missions are taken at the system offering them.\n")
+				return
+			}
+			offers := conn.System().MissionOffers()
+			n := 0
+			if len(args) == 2 {
+				n, _ = strconv.Atoi(args[1])
+			}
+			if n < 1 || n > len(offers) {
+				fmt.Fprintf(conn, "usage: mission accept [n], where n is one of the missions on offer here\n")
+				return
+			}
+			missions, err := conn.Missions()
+			if err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "the mission board is down.  try again later.\n")
+				return
+			}
+			if len(missions) >= maxMissions {
+				fmt.Fprintf(conn, "you already have %d missions.  finish or abandon one first.\n", maxMissions)
+				return
+			}
+			m := offers[n-1]
+			if err := conn.AcceptMission(m); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "you've already taken that mission.\n")
+				return
+			}
+			fmt.Fprintf(conn, "accepted mission #%d: %s.  you have %v.\n", m.id, m, missionTime)
+		case "abandon":
+			m := findMission(conn, args[1:])
+			if m == nil {
+				return
+			}
+			if err := m.Drop(); err != nil {
+				log_error("%v", err)
+				return
+			}
+			fmt.Fprintf(conn, "abandoned mission #%d.\n", m.id)
+		case "complete":
+			m := findMission(conn, args[1:])
+			if m == nil {
+				return
+			}
+			if clock.Now().After(m.deadline) {
+				fmt.Fprintf(conn, "mission #%d has expired.  use \"mission abandon %d\" to drop it.\n", m.id, m.id)
+				return
+			}
+			m.Complete(conn)
+		default:
+			fmt.Fprintf(conn, "no such mission subcommand: %s\n", args[0])
+		}
+	},
+}
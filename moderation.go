@@ -0,0 +1,532 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chat that players send each other is kept for a little while so that
+// reports can show what was actually said.
+const chatLogSize = 500
+
+type ChatLine struct {
+	ts   time.Time
+	from string
+	to   string // empty for broadcasts
+	text string
+}
+
+func (l ChatLine) String() string {
+	to := "broadcast"
+	if l.to != "" {
+		to = "to " + l.to
+	}
+	return fmt.Sprintf("%s %s (%s): %s", l.ts.UTC().Format("15:04:05"), l.from, to, l.text)
+}
+
+var chatLog struct {
+	sync.Mutex
+	lines []ChatLine
+}
+
+func recordChat(from, to, text string) {
+	chatLog.Lock()
+	defer chatLog.Unlock()
+	chatLog.lines = append(chatLog.lines, ChatLine{ts: time.Now(), from: from, to: to, text: text})
+	if len(chatLog.lines) > chatLogSize {
+		chatLog.lines = chatLog.lines[len(chatLog.lines)-chatLogSize:]
+	}
+}
+
+// chatContext is the most recent chat involving either player.
+func chatContext(a, b string, n int) []ChatLine {
+	chatLog.Lock()
+	defer chatLog.Unlock()
+	lines := make([]ChatLine, 0, n)
+	for i := len(chatLog.lines) - 1; i >= 0 && len(lines) < n; i-- {
+		l := chatLog.lines[i]
+		if l.from == a || l.from == b || l.to == a || l.to == b {
+			lines = append(lines, l)
+		}
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+const (
+	RP_Open      = "open"
+	RP_Reviewing = "reviewing"
+	RP_Actioned  = "actioned"
+	RP_Dismissed = "dismissed"
+)
+
+var reportStates = map[string]bool{
+	RP_Open:      true,
+	RP_Reviewing: true,
+	RP_Actioned:  true,
+	RP_Dismissed: true,
+}
+
+type Report struct {
+	id         int
+	reporter   string
+	target     string
+	reason     string
+	context    string
+	filed      time.Time
+	status     string
+	resolvedBy string
+	note       string
+}
+
+func reportsTable() {
+	stmnt := `create table if not exists reports (
+        id integer not null primary key autoincrement,
+        reporter text not null,
+        target text not null,
+        reason text not null,
+        context text not null,
+        filed integer not null,
+        status text not null default 'open',
+        resolved_by text not null default '',
+        note text not null default ''
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create reports table: %v", err)
+	}
+}
+
+func (r *Report) Store() error {
+	res, err := db.Exec(`
+        insert into reports
+        (reporter, target, reason, context, filed)
+        values
+        (?, ?, ?, ?, ?)
+    ;`, r.reporter, r.target, r.reason, r.context, r.filed.Unix())
+	if err != nil {
+		return fmt.Errorf("unable to file report: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("unable to read report id: %v", err)
+	}
+	r.id = int(id)
+	return nil
+}
+
+func resolveReport(id int, status, admin, note string) error {
+	res, err := db.Exec(`update reports set status = ?, resolved_by = ?, note = ? where id = ?`, status, admin, note, id)
+	if err != nil {
+		return fmt.Errorf("unable to update report %d: %v", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("there's no report #%d", id)
+	}
+	log_info("report %d marked %s by %s", id, status, admin)
+	audit(admin, "report "+status, fmt.Sprintf("#%d", id), note)
+	return nil
+}
+
+// loadReports reads the moderation queue, oldest first.  An empty status
+// reads every report that hasn't been closed.
+func loadReports(status string) ([]*Report, error) {
+	query := `select id, reporter, target, reason, context, filed, status, resolved_by, note from reports`
+	var args []interface{}
+	if status == "" {
+		query += ` where status in ('open', 'reviewing')`
+	} else {
+		query += ` where status = ?`
+		args = append(args, status)
+	}
+	rows, err := db.Query(query+` order by id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read reports: %v", err)
+	}
+	defer rows.Close()
+	reports := make([]*Report, 0, 16)
+	for rows.Next() {
+		var r Report
+		var filed int64
+		if err := rows.Scan(&r.id, &r.reporter, &r.target, &r.reason, &r.context, &filed, &r.status, &r.resolvedBy, &r.note); err != nil {
+			return nil, err
+		}
+		r.filed = time.Unix(filed, 0)
+		reports = append(reports, &r)
+	}
+	return reports, rows.Err()
+}
+
+func (r *Report) Summary() string {
+	return fmt.Sprintf("#%-4d %-10s %s reported %s: %s", r.id, r.status, r.reporter, r.target, r.reason)
+}
+
+var reportCommand = &Command{
+	name:   "report",
+	help:   "reports a player for abuse.  recent chat is attached for the moderators.  usage: report [player] [reason]",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) < 2 {
+			fmt.Fprintf(conn, "usage: report [player] [reason]\n")
+			return
+		}
+		if !characterExists(args[0]) {
+			fmt.Fprintf(conn, "there's nobody by the name %s\n", args[0])
+			return
+		}
+		lines := chatContext(conn.PlayerName(), args[0], 20)
+		context := make([]string, 0, len(lines))
+		for _, l := range lines {
+			context = append(context, l.String())
+		}
+		r := &Report{
+			reporter: conn.PlayerName(),
+			target:   args[0],
+			reason:   strings.Join(args[1:], " "),
+			context:  strings.Join(context, "\n"),
+			filed:    time.Now(),
+		}
+		if err := r.Store(); err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(conn, "couldn't file your report.  try again later.\n")
+			return
+		}
+		fmt.Fprintf(conn, "report #%d filed.  thanks, a moderator will take a look.\n", r.id)
+		for other, _ := range connected {
+			if other.IsAdmin() {
+				fmt.Fprintf(other, "[mod] new report #%d: %s reported %s\n", r.id, r.reporter, r.target)
+			}
+		}
+	},
+}
+
+var reportsCommand = &Command{
+	name: "reports",
+	help: "admin only.  the moderation queue.  usage:\n" +
+		"\treports [open|reviewing|actioned|dismissed]\n" +
+		"\treports show [id]\n" +
+		"\treports resolve [id] [reviewing|actioned|dismissed] [note]",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can review reports.\n")
+			return
+		}
+		if len(args) >= 2 && (args[0] == "show" || args[0] == "resolve") {
+			id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+			if err != nil {
+				fmt.Fprintf(conn, "that's not a report id: %s\n", args[1])
+				return
+			}
+			if args[0] == "resolve" {
+				if len(args) < 3 || !reportStates[args[2]] || args[2] == RP_Open {
+					fmt.Fprintf(conn, "usage: reports resolve [id] [reviewing|actioned|dismissed] [note]\n")
+					return
+				}
+				if err := resolveReport(id, args[2], conn.PlayerName(), strings.Join(args[3:], " ")); err != nil {
+					fmt.Fprintf(conn, "%v\n", err)
+					return
+				}
+				fmt.Fprintf(conn, "report #%d is now %s\n", id, args[2])
+				return
+			}
+			row := db.QueryRow(`select reason, context, resolved_by, note from reports where id = ?`, id)
+			var reason, context, by, note string
+			if err := row.Scan(&reason, &context, &by, &note); err != nil {
+				fmt.Fprintf(conn, "there's no report #%d\n", id)
+				return
+			}
+			fmt.Fprintf(conn, "reason: %s\n", reason)
+			if context == "" {
+				context = "(no recent chat)"
+			}
+			fmt.Fprintf(conn, "recent chat:\n%s\n", context)
+			if by != "" {
+				fmt.Fprintf(conn, "handled by %s: %s\n", by, note)
+			}
+			return
+		}
+		status := ""
+		if len(args) == 1 {
+			if !reportStates[args[0]] {
+				fmt.Fprintf(conn, "no such report state: %s\n", args[0])
+				return
+			}
+			status = args[0]
+		}
+		reports, err := loadReports(status)
+		if err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(conn, "couldn't read the moderation queue.\n")
+			return
+		}
+		if len(reports) == 0 {
+			fmt.Fprintf(conn, "the moderation queue is empty.\n")
+			return
+		}
+		for _, r := range reports {
+			fmt.Fprintf(conn, "%s\n", r.Summary())
+		}
+	},
+}
+
+// the admin dashboard is a small set of pages on the web listener.  It's
+// protected by a shared token and stays switched off without one.
+var adminToken = secret("EXO_ADMIN_TOKEN")
+
+func adminAuthorized(r *http.Request) bool {
+	if adminToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.FormValue("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+func adminReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r) {
+		http.Error(w, "not authorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method == "POST" {
+		id, err := strconv.Atoi(r.FormValue("id"))
+		status := r.FormValue("status")
+		if err != nil || !reportStates[status] {
+			http.Error(w, "bad report update", http.StatusBadRequest)
+			return
+		}
+		if err := resolveReport(id, status, "dashboard", r.FormValue("note")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/admin/reports?token="+r.FormValue("token"), http.StatusSeeOther)
+		return
+	}
+	status := r.FormValue("status")
+	if status != "" && !reportStates[status] {
+		http.Error(w, "no such report state", http.StatusBadRequest)
+		return
+	}
+	reports, err := loadReports(status)
+	if err != nil {
+		log_error("%v", err)
+		http.Error(w, "couldn't read the moderation queue", http.StatusInternalServerError)
+		return
+	}
+	token := html.EscapeString(r.FormValue("token"))
+	fmt.Fprintf(w, "<html><head><title>moderation queue</title></head><body><h1>moderation queue</h1>\n")
+	if len(reports) == 0 {
+		fmt.Fprintf(w, "<p>the moderation queue is empty.</p>\n")
+	}
+	for _, rep := range reports {
+		fmt.Fprintf(w, "<h2>#%d %s reported %s (%s)</h2>\n", rep.id, html.EscapeString(rep.reporter), html.EscapeString(rep.target), rep.status)
+		fmt.Fprintf(w, "<p>filed %s: %s</p>\n", rep.filed.UTC().Format(time.RFC1123), html.EscapeString(rep.reason))
+		fmt.Fprintf(w, "<pre>%s</pre>\n", html.EscapeString(rep.context))
+		if rep.resolvedBy != "" {
+			fmt.Fprintf(w, "<p>handled by %s: %s</p>\n", html.EscapeString(rep.resolvedBy), html.EscapeString(rep.note))
+		}
+		fmt.Fprintf(w, `<form method="post"><input type="hidden" name="token" value="%s"><input type="hidden" name="id" value="%d">`, token, rep.id)
+		fmt.Fprintf(w, `<select name="status"><option>reviewing</option><option>actioned</option><option>dismissed</option></select>`)
+		fmt.Fprintf(w, "<input name=\"note\" placeholder=\"note\"><input type=\"submit\" value=\"update\"></form>\n")
+	}
+	fmt.Fprintf(w, "</body></html>\n")
+}
+
+func init() {
+	http.HandleFunc("/admin/reports", adminReportsHandler)
+}
+
+// the audit trail records every moderation action taken by an admin, so
+// that moderators can see who did what and why.
+type AuditEntry struct {
+	ts     time.Time
+	admin  string
+	action string
+	target string
+	note   string
+}
+
+func (e AuditEntry) String() string {
+	s := fmt.Sprintf("%s %s: %s %s", e.ts.UTC().Format("Jan 2 15:04"), e.admin, e.action, e.target)
+	if e.note != "" {
+		s += " (" + e.note + ")"
+	}
+	return s
+}
+
+func auditTable() {
+	stmnt := `create table if not exists audit_log (
+        id integer not null primary key autoincrement,
+        ts integer not null,
+        admin text not null,
+        action text not null,
+        target text not null,
+        note text not null default ''
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create audit log table: %v", err)
+	}
+}
+
+func audit(admin, action, target, note string) {
+	_, err := db.Exec(`
+        insert into audit_log
+        (ts, admin, action, target, note)
+        values
+        (?, ?, ?, ?, ?)
+    ;`, time.Now().Unix(), admin, action, target, note)
+	if err != nil {
+		log_error("unable to write audit log entry for %s %s: %v", action, target, err)
+	}
+}
+
+// loadAudit reads the most recent n entries of the audit trail, oldest first.
+func loadAudit(n int) ([]AuditEntry, error) {
+	rows, err := db.Query(`select ts, admin, action, target, note from audit_log order by id desc limit ?`, n)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read audit log: %v", err)
+	}
+	defer rows.Close()
+	entries := make([]AuditEntry, 0, n)
+	for rows.Next() {
+		var e AuditEntry
+		var ts int64
+		if err := rows.Scan(&ts, &e.admin, &e.action, &e.target, &e.note); err != nil {
+			return nil, err
+		}
+		e.ts = time.Unix(ts, 0)
+		entries = append(entries, e)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, rows.Err()
+}
+
+// ShadowMuted is true for players whose chat goes nowhere.  They aren't told;
+// everything looks to them as though it was sent.
+func (c *Connection) ShadowMuted() bool {
+	return c.player != nil && c.player.shadowMuted
+}
+
+// setShadowMute mutes or unmutes the account that owns a character, along
+// with all of its other characters.
+func setShadowMute(name string, on bool) error {
+	row := db.QueryRow(`select account from characters where name = ?`, name)
+	var account int
+	if err := row.Scan(&account); err != nil {
+		return fmt.Errorf("there's nobody by the name %s", name)
+	}
+	if _, err := db.Exec(`update players set shadow_muted = ? where id = ?`, on, account); err != nil {
+		return fmt.Errorf("unable to update shadow mute for %s: %v", name, err)
+	}
+	for conn, _ := range connected {
+		if conn.player != nil && conn.player.id == account {
+			conn.player.shadowMuted = on
+		}
+	}
+	return nil
+}
+
+func shadowMuted() ([]string, error) {
+	rows, err := db.Query(`
+        select characters.name
+        from characters join players on characters.account = players.id
+        where players.shadow_muted = 1
+        order by characters.name
+    ;`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read shadow muted players: %v", err)
+	}
+	defer rows.Close()
+	names := make([]string, 0, 8)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+var muteCommand = &Command{
+	name: "mute",
+	help: "admin only.  shadow mutes a player, so that their tells and broadcasts are only seen by themselves.  usage:\n" +
+		"\tmute              (lists muted players)\n" +
+		"\tmute [player] [note]   (toggles the mute)\n" +
+		"\tmute log          (the moderation audit trail)",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can mute players.\n")
+			return
+		}
+		if len(args) == 0 {
+			names, err := shadowMuted()
+			if err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "couldn't read the mute list.\n")
+				return
+			}
+			if len(names) == 0 {
+				fmt.Fprintf(conn, "nobody is muted.\n")
+				return
+			}
+			fmt.Fprintf(conn, "muted: %s\n", strings.Join(names, ", "))
+			return
+		}
+		if args[0] == "log" {
+			entries, err := loadAudit(20)
+			if err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "couldn't read the audit log.\n")
+				return
+			}
+			if len(entries) == 0 {
+				fmt.Fprintf(conn, "the audit log is empty.\n")
+				return
+			}
+			for _, e := range entries {
+				fmt.Fprintf(conn, "%s\n", e)
+			}
+			return
+		}
+		name := args[0]
+		muted := false
+		if names, err := shadowMuted(); err == nil {
+			for _, n := range names {
+				if n == name {
+					muted = true
+				}
+			}
+		}
+		if err := setShadowMute(name, !muted); err != nil {
+			fmt.Fprintf(conn, "%v\n", err)
+			return
+		}
+		action := "shadow mute"
+		if muted {
+			action = "shadow unmute"
+		}
+		audit(conn.PlayerName(), action, name, strings.Join(args[1:], " "))
+		log_info("%s by %s: %s", action, conn.PlayerName(), name)
+		if muted {
+			fmt.Fprintf(conn, "%s is no longer muted.\n", name)
+		} else {
+			fmt.Fprintf(conn, "%s is now shadow muted.\n", name)
+		}
+	},
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+type Nest struct {
+	system    *System
+	site      *Site
+	guardians []int
+	damage    map[*Connection]int
+	angry     bool
+}
+
+func NewNest(s *System, site *Site) *Nest {
+	extra := int(s.ThreatLevel()) - 1
+	n := &Nest{
+		system:    s,
+		site:      site,
+		guardians: make([]int, 3+rand.Intn(3)+extra),
+	}
+	n.Heal()
+	return n
+}
+
+func (n *Nest) Heal() {
+	hp := int(80 + 20*n.system.ThreatLevel())
+	for i := range n.guardians {
+		n.guardians[i] = hp
+	}
+	n.damage = make(map[*Connection]int, 4)
+}
+
+func (n *Nest) Alive() int {
+	alive := 0
+	for _, hp := range n.guardians {
+		if hp > 0 {
+			alive++
+		}
+	}
+	return alive
+}
+
+var assaultCommand = &Command{
+	name: "assault",
+	help: "attacks the dragon in the current system, or the dragons guarding a nest.  you'll want friends",
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		n := system.nest
+		if (n == nil || !n.site.revealed) && system.dragon == nil {
+			fmt.Fprintf(conn, "there are no dragons here to fight in %s\n", system.name)
+			return
+		}
+		if clock.Now().Sub(conn.lastAssault) < 5*time.Second {
+			fmt.Fprintf(conn, "your guns are still cycling.\n")
+			return
+		}
+		conn.lastAssault = clock.Now()
+		if n == nil || !n.site.revealed {
+			system.dragon.Wound(conn, 20+rand.Intn(20))
+			return
+		}
+		for i, hp := range n.guardians {
+			if hp <= 0 {
+				continue
+			}
+			dmg := 20 + rand.Intn(20)
+			n.guardians[i] -= dmg
+			n.damage[conn] += dmg
+			if n.guardians[i] <= 0 {
+				system.EachConn(func(other *Connection) {
+					fmt.Fprintf(other, "%s has slain a nest guardian!  %d remain.\n", other.Describe(conn), n.Alive())
+				})
+			} else {
+				fmt.Fprintf(conn, "you hit a guardian for %d damage.  it has %d left.\n", dmg, n.guardians[i])
+			}
+			break
+		}
+		if n.Alive() == 0 {
+			n.Cleared()
+			return
+		}
+		if !n.angry {
+			n.angry = true
+			system.EachConn(func(other *Connection) {
+				fmt.Fprintf(other, "the dragons of the nest in %s awaken!\n", system.name)
+			})
+			After(10*time.Second, n.Retaliate)
+		}
+	},
+}
+
+func (n *Nest) Retaliate() {
+	if n.system.nest != n || n.Alive() == 0 {
+		return
+	}
+	targets := make([]*Connection, 0, 4)
+	n.system.EachConn(func(conn *Connection) {
+		if !conn.docked {
+			targets = append(targets, conn)
+		}
+	})
+	if len(targets) == 0 {
+		n.angry = false
+		n.Heal()
+		return
+	}
+	for i := 0; i < n.Alive(); i++ {
+		target := targets[rand.Intn(len(targets))]
+		if target.dead {
+			continue
+		}
+		fmt.Fprintf(target, "a guardian dragon breathes fire on you!\n")
+		n.system.Scorch(20 * time.Minute)
+		target.Damage(int(10+5*n.system.ThreatLevel()), nil, W_Dragon)
+	}
+	After(10*time.Second, n.Retaliate)
+}
+
+func (n *Nest) Cleared() {
+	s := n.system
+	s.nest = nil
+	log_info("dragon nest in %s was cleared", s.name)
+	publishNews("the dragon nest in %s has been cleared", s.name)
+	for conn, dmg := range n.damage {
+		if conn.dead || conn.System() != s {
+			continue
+		}
+		bones := 1 + dmg/50
+		loot := int64(5 * dmg)
+		bones = conn.Stow(goods["dragonbone"], bones)
+		fmt.Fprintf(conn, "you claim %d dragonbone and %d space duckets from the nest.\n", bones, loot)
+		conn.Deposit(loot)
+		conn.AdjustReputation(minersGuild, 5)
+		conn.AdjustReputation(dragonCultists, -15)
+		conn.Award(K_Title, "Dragonslayer")
+		conn.Award(K_Decal, "dragon wing")
+	}
+	s.miningBonus = clock.Now().Add(30 * time.Minute)
+	s.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "with the dragons gone, the mines of %s are yielding double for the next 30 minutes!\n", s.name)
+	})
+	After(time.Duration(float64(30*time.Minute)/s.ThreatLevel()), respawnNest)
+}
+
+func respawnNest() {
+	for i := 0; i < 20; i++ {
+		s, err := randomSystem()
+		if err != nil || s == nil || s.nest != nil {
+			continue
+		}
+		site := &Site{kind: S_Nest, bearing: rand.Intn(360)}
+		s.Sites()
+		s.sites = append(s.sites, site)
+		s.nest = NewNest(s, site)
+		log_info("a new dragon nest has formed in %s", s.name)
+		return
+	}
+}
+
+func (s *System) MiningRate() float64 {
+	if clock.Now().Before(s.miningBonus) {
+		return s.miningRate * 2 * miningMultiplier()
+	}
+	return s.miningRate * miningMultiplier()
+}
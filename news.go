@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Bulletin struct {
+	ts   time.Time
+	text string
+}
+
+var newsFeed = make([]Bulletin, 0, 32)
+
+func publishNews(template string, args ...interface{}) {
+	b := Bulletin{ts: time.Now(), text: fmt.Sprintf(template, args...)}
+	newsFeed = append(newsFeed, b)
+	if len(newsFeed) > 20 {
+		newsFeed = newsFeed[len(newsFeed)-20:]
+	}
+	log_info("news: %s", b.text)
+}
+
+var newsCommand = &Command{
+	name:   "news",
+	help:   "reads the latest bulletins from the galactic news feed",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(newsFeed) == 0 {
+			fmt.Fprintf(conn, "no news is good news.\n")
+			return
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		for i := len(newsFeed) - 1; i >= 0; i-- {
+			b := newsFeed[i]
+			fmt.Fprintf(conn, "%s  %s\n", b.ts.Format("15:04:05"), b.text)
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+	},
+}
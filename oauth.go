@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OAuthProvider struct {
+	name     string
+	authURL  string
+	tokenURL string
+	userURL  string
+	scope    string
+	clientId string
+	secret   string
+}
+
+type oauthState struct {
+	player   *Player
+	provider *OAuthProvider
+	expires  time.Time
+}
+
+type loginToken struct {
+	player  int
+	expires time.Time
+}
+
+var (
+	oauthProviders = map[string]*OAuthProvider{
+		"github": {
+			name:     "github",
+			authURL:  "https://github.com/login/oauth/authorize",
+			tokenURL: "https://github.com/login/oauth/access_token",
+			userURL:  "https://api.github.com/user",
+			scope:    "read:user",
+			clientId: os.Getenv("EXO_GITHUB_CLIENT_ID"),
+			secret:   secret("EXO_GITHUB_CLIENT_SECRET"),
+		},
+		"discord": {
+			name:     "discord",
+			authURL:  "https://discord.com/api/oauth2/authorize",
+			tokenURL: "https://discord.com/api/oauth2/token",
+			userURL:  "https://discord.com/api/users/@me",
+			scope:    "identify",
+			clientId: os.Getenv("EXO_DISCORD_CLIENT_ID"),
+			secret:   secret("EXO_DISCORD_CLIENT_SECRET"),
+		},
+	}
+	// oauthLock guards the states and tokens, which the web handlers and
+	// player connections both use.
+	oauthLock   sync.Mutex
+	oauthStates = make(map[string]*oauthState, 8)
+	loginTokens = make(map[string]loginToken, 8)
+)
+
+func oauthTable() {
+	stmnt := `create table if not exists oauth_links (
+        player integer not null,
+        provider text not null,
+        subject text not null,
+        linked integer not null,
+        unique (provider, subject),
+        unique (player, provider)
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create oauth links table: %v", err)
+	}
+}
+
+func (o *OAuthProvider) Enabled() bool {
+	return o.clientId != "" && o.secret != "" && httpBase != ""
+}
+
+func (o *OAuthProvider) RedirectURL() string {
+	return httpBase + "/oauth/" + o.name + "/callback"
+}
+
+// Begin registers a new state token and returns the url the player should
+// visit.  A nil player means the flow is a login rather than a link.
+func (o *OAuthProvider) Begin(p *Player) string {
+	state := randomToken(10)
+	oauthLock.Lock()
+	oauthStates[state] = &oauthState{player: p, provider: o, expires: time.Now().Add(10 * time.Minute)}
+	oauthLock.Unlock()
+	v := url.Values{
+		"client_id":     {o.clientId},
+		"redirect_uri":  {o.RedirectURL()},
+		"response_type": {"code"},
+		"scope":         {o.scope},
+		"state":         {state},
+	}
+	return o.authURL + "?" + v.Encode()
+}
+
+// Subject exchanges an authorization code for the provider's user id.
+func (o *OAuthProvider) Subject(code string) (string, error) {
+	form := url.Values{
+		"client_id":     {o.clientId},
+		"client_secret": {o.secret},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+		"redirect_uri":  {o.RedirectURL()},
+	}
+	req, err := http.NewRequest("POST", o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := fetchJSON(req, &token); err != nil {
+		return "", fmt.Errorf("unable to exchange %s code: %v", o.name, err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("%s returned no access token", o.name)
+	}
+	req, err = http.NewRequest("GET", o.userURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+	var user struct {
+		Id json.Number `json:"id"`
+	}
+	if err := fetchJSON(req, &user); err != nil {
+		return "", fmt.Errorf("unable to fetch %s user: %v", o.name, err)
+	}
+	if user.Id == "" {
+		return "", fmt.Errorf("%s returned no user id", o.name)
+	}
+	return user.Id.String(), nil
+}
+
+func fetchJSON(req *http.Request, v interface{}) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	dec := json.NewDecoder(res.Body)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func (p *Player) Link(provider, subject string) error {
+	_, err := db.Exec(`
+        insert or replace into oauth_links
+        (player, provider, subject, linked)
+        values
+        (?, ?, ?, ?)
+    ;`, p.id, provider, subject, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("unable to link %s to %s: %v", p.name, provider, err)
+	}
+	return nil
+}
+
+func (p *Player) Unlink(provider string) (bool, error) {
+	res, err := db.Exec(`delete from oauth_links where player = ? and provider = ?`, p.id, provider)
+	if err != nil {
+		return false, fmt.Errorf("unable to unlink %s from %s: %v", p.name, provider, err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *Player) Links() ([]string, error) {
+	rows, err := db.Query(`select provider from oauth_links where player = ? order by provider`, p.id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read links for %s: %v", p.name, err)
+	}
+	defer rows.Close()
+	links := make([]string, 0, 2)
+	for rows.Next() {
+		var provider string
+		if err := rows.Scan(&provider); err != nil {
+			return nil, err
+		}
+		links = append(links, provider)
+	}
+	return links, rows.Err()
+}
+
+func linkedPlayer(provider, subject string) (int, error) {
+	row := db.QueryRow(`select player from oauth_links where provider = ? and subject = ?`, provider, subject)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UseLoginToken burns a token issued by a linked account login, reporting
+// whether it belongs to the given player.
+func (p *Player) UseLoginToken(token string) bool {
+	oauthLock.Lock()
+	t, ok := loginTokens[token]
+	delete(loginTokens, token)
+	oauthLock.Unlock()
+	if !ok {
+		return false
+	}
+	return t.player == p.id && time.Now().Before(t.expires)
+}
+
+func oauthHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	provider, ok := oauthProviders[parts[1]]
+	if !ok || !provider.Enabled() {
+		http.NotFound(w, r)
+		return
+	}
+	switch parts[2] {
+	case "login":
+		http.Redirect(w, r, provider.Begin(nil), http.StatusFound)
+	case "callback":
+		oauthCallback(w, r, provider)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func oauthCallback(w http.ResponseWriter, r *http.Request, provider *OAuthProvider) {
+	oauthLock.Lock()
+	state, ok := oauthStates[r.FormValue("state")]
+	delete(oauthStates, r.FormValue("state"))
+	oauthLock.Unlock()
+	if !ok || state.provider != provider || time.Now().After(state.expires) {
+		http.Error(w, "this login link has expired.", http.StatusBadRequest)
+		return
+	}
+	subject, err := provider.Subject(r.FormValue("code"))
+	if err != nil {
+		log_error("%v", err)
+		http.Error(w, "couldn't verify your account.", http.StatusBadGateway)
+		return
+	}
+	if state.player != nil {
+		if err := state.player.Link(provider.name, subject); err != nil {
+			log_error("%v", err)
+			http.Error(w, "couldn't link your account.", http.StatusInternalServerError)
+			return
+		}
+		log_info("player %s linked their %s account", state.player.name, provider.name)
+		if conn := findConnection(state.player.name); conn != nil {
+			fmt.Fprintf(conn, "your %s account is now linked.\n", provider.name)
+		}
+		fmt.Fprintf(w, "your %s account is now linked to %s.\n", provider.name, state.player.name)
+		return
+	}
+	id, err := linkedPlayer(provider.name, subject)
+	if err != nil {
+		http.Error(w, "that account isn't linked to any player.", http.StatusForbidden)
+		return
+	}
+	token := randomToken(10)
+	oauthLock.Lock()
+	loginTokens[token] = loginToken{player: id, expires: time.Now().Add(10 * time.Minute)}
+	oauthLock.Unlock()
+	fmt.Fprintf(w, "your login token is %s\nenter it after your name when asked for it (\"yourname %s\"), or when asked for your authentication code.  it expires in 10 minutes.\n", token, token)
+}
+
+var linkCommand = &Command{
+	name: "link",
+	help: "links your account to an external login for recovery.  usage:\n" +
+		"\tlink   (lists linked accounts)\n" +
+		"\tlink [github|discord]\n" +
+		"\tlink revoke [github|discord]",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		p := conn.player
+		switch {
+		case len(args) == 0:
+			links, err := p.Links()
+			if err != nil {
+				log_error("%v", err)
+				return
+			}
+			if len(links) == 0 {
+				fmt.Fprintf(conn, "no linked accounts.\n")
+				return
+			}
+			fmt.Fprintf(conn, "linked accounts: %s\n", strings.Join(links, ", "))
+		case len(args) == 2 && args[0] == "revoke":
+			ok, err := p.Unlink(args[1])
+			if err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "couldn't revoke the link.\n")
+				return
+			}
+			if !ok {
+				fmt.Fprintf(conn, "your account isn't linked to %s\n", args[1])
+				return
+			}
+			fmt.Fprintf(conn, "revoked the link to %s\n", args[1])
+		case len(args) == 1:
+			provider, ok := oauthProviders[args[0]]
+			if !ok || !provider.Enabled() {
+				fmt.Fprintf(conn, "can't link to %s on this server.\n", args[0])
+				return
+			}
+			fmt.Fprintf(conn, "visit this address within 10 minutes to link your %s account:\n%s\n", provider.name, provider.Begin(p))
+		default:
+			fmt.Fprintf(conn, "usage: link [github|discord] or link revoke [github|discord]\n")
+		}
+	},
+}
+
+func init() {
+	http.HandleFunc("/oauth/", oauthHandler)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// how many writes can be waiting on a slow client before the game has to
+// wait for it.
+const outboxSize = 256
+
+type outgoing struct {
+	p      []byte
+	queued time.Time
+	// called with the time the write spent waiting and being written, once
+	// it's gone out.
+	sent func(time.Duration)
+	// everything after this write is compressed; see handshake.go
+	compress bool
+}
+
+// Outbox is the queue of output waiting to go out to a player.  It lets the
+// game carry on while a player's network catches up, and gives us a way to
+// tell how far behind they are.
+type Outbox struct {
+	sync.Mutex
+	c      chan outgoing
+	quit   chan struct{}
+	closed bool
+	depth  int
+	peak   int
+	// the peak depth is reset once a minute so it reflects recent trouble
+	peakReset time.Time
+	latency   time.Duration
+}
+
+func (c *Connection) startOutbox() {
+	c.outbox = &Outbox{
+		c:         make(chan outgoing, outboxSize),
+		quit:      make(chan struct{}),
+		peakReset: time.Now(),
+	}
+	go c.flush()
+}
+
+func (c *Connection) enqueue(o outgoing) {
+	b := c.outbox
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return
+	}
+	b.depth++
+	if b.depth > b.peak {
+		b.peak = b.depth
+	}
+	b.Unlock()
+	select {
+	case b.c <- o:
+	case <-b.quit:
+	}
+}
+
+func (c *Connection) flush() {
+	b := c.outbox
+	for {
+		var o outgoing
+		select {
+		case o = <-b.c:
+		case <-b.quit:
+			return
+		}
+		_, err := c.write(o.p)
+		if o.compress {
+			c.startCompression()
+		}
+		lag := time.Since(o.queued)
+		b.Lock()
+		b.depth--
+		b.latency = lag
+		b.Unlock()
+		if err != nil {
+			continue
+		}
+		if o.sent != nil {
+			// the callback will want to write, which can't happen from
+			// here if the queue is full.
+			go o.sent(lag)
+		}
+	}
+}
+
+// closeOutbox stops accepting output and waits a moment for what's already
+// queued to go out.
+func (c *Connection) closeOutbox() {
+	b := c.outbox
+	if b == nil {
+		return
+	}
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return
+	}
+	b.closed = true
+	b.Unlock()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if depth, _, _ := b.Stats(); depth == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(b.quit)
+}
+
+// Stats reports how many writes are queued right now, the most that have
+// been queued in the last minute or so, and how long the last write took to
+// go out.
+func (b *Outbox) Stats() (depth, peak int, latency time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	depth, peak, latency = b.depth, b.peak, b.latency
+	if time.Since(b.peakReset) > time.Minute {
+		b.peak = b.depth
+		b.peakReset = time.Now()
+	}
+	return
+}
+
+// pinger is implemented by transports that can measure a true round trip to
+// the client.
+type pinger interface {
+	Ping(func(time.Duration)) error
+}
+
+var pingCommand = &Command{
+	name: "ping",
+	help: "checks the health of your connection: round trip time and how much output is backed up waiting for you.\n" +
+		"\tif the queue is empty and the round trip is quick, any lag you're seeing is the game, not your network.",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if conn.outbox == nil {
+			return
+		}
+		depth, peak, latency := conn.outbox.Stats()
+		fmt.Fprintf(conn, "output queue: %d waiting (peak %d in the last minute)\n", depth, peak)
+		fmt.Fprintf(conn, "last write took %v\n", latency)
+		if p, ok := conn.rw.(pinger); ok {
+			err := p.Ping(func(rtt time.Duration) {
+				fmt.Fprintf(conn, "pong: round trip %v\n", rtt)
+			})
+			if err != nil {
+				fmt.Fprintf(conn, "ping failed: %v\n", err)
+			}
+			return
+		}
+		// without a protocol level ping, the best we can do is time an
+		// empty write through the queue and onto the wire.
+		conn.enqueue(outgoing{
+			queued: time.Now(),
+			sent: func(lag time.Duration) {
+				fmt.Fprintf(conn, "pong: through the queue in %v\n", lag)
+			},
+		})
+	},
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// Physics is the one model of how long things take to cross space.  Light
+// (scans, broadcasts, news of a bombing), bombs and ships all go at some
+// fraction of the speed of light, and every delay in the game is worked out
+// here from the distance and that speed.  It's configured from the
+// environment:
+//
+//	EXO_PHYSICS=simple|relativistic
+//	EXO_LIGHT_MS=100      game milliseconds for light to cross one unit
+//	EXO_BOMB_SPEED=0.909  as a fraction of light
+//	EXO_SHIP_SPEED=0.8    likewise
+//
+// The simple model just divides distance by speed, so anything that speeds a
+// ship or a bomb up (hot engines, swift dragons, research) can push it past
+// light.  The relativistic model holds everything under light speed, however
+// it's modified, and clocks aboard a fast ship run slow.
+type Physics struct {
+	mode string
+	// game time for light to cross one unit of distance
+	light time.Duration
+	// as fractions of the speed of light
+	bombSpeed float64
+	shipSpeed float64
+}
+
+const (
+	P_Simple       = "simple"
+	P_Relativistic = "relativistic"
+	// as close to light as anything gets in the relativistic model
+	maxSpeed = 0.99
+)
+
+var physics = loadPhysics()
+
+func loadPhysics() *Physics {
+	p := &Physics{
+		mode:      P_Simple,
+		light:     time.Duration(envInt("EXO_LIGHT_MS", 100)) * time.Millisecond,
+		bombSpeed: envFloat("EXO_BOMB_SPEED", 1/1.1),
+		shipSpeed: envFloat("EXO_SHIP_SPEED", 1/1.25),
+	}
+	switch mode := os.Getenv("EXO_PHYSICS"); mode {
+	case "", P_Simple:
+	case P_Relativistic:
+		p.mode = mode
+	default:
+		fmt.Fprintf(os.Stderr, "ignoring EXO_PHYSICS: %q isn't simple or relativistic\n", mode)
+	}
+	if p.light <= 0 {
+		fmt.Fprintf(os.Stderr, "ignoring EXO_LIGHT_MS: it has to be positive\n")
+		p.light = 100 * time.Millisecond
+	}
+	if p.bombSpeed <= 0 {
+		fmt.Fprintf(os.Stderr, "ignoring EXO_BOMB_SPEED: it has to be positive\n")
+		p.bombSpeed = 1 / 1.1
+	}
+	if p.shipSpeed <= 0 {
+		fmt.Fprintf(os.Stderr, "ignoring EXO_SHIP_SPEED: it has to be positive\n")
+		p.shipSpeed = 1 / 1.25
+	}
+	return p
+}
+
+func (p *Physics) Relativistic() bool {
+	return p.mode == P_Relativistic
+}
+
+// limit holds a speed under light, if the model says it has to be.
+func (p *Physics) limit(speed float64) float64 {
+	if p.Relativistic() && speed > maxSpeed {
+		return maxSpeed
+	}
+	return speed
+}
+
+// Delay is how long something going at speed takes to cross distance.
+func (p *Physics) Delay(distance, speed float64) time.Duration {
+	return time.Duration(distance / p.limit(speed) * float64(p.light))
+}
+
+func (p *Physics) LightTime(distance float64) time.Duration {
+	return p.Delay(distance, 1)
+}
+
+func (p *Physics) BombTime(distance float64) time.Duration {
+	return p.Delay(distance, p.bombSpeed)
+}
+
+func (p *Physics) TravelTime(distance float64) time.Duration {
+	return p.Delay(distance, p.shipSpeed)
+}
+
+// Modified applies a multiplier to a delay worked out by Delay, say for hot
+// engines or a slow bomb, without letting it break the speed limit.
+func (p *Physics) Modified(distance float64, d time.Duration, factor float64) time.Duration {
+	d = time.Duration(float64(d) * factor)
+	if p.Relativistic() {
+		if floor := p.Delay(distance, maxSpeed); d < floor {
+			return floor
+		}
+	}
+	return d
+}
+
+// Radius is how far something going at speed gets in elapsed game time.
+func (p *Physics) Radius(speed float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(elapsed) / float64(p.light) * p.limit(speed)
+}
+
+// LightRadius is how far a signal has spread in elapsed game time.
+func (p *Physics) LightRadius(elapsed time.Duration) float64 {
+	return p.Radius(1, elapsed)
+}
+
+// ShipTime is how long a trip over distance that takes d seems to take to
+// the crew.  Outside the relativistic model it's the same.
+func (p *Physics) ShipTime(distance float64, d time.Duration) time.Duration {
+	if !p.Relativistic() || d <= 0 {
+		return d
+	}
+	v := p.limit(distance * float64(p.light) / float64(d))
+	return time.Duration(float64(d) * math.Sqrt(1-v*v))
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"regexp"
+	"strings"
+	"time"
 )
 
 var namePattern = regexp.MustCompile(`^[[:alpha:]][[:alnum:]-_]{0,19}$`)
@@ -11,13 +14,26 @@ func ValidName(name string) bool {
 	return namePattern.MatchString(name)
 }
 
+// Player is an account.  Everything that happens in the galaxy belongs to
+// one of the account's characters instead.
 type Player struct {
-	id   int
-	name string
+	id    int
+	name  string
+	admin bool
+
+	totpSecret string
+
+	streak    int
+	lastLogin int
+
+	rulesVersion int
+
+	// a shadow muted player's chat is only ever shown back to themselves
+	shadowMuted bool
 }
 
 func (p *Player) Create() error {
-	_, err := db.Exec(`
+	res, err := db.Exec(`
         insert into players
         (name)
         values
@@ -26,6 +42,11 @@ func (p *Player) Create() error {
 	if err != nil {
 		return fmt.Errorf("unable to create player: %v", err)
 	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("unable to read id of new player: %v", err)
+	}
+	p.id = int(id)
 	return nil
 }
 
@@ -37,13 +58,116 @@ func playersTable() {
 	if _, err := db.Exec(stmnt); err != nil {
 		log_error("couldn't create player table: %v", err)
 	}
+	addColumn("players", "admin", "integer not null default 0")
+	addColumn("players", "home", "integer not null default 0")
+	addColumn("players", "home_set", "integer not null default 0")
+	addColumn("players", "system", "integer not null default 0")
+	addColumn("players", "kills", "integer not null default 0")
+	addColumn("players", "money", "integer not null default 0")
+	addColumn("players", "totp_secret", "text not null default ''")
+	addColumn("players", "streak", "integer not null default 0")
+	addColumn("players", "last_login", "integer not null default 0")
+	addColumn("players", "rules_version", "integer not null default 0")
+	addColumn("players", "shadow_muted", "integer not null default 0")
+}
+
+func promoteAdmins() {
+	for _, name := range strings.Split(os.Getenv("EXO_ADMINS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := db.Exec(`update players set admin = 1 where name = ?`, name); err != nil {
+			log_error("couldn't promote %s to admin: %v", name, err)
+		}
+	}
 }
 
 func loadPlayer(name string) (*Player, error) {
-	row := db.QueryRow(`select * from players where name = ?`, name)
+	row := db.QueryRow(`
+        select id, name, admin, totp_secret, streak, last_login, rules_version, shadow_muted
+        from players
+        where name = ?
+    ;`, name)
 	var p Player
-	if err := row.Scan(&p.id, &p.name); err != nil {
+	if err := row.Scan(&p.id, &p.name, &p.admin, &p.totpSecret, &p.streak, &p.lastLogin, &p.rulesVersion, &p.shadowMuted); err != nil {
 		return nil, fmt.Errorf("unable to fetch player from database: %v", err)
 	}
 	return &p, nil
 }
+
+// Save flushes the parts of a character's state that outlive the
+// connection.  Characters in transit are saved at the last system they were
+// seen in.
+func (c *Connection) Save() error {
+	ch := c.character
+	if ch == nil {
+		return nil
+	}
+	if c.location != nil && !c.location.arena {
+		ch.system = c.location.id
+	}
+	ch.kills = c.kills
+	ch.money = c.money
+	ch.reputation = c.repute
+	_, err := db.Exec(`
+        update characters
+        set system = ?, kills = ?, money = ?, reputation = ?
+        where id = ?
+    ;`, ch.system, ch.kills, ch.money, ch.reputation, ch.id)
+	if err != nil {
+		return fmt.Errorf("unable to save character %s: %v", ch.name, err)
+	}
+	return c.SaveCargo()
+}
+
+// Restore copies a loaded character's saved state onto the connection and
+// reclaims any colonies they left running while they were away.
+func (c *Connection) Restore() {
+	c.Reclaim()
+	c.kills = c.character.kills
+	c.Rebalanced(c.character.money)
+	c.repute = c.character.reputation
+	if err := c.LoadCargo(); err != nil {
+		log_error("%v", err)
+	}
+	if err := c.LoadResearch(); err != nil {
+		log_error("%v", err)
+	}
+	c.FinishResearch()
+	for _, s := range allSystems() {
+		if owner := s.Colonizer(); owner != nil && owner != c && owner.PlayerName() == c.character.name {
+			s.SetColonizer(c)
+			c.colonies = append(c.colonies, s)
+		}
+	}
+}
+
+// StartSystem is where a player appears when they connect: wherever they
+// were when they left, or their home system.
+func (c *Connection) StartSystem() (*System, error) {
+	if c.character != nil {
+		if s := systemById(c.character.system); s != nil {
+			return s, nil
+		}
+	}
+	return c.HomeSystem()
+}
+
+func startAutosave() {
+	After(30*time.Second, autosave)
+}
+
+func autosave() {
+	defer After(30*time.Second, autosave)
+	for conn, _ := range connected {
+		if err := conn.Save(); err != nil {
+			log_error("%v", err)
+		}
+	}
+	eachSystem(func(s *System) {
+		if s.Colonizer() != nil {
+			s.SaveColony()
+		}
+	})
+}
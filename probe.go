@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	probeCost     = 300
+	probeMaxStops = 8
+)
+
+type Survey struct {
+	system  *System
+	ts      time.Time
+	planets int
+	mining  float64
+	owner   string
+	hazard  string
+	ships   int
+}
+
+type Probe struct {
+	owner   *Connection
+	home    *System
+	route   []*System
+	at      *System
+	surveys []Survey
+}
+
+func (s *System) Survey() Survey {
+	survey := Survey{
+		system:  s,
+		ts:      time.Now(),
+		planets: s.planets,
+		mining:  s.MiningRate(),
+		ships:   s.NumInhabitants(),
+	}
+	if s.corp != nil {
+		survey.owner = s.corp.name
+	} else if owner := s.Colonizer(); owner != nil {
+		survey.owner = owner.PlayerName()
+	}
+	if h := s.Hazard(); h != nil {
+		survey.hazard = h.kind
+	}
+	return survey
+}
+
+func (p *Probe) Fly(from *System, stops []*System) {
+	if len(stops) == 0 {
+		After(from.TravelTimeTo(p.home), p.Return)
+		return
+	}
+	next := stops[0]
+	p.at = nil
+	After(from.TravelTimeTo(next), func() {
+		p.at = next
+		p.surveys = append(p.surveys, next.Survey())
+		log_info("probe from %s surveyed %s", p.owner.PlayerName(), next.name)
+		p.Fly(next, stops[1:])
+	})
+}
+
+func (p *Probe) Return() {
+	p.owner.RemoveProbe(p)
+	if p.owner.InTransit() {
+		p.Report()
+		return
+	}
+	After(p.home.LightTimeTo(p.owner.System()), p.Report)
+}
+
+func (p *Probe) Report() {
+	fmt.Fprintf(p.owner, "survey report from your probe, returned to %s:\n", p.home.name)
+	fmt.Fprintln(p.owner, "--------------------------------------------------------------------------------")
+	fmt.Fprintf(p.owner, "%-20s %-9s %-7s %-7s %-6s %-20s %s\n", "system", "surveyed", "planets", "mining", "ships", "colony", "hazard")
+	for _, s := range p.surveys {
+		owner := "-"
+		if s.owner != "" {
+			owner = s.owner
+		}
+		hazard := "-"
+		if s.hazard != "" {
+			hazard = s.hazard
+		}
+		fmt.Fprintf(p.owner, "%-20s %-9s %-7d %-7.2f %-6d %-20s %s\n", s.system.name, s.ts.Format("15:04:05"), s.planets, s.mining, s.ships, owner, hazard)
+	}
+	fmt.Fprintln(p.owner, "--------------------------------------------------------------------------------")
+}
+
+func (c *Connection) RemoveProbe(p *Probe) {
+	for i, other := range c.probes {
+		if other == p {
+			c.probes = append(c.probes[:i], c.probes[i+1:]...)
+			return
+		}
+	}
+}
+
+var probeCommand = &Command{
+	name: "probe",
+	help: "launches a survey probe that visits a list of systems and reports back when it returns.  " +
+		"costs 300 space duckets.  usage: probe [system, system, ...] or \"probe\" alone to list your probes",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			if len(conn.probes) == 0 {
+				fmt.Fprintf(conn, "you have no probes in flight.\n")
+				return
+			}
+			for _, p := range conn.probes {
+				where := "in transit"
+				if p.at != nil {
+					where = "last seen at " + p.at.name
+				}
+				fmt.Fprintf(conn, "probe from %s: %d/%d systems surveyed, %s\n", p.home.name, len(p.surveys), len(p.route), where)
+			}
+			return
+		}
+		names := strings.Split(strings.Join(args, " "), ",")
+		if len(names) > probeMaxStops {
+			fmt.Fprintf(conn, "probes can only visit %d systems.\n", probeMaxStops)
+			return
+		}
+		route := make([]*System, 0, len(names))
+		for _, name := range names {
+			s := lookupSystem(strings.TrimSpace(name))
+			if s == nil {
+				fmt.Fprintf(conn, "no such system: %s\n", strings.TrimSpace(name))
+				return
+			}
+			route = append(route, s)
+		}
+		if conn.money < probeCost {
+			fmt.Fprintf(conn, "not enough money!  probes cost %d space duckets, you only have %d in the bank.\n", probeCost, conn.money)
+			return
+		}
+		conn.Withdraw(probeCost)
+		home := conn.System()
+		p := &Probe{owner: conn, home: home, route: route, surveys: make([]Survey, 0, len(route))}
+		conn.probes = append(conn.probes, p)
+		total, from := time.Duration(0), home
+		for _, s := range route {
+			total += from.TravelTimeTo(s)
+			from = s
+		}
+		total += from.TravelTimeTo(home)
+		fmt.Fprintf(conn, "probe launched from %s.  expected back in %v\n", home.name, total)
+		p.Fly(home, route)
+	},
+}
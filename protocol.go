@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	P_Text = "text"
+	P_JSON = "json"
+)
+
+// Message is a single piece of game output as a bot client sees it.  Text is
+// always the same line a human would have read; Data carries the structured
+// version for the kinds of output that have one.
+type Message struct {
+	Type string      `json:"type"`
+	Text string      `json:"text"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Emit writes a message of the given kind.  Human players just see the text;
+// json clients get the text along with the data.
+func (c *Connection) Emit(kind string, data interface{}, template string, args ...interface{}) {
+	text := fmt.Sprintf(template, args...)
+	if c.protocol != P_JSON {
+		if c.gmcp && data != nil {
+			c.sendGMCP(kind, data)
+		}
+		c.send([]byte(text))
+		return
+	}
+	c.sendMessage(Message{Type: kind, Text: text, Data: data})
+}
+
+func (c *Connection) sendMessage(m Message) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		log_error("unable to encode %s message for %s: %v", m.Type, c.PlayerName(), err)
+		return
+	}
+	c.send(append(b, '\n'))
+}
+
+func (c *Connection) send(p []byte) (int, error) {
+	if c.rw == nil {
+		return len(p), nil
+	}
+	if c.outbox == nil {
+		return c.write(p)
+	}
+	c.enqueue(outgoing{p: append([]byte(nil), p...), queued: time.Now()})
+	return len(p), nil
+}
+
+type arrivalData struct {
+	Player string `json:"player"`
+	System string `json:"system"`
+}
+
+type bombNoticeData struct {
+	System string `json:"system"`
+}
+
+type scanShipData struct {
+	Pilot    string `json:"pilot"`
+	Alliance string `json:"alliance,omitempty"`
+	Ship     string `json:"ship,omitempty"`
+	Decal    string `json:"decal,omitempty"`
+}
+
+type scanData struct {
+	From        string         `json:"from"`
+	Delay       string         `json:"delay"`
+	Relay       string         `json:"relay,omitempty"`
+	Life        bool           `json:"life"`
+	Colony      string         `json:"colony,omitempty"`
+	Hazard      string         `json:"hazard,omitempty"`
+	Weapon      string         `json:"weapon,omitempty"`
+	Dragon      bool           `json:"dragon,omitempty"`
+	Wormhole    string         `json:"wormhole,omitempty"`
+	Buoys       int            `json:"buoys,omitempty"`
+	Interdictor bool           `json:"interdictor,omitempty"`
+	Contacts    int            `json:"contacts,omitempty"`
+	Ships       []scanShipData `json:"ships,omitempty"`
+}
+
+func (r *scanResults) data(source *System) *scanData {
+	d := &scanData{
+		From:        source.name,
+		Life:        r.life,
+		Hazard:      r.hazard,
+		Weapon:      r.weapon,
+		Dragon:      r.dragon,
+		Buoys:       r.buoys,
+		Interdictor: r.interdictor,
+		Contacts:    r.contacts,
+	}
+	if r.corp != nil {
+		d.Colony = r.corp.name
+	} else if r.colonizedBy != nil {
+		d.Colony = r.colonizedBy.PlayerName()
+	}
+	if r.wormhole != nil {
+		d.Wormhole = r.wormhole.name
+	}
+	for _, ship := range r.ships {
+		s := scanShipData{Pilot: ship.DisplayName()}
+		if a := ship.Alliance(); a != nil {
+			s.Alliance = a.name
+		}
+		if r.close {
+			s.Ship = ship.ShipLabel()
+			s.Decal = ship.Decal()
+		}
+		d.Ships = append(d.Ships, s)
+	}
+	return d
+}
+
+// EmitScan sends a set of scan results.  relay names the system that passed
+// the results along, if they didn't come straight back to the reader.
+func (c *Connection) EmitScan(source, relay *System, delay time.Duration, results *scanResults) {
+	data := results.data(source)
+	data.Delay = delay.String()
+	var buf bytes.Buffer
+	if relay != nil {
+		data.Relay = relay.name
+		fmt.Fprintf(&buf, "[fleet] scan results from %s relayed via %s:\n", source.name, relay.name)
+	} else {
+		fmt.Fprintf(&buf, "scan results from %s (%v away):\n", source.name, delay)
+	}
+	results.write(&buf)
+	c.Emit("scan", data, "%s", buf.String())
+}
+
+var protocolCommand = &Command{
+	name: "protocol",
+	help: "switches how the game talks to you.  usage: protocol text|json\n" +
+		"\tin json mode every line of output is a json object with a type, the text, and structured data where there is some.",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			fmt.Fprintf(conn, "protocol: %s\n", conn.Protocol())
+			fmt.Fprintf(conn, "version: %d (this server speaks %d to %d)\n", conn.ProtocolVersion(), minProtocolVersion, protocolVersion)
+			if conn.gmcp {
+				fmt.Fprintf(conn, "gmcp: on\n")
+			}
+			if conn.deflate != nil {
+				fmt.Fprintf(conn, "compression: on\n")
+			}
+			return
+		}
+		switch args[0] {
+		case P_Text, P_JSON:
+			conn.protocol = args[0]
+			fmt.Fprintf(conn, "protocol: %s\n", args[0])
+		default:
+			fmt.Fprintf(conn, "no such protocol: %s\n", args[0])
+		}
+	},
+}
+
+func (c *Connection) Protocol() string {
+	if c.protocol == "" {
+		return P_Text
+	}
+	return c.protocol
+}
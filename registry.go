@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var shipNamePattern = regexp.MustCompile(`^[[:alpha:]][[:alnum:] '-]{0,29}$`)
+
+func registryTable() {
+	stmnt := `create table if not exists registry (
+        name text unique,
+        owner text,
+        design text,
+        registered datetime default current_timestamp
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create registry table: %v", err)
+	}
+}
+
+func registerShip(name string, owner *Connection) error {
+	_, err := db.Exec(`
+        insert into registry
+        (name, owner, design)
+        values
+        (?, ?, ?)
+    ;`, name, owner.PlayerName(), owner.design.name)
+	if err != nil {
+		return fmt.Errorf("unable to register ship: %v", err)
+	}
+	return nil
+}
+
+// reregisterShip brings a registered ship's design up to date, for when a
+// pilot takes command of it again.
+func reregisterShip(name string, design *Design) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := db.Exec(`update registry set design = ? where name = ?`, design.name, name); err != nil {
+		return fmt.Errorf("unable to update registry for %s: %v", name, err)
+	}
+	return nil
+}
+
+// retireShip takes a destroyed ship out of the registry, so that its name is
+// free to be used again.
+func retireShip(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := db.Exec(`delete from registry where name = ?`, name); err != nil {
+		return fmt.Errorf("unable to retire ship %s: %v", name, err)
+	}
+	return nil
+}
+
+func (c *Connection) ShipLabel() string {
+	if c.shipName == "" {
+		return fmt.Sprintf("a %s", c.design.name)
+	}
+	return fmt.Sprintf("the %s %q", c.design.name, c.shipName)
+}
+
+var nameCommand = &Command{
+	name:   "name",
+	help:   "names your current ship and enters it in the public registry.  usage: name [ship-name]",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		name := strings.Join(args, " ")
+		if !shipNamePattern.MatchString(name) {
+			fmt.Fprintf(conn, "that ship name is illegal.\n")
+			return
+		}
+		if conn.shipName != "" {
+			fmt.Fprintf(conn, "your ship is already registered as %q\n", conn.shipName)
+			return
+		}
+		if err := registerShip(name, conn); err != nil {
+			log_error("player %s couldn't register ship %s: %v", conn.PlayerName(), name, err)
+			fmt.Fprintf(conn, "the registry already has a ship called %q\n", name)
+			return
+		}
+		conn.shipName = name
+		fmt.Fprintf(conn, "your %s is now registered as %q\n", conn.design.name, name)
+	},
+}
+
+var registryCommand = &Command{
+	name:   "registry",
+	help:   "searches the public ship registry by name.  usage: registry [search]",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		query := "%" + strings.Join(args, " ") + "%"
+		rows, err := db.Query(`
+            select name, owner, design, registered
+            from registry
+            where name like ?
+            order by name
+            limit 25
+        ;`, query)
+		if err != nil {
+			log_error("unable to search registry: %v", err)
+			return
+		}
+		defer rows.Close()
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		fmt.Fprintf(conn, "%-30s %-20s %-10s %s\n", "name", "owner", "design", "registered")
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		for rows.Next() {
+			var name, owner, design, registered string
+			if err := rows.Scan(&name, &owner, &design, &registered); err != nil {
+				log_error("error unpacking row from registry query: %v", err)
+				continue
+			}
+			fmt.Fprintf(conn, "%-30s %-20s %-10s %s\n", name, owner, design, registered)
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+	},
+}
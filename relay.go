@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The chat relay links channels across the servers of a federation (see
+// federation.go), so a channel like trade or help can be one conversation
+// across every region.  Each server opts its channels in separately:
+//
+//	EXO_RELAY_CHANNELS=trade,help
+//
+// and only relays, or accepts relayed chat for, the channels it lists.  Each
+// server posts its own players' chat straight to every peer, and never
+// passes on chat it was relayed, so there are no loops.  Relayed lines are
+// tagged with the region they came from, as in "[trade] alice@us: ...".
+var relayChannels = parseRelayChannels(os.Getenv("EXO_RELAY_CHANNELS"))
+
+const (
+	// how old a relayed line can be before it's dropped
+	relayTTL = time.Minute
+	// the longest line the relay will carry
+	maxRelayText = 500
+	// how many message ids to remember, to drop duplicates
+	relaySeenSize = 256
+)
+
+type relayMessage struct {
+	Id      string `json:"id"`
+	Origin  string `json:"origin"`
+	Channel string `json:"channel"`
+	From    string `json:"from"`
+	Text    string `json:"text"`
+	Sent    int64  `json:"sent"`
+}
+
+type signedRelay struct {
+	Message   json.RawMessage `json:"message"`
+	Signature string          `json:"signature"`
+}
+
+var relaySeen = struct {
+	sync.Mutex
+	ids   map[string]bool
+	order []string
+}{
+	ids: make(map[string]bool, relaySeenSize),
+}
+
+func parseRelayChannels(s string) map[string]bool {
+	names := make(map[string]bool, 4)
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func relayed(channel string) bool {
+	return federated() && relayChannels[channel]
+}
+
+func relayPeers() []string {
+	names := make([]string, 0, len(peers))
+	for name, _ := range peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// seenRelay reports whether a message has already been delivered, and
+// remembers it if it hasn't.
+func seenRelay(id string) bool {
+	relaySeen.Lock()
+	defer relaySeen.Unlock()
+	if relaySeen.ids[id] {
+		return true
+	}
+	relaySeen.ids[id] = true
+	relaySeen.order = append(relaySeen.order, id)
+	if len(relaySeen.order) > relaySeenSize {
+		delete(relaySeen.ids, relaySeen.order[0])
+		relaySeen.order = relaySeen.order[1:]
+	}
+	return false
+}
+
+// relayChat sends a line of channel chat to every peer, if the channel is
+// relayed.  It doesn't wait for them.
+func relayChat(channel, from, text string) {
+	if !relayed(channel) || len(text) > maxRelayText {
+		return
+	}
+	m := relayMessage{
+		Id:      randomToken(10),
+		Origin:  region,
+		Channel: channel,
+		From:    from,
+		Text:    text,
+		Sent:    time.Now().Unix(),
+	}
+	msg, err := json.Marshal(m)
+	if err != nil {
+		log_error("unable to encode relayed chat: %v", err)
+		return
+	}
+	body, err := json.Marshal(signedRelay{Message: msg, Signature: signFederated(SP_Relay, msg)})
+	if err != nil {
+		log_error("unable to encode relayed chat: %v", err)
+		return
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	for name, base := range peers {
+		go func(name, url string) {
+			res, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log_error("couldn't relay chat to %s: %v", name, err)
+				return
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				log_error("%s refused relayed chat on %s: %s", name, channel, res.Status)
+			}
+		}(name, base+"/relay/chat")
+	}
+}
+
+func relayHandler(w http.ResponseWriter, r *http.Request) {
+	if !federated() || len(relayChannels) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "chat is posted", http.StatusMethodNotAllowed)
+		return
+	}
+	var signed signedRelay
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<12)).Decode(&signed); err != nil {
+		http.Error(w, "bad message", http.StatusBadRequest)
+		return
+	}
+	if !hmac.Equal([]byte(signed.Signature), []byte(signFederated(SP_Relay, signed.Message))) {
+		log_error("rejected relayed chat with a bad signature from %s", r.RemoteAddr)
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+		return
+	}
+	var m relayMessage
+	if err := json.Unmarshal(signed.Message, &m); err != nil {
+		http.Error(w, "bad message", http.StatusBadRequest)
+		return
+	}
+	if _, ok := peers[m.Origin]; !ok || m.Origin == region {
+		http.Error(w, "not a peer", http.StatusForbidden)
+		return
+	}
+	if !relayChannels[m.Channel] {
+		// the channel isn't opted in here.  that's not the sender's fault.
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if time.Since(time.Unix(m.Sent, 0)) > relayTTL || !ValidName(m.From) || len(m.Text) > maxRelayText {
+		http.Error(w, "bad message", http.StatusBadRequest)
+		return
+	}
+	if seenRelay(m.Origin + "/" + m.Id) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	from := m.From + "@" + m.Origin
+	recordChat(from, "#"+m.Channel, m.Text)
+	deliverChannel(m.Channel, from, m.Text)
+	w.WriteHeader(http.StatusOK)
+}
+
+func init() {
+	http.HandleFunc("/relay/chat", relayHandler)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type Relic struct {
+	system  *System
+	carrier *Connection
+	scores  map[*Corporation]int
+}
+
+var relic *Relic
+
+func startRelic() {
+	s, err := randomSystem()
+	if err != nil || s == nil {
+		log_error("unable to place the relic: %v", err)
+		return
+	}
+	relic = &Relic{system: s, scores: make(map[*Corporation]int, 8)}
+	log_info("the relic has appeared in %s", s.name)
+	relic.Broadcast()
+	After(time.Minute, relic.Score)
+}
+
+func (r *Relic) Broadcast() {
+	from := r.system
+	held := "unclaimed"
+	if r.carrier != nil {
+		held = "carried by a ship"
+	}
+	for _, s := range allSystems() {
+		to := s
+		After(from.LightTimeTo(to), func() {
+			to.EachConn(func(conn *Connection) {
+				conn.relicSeen = from
+				fmt.Fprintf(conn, "the relic's signal now emanates from %s (%s)\n", from.name, held)
+			})
+		})
+	}
+}
+
+func (r *Relic) Owner() *Corporation {
+	if r.carrier != nil {
+		corp := memberships[r.carrier.PlayerName()]
+		if corp != nil && r.system.Territory() == corp {
+			return corp
+		}
+		return nil
+	}
+	return r.system.Territory()
+}
+
+func (s *System) Territory() *Corporation {
+	if s.corp != nil {
+		return s.corp
+	}
+	if owner := s.Colonizer(); owner != nil {
+		return memberships[owner.PlayerName()]
+	}
+	return nil
+}
+
+func (r *Relic) Score() {
+	defer After(time.Minute, r.Score)
+	corp := r.Owner()
+	if corp == nil {
+		return
+	}
+	r.scores[corp]++
+	corp.Notify("the relic scores a point for %s.  total: %d", corp.name, r.scores[corp])
+}
+
+func (r *Relic) Moved(s *System) {
+	r.system = s
+	r.Broadcast()
+}
+
+func (r *Relic) Drop(s *System) {
+	if s == nil {
+		s = r.system
+	}
+	r.carrier = nil
+	r.Moved(s)
+}
+
+var relicCommand = &Command{
+	name:   "relic",
+	help:   "capture the relic.  use \"relic\" for standings, \"relic take\" to pick it up, \"relic drop\" to leave it",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if relic == nil {
+			fmt.Fprintf(conn, "there is no relic in this galaxy.\n")
+			return
+		}
+		if len(args) == 0 {
+			if conn.relicSeen != nil {
+				fmt.Fprintf(conn, "last known relic position: %s\n", conn.relicSeen.name)
+			} else {
+				fmt.Fprintf(conn, "the relic's signal hasn't reached you yet.\n")
+			}
+			corps := make([]*Corporation, 0, len(relic.scores))
+			for corp, _ := range relic.scores {
+				corps = append(corps, corp)
+			}
+			sort.Slice(corps, func(i, j int) bool { return relic.scores[corps[i]] > relic.scores[corps[j]] })
+			for _, corp := range corps {
+				fmt.Fprintf(conn, "\t%-20s %d\n", corp.name, relic.scores[corp])
+			}
+			return
+		}
+		switch args[0] {
+		case "take":
+			if conn.InTransit() || relic.system != conn.System() || relic.carrier != nil {
+				fmt.Fprintf(conn, "the relic isn't here for the taking.\n")
+				return
+			}
+			relic.carrier = conn
+			fmt.Fprintf(conn, "you've taken the relic aboard.\n")
+			relic.Broadcast()
+		case "drop":
+			if relic.carrier != conn || conn.InTransit() {
+				fmt.Fprintf(conn, "you can't drop the relic here.\n")
+				return
+			}
+			fmt.Fprintf(conn, "you've left the relic in %s.\n", conn.System().name)
+			relic.Drop(conn.System())
+		default:
+			fmt.Fprintf(conn, "no such relic subcommand: %s\n", args[0])
+		}
+	},
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reputation is what the galaxy at large thinks of a pilot, as opposed to
+// the standing they have with each of the NPC factions.  It follows the
+// character around, and shows on their profile.  Preying on neutrals and
+// burning colonies drags it down; finishing contracts, slaying dragons and
+// hunting down the notorious builds it back up.  Respectable stations won't
+// trade with the notorious, and merchants treat pilots by their name.
+const (
+	minRepute = -1000
+	maxRepute = 1000
+
+	// high security station markets turn away anyone at or below this
+	marketRepute = -200
+	// merchant ships won't deal with anyone at or below this
+	merchantRepute = -100
+	// and give a discount to anyone at or above this
+	favoredRepute = 200
+)
+
+var reputeTiers = []struct {
+	min  int
+	name string
+}{
+	{500, "renowned"},
+	{200, "honored"},
+	{50, "respected"},
+	{-50, "unknown"},
+	{-200, "shady"},
+	{-500, "notorious"},
+	{minRepute, "infamous"},
+}
+
+func reputeTier(n int) string {
+	for _, t := range reputeTiers {
+		if n >= t.min {
+			return t.name
+		}
+	}
+	return reputeTiers[len(reputeTiers)-1].name
+}
+
+func (c *Connection) Repute() int {
+	return c.repute
+}
+
+func (c *Connection) AdjustRepute(delta int, why string) {
+	before := c.repute
+	c.repute += delta
+	if c.repute > maxRepute {
+		c.repute = maxRepute
+	}
+	if c.repute < minRepute {
+		c.repute = minRepute
+	}
+	if c.repute == before {
+		return
+	}
+	if delta > 0 {
+		fmt.Fprintf(c, "your reputation grows for %s.\n", why)
+	} else {
+		fmt.Fprintf(c, "your reputation suffers for %s.\n", why)
+	}
+	if reputeTier(before) != reputeTier(c.repute) {
+		fmt.Fprintf(c, "you are now %s across the galaxy.\n", reputeTier(c.repute))
+	}
+}
+
+// Notorious pilots are fair game; everyone else is a neutral unless there's
+// a war or an outlaw flag in it.
+func (c *Connection) Notorious() bool {
+	return c.repute <= marketRepute
+}
+
+// KilledPilot adjusts the killer's reputation for the kind of pilot they
+// killed.
+func (c *Connection) KilledPilot(victim *Connection) {
+	switch {
+	case victim == c:
+	case victim.Notorious():
+		c.AdjustRepute(10, "bringing down "+victim.PlayerName())
+	case victim.Outlaw() || AtWar(memberships[c.PlayerName()], memberships[victim.PlayerName()]):
+	default:
+		c.AdjustRepute(-20, "killing a neutral pilot")
+	}
+}
+
+// TradesWith reports whether a station's market will deal with the pilot,
+// telling them if it won't.
+func (s *System) TradesWith(c *Connection) bool {
+	if !s.HighSec() || !c.Notorious() {
+		return true
+	}
+	fmt.Fprintf(c, "the market on %s won't deal with anyone %s.\n", s.name, reputeTier(c.repute))
+	return false
+}
+
+// profile is what anyone can see about a pilot, online or not.
+type profile struct {
+	name     string
+	title    string
+	kills    int
+	repute   int
+	alliance string
+	online   bool
+}
+
+func loadProfile(name string) (*profile, error) {
+	if other := findConnection(name); other != nil && other.character != nil {
+		p := &profile{
+			name:   other.PlayerName(),
+			title:  other.character.title,
+			kills:  other.kills,
+			repute: other.repute,
+			online: true,
+		}
+		if a := other.Alliance(); a != nil {
+			p.alliance = a.name
+		}
+		return p, nil
+	}
+	p := &profile{}
+	row := db.QueryRow(`select name, title, kills, reputation from characters where name = ?`, name)
+	if err := row.Scan(&p.name, &p.title, &p.kills, &p.repute); err != nil {
+		return nil, fmt.Errorf("unable to load profile of %s: %v", name, err)
+	}
+	return p, nil
+}
+
+var profileCommand = &Command{
+	name:   "profile",
+	help:   "shows a pilot's public profile, or your own.  usage: profile [pilot]",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		name := conn.PlayerName()
+		if len(args) > 0 {
+			name = strings.Join(args, " ")
+		}
+		p, err := loadProfile(name)
+		if err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(conn, "no pilot called %s is on record.\n", name)
+			return
+		}
+		fmt.Fprintf(conn, "pilot: %s\n", p.name)
+		if p.title != "" {
+			fmt.Fprintf(conn, "title: %s\n", p.title)
+		}
+		if p.alliance != "" {
+			fmt.Fprintf(conn, "alliance: %s\n", p.alliance)
+		}
+		fmt.Fprintf(conn, "kills: %d\n", p.kills)
+		fmt.Fprintf(conn, "reputation: %s (%d)\n", reputeTier(p.repute), p.repute)
+		if p.online {
+			fmt.Fprintf(conn, "online now\n")
+		}
+	},
+}
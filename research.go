@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Research is a pilot's long game.  They put resources into a project, and
+// when it's done some part of their ship works a little better for good:
+// engines cut travel time, sensors identify ships from further off, ordnance
+// makes bombs cheaper to build and shields hold more.  Each tech goes up in
+// levels, each one dearer and slower than the last, and a pilot can only run
+// one project at a time.  Levels and the project under way are kept in the
+// database, and a project finishes whether or not its pilot is online.
+type Tech struct {
+	name  string
+	about string
+	// what the first level costs.  each level after costs that many times more.
+	cost Resources
+	// how long the first level takes, likewise
+	time time.Duration
+	// how much each level changes the multiplier
+	step float64
+}
+
+const maxTechLevel = 5
+
+// research is a pilot's progress.  Projects finish on the scheduler while the
+// pilot's own goroutine reads their levels, so it's all behind a lock.
+type research struct {
+	sync.Mutex
+	levels  map[string]int
+	project string
+	done    time.Time
+}
+
+var techs = map[string]*Tech{
+	"engines": {
+		name:  "engines",
+		about: "travel time -5% per level",
+		cost:  Resources{"ore": 40, "gas": 60},
+		time:  30 * time.Minute,
+		step:  -0.05,
+	},
+	"sensors": {
+		name:  "sensors",
+		about: "ships identified 20% further away per level",
+		cost:  Resources{"ore": 20, "crystal": 20},
+		time:  30 * time.Minute,
+		step:  0.2,
+	},
+	"ordnance": {
+		name:  "ordnance",
+		about: "bombs cost 10% less to build per level",
+		cost:  Resources{"ore": 80, "gas": 20},
+		time:  45 * time.Minute,
+		step:  -0.1,
+	},
+	"shields": {
+		name:  "shields",
+		about: "shield capacity +10% per level",
+		cost:  Resources{"gas": 40, "crystal": 30},
+		time:  45 * time.Minute,
+		step:  0.1,
+	},
+}
+
+var techOrder = []string{"engines", "sensors", "ordnance", "shields"}
+
+// fastestEngines is the travel time multiplier at full engine research, for
+// anything that needs to know how fast a ship could possibly go.
+var fastestEngines = 1 + maxTechLevel*techs["engines"].step
+
+func researchTable() {
+	stmnt := `create table if not exists research (
+        character integer not null,
+        tech text not null,
+        level integer not null default 0,
+        finishes integer not null default 0,
+        primary key (character, tech)
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create research table: %v", err)
+	}
+}
+
+// LevelCost is what it takes to research a tech from level-1 to level.
+func (t *Tech) LevelCost(level int) Resources {
+	r := make(Resources, len(t.cost))
+	for name, n := range t.cost {
+		r[name] = n * level
+	}
+	return r
+}
+
+func (t *Tech) LevelTime(level int) time.Duration {
+	return t.time * time.Duration(level)
+}
+
+// Researched is the level a pilot has reached in a tech.
+func (c *Connection) Researched(name string) int {
+	c.research.Lock()
+	defer c.research.Unlock()
+	return c.research.levels[name]
+}
+
+// Project is the research under way, if any, and when it'll be done.
+func (c *Connection) Project() (string, time.Time) {
+	c.research.Lock()
+	defer c.research.Unlock()
+	return c.research.project, c.research.done
+}
+
+// TechBonus is the multiplier a pilot's research in a tech applies.
+func (c *Connection) TechBonus(name string) float64 {
+	return 1 + float64(c.Researched(name))*techs[name].step
+}
+
+func (c *Connection) LoadResearch() error {
+	rows, err := db.Query(`select tech, level, finishes from research where character = ?`, c.character.id)
+	if err != nil {
+		return fmt.Errorf("unable to load research for %s: %v", c.character.name, err)
+	}
+	defer rows.Close()
+	c.research.Lock()
+	defer c.research.Unlock()
+	c.research.levels = make(map[string]int, len(techs))
+	c.research.project, c.research.done = "", time.Time{}
+	for rows.Next() {
+		var name string
+		var level int
+		var finishes int64
+		if err := rows.Scan(&name, &level, &finishes); err != nil {
+			return fmt.Errorf("unable to scan research row: %v", err)
+		}
+		if _, ok := techs[name]; !ok {
+			continue
+		}
+		c.research.levels[name] = level
+		if finishes > 0 {
+			c.research.project, c.research.done = name, time.Unix(finishes, 0)
+		}
+	}
+	return rows.Err()
+}
+
+// StartResearch pays for the next level of a tech and sets it going.
+func (c *Connection) StartResearch(t *Tech) error {
+	level := c.Researched(t.name) + 1
+	done := clock.Now().Add(t.LevelTime(level))
+	if _, err := db.Exec(`
+        insert or replace into research
+        (character, tech, level, finishes)
+        values
+        (?, ?, ?, ?)
+    ;`, c.character.id, t.name, level-1, done.Unix()); err != nil {
+		return fmt.Errorf("unable to start %s research for %s: %v", t.name, c.character.name, err)
+	}
+	c.TakeResources(t.LevelCost(level))
+	c.research.Lock()
+	c.research.project, c.research.done = t.name, done
+	c.research.Unlock()
+	return nil
+}
+
+// FinishResearch completes the pilot's project, if it's due.
+func (c *Connection) FinishResearch() {
+	c.research.Lock()
+	name := c.research.project
+	if name == "" || clock.Now().Before(c.research.done) {
+		c.research.Unlock()
+		return
+	}
+	level := c.research.levels[name] + 1
+	if _, err := db.Exec(`
+        update research set level = ?, finishes = 0
+        where character = ? and tech = ?
+    ;`, level, c.character.id, name); err != nil {
+		c.research.Unlock()
+		log_error("unable to finish %s research for %s: %v", name, c.character.name, err)
+		return
+	}
+	c.research.levels[name] = level
+	c.research.project, c.research.done = "", time.Time{}
+	c.research.Unlock()
+	if name == "shields" && c.shield > c.MaxShield() {
+		c.shield = c.MaxShield()
+	}
+	c.Notice("research complete: %s level %d (%s).\n", name, level, techs[name].about)
+	log_info("%s finished %s research, level %d", c.PlayerName(), name, level)
+}
+
+func startResearch() {
+	After(time.Minute, researchTick)
+}
+
+func researchTick() {
+	defer After(time.Minute, researchTick)
+	for conn, _ := range connected {
+		if conn.character != nil {
+			conn.FinishResearch()
+		}
+	}
+}
+
+var researchCommand = &Command{
+	name: "research",
+	help: "invest resources in better ship technology.  usage:\n" +
+		"\tresearch   (shows your levels, what's under way, and what the next levels cost)\n" +
+		"\tresearch [engines|sensors|ordnance|shields]   (starts the next level)",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if conn.character == nil {
+			return
+		}
+		project, done := conn.Project()
+		if len(args) == 0 {
+			fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+			for _, name := range techOrder {
+				t := techs[name]
+				level := conn.Researched(name)
+				switch {
+				case project == name:
+					fmt.Fprintf(conn, "%-10s level %d  researching level %d, done in %v\n", name, level, level+1, done.Sub(clock.Now()).Round(time.Minute))
+				case level >= maxTechLevel:
+					fmt.Fprintf(conn, "%-10s level %d  fully researched\n", name, level)
+				default:
+					fmt.Fprintf(conn, "%-10s level %d  next level takes %s and %v\n", name, level, t.LevelCost(level+1), t.LevelTime(level+1))
+				}
+				fmt.Fprintf(conn, "%-10s %s\n", "", t.about)
+			}
+			fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+			return
+		}
+		t, ok := techs[strings.ToLower(args[0])]
+		if !ok {
+			fmt.Fprintf(conn, "there's no such research as %s.  try one of: %s\n", args[0], strings.Join(techOrder, ", "))
+			return
+		}
+		if project != "" {
+			fmt.Fprintf(conn, "your %s research still has %v to go.  one project at a time.\n", project, done.Sub(clock.Now()).Round(time.Minute))
+			return
+		}
+		level := conn.Researched(t.name) + 1
+		if level > maxTechLevel {
+			fmt.Fprintf(conn, "your %s are as good as they get.\n", t.name)
+			return
+		}
+		cost := t.LevelCost(level)
+		if !conn.HasResources(cost) {
+			fmt.Fprintf(conn, "%s level %d takes %s.  you don't have that in your hold.\n", t.name, level, cost)
+			return
+		}
+		if err := conn.StartResearch(t); err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(conn, "the lab couldn't take your project.  try again later.\n")
+			return
+		}
+		fmt.Fprintf(conn, "put %s into %s research.  level %d will be ready in %v.\n", cost, t.name, level, t.LevelTime(level))
+	},
+}
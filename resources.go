@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// resources are the raw materials dug out of the galaxy.  They're carried
+// as cargo like any other good, and building things takes a mix of them on
+// top of the duckets.
+var resources = []string{"ore", "gas", "crystal"}
+
+// Resources is an amount of each resource, usually the materials something
+// takes to build.
+type Resources map[string]int
+
+func (r Resources) String() string {
+	parts := make([]string, 0, len(resources))
+	for _, name := range resources {
+		if r[name] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", r[name], name))
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func isResource(name string) bool {
+	for _, r := range resources {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Connection) HasResources(r Resources) bool {
+	for name, n := range r {
+		if c.cargo[name] < n {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Connection) TakeResources(r Resources) {
+	for name, n := range r {
+		c.AddCargo(goods[name], -n)
+	}
+}
+
+// rollAbundance decides how rich a system is in each resource.  Ore turns
+// up nearly everywhere, crystal is scarce.
+func (s *System) rollAbundance() {
+	s.abundance = map[string]float64{
+		"ore":     0.5 + 0.5*rand.Float64(),
+		"gas":     rand.Float64(),
+		"crystal": 0.5 * rand.Float64(),
+	}
+}
+
+func (s *System) Abundance(resource string) float64 {
+	return s.abundance[resource]
+}
+
+func (s *System) StoreAbundance() {
+	_, err := db.Exec(`
+        update planets
+        set ore = ?, gas = ?, crystal = ?
+        where id = ?
+    ;`, s.abundance["ore"], s.abundance["gas"], s.abundance["crystal"], s.id)
+	if err != nil {
+		log_error("unable to store resource abundance for %s: %v", s.name, err)
+	}
+}
+
+var resourcesCommand = &Command{
+	name:   "resources",
+	help:   "shows how rich the current system is in each resource, and how much of each you're carrying",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		system := conn.System()
+		if system == nil {
+			// there's nothing to mine between systems, only the hold to show
+			fmt.Fprintf(conn, "%-10s %s\n", "resource", "in hold")
+			for _, name := range resources {
+				fmt.Fprintf(conn, "%-10s %d\n", name, conn.cargo[name])
+			}
+			return
+		}
+		fmt.Fprintf(conn, "%-10s %-10s %s\n", "resource", "abundance", "in hold")
+		for _, name := range resources {
+			fmt.Fprintf(conn, "%-10s %3.0f%%       %d\n", name, 100*system.Abundance(name), conn.cargo[name])
+		}
+	},
+}
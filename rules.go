@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rulesVersion must be bumped whenever rulesText changes in a way players
+// need to agree to.  Everyone is asked to accept the new rules the next time
+// they log in.
+const rulesVersion = 1
+
+const rulesText = `1. one account per person.  alts go on your account as characters.
+2. no bots or scripts outside of the json protocol, and no automating play while away from the keyboard.
+3. don't exploit bugs.  report them to an admin instead.
+4. no harassment, hate speech or threats in tells, broadcasts, mail or names.
+5. what happens in space is fair game: bombing, piracy, scams and betrayal are all part of the galaxy.
+6. admins have the final word.  breaking the rules can get your account banned.`
+
+func (p *Player) AcceptRules() error {
+	if _, err := db.Exec(`update players set rules_version = ? where id = ?`, rulesVersion, p.id); err != nil {
+		return fmt.Errorf("unable to record rules acceptance for %s: %v", p.name, err)
+	}
+	p.rulesVersion = rulesVersion
+	return nil
+}
+
+// AgreeToRules makes sure the player has accepted the current rules, asking
+// them to if they haven't.  It reports whether they may play.
+func (c *Connection) AgreeToRules() bool {
+	if c.player.rulesVersion >= rulesVersion {
+		return true
+	}
+	if c.player.rulesVersion == 0 {
+		fmt.Fprintf(c, "before you play, please read the rules of the galaxy:\n")
+	} else {
+		fmt.Fprintf(c, "the rules have changed since you last played.  please read them again:\n")
+	}
+	fmt.Fprintf(c, "%s\n", rulesText)
+	for {
+		fmt.Fprintf(c, "type \"accept\" to agree to the rules, or \"quit\" to leave.\n")
+		line, err := c.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		switch strings.TrimSpace(line) {
+		case "accept":
+			if err := c.player.AcceptRules(); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(c, "couldn't record your acceptance.  try again later.\n")
+				return false
+			}
+			return true
+		case "quit":
+			return false
+		}
+	}
+}
+
+var rulesCommand = &Command{
+	name:   "rules",
+	help:   "shows the rules of the galaxy",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		fmt.Fprintf(conn, "rules, version %d:\n%s\n", rulesVersion, rulesText)
+	},
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Secrets (oauth client secrets, the admin token, smtp passwords) can be
+// given to the server three ways, checked in this order:
+//
+//	NAME=value            in the environment
+//	NAME_FILE=path        a file holding the value, for docker and friends
+//	EXO_SECRETS_FILE      an encrypted file of name/value pairs, unlocked
+//	                      by the passphrase in EXO_SECRETS_KEY
+//
+// The encrypted file is made with "exo seal-secrets < secrets.json", which
+// reads a json object of names to values and writes the sealed file to
+// stdout.
+var sealed struct {
+	sync.Once
+	values map[string]string
+	err    error
+}
+
+func secretsKey() ([]byte, error) {
+	passphrase := os.Getenv("EXO_SECRETS_KEY")
+	if passphrase == "" {
+		if path := os.Getenv("EXO_SECRETS_KEY_FILE"); path != "" {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read EXO_SECRETS_KEY_FILE: %v", err)
+			}
+			passphrase = strings.TrimSpace(string(b))
+		}
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("EXO_SECRETS_FILE is set but EXO_SECRETS_KEY isn't")
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	return key[:], nil
+}
+
+func secretsCipher() (cipher.AEAD, error) {
+	key, err := secretsKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func loadSealedSecrets() (map[string]string, error) {
+	path := os.Getenv("EXO_SECRETS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read secrets file: %v", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("secrets file %s is corrupt: %v", path, err)
+	}
+	gcm, err := secretsCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("secrets file %s is corrupt", path)
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unlock secrets file %s: wrong key?", path)
+	}
+	values := make(map[string]string, 8)
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, fmt.Errorf("secrets file %s is corrupt: %v", path, err)
+	}
+	return values, nil
+}
+
+func unseal() map[string]string {
+	sealed.Do(func() { sealed.values, sealed.err = loadSealedSecrets() })
+	return sealed.values
+}
+
+// secret looks up a secret setting.  Missing secrets are empty.
+func secret(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read %s_FILE: %v\n", name, err)
+			return ""
+		}
+		return strings.TrimSpace(string(b))
+	}
+	return unseal()[name]
+}
+
+func init() {
+	subcommands["seal-secrets"] = runSealSecrets
+}
+
+func runSealSecrets(args []string) int {
+	if err := sealSecrets(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to seal secrets: %v\n", err)
+		return E_Bad_Config
+	}
+	return 0
+}
+
+// sealSecrets is the "seal-secrets" subcommand.
+func sealSecrets(in io.Reader, out io.Writer) error {
+	values := make(map[string]string, 8)
+	if err := json.NewDecoder(in).Decode(&values); err != nil {
+		return fmt.Errorf("secrets should be a json object of names to values: %v", err)
+	}
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	gcm, err := secretsCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)))
+	return err
+}
+
+// checkConfig catches settings that can't work before the server starts
+// taking players.
+func checkConfig() error {
+	var problems errorGroup
+	unseal()
+	if sealed.err != nil {
+		problems.AddError(sealed.err)
+	}
+	for _, p := range oauthProviders {
+		if (p.clientId == "") != (p.secret == "") {
+			problems.AddError(fmt.Errorf("%s login needs both a client id and a client secret", p.name))
+		}
+	}
+	if adminToken != "" && len(adminToken) < 16 {
+		problems.AddError(fmt.Errorf("EXO_ADMIN_TOKEN is too short to be safe; use at least 16 characters"))
+	}
+	switch signupVerify {
+	case "", "token":
+	case "email":
+		if smtpAddr == "" || smtpFrom == "" {
+			problems.AddError(fmt.Errorf("EXO_SIGNUP_VERIFY=email needs EXO_SMTP_ADDR and EXO_SMTP_FROM"))
+		}
+	default:
+		problems.AddError(fmt.Errorf("EXO_SIGNUP_VERIFY must be email or token, not %q", signupVerify))
+	}
+	if smtpUser != "" && smtpPassword == "" {
+		problems.AddError(fmt.Errorf("EXO_SMTP_USER is set but EXO_SMTP_PASSWORD isn't"))
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+func (s *System) Security() float64 {
+	if s.arena {
+		return 0
+	}
+	return math.Min(1, math.Max(0, 1-dist3d(0, 0, 0, s.x, s.y, s.z)/300))
+}
+
+func (s *System) HighSec() bool {
+	return s.Security() >= 0.5
+}
+
+func (c *Connection) Outlaw() bool {
+	return c.security <= -2
+}
+
+func (c *Connection) AdjustSecurity(delta float64) {
+	before := c.Outlaw()
+	c.security = math.Min(5, math.Max(-10, c.security+delta))
+	if c.Outlaw() && !before {
+		fmt.Fprintf(c, "your security status has fallen to %.1f.  police in high security systems will shoot on sight.\n", c.security)
+	} else if !c.Outlaw() && before {
+		fmt.Fprintf(c, "your security status has recovered to %.1f.  the police no longer consider you an outlaw.\n", c.security)
+	}
+}
+
+func (c *Connection) Aggressed(victim *Connection, s *System) {
+	if s == nil || victim == c || victim.Outlaw() || !s.HighSec() {
+		return
+	}
+	if AtWar(memberships[c.PlayerName()], memberships[victim.PlayerName()]) {
+		return
+	}
+	c.AdjustSecurity(-2 * s.Security())
+	log_info("player %s attacked innocent %s in %s.  security: %.1f", c.PlayerName(), victim.PlayerName(), s.name, c.security)
+}
+
+func startSecurity() {
+	After(time.Minute, securityTick)
+}
+
+func securityTick() {
+	defer After(time.Minute, securityTick)
+	for conn, _ := range connected {
+		if conn.security < 0 {
+			conn.AdjustSecurity(0.05)
+		}
+		if s := conn.System(); s != nil {
+			s.Police(conn)
+		}
+	}
+}
+
+func (s *System) Police(p *Connection) {
+	if !p.Outlaw() || !s.HighSec() || p.docked || p.dead {
+		return
+	}
+	fmt.Fprintf(p, "police cruisers in %s open fire on you!\n", s.name)
+	p.Damage(int(20*s.Security()), nil, "police")
+}
+
+var securityCommand = &Command{
+	name:   "security",
+	help:   "shows your security status and the security level of your current system",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		fmt.Fprintf(conn, "security status: %.1f\n", conn.security)
+		if conn.Outlaw() {
+			fmt.Fprintf(conn, "you are an outlaw.\n")
+		}
+		if s := conn.System(); s != nil {
+			fmt.Fprintf(conn, "%s security level: %.1f\n", s.name, s.Security())
+		}
+	},
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var selfDestructCommand = &Command{
+	name:   "selfdestruct",
+	help:   "blows up your ship, damaging everything in the system.  use \"selfdestruct confirm\" to start the countdown and \"selfdestruct abort\" to stop it",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			fmt.Fprintf(conn, "are you sure?  type \"selfdestruct confirm\" to begin a 10 second countdown.\n")
+			return
+		}
+		switch args[0] {
+		case "confirm":
+			if !conn.destruct.IsZero() {
+				fmt.Fprintf(conn, "self-destruct is already counting down.\n")
+				return
+			}
+			conn.StartSelfDestruct(10 * time.Second)
+		case "abort":
+			if conn.destruct.IsZero() {
+				fmt.Fprintf(conn, "self-destruct is not active.\n")
+				return
+			}
+			conn.destruct = time.Time{}
+			fmt.Fprintf(conn, "self-destruct aborted.\n")
+			if s := conn.System(); s != nil {
+				s.EachConn(func(other *Connection) {
+					if other != conn {
+						fmt.Fprintf(other, "the self-destruct sequence of %s has been aborted.\n", other.Describe(conn))
+					}
+				})
+			}
+		default:
+			fmt.Fprintf(conn, "unknown self-destruct option: %s\n", args[0])
+		}
+	},
+}
+
+func (c *Connection) StartSelfDestruct(delay time.Duration) {
+	at := clock.Now().Add(delay)
+	c.destruct = at
+	c.destructCountdown(at, delay)
+	for _, mark := range []time.Duration{5 * time.Second, 3 * time.Second, time.Second} {
+		if mark >= delay {
+			continue
+		}
+		remaining := mark
+		At(at.Add(-remaining), func() {
+			c.destructCountdown(at, remaining)
+		})
+	}
+	At(at, func() {
+		if !c.destruct.Equal(at) || c.dead {
+			return
+		}
+		c.SelfDestruct()
+	})
+}
+
+func (c *Connection) destructCountdown(at time.Time, remaining time.Duration) {
+	if !c.destruct.Equal(at) || c.dead {
+		return
+	}
+	fmt.Fprintf(c, "self-destruct in %v\n", remaining)
+	s := c.System()
+	if s == nil {
+		return
+	}
+	s.EachConn(func(conn *Connection) {
+		if conn != c {
+			fmt.Fprintf(conn, "warning: %s will self-destruct in %v\n", conn.Describe(c), remaining)
+		}
+	})
+}
+
+func (c *Connection) SelfDestruct() {
+	s := c.System()
+	log_info("player %s self-destructed", c.PlayerName())
+	c.AdjustReputation(dragonCultists, 10)
+	fmt.Fprintf(c, "your ship explodes in a brilliant flash.\n")
+	c.Die()
+	if s == nil {
+		return
+	}
+	s.EachConn(func(conn *Connection) {
+		if conn.docked {
+			fmt.Fprintf(conn, "a ship explodes in %s, but your docking clamps keep you safe\n", s.name)
+			return
+		}
+		fmt.Fprintf(conn, "you are caught in the blast of a self-destructing ship!\n")
+		conn.Damage(60, c, W_SelfDestruct)
+	})
+	if owner := s.Colonizer(); owner != nil && owner != c {
+		s.DestroyColony()
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// stardates count a thousand units per year from the turn of the millennium.
+var stardateEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func Stardate(t time.Time) float64 {
+	years := t.Sub(stardateEpoch).Hours() / (24 * 365.25)
+	return years * 1000
+}
+
+// timedEvents are the kinds of scheduled event that players get a countdown
+// for, along with how they're described.
+var timedEvents = []struct {
+	name  string
+	label string
+}{
+	{EV_Contest, "contested system"},
+	{EK_DoubleMining, "news: double mining"},
+	{EK_DragonInvasion, "news: dragon invasion"},
+	{EV_Maintenance, "server maintenance"},
+}
+
+var maintenance *Future
+
+// scheduleMaintenance counts down to a graceful restart, warning everyone
+// along the way.
+func scheduleMaintenance(delay time.Duration) {
+	if maintenance != nil {
+		scheduler.Cancel(maintenance.id)
+	}
+	ts := clock.Now().Add(delay)
+	maintenance = AtNamed(EV_Maintenance, ts, func() {
+		shutdown("scheduled maintenance")
+	})
+	for _, warning := range []time.Duration{5 * time.Minute, time.Minute} {
+		if delay <= warning {
+			continue
+		}
+		w := warning
+		m := maintenance
+		At(ts.Add(-w), func() {
+			if maintenance != m {
+				return
+			}
+			for conn, _ := range connected {
+				fmt.Fprintf(conn, "the server goes down for maintenance in %v.  dock up!\n", w)
+			}
+		})
+	}
+	for conn, _ := range connected {
+		fmt.Fprintf(conn, "the server will go down for maintenance in %v\n", delay)
+	}
+}
+
+var timeCommand = &Command{
+	name: "time",
+	help: "shows the server time and how long until upcoming events.  usage:\n" +
+		"\ttime\n" +
+		"\ttime maintenance [minutes]|cancel   (admin only)",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) > 0 {
+			timeMaintenance(conn, args...)
+			return
+		}
+		now := clock.Now()
+		fmt.Fprintf(conn, "server time: %s\n", now.UTC().Format("2006-01-02 15:04:05 MST"))
+		fmt.Fprintf(conn, "stardate:    %.1f\n", Stardate(now))
+		if c, ok := clock.(*gameClock); ok {
+			if rate, paused := c.Rate(); paused {
+				fmt.Fprintf(conn, "game time is paused\n")
+			} else if rate != 1 {
+				fmt.Fprintf(conn, "game time is running at %gx\n", rate)
+			}
+		}
+		fmt.Fprintf(conn, "physics:     %s, light crosses %.0f units a minute\n", physics.mode, physics.LightRadius(time.Minute))
+		next := make(map[string]time.Time, len(timedEvents))
+		for _, future := range scheduler.Pending() {
+			if _, ok := next[future.name]; !ok {
+				next[future.name] = future.ts
+			}
+		}
+		shown := false
+		for _, e := range timedEvents {
+			ts, ok := next[e.name]
+			if !ok {
+				continue
+			}
+			shown = true
+			fmt.Fprintf(conn, "\t%-24s in %v\n", e.label, ts.Sub(now).Truncate(time.Second))
+		}
+		if contest != nil {
+			shown = true
+			fmt.Fprintf(conn, "\t%-24s ends in %v\n", "contest on "+contest.system.name, contest.ends.Sub(now).Truncate(time.Second))
+		}
+		if !shown {
+			fmt.Fprintf(conn, "nothing is scheduled.\n")
+		}
+	},
+}
+
+func timeMaintenance(conn *Connection, args ...string) {
+	if !conn.IsAdmin() {
+		fmt.Fprintf(conn, "only admins can schedule maintenance.\n")
+		return
+	}
+	if len(args) != 2 || args[0] != "maintenance" {
+		fmt.Fprintf(conn, "usage: time maintenance [minutes]|cancel\n")
+		return
+	}
+	if args[1] == "cancel" {
+		if maintenance == nil || !scheduler.Cancel(maintenance.id) {
+			fmt.Fprintf(conn, "there's no maintenance scheduled.\n")
+			return
+		}
+		maintenance = nil
+		for c, _ := range connected {
+			fmt.Fprintf(c, "scheduled maintenance has been called off.\n")
+		}
+		return
+	}
+	minutes, err := strconv.Atoi(args[1])
+	if err != nil || minutes < 1 {
+		fmt.Fprintf(conn, "that's not a number of minutes: %s\n", args[1])
+		return
+	}
+	log_info("admin %s scheduled maintenance in %d minutes", conn.PlayerName(), minutes)
+	scheduleMaintenance(time.Duration(minutes) * time.Minute)
+}
@@ -2,41 +2,155 @@ package main
 
 import (
 	"bufio"
+	"compress/zlib"
 	"fmt"
+	"io"
 	"math/rand"
-	"net"
 	"strings"
+	"sync"
 	"time"
 )
 
-var connected = make(map[*Connection]bool, 32)
+// connected is changed by connection goroutines as players come and go, so
+// the changes are made under connectedLock, and anything that reads it from
+// elsewhere (the diagnostic console, say) takes a snapshot under the lock.
+var (
+	connected     = make(map[*Connection]bool, 32)
+	connectedLock sync.RWMutex
+)
 
+// connections is a snapshot of everyone connected.
+func connections() []*Connection {
+	connectedLock.RLock()
+	defer connectedLock.RUnlock()
+	conns := make([]*Connection, 0, len(connected))
+	for conn, _ := range connected {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// Connection is a player's session.  It doesn't care how the player is
+// connected, only that it can read lines from them and write text back.
 type Connection struct {
-	net.Conn
+	rw io.ReadWriter
 	*bufio.Reader
-	player   *Player
-	location *System
-	lastScan time.Time
-	lastBomb time.Time
-	kills    int
-	dead     bool
-	money    int64
-	mining   bool
-	colonies []*System
-	bombs    int
-}
-
-func NewConnection(conn net.Conn) *Connection {
+	player    *Player
+	character *Character
+	location  *System
+	lastScan  time.Time
+	lastBomb  time.Time
+	kills     int
+	dead      bool
+	money     int64
+	mining    bool
+	colonies  []*System
+	bombs     int
+	silent    bool
+	known     map[*Connection]bool
+	docked    bool
+	hull      int
+	shield    int
+	destruct  time.Time
+	crew      int
+	heldBy    *Connection
+	escorts   int
+	upkeep    bool
+
+	pendingTOTP string
+
+	overheated map[string]time.Time
+	burnt      map[string]time.Time
+
+	lastJam      time.Time
+	paintedUntil time.Time
+	lastSeerScan time.Time
+
+	reputation map[*Faction]int
+	upgrades   map[string]bool
+	modules    map[string]bool
+	loadouts   map[string][]string
+	cargo      map[string]int
+	armory     map[string]int
+	anomaly    *AnomalyScan
+	capital    *CapitalShip
+	fleet      *Fleet
+	arena      *Arena
+	duel       *Duel
+	challenge  *Duel
+	relicSeen  *System
+	security   float64
+	repute     int
+
+	research research
+
+	hangar    int
+	fighters  int
+	defenders int
+	harassers int
+	harassing *Connection
+
+	design   *Design
+	ships    []*Ship
+	probes   []*Probe
+	shipName string
+	lastLoss struct {
+		ship   string
+		system *System
+		value  int64
+	}
+
+	lastAssault time.Time
+
+	scanned       map[int]bool
+	scannedPeriod string
+
+	protocol string
+	version  int
+	gmcp     bool
+	deflate  *zlib.Writer
+
+	leaving   bool
+	loggedOut bool
+
+	connectedAt time.Time
+
+	outbox *Outbox
+
+	watch exploitWatch
+}
+
+func NewConnection(rw io.ReadWriter) *Connection {
 	c := &Connection{
-		Conn:   conn,
-		Reader: bufio.NewReader(conn),
+		rw:     rw,
+		Reader: bufio.NewReader(rw),
 		bombs:  1,
+		hull:   100,
+		shield: starterDesign.maxShield,
+		crew:   10,
+		design: starterDesign,
+
+		connectedAt: time.Now(),
 	}
+	c.startOutbox()
+	connectedLock.Lock()
 	connected[c] = true
+	connectedLock.Unlock()
 	return c
 }
 
+// Write is where all free-form game output ends up.  For json clients, each
+// write becomes a text message of its own.
+func (c *Connection) Write(p []byte) (int, error) {
+	if c.protocol == P_JSON {
+		c.sendMessage(Message{Type: "text", Text: string(p)})
+		return len(p), nil
+	}
+	return c.send(p)
+}
+
 func (c *Connection) Login() {
+	c.Greet()
 	for {
 		fmt.Fprintf(c, "what is your name, adventurer?\n")
 		name, err := c.ReadString('\n')
@@ -46,6 +160,15 @@ func (c *Connection) Login() {
 			log_error("player failed to connect: %v", err)
 			return
 		}
+		if fields := strings.Fields(name); len(fields) > 0 && fields[0] == "hello" && len(fields) > 1 {
+			c.Negotiate(fields[1:])
+			continue
+		}
+		// a login token from a linked account can follow the name
+		var token string
+		if fields := strings.Fields(name); len(fields) == 2 {
+			name, token = fields[0], fields[1]
+		}
 		if !ValidName(name) {
 			fmt.Fprintf(c, "that name is illegal.\n")
 			continue
@@ -54,19 +177,75 @@ func (c *Connection) Login() {
 		player, err := loadPlayer(name)
 		if err != nil {
 			log_error("could not read player: %v", err)
+			if characterExists(name) || takenElsewhere(name) {
+				fmt.Fprintf(c, "that name is taken.\n")
+				continue
+			}
+			if !c.AllowSignup() || !c.SolvePuzzle() {
+				return
+			}
+			email, ok := c.VerifySignup(name)
+			if !ok {
+				return
+			}
 			player = &Player{name: name}
 			if err := player.Create(); err != nil {
 
+			}
+			recordSignup(c.RemoteIP())
+			if email != "" {
+				if err := player.SetEmail(email); err != nil {
+					log_error("%v", err)
+				}
+			}
+			c.player = player
+			if !c.AgreeToRules() || !c.ChooseCharacter() {
+				return
 			}
 			fmt.Fprintf(c, "you look new around these parts, %s.\n", player.name)
-			fmt.Fprintf(c, `if you'd like a description of how to play, type the "help" command`)
+			fmt.Fprintf(c, "if you'd like a description of how to play, type the \"help\" command\n")
 		} else {
+			if !c.AllowLogin() {
+				return
+			}
+			if !c.Authenticate(player, token) {
+				fmt.Fprintf(c, "authentication failed.\n")
+				recordLoginFailure(c.RemoteIP())
+				continue
+			}
 			c.player = player
-			fmt.Fprintf(c, "welcome back, %s.\n", player.name)
+			if !c.AgreeToRules() || !c.ChooseCharacter() {
+				return
+			}
+			c.Restore()
+			fmt.Fprintf(c, "welcome back, %s.\n", c.character.name)
+		}
+		if c.player.admin && c.player.totpSecret == "" {
+			fmt.Fprintf(c, "admin accounts need two-factor authentication.  your admin powers are suspended until you run \"2fa setup\".\n")
 		}
 		break
 	}
+	c.JoinChannel(defaultChannel)
+	c.CheckIn()
+	c.CheckMail()
+	if c.character.Home() == nil {
+		if home := randomHome(); home != nil {
+			if err := c.character.SetHome(home); err != nil {
+				log_error("%v", err)
+			}
+			c.character.homeSet = time.Time{}
+			fmt.Fprintf(c, "your home system is %s.  you'll respawn there if your ship is destroyed.\n", home.name)
+		}
+	}
+}
 
+func findConnection(name string) *Connection {
+	for _, conn := range connections() {
+		if conn.PlayerName() == name {
+			return conn
+		}
+	}
+	return nil
 }
 
 func (c *Connection) SetSystem(s *System) {
@@ -77,63 +256,168 @@ func (c *Connection) System() *System {
 	return c.location
 }
 
+// Close is safe to call more than once.  Win closes every connection, and
+// then each one's own handler closes it again on the way out.
 func (c *Connection) Close() error {
+	if c.loggedOut {
+		return nil
+	}
 	log_info("player disconnecting: %s", c.PlayerName())
+	c.CancelTrades()
+	if err := c.Save(); err != nil {
+		log_error("%v", err)
+	}
+	if relic != nil && relic.carrier == c {
+		relic.Drop(c.location)
+	}
+	connectedLock.Lock()
 	delete(connected, c)
-	return c.Conn.Close()
+	connectedLock.Unlock()
+	c.LeaveChannels()
+	c.loggedOut = true
+	c.Park()
+	c.closeOutbox()
+	if c.deflate != nil {
+		c.deflate.Close()
+	}
+	if closer, ok := c.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (c *Connection) IsAdmin() bool {
+	return c.player != nil && c.player.admin && c.player.totpSecret != ""
 }
 
 func (c *Connection) PlayerName() string {
+	if c.character != nil {
+		return c.character.name
+	}
 	if c.player == nil {
 		return ""
 	}
 	return c.player.name
 }
 
+func (c *Connection) Identify(other *Connection) {
+	if c.known == nil {
+		c.known = make(map[*Connection]bool, 8)
+	}
+	c.known[other] = true
+}
+
+func (c *Connection) Describe(other *Connection) string {
+	if c.known[other] {
+		return other.PlayerName()
+	}
+	return "an unidentified ship"
+}
+
+func (c *Connection) TravelTime(from, to *System) time.Duration {
+	delay := from.TravelTimeTo(to)
+	if c.silent {
+		delay = delay * 3 / 2
+	}
+	if c.Hot("engines") {
+		delay = delay * 2 / 3
+	}
+	if c.Tamed("swift") {
+		delay = time.Duration(float64(delay) * swiftTravel)
+	}
+	return physics.Modified(from.DistanceTo(to), delay, c.design.speed*c.CargoDrag()*c.TechBonus("engines"))
+}
+
 func (c *Connection) InTransit() bool {
 	return c.location == nil
 }
 
+// AtStation says whether the pilot is at a system with a station, where the
+// station's offices are open to them.
+func (c *Connection) AtStation() bool {
+	return c.location != nil && c.location.station
+}
+
+// closeScan is how near a system has to be for a scan to make out the ships
+// in it, before any sensor research.
+const closeScan = 20.0
+
+func (c *Connection) ScanReach() float64 {
+	return closeScan * c.TechBonus("sensors")
+}
+
 func (c *Connection) RecordScan() {
 	fmt.Fprintln(c, "scanning known systems for signs of life")
-	c.lastScan = time.Now()
+	c.lastScan = clock.Now()
 	After(1*time.Minute, func() {
 		fmt.Fprintln(c, "scanner ready")
 	})
 }
 
 func (c *Connection) RecordBomb() {
-	c.lastBomb = time.Now()
-	After(15*time.Second, func() {
+	c.lastBomb = clock.Now()
+	After(c.BombReload(), func() {
 		fmt.Fprintln(c, "bomb arsenal reloaded")
 	})
 }
 
+// BombReload is how long the ship's launchers take to reload.  More
+// launchers reload faster.
+func (c *Connection) BombReload() time.Duration {
+	if c.design.weapons <= 1 {
+		return 15 * time.Second
+	}
+	return 15 * time.Second / time.Duration(c.design.weapons)
+}
+
 func (c *Connection) CanScan() bool {
-	return time.Since(c.lastScan) > 1*time.Minute
+	return clock.Now().Sub(c.lastScan) > 1*time.Minute
 }
 
 func (c *Connection) CanBomb() bool {
-	return time.Since(c.lastBomb) > 15*time.Second
+	return c.design.weapons > 0 && clock.Now().Sub(c.lastBomb) > c.BombReload()
 }
 
 func (c *Connection) NextScan() time.Duration {
-	return -time.Since(c.lastScan.Add(time.Minute))
+	return c.lastScan.Add(time.Minute).Sub(clock.Now())
 }
 
 func (c *Connection) NextBomb() time.Duration {
-	return -time.Since(c.lastBomb.Add(15 * time.Second))
+	return c.lastBomb.Add(c.BombReload()).Sub(clock.Now())
 }
 
-func (c *Connection) MadeKill(victim *Connection) {
+func (c *Connection) MadeKill(victim *Connection, weapon string) {
+	recordKill(c, victim, weapon)
+	c.Aggressed(victim, victim.lastLoss.system)
+	recordActivity(A_Kill, c.PlayerName(), victim.lastLoss.system)
 	c.kills += 1
+	c.Progress(CH_Kill, 1)
+	if c.kills == 10 {
+		c.Award(K_Title, "Ace")
+		c.Award(K_Decal, "skull")
+	}
+	c.AdjustReputation(pirateClans, 10)
+	c.AdjustReputation(minersGuild, -5)
+	c.KilledPilot(victim)
+	c.ClaimBounties(victim)
 	if c.kills == 3 {
 		c.Win()
 	}
 }
 
+func (c *Connection) MaxHull() int {
+	if c.HasUpgrade("plating") {
+		return c.design.maxHull + 50
+	}
+	return c.design.maxHull
+}
+
+func (c *Connection) Rank() int {
+	return 1 + c.kills + int(c.money/5000)
+}
+
 func (c *Connection) StartMining() {
-	fmt.Fprintf(c, "now mining %s with a payout rate of %v\n", c.System().name, c.System().miningRate)
+	fmt.Fprintf(c, "now mining %s with a payout rate of %v\n", c.System().name, c.System().MiningRate())
 	fmt.Fprintln(c, "(press enter to stop mining)")
 	c.mining = true
 }
@@ -148,36 +432,100 @@ func (c *Connection) IsMining() bool {
 }
 
 func (c *Connection) Payout() {
-	if c.dead {
+	if c.dead || c.InTransit() {
 		return
 	}
-	reward := int64(rand.NormFloat64()*5.0 + 100.0*c.System().miningRate)
+	reward := int64(rand.NormFloat64()*5.0 + 100.0*c.System().MiningRate())
+	if c.HasUpgrade("drill") {
+		reward = reward * 5 / 4
+	}
+	if corp := memberships[c.PlayerName()]; corp != nil && corp.Buffed() {
+		reward = reward * 5 / 4
+	}
 	c.Deposit(reward)
+	c.MinedTogether(reward)
+	c.Progress(CH_Mine, 1)
+	c.AdjustReputation(minersGuild, 1)
 	fmt.Fprintf(c, "mined: %d space duckets. total: %d\n", reward, c.money)
 }
 
 func (c *Connection) Withdraw(n int64) {
-	c.money -= n
+	c.Credited(-n)
+	recordBurned(n)
 }
 
 func (c *Connection) Deposit(n int64) {
-	c.money += n
+	c.Credited(n)
+	recordMinted(n)
 	if c.money >= 25000 {
 		c.Win()
 	}
 }
 
+// Win ends the game.  A player's allies share in the victory.
 func (c *Connection) Win() {
 	for conn, _ := range connected {
 		fmt.Fprintf(conn, "player %s has won.\n", c.PlayerName())
+		if a := c.Alliance(); a != nil {
+			fmt.Fprintf(conn, "victory goes to the alliance %s: %s\n", a.name, strings.Join(a.Members(), ", "))
+		}
 		conn.Close()
 	}
 }
 
+func (c *Connection) Damage(n int, attacker *Connection, weapon string) {
+	if c.duel != nil && attacker != c.duel.Opponent(c) {
+		fmt.Fprintf(c, "duel marshals deflect outside interference.\n")
+		return
+	}
+	out := ResolveHit(Hit{Damage: n, Painted: c.Painted(), Shield: c.shield, Hull: c.hull})
+	n, hit := out.Damage, out.Taken
+	c.shield, c.hull = out.Shield, out.Hull
+	if c.duel != nil && out.Destroyed {
+		c.duel.Resolve(c)
+		return
+	}
+	if c.hull > 0 {
+		if hit < n {
+			fmt.Fprintf(c, "your shields absorb %d damage and your hull takes %d.  shields: %d hull: %d\n", n-hit, hit, c.shield, c.hull)
+		} else {
+			fmt.Fprintf(c, "your ship takes %d damage.  hull: %d\n", n, c.hull)
+		}
+		return
+	}
+	c.Die()
+	if attacker != nil && attacker != c {
+		attacker.MadeKill(c, weapon)
+	}
+}
+
 func (c *Connection) Die() {
-	fmt.Fprintf(c, "you were bombed.  You will respawn in 1 minutes.\n")
+	fmt.Fprintf(c, "your ship has been destroyed.  You will respawn in 1 minute.\n")
+	c.lastLoss.ship = c.ShipLabel()
+	c.lastLoss.system = c.location
+	c.lastLoss.value = c.ShipValue()
+	if relic != nil && relic.carrier == c {
+		relic.Drop(c.location)
+	}
 	c.dead = true
-	c.System().Leave(c)
+	c.destruct = time.Time{}
+	if c.capital != nil {
+		c.capital.Remove(c)
+	}
+	c.heldBy = nil
+	c.escorts = 0
+	c.cargo = nil
+	c.fighters = 0
+	c.defenders = 0
+	c.harassers = 0
+	c.harassing = nil
+	if c.location != nil {
+		c.location.Leave(c)
+	}
+	if c.Hardcore() {
+		c.Perish()
+		return
+	}
 	After(30*time.Second, func() {
 		fmt.Fprintf(c, "respawn in 30 seconds.\n")
 	})
@@ -185,10 +533,21 @@ func (c *Connection) Die() {
 }
 
 func (c *Connection) Respawn() {
+	if c.loggedOut {
+		return
+	}
 	c.dead = false
+	c.design = starterDesign
+	if err := retireShip(c.shipName); err != nil {
+		log_error("%v", err)
+	}
+	c.shipName = ""
+	c.hull = c.MaxHull()
+	c.shield = c.MaxShield()
+	c.crew = 10
 
 WUT:
-	s, err := randomSystem()
+	s, err := c.HomeSystem()
 	if err != nil {
 		log_error("error in respawn: %v", err)
 		goto WUT
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	shieldRecharge = 5
+	shieldInterval = 10 * time.Second
+)
+
+// bombDamage is what a standard bomb does to each ship caught in the blast.
+// Bigger bombs scale it up by their yield.
+var bombDamage = envInt("EXO_BOMB_DAMAGE", 120)
+
+func BombDamage(yield int) int {
+	return bombDamage * yield / baseYield
+}
+
+func (c *Connection) MaxShield() int {
+	return int(float64(c.design.maxShield) * c.TechBonus("shields"))
+}
+
+func startShields() {
+	After(shieldInterval, shieldTick)
+}
+
+// shieldTick recharges the shields of every ship that's out in space.
+func shieldTick() {
+	defer After(shieldInterval, shieldTick)
+	for conn, _ := range connected {
+		if conn.dead || conn.shield >= conn.MaxShield() {
+			continue
+		}
+		conn.shield += shieldRecharge
+		if conn.shield > conn.MaxShield() {
+			conn.shield = conn.MaxShield()
+		}
+	}
+}
+
+var shieldsCommand = &Command{
+	name:   "shields",
+	help:   "shows the state of your hull and shields",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		fmt.Fprintf(conn, "hull: %d/%d\n", conn.hull, conn.MaxHull())
+		fmt.Fprintf(conn, "shields: %d/%d (recharging %d every %v)\n", conn.shield, conn.MaxShield(), shieldRecharge, shieldInterval)
+	},
+}
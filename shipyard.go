@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type Design struct {
+	name      string
+	maxHull   int
+	ore       int
+	machinery int
+	cost      int64
+	slots     int
+	maxShield int
+	hold      int
+	// travel time against a standard hull; lower is faster
+	speed float64
+	// bomb launchers.  each one shortens the reload, and a hull without any
+	// can't launch bombs at all.
+	weapons int
+	// only built at shipyards, not at every station
+	shipyard bool
+}
+
+type Ship struct {
+	name   string
+	design *Design
+	hull   int
+	bombs  int
+	cargo  map[string]int
+	owner  *Connection
+	parked *System
+}
+
+var starterDesign = &Design{name: "starter", maxHull: 100, slots: 3, maxShield: 50, hold: 60, speed: 1, weapons: 1}
+
+var designs = map[string]*Design{
+	"cutter":    {name: "cutter", maxHull: 80, ore: 20, machinery: 5, cost: 500, slots: 2, maxShield: 60, hold: 30, speed: 1, weapons: 1},
+	"hauler":    {name: "hauler", maxHull: 100, ore: 40, machinery: 10, cost: 1000, slots: 3, maxShield: 40, hold: 250, speed: 1, weapons: 1},
+	"frigate":   {name: "frigate", maxHull: 150, ore: 60, machinery: 20, cost: 2000, slots: 5, maxShield: 100, hold: 100, speed: 1, weapons: 1},
+	"scout":     {name: "scout", maxHull: 60, ore: 15, machinery: 10, cost: 1200, slots: 2, maxShield: 40, hold: 20, speed: 0.7, weapons: 1, shipyard: true},
+	"freighter": {name: "freighter", maxHull: 120, ore: 50, machinery: 15, cost: 1500, slots: 2, maxShield: 50, hold: 400, speed: 1.4, weapons: 0, shipyard: true},
+	"destroyer": {name: "destroyer", maxHull: 200, ore: 80, machinery: 30, cost: 3000, slots: 4, maxShield: 120, hold: 60, speed: 1, weapons: 3, shipyard: true},
+}
+
+// shipyards are the stations big enough to build the specialist hulls.
+const shipyardPlanets = 5
+
+func (s *System) Shipyard() bool {
+	return s.station && !s.arena && s.planets >= shipyardPlanets
+}
+
+// fastestHull is the lowest travel time multiplier of any design, for
+// anything that needs to know how fast a ship could possibly go.
+func fastestHull() float64 {
+	fastest := starterDesign.speed
+	for _, d := range designs {
+		if d.speed < fastest {
+			fastest = d.speed
+		}
+	}
+	return fastest
+}
+
+func (s *System) Park(ship *Ship) {
+	if s.parked == nil {
+		s.parked = make(map[*Ship]bool, 4)
+	}
+	ship.parked = s
+	s.parked[ship] = true
+}
+
+func (s *System) Unpark(ship *Ship) {
+	delete(s.parked, ship)
+	ship.parked = nil
+}
+
+func (s *System) DestroyParked() {
+	for ship, _ := range s.parked {
+		s.Unpark(ship)
+		ship.owner.RemoveShip(ship)
+		fmt.Fprintf(ship.owner, "your parked %s in %s has been destroyed!\n", ship.design.name, s.name)
+	}
+}
+
+func (c *Connection) RemoveShip(ship *Ship) {
+	for i, other := range c.ships {
+		if other == ship {
+			c.ships = append(c.ships[:i], c.ships[i+1:]...)
+			return
+		}
+	}
+}
+
+var shipyardCommand = &Command{
+	name:   "shipyard",
+	help:   "lists the ship designs that can be built at a station.  speed is travel time against a standard hull; lower is faster",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		names := make([]string, 0, len(designs))
+		for name, _ := range designs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		fmt.Fprintf(conn, "%-10s %-6s %-6s %-6s %-8s %-6s %-10s %s\n", "design", "hull", "hold", "speed", "weapons", "ore", "machinery", "duckets")
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		for _, name := range names {
+			d := designs[name]
+			where := ""
+			if d.shipyard {
+				where = "shipyards only"
+			}
+			fmt.Fprintf(conn, "%-10s %-6d %-6d %-6.1f %-8d %-6d %-10d %-8d %s\n", d.name, d.maxHull, d.hold, d.speed, d.weapons, d.ore, d.machinery, d.cost, where)
+		}
+		fmt.Fprintln(conn, "--------------------------------------------------------------------------------")
+		if s := conn.System(); s != nil && s.Shipyard() {
+			fmt.Fprintf(conn, "%s has a shipyard.\n", s.name)
+		}
+	},
+}
+
+var buildCommand = &Command{
+	name:   "build",
+	help:   "builds a new ship at a station from ore, machinery and space duckets.  usage: build [design]",
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) != 1 {
+			fmt.Fprintf(conn, "usage: build [design]\n")
+			return
+		}
+		d, ok := designs[args[0]]
+		if !ok {
+			fmt.Fprintf(conn, "no such design: %s\n", args[0])
+			return
+		}
+		system := conn.System()
+		if !system.station {
+			fmt.Fprintf(conn, "ships can only be built at a station.\n")
+			return
+		}
+		if d.shipyard && !system.Shipyard() {
+			fmt.Fprintf(conn, "a %s can only be built at a shipyard.  %s doesn't have one.\n", d.name, system.name)
+			return
+		}
+		if conn.cargo["ore"] < d.ore || conn.cargo["machinery"] < d.machinery {
+			fmt.Fprintf(conn, "a %s needs %d ore and %d machinery in your hold.\n", d.name, d.ore, d.machinery)
+			return
+		}
+		if conn.money < d.cost {
+			fmt.Fprintf(conn, "not enough money!  a %s costs %d space duckets to build.\n", d.name, d.cost)
+			return
+		}
+		conn.Withdraw(d.cost)
+		conn.AddCargo(goods["ore"], -d.ore)
+		conn.AddCargo(goods["machinery"], -d.machinery)
+		ship := &Ship{design: d, hull: d.maxHull, owner: conn}
+		conn.ships = append(conn.ships, ship)
+		system.Park(ship)
+		fmt.Fprintf(conn, "the shipwrights of %s have built you a %s.  it's parked here.  use \"ships\" to see your fleet.\n", system.name, d.name)
+	},
+}
+
+var shipsCommand = &Command{
+	name:   "ships",
+	help:   "lists your parked ships",
+	mobile: true,
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		fmt.Fprintf(conn, "flying: %s (hull %d)\n", conn.ShipLabel(), conn.hull)
+		for i, ship := range conn.ships {
+			fmt.Fprintf(conn, "%-4d %-10s %-30s hull %-4d parked at %s\n", i, ship.design.name, ship.name, ship.hull, ship.parked.name)
+		}
+	},
+}
+
+var switchCommand = &Command{
+	name:   "switch",
+	help:   "parks your current ship and takes command of one parked at this station.  usage: switch [ship-number]",
+	docked: true,
+	handler: func(conn *Connection, args ...string) {
+		if len(args) != 1 {
+			fmt.Fprintf(conn, "usage: switch [ship-number]\n")
+			return
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 || n >= len(conn.ships) {
+			fmt.Fprintf(conn, "you don't have a ship number %s\n", args[0])
+			return
+		}
+		system := conn.System()
+		next := conn.ships[n]
+		if next.parked != system {
+			fmt.Fprintf(conn, "that ship is parked at %s\n", next.parked.name)
+			return
+		}
+		if !system.station {
+			fmt.Fprintf(conn, "you can only switch ships at a station.\n")
+			return
+		}
+		current := &Ship{
+			name:   conn.shipName,
+			design: conn.design,
+			hull:   conn.hull,
+			bombs:  conn.bombs,
+			cargo:  conn.cargo,
+			owner:  conn,
+		}
+		system.Unpark(next)
+		conn.ships[n] = current
+		system.Park(current)
+		conn.design = next.design
+		conn.shipName = next.name
+		if err := reregisterShip(next.name, next.design); err != nil {
+			log_error("%v", err)
+		}
+		conn.hull = next.hull
+		conn.shield = 0
+		conn.bombs = next.bombs
+		conn.cargo = next.cargo
+		fmt.Fprintf(conn, "you've taken command of your %s.  your %s is parked here.\n", next.design.name, current.design.name)
+	},
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+var hailCommand = &Command{
+	name: "hail",
+	help: "sends a message to a single system.  usage: hail [system] [message]",
+	handler: func(conn *Connection, args ...string) {
+		to, rest := splitSystemArgs(args)
+		if to == nil || len(rest) == 0 {
+			fmt.Fprintf(conn, "usage: hail [system] [message]\n")
+			return
+		}
+		msg := strings.Join(rest, " ")
+		from := conn.System()
+		log_info("hail sent from %s to %s: %v", from.name, to.name, msg)
+		recordChat(conn.PlayerName(), to.name, msg)
+		if conn.ShadowMuted() {
+			return
+		}
+		transmit(conn, from, to, msg)
+	},
+}
+
+func splitSystemArgs(args []string) (*System, []string) {
+	for i := len(args); i > 0; i-- {
+		if s := lookupSystem(strings.Join(args[:i], " ")); s != nil {
+			return s, args[i:]
+		}
+	}
+	return nil, args
+}
+
+func transmit(sender *Connection, from, to *System, msg string) {
+	for _, relay := range relaySystems(from, to) {
+		r := relay
+		After(from.LightTimeTo(r), func() {
+			interceptMessage(r, from, to, sender, msg)
+		})
+	}
+	AfterNamed(EV_Message, from.LightTimeTo(to), func() {
+		deliverMessage(to.id, from.id, sender, msg)
+	})
+}
+
+func relaySystems(from, to *System) []*System {
+	relays := make([]*System, 0, 8)
+	length := from.DistanceTo(to)
+	if length == 0 {
+		return relays
+	}
+	for _, s := range allSystems() {
+		if s == from || s == to {
+			continue
+		}
+		t := ((s.x-from.x)*(to.x-from.x) + (s.y-from.y)*(to.y-from.y) + (s.z-from.z)*(to.z-from.z)) / sq(length)
+		if t <= 0 || t >= 1 {
+			continue
+		}
+		px := from.x + t*(to.x-from.x)
+		py := from.y + t*(to.y-from.y)
+		pz := from.z + t*(to.z-from.z)
+		if dist3d(px, py, pz, s.x, s.y, s.z) < math.Max(5, length*0.05) {
+			relays = append(relays, s)
+		}
+	}
+	return relays
+}
+
+func interceptMessage(relay, from, to *System, sender *Connection, msg string) {
+	relay.EachConn(func(conn *Connection) {
+		if conn == sender || !conn.HasUpgrade("sigint") {
+			return
+		}
+		if sender.HasUpgrade("encryption") {
+			fmt.Fprintf(conn, "intercepted an encrypted transmission from %s to %s\n", from.name, to.name)
+			return
+		}
+		fmt.Fprintf(conn, "intercepted a transmission from %s to %s: %s\n", from.name, to.name, msg)
+	})
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// new accounts are throttled per address and per subnet so that griefers
+// can't churn through throwaway accounts.  Optionally every new account can
+// be made to prove itself with an emailed code or an invite token.
+var (
+	signupWindow      = time.Duration(envInt("EXO_SIGNUP_WINDOW_HOURS", 24)) * time.Hour
+	signupLimit       = envInt("EXO_SIGNUP_LIMIT", 3)
+	subnetSignupLimit = envInt("EXO_SUBNET_SIGNUP_LIMIT", 10)
+
+	// failed logins are throttled the same way, so that nobody can guess
+	// their way into an account
+	loginFailureWindow = time.Duration(envInt("EXO_LOGIN_FAILURE_WINDOW_MINUTES", 15)) * time.Minute
+	loginFailureLimit  = envInt("EXO_LOGIN_FAILURE_LIMIT", 5)
+
+	// "email", "token" or empty for no verification
+	signupVerify = os.Getenv("EXO_SIGNUP_VERIFY")
+	// set to 1 to have new players solve a puzzle to show they're human
+	signupPuzzle = envInt("EXO_SIGNUP_PUZZLE", 0) != 0
+
+	smtpAddr     = os.Getenv("EXO_SMTP_ADDR")
+	smtpFrom     = os.Getenv("EXO_SMTP_FROM")
+	smtpUser     = os.Getenv("EXO_SMTP_USER")
+	smtpPassword = secret("EXO_SMTP_PASSWORD")
+)
+
+func signupsTable() {
+	stmnt := `create table if not exists signups (
+        ip text not null,
+        subnet text not null,
+        ts integer not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create signups table: %v", err)
+	}
+	stmnt = `create table if not exists invites (
+        code text not null unique,
+        created_by text not null,
+        used_by text not null default ''
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create invites table: %v", err)
+	}
+	stmnt = `create table if not exists verifications (
+        ip text not null,
+        subnet text not null,
+        ts integer not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create verifications table: %v", err)
+	}
+	stmnt = `create table if not exists login_failures (
+        ip text not null,
+        subnet text not null,
+        ts integer not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create login_failures table: %v", err)
+	}
+	addColumn("players", "email", "text not null default ''")
+}
+
+// RemoteIP is the address the player is connecting from, if we can tell.
+func (c *Connection) RemoteIP() string {
+	conn, ok := c.rw.(interface{ RemoteAddr() net.Addr })
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// subnet groups addresses that probably belong to the same person: a /24
+// for IPv4 and a /64 for IPv6.
+func subnet(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return addr.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// recentFrom counts the rows in one of the throttle tables (signups,
+// verifications or login_failures) from an address or subnet inside the window.
+func recentFrom(table, column, value string, window time.Duration) int {
+	row := db.QueryRow(`select count(*) from `+table+` where `+column+` = ? and ts > ?`, value, time.Now().Add(-window).Unix())
+	var n int
+	if err := row.Scan(&n); err != nil {
+		log_error("unable to count %s from %s: %v", table, value, err)
+	}
+	return n
+}
+
+func recordFrom(table, ip string) {
+	if _, err := db.Exec(`insert into `+table+` (ip, subnet, ts) values (?, ?, ?)`, ip, subnet(ip), time.Now().Unix()); err != nil {
+		log_error("unable to record %s from %s: %v", table, ip, err)
+	}
+}
+
+func recentSignups(column, value string) int {
+	return recentFrom("signups", column, value, signupWindow)
+}
+
+func recordSignup(ip string) {
+	recordFrom("signups", ip)
+}
+
+func recordLoginFailure(ip string) {
+	if ip != "" {
+		recordFrom("login_failures", ip)
+	}
+}
+
+// AllowLogin checks the connection against the limit on failed logins.
+func (c *Connection) AllowLogin() bool {
+	ip := c.RemoteIP()
+	if ip == "" || loginFailureLimit <= 0 {
+		return true
+	}
+	if recentFrom("login_failures", "ip", ip, loginFailureWindow) >= loginFailureLimit {
+		log_info("refused login from %s: too many failures", ip)
+		fmt.Fprintf(c, "too many failed logins from your address.  try again later.\n")
+		return false
+	}
+	return true
+}
+
+// AllowSignup checks the connection against the account creation limits.
+func (c *Connection) AllowSignup() bool {
+	ip := c.RemoteIP()
+	if ip == "" {
+		return true
+	}
+	if signupLimit > 0 && recentSignups("ip", ip) >= signupLimit {
+		log_info("refused signup from %s: too many accounts", ip)
+		fmt.Fprintf(c, "too many accounts have been created from your address recently.  try again later.\n")
+		return false
+	}
+	if subnetSignupLimit > 0 && recentSignups("subnet", subnet(ip)) >= subnetSignupLimit {
+		log_info("refused signup from %s: too many accounts from %s", ip, subnet(ip))
+		fmt.Fprintf(c, "too many accounts have been created from your network recently.  try again later.\n")
+		return false
+	}
+	return true
+}
+
+// VerifySignup asks a new player to prove they're worth an account, if the
+// server wants them to.  It returns the verified email address, if any.
+func (c *Connection) VerifySignup(name string) (string, bool) {
+	switch signupVerify {
+	case "email":
+		return c.verifyEmail()
+	case "token":
+		return "", c.redeemInvite(name)
+	}
+	return "", true
+}
+
+func (c *Connection) prompt(template string, args ...interface{}) (string, bool) {
+	fmt.Fprintf(c, template, args...)
+	line, err := c.ReadString('\n')
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(line), true
+}
+
+var numberWords = []string{
+	"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+	"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen",
+}
+
+// puzzle is a little sum written out in words.  It's no match for a
+// determined bot author, but it stops the ones that just blast names at the
+// login prompt.
+func puzzle() (string, int) {
+	a, b := 2+rand.Intn(9), 1+rand.Intn(9)
+	switch rand.Intn(3) {
+	case 0:
+		return fmt.Sprintf("what is %s plus %s?", numberWords[a], numberWords[b]), a + b
+	case 1:
+		if b > a {
+			a, b = b, a
+		}
+		return fmt.Sprintf("what do you get if you take %s away from %s?", numberWords[b], numberWords[a]), a - b
+	default:
+		return fmt.Sprintf("a fleet has %s ships and %s more arrive.  how many ships are in the fleet?", numberWords[a], numberWords[b]), a + b
+	}
+}
+
+// SolvePuzzle asks a new player to prove they're human.
+func (c *Connection) SolvePuzzle() bool {
+	if !signupPuzzle {
+		return true
+	}
+	for tries := 0; tries < 3; tries++ {
+		question, answer := puzzle()
+		line, ok := c.prompt("%s (answer with a number)\n", question)
+		if !ok {
+			return false
+		}
+		if n, err := strconv.Atoi(line); err == nil && n == answer {
+			return true
+		}
+		if answer < len(numberWords) && strings.EqualFold(line, numberWords[answer]) {
+			return true
+		}
+		fmt.Fprintf(c, "that's not right.\n")
+	}
+	log_info("refused signup from %s: failed the signup puzzle", c.RemoteIP())
+	return false
+}
+
+func (c *Connection) verifyEmail() (string, bool) {
+	for {
+		email, ok := c.prompt("new accounts need a verified email address.  what's yours?\n")
+		if !ok {
+			return "", false
+		}
+		if !strings.Contains(email, "@") || strings.ContainsAny(email, " \r\n") {
+			fmt.Fprintf(c, "that doesn't look like an email address.\n")
+			continue
+		}
+		row := db.QueryRow(`select count(*) from players where email = ?`, email)
+		var n int
+		if err := row.Scan(&n); err != nil || n > 0 {
+			fmt.Fprintf(c, "that email address already has an account.\n")
+			return "", false
+		}
+		// every email sent counts, whether or not it leads to an account, so
+		// that the server can't be used to spam people
+		ip := c.RemoteIP()
+		if ip != "" && signupLimit > 0 && recentFrom("verifications", "ip", ip, signupWindow) >= signupLimit {
+			log_info("refused verification email from %s: too many sent", ip)
+			fmt.Fprintf(c, "too many verification emails have been sent from your address recently.  try again later.\n")
+			return "", false
+		}
+		code := randomToken(5)
+		if err := sendVerification(email, code); err != nil {
+			log_error("%v", err)
+			fmt.Fprintf(c, "couldn't send a verification email.  try again later.\n")
+			return "", false
+		}
+		if ip != "" {
+			recordFrom("verifications", ip)
+		}
+		for tries := 0; tries < 3; tries++ {
+			entered, ok := c.prompt("we've sent a code to %s.  enter it here:\n", email)
+			if !ok {
+				return "", false
+			}
+			if strings.EqualFold(entered, code) {
+				return email, true
+			}
+			fmt.Fprintf(c, "that's not the right code.\n")
+		}
+		return "", false
+	}
+}
+
+func sendVerification(to, code string) error {
+	if smtpAddr == "" || smtpFrom == "" {
+		return fmt.Errorf("can't verify %s: EXO_SMTP_ADDR and EXO_SMTP_FROM aren't set", to)
+	}
+	var auth smtp.Auth
+	if smtpUser != "" {
+		host, _, _ := net.SplitHostPort(smtpAddr)
+		auth = smtp.PlainAuth("", smtpUser, smtpPassword, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: your verification code\r\n\r\nyour verification code is %s\r\n", smtpFrom, to, code)
+	if err := smtp.SendMail(smtpAddr, auth, smtpFrom, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("unable to send verification email to %s: %v", to, err)
+	}
+	return nil
+}
+
+func (c *Connection) redeemInvite(name string) bool {
+	for tries := 0; tries < 3; tries++ {
+		code, ok := c.prompt("new accounts need an invite.  enter your invite code:\n")
+		if !ok {
+			return false
+		}
+		res, err := db.Exec(`update invites set used_by = ? where code = ? and used_by = ''`, name, strings.ToUpper(code))
+		if err != nil {
+			log_error("unable to redeem invite: %v", err)
+			return false
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return true
+		}
+		fmt.Fprintf(c, "that invite code isn't valid.\n")
+	}
+	return false
+}
+
+func (p *Player) SetEmail(email string) error {
+	if _, err := db.Exec(`update players set email = ? where id = ?`, email, p.id); err != nil {
+		return fmt.Errorf("unable to set email for %s: %v", p.name, err)
+	}
+	return nil
+}
+
+var inviteCommand = &Command{
+	name:   "invite",
+	help:   "admin only.  creates a one-use invite code for a new account",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can create invites.\n")
+			return
+		}
+		code := randomToken(5)
+		if _, err := db.Exec(`insert into invites (code, created_by) values (?, ?)`, code, conn.PlayerName()); err != nil {
+			log_error("unable to create invite: %v", err)
+			fmt.Fprintf(conn, "couldn't create an invite.\n")
+			return
+		}
+		audit(conn.PlayerName(), "invite", code, "")
+		fmt.Fprintf(conn, "invite code: %s\n", code)
+	},
+}
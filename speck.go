@@ -8,7 +8,7 @@ import (
 	"strings"
 )
 
-func speckStream(r io.ReadCloser, c chan System) {
+func speckStream(r io.ReadCloser, c chan *System) {
 	defer close(c)
 	defer r.Close()
 	keep := regexp.MustCompile(`^\s*[\d-]`)
@@ -29,8 +29,7 @@ func speckStream(r io.ReadCloser, c chan System) {
 			continue
 		}
 		planet := parseSpeckLine(line)
-		c <- *planet
-
+		c <- planet
 	}
 }
 
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	streakReward    = 50
+	streakRewardCap = 7
+)
+
+func loginDay(t time.Time) int {
+	return int(t.UTC().Unix() / 86400)
+}
+
+// CheckIn counts today's login toward the account's streak and pays out the
+// daily reward the first time the account logs in on a given day.  Missing a
+// day starts the streak over.
+func (c *Connection) CheckIn() {
+	p := c.player
+	today := loginDay(time.Now())
+	switch p.lastLogin {
+	case today:
+		fmt.Fprintf(c, "login streak: %d days\n", p.streak)
+		return
+	case today - 1:
+		p.streak++
+	default:
+		p.streak = 1
+	}
+	p.lastLogin = today
+	_, err := db.Exec(`update players set streak = ?, last_login = ? where id = ?`, p.streak, p.lastLogin, p.id)
+	if err != nil {
+		log_error("unable to save login streak for %s: %v", p.name, err)
+		return
+	}
+	days := p.streak
+	if days > streakRewardCap {
+		days = streakRewardCap
+	}
+	reward := int64(days * streakReward)
+	c.Deposit(reward)
+	if p.streak == 1 {
+		fmt.Fprintf(c, "daily login bonus: %d space duckets.  log in tomorrow to start a streak.\n", reward)
+		return
+	}
+	fmt.Fprintf(c, "login streak: %d days!  daily bonus: %d space duckets.\n", p.streak, reward)
+}
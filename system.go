@@ -6,55 +6,229 @@ import (
 	"io"
 	"math"
 	"math/rand"
+	"sort"
+	"sync"
 	"time"
 )
 
 var (
 	index     map[int]*System
 	nameIndex map[string]*System
+
+	// indexLock guards index and nameIndex against the galaxy growing while
+	// something is reading them.  Outside of loading the galaxy and growing
+	// it, go through systemById, systemByName, systemCount, eachSystem and
+	// allSystems rather than reading the maps directly.
+	indexLock sync.RWMutex
 )
 
+func systemById(id int) *System {
+	indexLock.RLock()
+	defer indexLock.RUnlock()
+	return index[id]
+}
+
+// systemByName looks a system up by its name.
+func systemByName(name string) (*System, bool) {
+	indexLock.RLock()
+	defer indexLock.RUnlock()
+	s, ok := nameIndex[name]
+	return s, ok
+}
+
+// systemCount is how many systems there are in the galaxy.
+func systemCount() int {
+	indexLock.RLock()
+	defer indexLock.RUnlock()
+	return len(index)
+}
+
+// allSystems is a snapshot of every system in the galaxy, for loops that
+// stop early or that might add systems themselves.
+func allSystems() []*System {
+	indexLock.RLock()
+	defer indexLock.RUnlock()
+	systems := make([]*System, 0, len(index))
+	for _, s := range index {
+		systems = append(systems, s)
+	}
+	return systems
+}
+
+// eachSystem calls fn with every system in the galaxy.  fn must not add
+// systems to the galaxy.
+func eachSystem(fn func(*System)) {
+	indexLock.RLock()
+	defer indexLock.RUnlock()
+	for _, s := range index {
+		fn(s)
+	}
+}
+
 type System struct {
-	id          int
-	x, y, z     float64
-	planets     int
-	name        string
+	id            int
+	x, y, z       float64
+	planets       int
+	name          string
+	miningRate    float64
+	station       bool
+	stock         map[string]float64
+	corp          *Corporation
+	hub           *System
+	dispatch      *Future
+	stockpile     int
+	freighters    map[*Freighter]bool
+	traders       map[*Trader]bool
+	buoys         map[*Connection]bool
+	wormhole      *Wormhole
+	sites         []*Site
+	sitesRolled   bool
+	nest          *Nest
+	dragon        *Dragon
+	miningBonus   time.Time
+	parked        map[*Ship]bool
+	hazard        *Hazard
+	arena         bool
+	interdictor   *Interdictor
+	colonyRunning bool
+	supply        int
+	cutOff        int
+	lastBomb      *BombClass
+	lastBombAt    time.Time
+	reserve       int64
+	colonyShields int
+	turrets       int
+	accrued       map[string]float64
+	accruedAt     time.Time
+	eggHatches    time.Time
+	abundance     map[string]float64
+	demand        map[string]float64
+
+	// mu guards the fields below, which are touched both by connection
+	// handlers and by the work queue.
+	mu          sync.Mutex
 	players     map[*Connection]bool
-	miningRate  float64
 	colonizedBy *Connection
 }
 
 func (s *System) Arrive(p *Connection) {
+	p.Arrived(s)
 	p.SetSystem(s)
 	log_info("player %s has arrived at system %s", p.PlayerName(), s.name)
+	if !p.silent {
+		s.EachConn(func(conn *Connection) {
+			conn.Emit("arrival", arrivalData{conn.Describe(p), s.name}, "%s has arrived in %s\n", conn.Describe(p), s.name)
+		})
+	}
+	s.mu.Lock()
 	if s.players == nil {
 		s.players = make(map[*Connection]bool, 8)
 	}
 	s.players[p] = true
+	s.mu.Unlock()
+	if h := s.Hazard(); h != nil {
+		fmt.Fprintf(p, "warning: %s is a %s zone.  your hull will take damage while you remain here.\n", s.name, h.kind)
+	}
+	s.BuoyReport(p)
+	if relic != nil && relic.carrier == p {
+		relic.Moved(s)
+	}
+	s.CustomsCheck(p)
+	s.PirateAmbush(p)
+	s.Police(p)
 }
 
 func (s *System) Leave(p *Connection) {
+	s.mu.Lock()
 	delete(s.players, p)
+	s.mu.Unlock()
 	p.location = nil
+	p.LoseFighters()
+	s.EachConn(func(conn *Connection) {
+		if conn.heldBy == p {
+			conn.Release()
+		}
+	})
+	if p.silent || p.dead {
+		return
+	}
+	s.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "%s has departed from %s\n", conn.Describe(p), s.name)
+	})
 }
 
+// Occupants is a snapshot of the players in the system.  It's safe to range
+// over while players come and go.
+func (s *System) Occupants() map[*Connection]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	players := make(map[*Connection]bool, len(s.players))
+	for conn, _ := range s.players {
+		players[conn] = true
+	}
+	return players
+}
+
+// EachConn calls fn for every player in the system.  The system isn't locked
+// while fn runs, so fn is free to move players in and out of it.
 func (s *System) EachConn(fn func(*Connection)) {
-	if s.players == nil {
+	for conn, _ := range s.Occupants() {
+		fn(conn)
+	}
+}
+
+func (s *System) Colonizer() *Connection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.colonizedBy
+}
+
+func (s *System) SetColonizer(c *Connection) {
+	s.mu.Lock()
+	s.colonizedBy = c
+	s.mu.Unlock()
+}
+
+func (s *System) DestroyColony() {
+	s.mu.Lock()
+	owner := s.colonizedBy
+	s.colonizedBy = nil
+	s.mu.Unlock()
+	if owner == nil {
 		return
 	}
-	for conn, _ := range s.players {
-		fn(conn)
+	owner.Notice("your mining colony on %s has been destroyed!\n", s.name)
+	if s.corp != nil {
+		s.corp.Notify("the corporate colony on %s has been destroyed!", s.name)
 	}
+	s.DeleteColony()
+	s.corp = nil
+	s.hub = nil
+	s.stockpile = 0
+	s.reserve = 0
+	s.colonyShields = 0
+	s.turrets = 0
+	s.accrued = nil
+	s.accruedAt = time.Time{}
+	s.eggHatches = time.Time{}
 }
 
-func (s *System) NumInhabitants() int {
-	if s.players == nil {
-		return 0
+func (s *System) FindPlayer(name string) *Connection {
+	for conn, _ := range s.Occupants() {
+		if conn.PlayerName() == name {
+			return conn
+		}
 	}
+	return nil
+}
+
+func (s *System) NumInhabitants() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return len(s.players)
 }
 
-func (e System) Store(db *sql.DB) {
+func (e *System) Store(db *sql.DB) {
 	_, err := db.Exec(`
     insert into planets
     (name, x, y, z, planets)
@@ -70,49 +244,98 @@ func (s *System) DistanceTo(other *System) float64 {
 	return dist3d(s.x, s.y, s.z, other.x, other.y, other.z)
 }
 
+// The delays between systems all come from the physics model; see physics.go.
 func (s *System) LightTimeTo(other *System) time.Duration {
-	return time.Duration(int64(s.DistanceTo(other) * 100000000))
+	return physics.LightTime(s.DistanceTo(other))
 }
 
 func (s *System) BombTimeTo(other *System) time.Duration {
-	return time.Duration(int64(s.DistanceTo(other) * 110000000))
+	return physics.BombTime(s.DistanceTo(other))
 }
 
 func (s *System) TravelTimeTo(other *System) time.Duration {
-	return time.Duration(int64(s.DistanceTo(other) * 125000000))
+	return physics.TravelTime(s.DistanceTo(other))
 }
 
-func (s *System) Bombed(bomber *Connection) {
+func (s *System) Bombed(bomber *Connection, yield int) {
+	s.BombedWith(bomber, fission, yield)
+}
+
+func (s *System) BombedWith(bomber *Connection, class *BombClass, yield int) {
+	s.lastBomb = class
+	s.lastBombAt = clock.Now()
+	hit := make(map[*CapitalShip]bool, 2)
 	s.EachConn(func(conn *Connection) {
-		conn.Die()
-		bomber.MadeKill(conn)
+		if bomber.Allied(conn) {
+			fmt.Fprintf(conn, "a bomb detonates in %s, but its warhead recognizes your allied transponder\n", s.name)
+			return
+		}
+		if conn.capital != nil {
+			hit[conn.capital] = true
+			return
+		}
+		if conn.docked {
+			fmt.Fprintf(conn, "a bomb detonates in %s, but your docking clamps keep you safe\n", s.name)
+			return
+		}
+		if conn.duel != nil {
+			fmt.Fprintf(conn, "duel marshals shield you from the bomb blast in %s\n", s.name)
+			return
+		}
+		if PointDefenseApplies(class, yield) && (conn.EscortsIntercept() || conn.FightersIntercept()) {
+			return
+		}
+		if class.emp && conn.shield > 0 {
+			conn.shield = 0
+			fmt.Fprintf(conn, "an electromagnetic pulse knocks out your shields!\n")
+		}
+		fmt.Fprintf(conn, "you were bombed.\n")
+		conn.Damage(BombDamage(yield), bomber, W_Bomb)
 	})
-	if s.colonizedBy != nil {
-		fmt.Fprintf(s.colonizedBy, "your mining colony on %s has been destroyed!\n", s.name)
-		s.colonizedBy = nil
+	for ship, _ := range hit {
+		ship.Damage(yield, bomber, W_Bomb)
+	}
+	if owner := s.Colonizer(); owner != nil && !bomber.Allied(owner) && !s.Defend(class, yield) {
+		if s.HighSec() && !owner.Outlaw() && owner != bomber {
+			bomber.AdjustSecurity(-s.Security())
+		}
+		s.DestroyColony()
+		recordActivity(A_ColonyDestroyed, bomber.PlayerName(), s)
+		bomber.AdjustReputation(minersGuild, -10)
+		bomber.AdjustReputation(dragonCultists, 5)
+		if owner != bomber {
+			bomber.AdjustRepute(-15, "destroying a colony")
+		}
+	}
+	for owner, _ := range s.buoys {
+		s.LoseBuoy(owner)
+	}
+	s.DestroyParked()
+	s.LoseInterdictor()
+	if class.fallout != nil {
+		class.fallout(s)
 	}
 
-	for id, _ := range index {
-		if id == s.id {
-			continue
+	eachSystem(func(other *System) {
+		if other == s {
+			return
 		}
-		delay := s.BombTimeTo(index[id])
-		id2 := id
-		After(delay, func() {
+		id2 := other.id
+		AfterNamed(EV_BombNotice, s.BombTimeTo(other), func() {
 			bombNotice(id2, s.id)
 		})
-	}
+	})
 }
 
 func bombNotice(to_id, from_id int) {
-	to := index[to_id]
-	from := index[from_id]
+	to := systemById(to_id)
+	from := systemById(from_id)
 	to.EachConn(func(conn *Connection) {
-		fmt.Fprintf(conn, "a bombing has been observed on %s\n", from.name)
+		conn.Emit("bomb_notice", bombNoticeData{from.name}, "a bombing has been observed on %s\n", from.name)
 	})
 }
 
-func (e System) String() string {
+func (e *System) String() string {
 	return fmt.Sprintf("<name: %s x: %v y: %v z: %v planets: %v>", e.name, e.x, e.y, e.z, e.planets)
 }
 
@@ -121,28 +344,27 @@ type Neighbor struct {
 	distance float64
 }
 
+// Nearby finds the n systems closest to this one, closest first.
 func (e *System) Nearby(n int) ([]Neighbor, error) {
-	rows, err := db.Query(`
-        select planets.id, edges.distance
-        from edges
-        join planets on edges.id_2 = planets.id
-        where edges.id_1 = ?
-        order by distance
-        limit ?
-    ;`, e.id, n)
-	if err != nil {
-		log_error("unable to get nearby systems for %s: %v", e.name, err)
-		return nil, err
+	if e.arena {
+		return nil, nil
 	}
-	neighbors := make([]Neighbor, 0, n)
-	for rows.Next() {
-		var neighbor Neighbor
-		if err := rows.Scan(&neighbor.id, &neighbor.distance); err != nil {
-			log_error("error unpacking row from nearby neighbors query: %v", err)
-			continue
-		}
-		neighbors = append(neighbors, neighbor)
+	indexLock.RLock()
+	defer indexLock.RUnlock()
+	return galaxyTree.nearest(e, n, make([]Neighbor, 0, n)), nil
+}
+
+// NearbyWithin finds every system within radius of this one, closest first.
+func (e *System) NearbyWithin(radius float64) ([]Neighbor, error) {
+	if e.arena {
+		return nil, nil
 	}
+	indexLock.RLock()
+	neighbors := galaxyTree.within(e, radius, make([]Neighbor, 0, 16))
+	indexLock.RUnlock()
+	sort.Slice(neighbors, func(i, j int) bool {
+		return neighbors[i].distance < neighbors[j].distance
+	})
 	return neighbors, nil
 }
 
@@ -163,7 +385,7 @@ func dist3d(x1, y1, z1, x2, y2, z2 float64) float64 {
 }
 
 func indexSystems() map[int]*System {
-	rows, err := db.Query(`select * from planets`)
+	rows, err := db.Query(`select id, name, x, y, z, planets, ore, gas, crystal from planets`)
 	if err != nil {
 		log_error("unable to select all planets: %v", err)
 		return nil
@@ -171,38 +393,60 @@ func indexSystems() map[int]*System {
 	defer rows.Close()
 	index = make(map[int]*System, 551)
 	nameIndex = make(map[string]*System, 551)
+	var unrolled []*System
 	for rows.Next() {
 		p := System{}
-		if err := rows.Scan(&p.id, &p.name, &p.x, &p.y, &p.z, &p.planets); err != nil {
+		var ore, gas, crystal float64
+		if err := rows.Scan(&p.id, &p.name, &p.x, &p.y, &p.z, &p.planets, &ore, &gas, &crystal); err != nil {
 			log_info("unable to scan planet row: %v", err)
 			continue
 		}
+		if ore < 0 {
+			unrolled = append(unrolled, &p)
+		} else {
+			p.abundance = map[string]float64{"ore": ore, "gas": gas, "crystal": crystal}
+		}
 		index[p.id] = &p
 		nameIndex[p.name] = &p
 		p.miningRate = rand.Float64()
+		p.station = p.planets >= 3
+	}
+	rows.Close()
+	for _, s := range unrolled {
+		s.rollAbundance()
+		s.StoreAbundance()
 	}
+	indexTree()
+	loadColonies()
 	return index
 }
 
 func randomSystem() (*System, error) {
-	n := len(index)
-	if n == 0 {
+	systems := allSystems()
+	if len(systems) == 0 {
 		return nil, fmt.Errorf("no planets are known to exist")
 	}
-
-	pick := rand.Intn(n)
-	planet := index[pick]
-	return planet, nil
+	return systems[rand.Intn(len(systems))], nil
 }
 
 type scanResults struct {
 	life        bool
 	miningRate  float64
 	colonizedBy *Connection
+	corp        *Corporation
+	ships       []*Connection
+	buoys       int
+	interdictor bool
+	contacts    int
+	wormhole    *System
+	close       bool
+	hazard      string
+	weapon      string
+	dragon      bool
 }
 
 func (r *scanResults) negative() bool {
-	return !r.life && r.colonizedBy == nil
+	return !r.life && r.colonizedBy == nil && r.buoys == 0 && !r.interdictor && r.wormhole == nil && r.hazard == "" && r.weapon == "" && !r.dragon
 }
 
 func (r *scanResults) String() string {
@@ -216,14 +460,48 @@ func (r *scanResults) write(w io.Writer) {
 	if r.life {
 		fmt.Fprintf(w, "\tlife detected\n")
 	}
-	if r.colonizedBy != nil {
+	if r.dragon {
+		fmt.Fprintf(w, "\tmassive lifeform detected\n")
+	}
+	if r.corp != nil {
+		fmt.Fprintf(w, "\tmining colony owned by %s\n", r.corp.name)
+	} else if r.colonizedBy != nil {
 		fmt.Fprintf(w, "\tmining colony owned by %s\n", r.colonizedBy.PlayerName())
 	}
+	if r.hazard != "" {
+		fmt.Fprintf(w, "\t%s\n", r.hazard)
+	}
+	if r.weapon != "" {
+		fmt.Fprintf(w, "\tblast residue from a %s bomb\n", r.weapon)
+	}
+	if r.wormhole != nil {
+		fmt.Fprintf(w, "\twormhole anomaly leading to %s\n", r.wormhole.name)
+	}
+	if r.buoys > 0 {
+		fmt.Fprintf(w, "\t%d sensor buoys\n", r.buoys)
+	}
+	if r.interdictor {
+		fmt.Fprintf(w, "\twarp interdictor\n")
+	}
+	if r.contacts > 0 {
+		fmt.Fprintf(w, "\t%d unresolved contacts\n", r.contacts)
+	}
+	for _, ship := range r.ships {
+		if r.close {
+			if decal := ship.Decal(); decal != "" {
+				fmt.Fprintf(w, "\t%s with %s decals, piloted by %s\n", ship.ShipLabel(), decal, ship.DisplayName())
+				continue
+			}
+			fmt.Fprintf(w, "\t%s piloted by %s\n", ship.ShipLabel(), ship.DisplayName())
+		} else {
+			fmt.Fprintf(w, "\tship piloted by %s\n", ship.DisplayName())
+		}
+	}
 }
 
-func scanSystem(id int, reply int) {
-	system := index[id]
-	source := index[reply]
+func scanSystem(id int, reply int, reach float64) {
+	system := systemById(id)
+	source := systemById(reply)
 	delay := system.LightTimeTo(source)
 	log_info("scan hit %s from %s after traveling for %v", system.name, source.name, delay)
 
@@ -231,32 +509,76 @@ func scanSystem(id int, reply int) {
 		fmt.Fprintf(conn, "scan detected from %s\n", source.name)
 	})
 	results := &scanResults{
-		life:        len(system.players) > 0,
-		colonizedBy: system.colonizedBy,
+		life:        system.NumInhabitants() > 0,
+		colonizedBy: system.Colonizer(),
+		corp:        system.corp,
+		buoys:       len(system.buoys),
+		interdictor: system.interdictor != nil,
+		close:       system.DistanceTo(source) < reach,
+		weapon:      system.Residue(),
+		dragon:      system.dragon != nil,
 	}
-	After(delay, func() {
-		deliverReply(source.id, system.id, results)
+	if h := system.Hazard(); h != nil {
+		results.hazard = h.kind
+	}
+	if system.wormhole != nil {
+		results.wormhole = system.wormhole.Other(system)
+	}
+	system.EachConn(func(conn *Connection) {
+		if conn.Dampened() {
+			results.contacts++
+			return
+		}
+		results.ships = append(results.ships, conn)
 	})
+	AfterData(EV_ScanReply, delay, encodeEvent(newReplyEvent(source.id, system.id, results)), func() {
+		deliverReply(source.id, system.id, results)
+	}).Describe("scan echo from %s returning to %s", system.name, source.name)
 }
 
 func deliverReply(id int, echo int, results *scanResults) {
-	system := index[id]
-	source := index[echo]
+	system := systemById(id)
+	source := systemById(echo)
 	delay := system.LightTimeTo(source)
 	log_info("echo received at %s reflected from %s after traveling for %v", system.name, source.name, delay)
+	if results.negative() {
+		return
+	}
 	system.EachConn(func(conn *Connection) {
-		if results.negative() {
-			return
+		conn.EmitScan(source, nil, delay, results)
+		for _, ship := range results.ships {
+			conn.Identify(ship)
 		}
-		fmt.Fprintf(conn, "scan results from %s (%v away):\n", source.name, delay)
-		results.write(conn)
+		conn.ScannedSystem(source)
+		conn.MissionScanned(source)
 	})
+	shareScan(system.Occupants(), system, source, results)
 }
 
-func deliverMessage(to_id, from_id int, msg string) {
-	to := index[to_id]
-	from := index[from_id]
+// deliverTell hands a direct message to its recipient if they're still in the
+// system it was sent to.  If they've moved on, it's lost; if they've logged
+// off, it waits in their mailbox.
+func deliverTell(to *Connection, system, from *System, sender *Connection, msg string) {
+	if !connected[to] {
+		if err := sendMail(to.PlayerName(), sender.PlayerName(), msg); err != nil {
+			log_error("%v", err)
+		}
+		return
+	}
+	if to.System() != system {
+		return
+	}
+	fmt.Fprintf(to, "%s tells you (from %s): %s\n", sender.PlayerName(), from.name, msg)
+}
+
+func deliverMessage(to_id, from_id int, sender *Connection, msg string) {
+	to := systemById(to_id)
+	from := systemById(from_id)
 	to.EachConn(func(conn *Connection) {
-		fmt.Fprintf(conn, "Message from %s: %s", from.name, msg)
+		if conn.HasUpgrade("sigint") && !sender.HasUpgrade("encryption") {
+			fmt.Fprintf(conn, "Message from %s (traced to %s): %s\n", from.name, sender.PlayerName(), msg)
+			return
+		}
+		fmt.Fprintf(conn, "Message from %s: %s\n", from.name, msg)
 	})
 }
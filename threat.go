@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+var sectorThreat = make(map[Sector]float64, 64)
+
+func (c *Connection) FleetPower() float64 {
+	power := float64(c.hull) + 50*float64(c.bombs) + 30*float64(c.escorts) + 20*float64(c.fighters+c.defenders+c.harassers)
+	return power / 100
+}
+
+func recomputeThreat() {
+	density := make(map[Sector]int, 64)
+	power := make(map[Sector]float64, 64)
+	for conn, _ := range connected {
+		s := conn.System()
+		if s == nil || s.arena || conn.dead {
+			continue
+		}
+		sector := s.Sector()
+		density[sector]++
+		power[sector] += conn.FleetPower()
+	}
+	threat := make(map[Sector]float64, len(density))
+	for sector, n := range density {
+		level := 1 + 0.5*float64(n-1) + 0.25*power[sector]
+		threat[sector] = math.Min(5, math.Max(1, level))
+	}
+	sectorThreat = threat
+	log_info("recomputed threat levels for %d occupied sectors", len(threat))
+}
+
+func (s *System) ThreatLevel() float64 {
+	if level, ok := sectorThreat[s.Sector()]; ok {
+		return level
+	}
+	return 1
+}
+
+func (s *System) PirateAmbush(p *Connection) {
+	if s.arena || s.station || p.silent {
+		return
+	}
+	level := s.ThreatLevel()
+	if rand.Float64() >= 0.02*level {
+		return
+	}
+	log_info("pirates ambushed player %s in %s at threat level %.1f", p.PlayerName(), s.name, level)
+	fmt.Fprintf(p, "pirates drop out of warp and open fire!\n")
+	if p.EscortsIntercept() || p.FightersIntercept() {
+		fmt.Fprintf(p, "the pirates break off their attack.\n")
+		return
+	}
+	p.Damage(int(10*level), nil, "pirate raid")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	K_Title = "title"
+	K_Decal = "decal"
+)
+
+func titlesTable() {
+	stmnt := `create table if not exists titles (
+        character integer not null,
+        kind text not null,
+        name text not null,
+        unique (character, kind, name)
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create titles table: %v", err)
+	}
+	addColumn("characters", "title", "text not null default ''")
+	addColumn("characters", "decal", "text not null default ''")
+}
+
+// Award grants a title or decal.  Awards are purely cosmetic.
+func (c *Connection) Award(kind, name string) {
+	ch := c.character
+	if ch == nil || ch.id == 0 {
+		return
+	}
+	res, err := db.Exec(`insert or ignore into titles (character, kind, name) values (?, ?, ?)`, ch.id, kind, name)
+	if err != nil {
+		log_error("unable to award %s %q to %s: %v", kind, name, ch.name, err)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return
+	}
+	fmt.Fprintf(c, "you've earned the %s %q!  use \"%s %s\" to show it off.\n", kind, name, kind, name)
+}
+
+func (ch *Character) Awards(kind string) ([]string, error) {
+	rows, err := db.Query(`select name from titles where character = ? and kind = ?`, ch.id, kind)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %ss for %s: %v", kind, ch.name, err)
+	}
+	defer rows.Close()
+	names := make([]string, 0, 8)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, rows.Err()
+}
+
+func (ch *Character) Wear(kind, name string) error {
+	_, err := db.Exec(fmt.Sprintf(`update characters set %s = ? where id = ?`, kind), name, ch.id)
+	if err != nil {
+		return fmt.Errorf("unable to set %s for %s: %v", kind, ch.name, err)
+	}
+	if kind == K_Title {
+		ch.title = name
+	} else {
+		ch.decal = name
+	}
+	return nil
+}
+
+func (c *Connection) Decal() string {
+	if c.character == nil {
+		return ""
+	}
+	return c.character.decal
+}
+
+func wearCommand(kind string) *Command {
+	return &Command{
+		name:   kind,
+		help:   fmt.Sprintf("lists the %ss you've earned, or shows one off.  usage: %s [name|none]", kind, kind),
+		mobile: true,
+		arena:  true,
+		handler: func(conn *Connection, args ...string) {
+			ch := conn.character
+			earned, err := ch.Awards(kind)
+			if err != nil {
+				log_error("%v", err)
+				return
+			}
+			if len(args) == 0 {
+				if len(earned) == 0 {
+					fmt.Fprintf(conn, "you haven't earned any %ss yet.\n", kind)
+					return
+				}
+				for _, name := range earned {
+					marker := " "
+					if name == ch.title || name == ch.decal {
+						marker = "*"
+					}
+					fmt.Fprintf(conn, "%s %s\n", marker, name)
+				}
+				return
+			}
+			name := strings.Join(args, " ")
+			if name == "none" {
+				name = ""
+			} else {
+				i := sort.SearchStrings(earned, name)
+				if i == len(earned) || earned[i] != name {
+					fmt.Fprintf(conn, "you haven't earned the %s %q\n", kind, name)
+					return
+				}
+			}
+			if err := ch.Wear(kind, name); err != nil {
+				log_error("%v", err)
+				return
+			}
+			if name == "" {
+				fmt.Fprintf(conn, "you're no longer showing a %s.\n", kind)
+			} else {
+				fmt.Fprintf(conn, "now showing the %s %q\n", kind, name)
+			}
+		},
+	}
+}
+
+var (
+	titleCommand = wearCommand(K_Title)
+	decalCommand = wearCommand(K_Decal)
+)
+
+var whoCommand = &Command{
+	name:   "who",
+	help:   "lists the pilots who are online",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		names := make([]string, 0, len(connected))
+		for other, _ := range connected {
+			if other.character != nil {
+				names = append(names, other.DisplayName())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(conn, "\t%s\n", name)
+		}
+		fmt.Fprintf(conn, "%d pilots online\n", len(names))
+	},
+}
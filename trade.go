@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long a trade offer stands before the escrow is returned
+const tradeTimeout = 2 * time.Minute
+
+// Bundle is one side of a trade: some duckets and some goods.
+type Bundle struct {
+	money int64
+	goods map[string]int
+}
+
+func (b Bundle) String() string {
+	parts := make([]string, 0, len(b.goods)+1)
+	if b.money > 0 {
+		parts = append(parts, fmt.Sprintf("%d duckets", b.money))
+	}
+	for _, name := range goodNames() {
+		if n := b.goods[name]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, name))
+		}
+	}
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, " and ")
+}
+
+// parseBundle reads things like "500 duckets and 10 ore".
+func parseBundle(words []string) (Bundle, error) {
+	b := Bundle{goods: make(map[string]int, 2)}
+	for i := 0; i < len(words); i++ {
+		if words[i] == "and" {
+			continue
+		}
+		if i+1 >= len(words) {
+			return b, fmt.Errorf("%s what?", words[i])
+		}
+		n, err := strconv.Atoi(words[i])
+		if err != nil || n < 1 {
+			return b, fmt.Errorf("that's not a quantity: %s", words[i])
+		}
+		i++
+		switch item := words[i]; {
+		case item == "duckets" || item == "ducket":
+			b.money += int64(n)
+		case goods[item] != nil:
+			b.goods[item] += n
+		default:
+			return b, fmt.Errorf("nobody trades in %s", item)
+		}
+	}
+	if b.money == 0 && len(b.goods) == 0 {
+		return b, fmt.Errorf("a trade needs something on each side")
+	}
+	return b, nil
+}
+
+// Units is how much room the goods in a bundle take up in a hold.
+func (b Bundle) Units() int {
+	units := 0
+	for _, n := range b.goods {
+		units += n
+	}
+	return units
+}
+
+func (c *Connection) Has(b Bundle) bool {
+	if c.money < b.money {
+		return false
+	}
+	for name, n := range b.goods {
+		if c.cargo[name] < n {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Connection) Take(b Bundle) {
+	c.Withdraw(b.money)
+	for name, n := range b.goods {
+		c.AddCargo(goods[name], -n)
+	}
+}
+
+func (c *Connection) Give(b Bundle) {
+	for name, n := range b.goods {
+		c.AddCargo(goods[name], n)
+	}
+	if b.money > 0 {
+		c.Deposit(b.money)
+	}
+}
+
+// Trade is an offer from one player to another.  Whatever the seller puts
+// up is held in escrow from the moment the offer is made, so the buyer can
+// be sure it's there, and goes back to the seller if the trade falls
+// through.
+type Trade struct {
+	from    *Connection
+	to      *Connection
+	offer   Bundle
+	request Bundle
+	made    time.Time
+}
+
+func (t *Trade) String() string {
+	return fmt.Sprintf("%s offers %s to %s for %s", t.from.PlayerName(), t.offer, t.to.PlayerName(), t.request)
+}
+
+var trades = struct {
+	sync.Mutex
+	open map[*Connection]*Trade // by seller
+}{open: make(map[*Connection]*Trade, 8)}
+
+func tradesTable() {
+	stmnt := `create table if not exists trades (
+        id integer not null primary key autoincrement,
+        ts integer not null,
+        seller text not null,
+        buyer text not null,
+        offer text not null,
+        request text not null,
+        outcome text not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create trades table: %v", err)
+	}
+}
+
+func (t *Trade) Log(outcome string) {
+	_, err := db.Exec(`
+        insert into trades
+        (ts, seller, buyer, offer, request, outcome)
+        values
+        (?, ?, ?, ?, ?, ?)
+    ;`, time.Now().Unix(), t.from.PlayerName(), t.to.PlayerName(), t.offer.String(), t.request.String(), outcome)
+	if err != nil {
+		log_error("unable to log trade: %v", err)
+	}
+	log_info("trade %s: %s", outcome, t)
+}
+
+// closeTrade takes the trade off the books, reporting whether it was still
+// open.  Exactly one caller gets to settle any trade.
+func closeTrade(t *Trade) bool {
+	trades.Lock()
+	defer trades.Unlock()
+	if trades.open[t.from] != t {
+		return false
+	}
+	delete(trades.open, t.from)
+	return true
+}
+
+// Refund ends the trade without a deal and hands the escrow back.
+func (t *Trade) Refund(outcome string) {
+	if !closeTrade(t) {
+		return
+	}
+	t.from.Give(t.offer)
+	t.Log(outcome)
+	t.from.Notice("your trade offer to %s was %s.  %s has been returned to you.\n", t.to.PlayerName(), outcome, t.offer)
+	if connected[t.to] {
+		fmt.Fprintf(t.to, "the trade offer from %s was %s.\n", t.from.PlayerName(), outcome)
+	}
+}
+
+func (t *Trade) Accept() error {
+	if t.from.System() != t.to.System() {
+		return fmt.Errorf("you need to be in the same system as %s to trade", t.from.PlayerName())
+	}
+	if !t.to.Has(t.request) {
+		return fmt.Errorf("you don't have %s", t.request)
+	}
+	if t.to.CargoSpace()+t.request.Units() < t.offer.Units() {
+		return fmt.Errorf("you don't have room in your hold for %s", t.offer)
+	}
+	if t.from.CargoSpace() < t.request.Units() {
+		return fmt.Errorf("%s doesn't have room in their hold for %s", t.from.PlayerName(), t.request)
+	}
+	if !closeTrade(t) {
+		return fmt.Errorf("that offer has been withdrawn")
+	}
+	t.to.Take(t.request)
+	t.to.Give(t.offer)
+	t.from.Give(t.request)
+	t.Log("completed")
+	fmt.Fprintf(t.from, "%s accepted your trade.  you received %s.\n", t.to.PlayerName(), t.request)
+	fmt.Fprintf(t.to, "trade complete.  you received %s.\n", t.offer)
+	return nil
+}
+
+// CancelTrades returns the escrow for every trade a player is part of.  It's
+// called when they leave.
+func (c *Connection) CancelTrades() {
+	trades.Lock()
+	mine := make([]*Trade, 0, 2)
+	for _, t := range trades.open {
+		if t.from == c || t.to == c {
+			mine = append(mine, t)
+		}
+	}
+	trades.Unlock()
+	for _, t := range mine {
+		t.Refund("cancelled")
+	}
+}
+
+func openTrades(c *Connection) []*Trade {
+	trades.Lock()
+	defer trades.Unlock()
+	open := make([]*Trade, 0, 4)
+	for _, t := range trades.open {
+		if t.from == c || t.to == c {
+			open = append(open, t)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool { return open[i].made.Before(open[j].made) })
+	return open
+}
+
+func tradeFrom(seller, buyer *Connection) *Trade {
+	trades.Lock()
+	defer trades.Unlock()
+	if t := trades.open[seller]; t != nil && t.to == buyer {
+		return t
+	}
+	return nil
+}
+
+var tradeCommand = &Command{
+	name: "trade",
+	help: "trades with another player in the same system.  what you offer is held in escrow until the trade is accepted, declined or times out.  usage:\n" +
+		"\ttrade   (lists your open trades)\n" +
+		"\ttrade [player] [offer] for [request]   e.g. trade bob 10 ore and 5 gas for 400 duckets\n" +
+		"\ttrade accept [player]\n" +
+		"\ttrade decline [player]\n" +
+		"\ttrade cancel\n" +
+		"\ttrade log [player]   (admin only)",
+	handler: func(conn *Connection, args ...string) {
+		if len(args) == 0 {
+			open := openTrades(conn)
+			if len(open) == 0 {
+				fmt.Fprintf(conn, "you have no open trades.\n")
+				return
+			}
+			for _, t := range open {
+				fmt.Fprintf(conn, "%s (%v left)\n", t, (tradeTimeout - clock.Now().Sub(t.made)).Truncate(time.Second))
+			}
+			return
+		}
+		switch args[0] {
+		case "accept", "decline":
+			if len(args) != 2 {
+				fmt.Fprintf(conn, "usage: trade %s [player]\n", args[0])
+				return
+			}
+			seller := findConnection(args[1])
+			var t *Trade
+			if seller != nil {
+				t = tradeFrom(seller, conn)
+			}
+			if t == nil {
+				fmt.Fprintf(conn, "%s hasn't offered you a trade\n", args[1])
+				return
+			}
+			if args[0] == "decline" {
+				t.Refund("declined")
+				return
+			}
+			if err := t.Accept(); err != nil {
+				fmt.Fprintf(conn, "%v\n", err)
+			}
+			return
+		case "log":
+			if !conn.IsAdmin() {
+				fmt.Fprintf(conn, "only admins can read the trade log.\n")
+				return
+			}
+			if len(args) != 2 {
+				fmt.Fprintf(conn, "usage: trade log [player]\n")
+				return
+			}
+			rows, err := db.Query(`
+                select ts, seller, buyer, offer, request, outcome
+                from trades
+                where seller = ? or buyer = ?
+                order by id desc
+                limit 20
+            ;`, args[1], args[1])
+			if err != nil {
+				log_error("unable to read trade log: %v", err)
+				fmt.Fprintf(conn, "couldn't read the trade log.\n")
+				return
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var ts int64
+				var seller, buyer, offer, request, outcome string
+				if err := rows.Scan(&ts, &seller, &buyer, &offer, &request, &outcome); err != nil {
+					log_error("unable to scan trade log row: %v", err)
+					return
+				}
+				fmt.Fprintf(conn, "%s %s offered %s to %s for %s: %s\n", time.Unix(ts, 0).UTC().Format("Jan 2 15:04"), seller, offer, buyer, request, outcome)
+			}
+			return
+		case "cancel":
+			trades.Lock()
+			t := trades.open[conn]
+			trades.Unlock()
+			if t == nil {
+				fmt.Fprintf(conn, "you haven't offered anyone a trade.\n")
+				return
+			}
+			t.Refund("withdrawn")
+			return
+		}
+
+		split := -1
+		for i, word := range args {
+			if word == "for" {
+				split = i
+				break
+			}
+		}
+		if split < 2 || split == len(args)-1 {
+			fmt.Fprintf(conn, "usage: trade [player] [offer] for [request]\n")
+			return
+		}
+		buyer := conn.System().FindPlayer(args[0])
+		if buyer == nil || buyer == conn {
+			fmt.Fprintf(conn, "there's nobody named %s in %s to trade with\n", args[0], conn.System().name)
+			return
+		}
+		offer, err := parseBundle(args[1:split])
+		if err != nil {
+			fmt.Fprintf(conn, "%v\n", err)
+			return
+		}
+		request, err := parseBundle(args[split+1:])
+		if err != nil {
+			fmt.Fprintf(conn, "%v\n", err)
+			return
+		}
+		if !conn.Has(offer) {
+			fmt.Fprintf(conn, "you don't have %s to offer\n", offer)
+			return
+		}
+		t := &Trade{from: conn, to: buyer, offer: offer, request: request, made: clock.Now()}
+		trades.Lock()
+		if trades.open[conn] != nil {
+			trades.Unlock()
+			fmt.Fprintf(conn, "you already have a trade open.  \"trade cancel\" it first.\n")
+			return
+		}
+		trades.open[conn] = t
+		trades.Unlock()
+		conn.Take(offer)
+		After(tradeTimeout, func() { t.Refund("not taken up in time") })
+		fmt.Fprintf(conn, "offered %s to %s for %s.  your offer is held in escrow.\n", offer, buyer.PlayerName(), request)
+		fmt.Fprintf(buyer, "%s offers you %s for %s.  \"trade accept %s\" or \"trade decline %s\"\n", conn.PlayerName(), offer, request, conn.PlayerName(), conn.PlayerName())
+	},
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Traders are neutral merchant ships that run goods from station to
+// station, buying wherever a good is cheap and selling it on at the next
+// stop.  Pilots in the same system can trade with them, a little worse than
+// the station's own prices, or plunder them, which the miners' guild and the
+// police take a dim view of.
+type Trader struct {
+	name   string
+	hold   map[string]int
+	money  int64
+	system *System // nil while it's in flight
+	visit  int     // counts stops, so a stale departure doesn't cut one short
+}
+
+var traderNames = []string{
+	"Prosperity", "Far Horizon", "Golden Goose", "Lucky Star", "Tradewind",
+	"Silver Gull", "Dust Runner", "Cask and Crate", "Quiet Profit", "Long Haul",
+}
+
+// what traders deal in.  They won't touch contraband.
+var traderGoods = []string{"ore", "gas", "crystal", "water", "machinery"}
+
+var traders = make(map[*Trader]bool, 8)
+
+const (
+	traderHold = 200
+	// how long a trader stays at a station
+	traderStay = 2 * time.Minute
+	// how many stations a trader considers for its next stop
+	traderRange = 8
+	// traders sell to pilots this far over the station's price, and buy
+	// this far under it
+	traderMarkup   = 1.1
+	traderMarkdown = 0.9
+	// how likely a plundering pilot is to overpower a trader's crew
+	plunderChance = 0.6
+	// how long before a plundered trader is replaced
+	traderRespawn = 10 * time.Minute
+)
+
+var traderCount = envInt("EXO_TRADERS", 6)
+
+func startTraders() {
+	for i := 0; i < traderCount; i++ {
+		spawnTrader()
+	}
+}
+
+func spawnTrader() {
+	for i := 0; i < 20; i++ {
+		s, err := randomSystem()
+		if err != nil || s == nil || s.arena || !s.station {
+			continue
+		}
+		t := &Trader{
+			name:  traderNames[rand.Intn(len(traderNames))],
+			hold:  make(map[string]int, len(traderGoods)),
+			money: 5000,
+		}
+		traders[t] = true
+		log_info("the trader %s has started trading at %s", t.name, s.name)
+		t.Dock(s)
+		return
+	}
+}
+
+func (t *Trader) String() string {
+	return "the merchant vessel " + t.name
+}
+
+func (t *Trader) Load() int {
+	load := 0
+	for _, n := range t.hold {
+		load += n
+	}
+	return load
+}
+
+// Dock brings the trader into a station, where it sells what it's carrying
+// and fills up on whatever's cheapest before moving on.
+func (t *Trader) Dock(s *System) {
+	if !traders[t] {
+		return
+	}
+	t.system = s
+	if s.traders == nil {
+		s.traders = make(map[*Trader]bool, 2)
+	}
+	s.traders[t] = true
+	s.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "%s arrives in %s\n", t, s.name)
+	})
+	for name, n := range t.hold {
+		g := goods[name]
+		value := s.Price(g) * int64(n)
+		t.money += value
+		s.Supply(g, float64(n))
+		Traded(g, -float64(n))
+		recordVolume(s, value)
+		delete(t.hold, name)
+	}
+	if t.money < 1000 {
+		// the merchant houses keep their ships afloat
+		t.money = 5000
+	}
+	var cheapest *Good
+	best := 0.0
+	for _, name := range traderGoods {
+		g := goods[name]
+		if ratio := float64(s.Price(g)) / float64(g.basePrice); cheapest == nil || ratio < best {
+			cheapest, best = g, ratio
+		}
+	}
+	n := traderHold
+	if afford := int(t.money / s.Price(cheapest)); afford < n {
+		n = afford
+	}
+	if n > 0 {
+		cost := s.Price(cheapest) * int64(n)
+		t.money -= cost
+		t.hold[cheapest.name] = n
+		s.Supply(cheapest, -float64(n))
+		Traded(cheapest, float64(n))
+		recordVolume(s, cost)
+	}
+	t.visit++
+	t.departLater()
+}
+
+func (t *Trader) departLater() {
+	visit := t.visit
+	AfterNamed(EV_Trader, traderStay, func() {
+		if t.visit == visit {
+			t.Depart()
+		}
+	}).Describe("trader %s leaves %s", t.name, t.system.name)
+}
+
+// Depart sends the trader on to another station nearby.
+func (t *Trader) Depart() {
+	from := t.system
+	if !traders[t] || from == nil {
+		return
+	}
+	neighbors, _ := from.Nearby(traderRange)
+	stations := make([]*System, 0, len(neighbors))
+	for _, n := range neighbors {
+		if s := systemById(n.id); s != nil && s.station {
+			stations = append(stations, s)
+		}
+	}
+	if len(stations) == 0 {
+		t.departLater()
+		return
+	}
+	to := stations[rand.Intn(len(stations))]
+	delete(from.traders, t)
+	t.system = nil
+	from.EachConn(func(conn *Connection) {
+		fmt.Fprintf(conn, "%s departs %s for %s\n", t, from.name, to.name)
+	})
+	AfterNamed(EV_Trader, from.TravelTimeTo(to), func() { t.Dock(to) }).Describe("trader %s flying from %s to %s", t.name, from.name, to.name)
+}
+
+// findTrader picks the trader in the system to deal with: the one named, or
+// the only one there.
+func findTrader(conn *Connection, name string) *Trader {
+	s := conn.System()
+	if len(s.traders) == 0 {
+		fmt.Fprintf(conn, "there are no merchant ships in %s\n", s.name)
+		return nil
+	}
+	var found *Trader
+	for t, _ := range s.traders {
+		if name == "" || strings.EqualFold(t.name, name) {
+			if found != nil && name == "" {
+				fmt.Fprintf(conn, "there's more than one merchant here.  say which one.\n")
+				return nil
+			}
+			found = t
+		}
+	}
+	if found == nil {
+		fmt.Fprintf(conn, "there's no merchant called %s here\n", name)
+	}
+	return found
+}
+
+func (t *Trader) Plundered(conn *Connection) {
+	s := t.system
+	if rand.Float64() > plunderChance {
+		fmt.Fprintf(conn, "the crew of %s fight you off and make a run for it!\n", t)
+		conn.Damage(15, nil, "merchant guns")
+		t.Depart()
+		return
+	}
+	delete(s.traders, t)
+	delete(traders, t)
+	took := make([]string, 0, len(t.hold))
+	for name, n := range t.hold {
+		if n = conn.Stow(goods[name], n); n > 0 {
+			took = append(took, fmt.Sprintf("%d %s", n, name))
+		}
+	}
+	loot := t.money / 10
+	conn.Deposit(loot)
+	if len(took) == 0 {
+		took = append(took, "nothing from the hold")
+	}
+	fmt.Fprintf(conn, "you plundered %s: %s and %d space duckets.\n", t, strings.Join(took, ", "), loot)
+	s.EachConn(func(other *Connection) {
+		if other != conn {
+			fmt.Fprintf(other, "%s has plundered %s!\n", other.Describe(conn), t)
+		}
+	})
+	log_info("%s plundered the trader %s in %s", conn.PlayerName(), t.name, s.name)
+	conn.AdjustRepute(-10, "plundering a merchant")
+	conn.AdjustReputation(minersGuild, -10)
+	conn.AdjustReputation(pirateClans, 3)
+	if s.HighSec() {
+		conn.AdjustSecurity(-2 * s.Security())
+	}
+	After(traderRespawn, spawnTrader)
+}
+
+var merchantCommand = &Command{
+	name: "merchant",
+	help: "deals with the merchant ships in your system.  usage:\n" +
+		"\tmerchant                              (lists merchants here and what they carry)\n" +
+		"\tmerchant buy [good] [quantity] [ship]\n" +
+		"\tmerchant sell [good] [quantity] [ship]\n" +
+		"\tmerchant plunder [ship]              (attacks a merchant for its cargo)",
+	handler: func(conn *Connection, args ...string) {
+		s := conn.System()
+		if len(args) == 0 {
+			if len(s.traders) == 0 {
+				fmt.Fprintf(conn, "there are no merchant ships in %s\n", s.name)
+				return
+			}
+			for t, _ := range s.traders {
+				fmt.Fprintf(conn, "%s (%d/%d in the hold)\n", t, t.Load(), traderHold)
+				for _, name := range traderGoods {
+					g := goods[name]
+					fmt.Fprintf(conn, "\t%-10s %-5d sells at %-6d buys at %d\n", name, t.hold[name], t.SellPrice(conn, g), t.BuyPrice(conn, g))
+				}
+			}
+			return
+		}
+		switch args[0] {
+		case "buy", "sell":
+			if len(args) < 3 {
+				fmt.Fprintf(conn, "usage: merchant %s [good] [quantity] [ship]\n", args[0])
+				return
+			}
+			g, n, ok := parseTrade(conn, args[1:3])
+			if !ok {
+				return
+			}
+			t := findTrader(conn, strings.Join(args[3:], " "))
+			if t == nil || !t.Serves(conn) {
+				return
+			}
+			if args[0] == "buy" {
+				t.SellTo(conn, g, n)
+			} else {
+				t.BuyFrom(conn, g, n)
+			}
+		case "plunder":
+			if conn.docked {
+				fmt.Fprintf(conn, "you can't attack anybody while you're docked.\n")
+				return
+			}
+			if reason := TreatyForbids(conn, s); reason != "" {
+				fmt.Fprintf(conn, "plundering a merchant here would violate a peace treaty: %s\n", reason)
+				return
+			}
+			if t := findTrader(conn, strings.Join(args[1:], " ")); t != nil {
+				t.Plundered(conn)
+			}
+		default:
+			fmt.Fprintf(conn, "usage: merchant [buy|sell|plunder]\n")
+		}
+	},
+}
+
+func (t *Trader) Deals(g *Good) bool {
+	for _, name := range traderGoods {
+		if name == g.name {
+			return true
+		}
+	}
+	return false
+}
+
+// Serves reports whether the trader will deal with a pilot at all.  Merchant
+// crews know who's who, and keep their distance from the disreputable.
+func (t *Trader) Serves(conn *Connection) bool {
+	if conn.Repute() <= merchantRepute {
+		fmt.Fprintf(conn, "%s won't deal with anyone %s.\n", t, reputeTier(conn.Repute()))
+		return false
+	}
+	return true
+}
+
+// SellPrice and BuyPrice are what the trader charges and pays a pilot.
+// Pilots with a good name get the station's own prices.
+func (t *Trader) SellPrice(conn *Connection, g *Good) int64 {
+	markup := traderMarkup
+	if conn.Repute() >= favoredRepute {
+		markup = 1
+	}
+	return int64(float64(t.system.Price(g)) * markup)
+}
+
+func (t *Trader) BuyPrice(conn *Connection, g *Good) int64 {
+	markdown := traderMarkdown
+	if conn.Repute() >= favoredRepute {
+		markdown = 1
+	}
+	return int64(float64(t.system.Price(g)) * markdown)
+}
+
+func (t *Trader) SellTo(conn *Connection, g *Good, n int) {
+	if t.hold[g.name] < n {
+		fmt.Fprintf(conn, "%s only has %d %s\n", t, t.hold[g.name], g.name)
+		return
+	}
+	if n > conn.CargoSpace() {
+		fmt.Fprintf(conn, "not enough room!  your hold has space for %d more\n", conn.CargoSpace())
+		return
+	}
+	cost := t.SellPrice(conn, g) * int64(n)
+	if conn.money < cost {
+		fmt.Fprintf(conn, "not enough money!  %d %s costs %d space duckets, you only have %d in the bank.\n", n, g.name, cost, conn.money)
+		return
+	}
+	conn.Withdraw(cost)
+	conn.AddCargo(g, n)
+	t.hold[g.name] -= n
+	t.money += cost
+	fmt.Fprintf(conn, "bought %d %s from %s for %d space duckets\n", n, g.name, t, cost)
+}
+
+func (t *Trader) BuyFrom(conn *Connection, g *Good, n int) {
+	if !t.Deals(g) {
+		fmt.Fprintf(conn, "%s doesn't deal in %s\n", t, g.name)
+		return
+	}
+	if conn.cargo[g.name] < n {
+		fmt.Fprintf(conn, "you only have %d %s\n", conn.cargo[g.name], g.name)
+		return
+	}
+	if room := traderHold - t.Load(); n > room {
+		fmt.Fprintf(conn, "%s only has room for %d more\n", t, room)
+		return
+	}
+	earned := t.BuyPrice(conn, g) * int64(n)
+	if earned > t.money {
+		fmt.Fprintf(conn, "%s can't afford that.  it has %d space duckets.\n", t, t.money)
+		return
+	}
+	conn.AddCargo(g, -n)
+	conn.Deposit(earned)
+	t.hold[g.name] += n
+	t.money -= earned
+	fmt.Fprintf(conn, "sold %d %s to %s for %d space duckets\n", n, g.name, t, earned)
+}
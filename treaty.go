@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Treaty struct {
+	a, b        *Corporation
+	payer       *Corporation
+	reparations int64
+	paid        int64
+	dmz         map[*System]bool
+	duration    time.Duration
+	expires     time.Time
+}
+
+var (
+	treaties = make([]*Treaty, 0, 8)
+	offers   = make(map[*Corporation]map[*Corporation]*Treaty, 8)
+)
+
+func (t *Treaty) Involves(c *Corporation) bool {
+	return t.a == c || t.b == c
+}
+
+func (t *Treaty) Payee() *Corporation {
+	if t.payer == t.a {
+		return t.b
+	}
+	return t.a
+}
+
+func (t *Treaty) Active() bool {
+	return clock.Now().Before(t.expires)
+}
+
+func (t *Treaty) String() string {
+	parts := []string{fmt.Sprintf("peace between %s and %s for %v", t.a.name, t.b.name, t.duration)}
+	if !t.expires.IsZero() {
+		parts[0] += fmt.Sprintf(" (until %v)", t.expires.Format(time.Stamp))
+	}
+	if t.payer != nil {
+		parts = append(parts, fmt.Sprintf("%s pays %d space duckets in reparations to %s (%d paid)", t.payer.name, t.reparations, t.Payee().name, t.paid))
+	}
+	if len(t.dmz) > 0 {
+		names := make([]string, 0, len(t.dmz))
+		for s, _ := range t.dmz {
+			names = append(names, s.name)
+		}
+		parts = append(parts, "demilitarized: "+strings.Join(names, ", "))
+	}
+	return strings.Join(parts, "\n\t")
+}
+
+func findTreaty(a, b *Corporation) *Treaty {
+	for _, t := range treaties {
+		if t.Active() && t.Involves(a) && t.Involves(b) {
+			return t
+		}
+	}
+	return nil
+}
+
+// TreatyForbids returns the reason an attack by p on the target system is
+// blocked by a peace treaty, or an empty string if the attack is allowed.
+func TreatyForbids(p *Connection, target *System) string {
+	corp := memberships[p.PlayerName()]
+	for _, t := range treaties {
+		if !t.Active() {
+			continue
+		}
+		if t.dmz[target] {
+			return fmt.Sprintf("%s is demilitarized under the treaty between %s and %s", target.name, t.a.name, t.b.name)
+		}
+		if corp != nil && t.Involves(corp) && target.corp != nil && target.corp != corp && t.Involves(target.corp) {
+			return fmt.Sprintf("%s is at peace with %s", corp.name, target.corp.name)
+		}
+	}
+	return ""
+}
+
+func AtPeace(a, b *Connection) bool {
+	ca, cb := memberships[a.PlayerName()], memberships[b.PlayerName()]
+	return ca != nil && cb != nil && ca != cb && findTreaty(ca, cb) != nil
+}
+
+func signTreaty(t *Treaty) {
+	if w := findWar(t.a, t.b); w != nil {
+		endWar(w)
+	}
+	t.expires = clock.Now().Add(t.duration)
+	treaties = append(treaties, t)
+	publishNews("%s and %s have signed a peace treaty", t.a.name, t.b.name)
+	for _, c := range []*Corporation{t.a, t.b} {
+		c.Notify("treaty signed: %s", t)
+	}
+	if t.payer != nil {
+		installments := int64(t.duration / time.Hour)
+		if installments < 1 {
+			installments = 1
+		}
+		scheduleReparations(t, t.reparations/installments, t.duration/time.Duration(installments))
+	}
+	At(t.expires, func() {
+		expireTreaty(t)
+	})
+}
+
+func scheduleReparations(t *Treaty, installment int64, every time.Duration) {
+	After(every, func() {
+		if !t.Active() || findTreaty(t.a, t.b) != t {
+			return
+		}
+		due := installment
+		if remaining := t.reparations - t.paid; due > remaining || clock.Now().Add(every).After(t.expires) {
+			due = remaining
+		}
+		if due <= 0 {
+			return
+		}
+		payee := t.Payee()
+		if t.payer.treasury < due {
+			publishNews("%s has defaulted on its reparations to %s.  the war resumes!", t.payer.name, payee.name)
+			expireTreaty(t)
+			wars = append(wars, &War{a: payee, b: t.payer, started: clock.Now()})
+			return
+		}
+		t.payer.treasury -= due
+		payee.Deposit(due)
+		t.paid += due
+		t.payer.Notify("paid %d space duckets in reparations to %s", due, payee.name)
+		payee.Notify("received %d space duckets in reparations from %s", due, t.payer.name)
+		scheduleReparations(t, installment, every)
+	})
+}
+
+func expireTreaty(t *Treaty) {
+	for i, other := range treaties {
+		if other == t {
+			treaties = append(treaties[:i], treaties[i+1:]...)
+			for _, c := range []*Corporation{t.a, t.b} {
+				c.Notify("the treaty between %s and %s has ended", t.a.name, t.b.name)
+			}
+			return
+		}
+	}
+}
+
+// corpPeace handles treaty negotiation.  Terms are given as key=value pairs:
+//
+//	corp peace offer enemy-corp hours=24 pay=5000 dmz=sol,vega
+//	corp peace offer enemy-corp hours=24 demand=5000
+//	corp peace accept enemy-corp
+func corpPeace(conn *Connection, corp *Corporation, args ...string) {
+	if len(args) == 0 {
+		n := 0
+		for _, t := range treaties {
+			if t.Active() && t.Involves(corp) {
+				fmt.Fprintf(conn, "%s\n", t)
+				n++
+			}
+		}
+		for other, t := range offers[corp] {
+			fmt.Fprintf(conn, "offer from %s: %s\n", other.name, t)
+			n++
+		}
+		if n == 0 {
+			fmt.Fprintf(conn, "no treaties or offers.\n")
+		}
+		return
+	}
+	if corp.members[conn.PlayerName()] != R_CEO {
+		fmt.Fprintf(conn, "only the ceo can negotiate treaties.\n")
+		return
+	}
+	if len(args) < 2 {
+		fmt.Fprintf(conn, "usage: corp peace [offer|accept] [corp-name] [terms...]\n")
+		return
+	}
+	enemy, ok := corporations[args[1]]
+	if !ok {
+		fmt.Fprintf(conn, "no such corporation: %s\n", args[1])
+		return
+	}
+	switch args[0] {
+	case "offer":
+		if findWar(corp, enemy) == nil {
+			fmt.Fprintf(conn, "you're not at war with %s\n", enemy.name)
+			return
+		}
+		t, ok := parseTerms(conn, corp, enemy, args[2:])
+		if !ok {
+			return
+		}
+		if offers[enemy] == nil {
+			offers[enemy] = make(map[*Corporation]*Treaty, 2)
+		}
+		offers[enemy][corp] = t
+		corp.Notify("offered peace to %s: %s", enemy.name, t)
+		enemy.Notify("%s offers peace: %s.  use \"corp peace accept %s\" to sign.", corp.name, t, corp.name)
+	case "accept":
+		t, ok := offers[corp][enemy]
+		if !ok {
+			fmt.Fprintf(conn, "%s hasn't offered you peace.\n", enemy.name)
+			return
+		}
+		delete(offers[corp], enemy)
+		if findWar(corp, enemy) == nil {
+			fmt.Fprintf(conn, "you're no longer at war with %s\n", enemy.name)
+			return
+		}
+		signTreaty(t)
+	default:
+		fmt.Fprintf(conn, "usage: corp peace [offer|accept] [corp-name] [terms...]\n")
+	}
+}
+
+func parseTerms(conn *Connection, corp, enemy *Corporation, args []string) (*Treaty, bool) {
+	t := &Treaty{a: corp, b: enemy, dmz: make(map[*System]bool, 4)}
+	t.duration = 24 * time.Hour
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			fmt.Fprintf(conn, "bad treaty term: %s\n", arg)
+			return nil, false
+		}
+		switch parts[0] {
+		case "hours":
+			n, err := strconv.Atoi(parts[1])
+			if err != nil || n < 1 || n > 24*7 {
+				fmt.Fprintf(conn, "treaties last between 1 and %d hours\n", 24*7)
+				return nil, false
+			}
+			t.duration = time.Duration(n) * time.Hour
+		case "pay", "demand":
+			n, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil || n < 1 {
+				fmt.Fprintf(conn, "that's not an amount: %s\n", parts[1])
+				return nil, false
+			}
+			t.reparations = n
+			t.payer = corp
+			if parts[0] == "demand" {
+				t.payer = enemy
+			}
+		case "dmz":
+			for _, name := range strings.Split(parts[1], ",") {
+				s := lookupSystem(name)
+				if s == nil {
+					fmt.Fprintf(conn, "no such system: %s\n", name)
+					return nil, false
+				}
+				t.dmz[s] = true
+			}
+		default:
+			fmt.Fprintf(conn, "unknown treaty term: %s\n", parts[0])
+			return nil, false
+		}
+	}
+	return t, true
+}
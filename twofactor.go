@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 8
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func recoveryTable() {
+	stmnt := `create table if not exists recovery_codes (
+        id integer not null primary key autoincrement,
+        player integer not null,
+        hash text not null
+    );`
+	if _, err := db.Exec(stmnt); err != nil {
+		log_error("couldn't create recovery codes table: %v", err)
+	}
+}
+
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return b32.EncodeToString(buf)
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// totp computes the RFC 6238 code for the given secret and time step.
+func totp(secret string, step int64) (string, error) {
+	key, err := b32.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
+
+// validTOTP accepts codes from the previous, current and next 30 second step
+// to allow for clock drift.
+func validTOTP(secret, code string) bool {
+	step := time.Now().Unix() / 30
+	for _, s := range []int64{step - 1, step, step + 1} {
+		want, err := totp(secret, s)
+		if err != nil {
+			return false
+		}
+		if hmac.Equal([]byte(want), []byte(code)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Player) SetTOTP(secret string) error {
+	if _, err := db.Exec(`update players set totp_secret = ? where id = ?`, secret, p.id); err != nil {
+		return fmt.Errorf("unable to store 2fa secret for %s: %v", p.name, err)
+	}
+	p.totpSecret = secret
+	return nil
+}
+
+func (p *Player) NewRecoveryCodes() ([]string, error) {
+	if _, err := db.Exec(`delete from recovery_codes where player = ?`, p.id); err != nil {
+		return nil, fmt.Errorf("unable to clear recovery codes for %s: %v", p.name, err)
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code := randomToken(5)
+		if _, err := db.Exec(`insert into recovery_codes (player, hash) values (?, ?)`, p.id, hashCode(code)); err != nil {
+			return nil, fmt.Errorf("unable to store recovery code for %s: %v", p.name, err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode burns a recovery code, reporting whether it was valid.
+func (p *Player) UseRecoveryCode(code string) bool {
+	res, err := db.Exec(`delete from recovery_codes where player = ? and hash = ?`, p.id, hashCode(code))
+	if err != nil {
+		log_error("unable to check recovery code for %s: %v", p.name, err)
+		return false
+	}
+	n, err := res.RowsAffected()
+	return err == nil && n > 0
+}
+
+// Authenticate asks for a second factor if the player has one set up.  A
+// login token from a linked account, given along with the name, stands in
+// for it, and is checked first so that it works whether or not the player
+// uses two-factor authentication.
+func (c *Connection) Authenticate(p *Player, token string) bool {
+	if token != "" {
+		if p.UseLoginToken(token) {
+			return true
+		}
+		log_info("player %s gave a bad login token", p.name)
+		return false
+	}
+	if p.totpSecret == "" {
+		return true
+	}
+	for tries := 0; tries < 3; tries++ {
+		fmt.Fprintf(c, "authentication code (or recovery code):\n")
+		code, err := c.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		code = strings.TrimSpace(code)
+		if validTOTP(p.totpSecret, code) {
+			return true
+		}
+		if p.UseRecoveryCode(code) {
+			fmt.Fprintf(c, "recovery code accepted.  it can't be used again.\n")
+			return true
+		}
+		if p.UseLoginToken(code) {
+			return true
+		}
+		fmt.Fprintf(c, "that code is not valid.\n")
+	}
+	log_info("player %s failed two-factor authentication", p.name)
+	return false
+}
+
+var twoFactorCommand = &Command{
+	name: "2fa",
+	help: "manages two-factor authentication.  usage:\n" +
+		"\t2fa setup   (generates a new secret for your authenticator app)\n" +
+		"\t2fa confirm [code]   (turns on 2fa once your app is set up)\n" +
+		"\t2fa codes [code]   (replaces your recovery codes)\n" +
+		"\t2fa disable [code]",
+	mobile: true,
+	arena:  true,
+	handler: func(conn *Connection, args ...string) {
+		p := conn.player
+		if len(args) == 0 {
+			if p.totpSecret == "" {
+				fmt.Fprintf(conn, "two-factor authentication is off.\n")
+			} else {
+				fmt.Fprintf(conn, "two-factor authentication is on.\n")
+			}
+			return
+		}
+		switch args[0] {
+		case "setup":
+			if p.totpSecret != "" {
+				fmt.Fprintf(conn, "two-factor authentication is already on.\n")
+				return
+			}
+			conn.pendingTOTP = randomToken(20)
+			fmt.Fprintf(conn, "add this secret to your authenticator app: %s\n", conn.pendingTOTP)
+			fmt.Fprintf(conn, "otpauth://totp/exo:%s?secret=%s&issuer=exo\n", p.name, conn.pendingTOTP)
+			fmt.Fprintf(conn, "then use \"2fa confirm [code]\" to turn it on.\n")
+		case "confirm":
+			if conn.pendingTOTP == "" {
+				fmt.Fprintf(conn, "use \"2fa setup\" first.\n")
+				return
+			}
+			if len(args) != 2 || !validTOTP(conn.pendingTOTP, args[1]) {
+				fmt.Fprintf(conn, "that code is not valid.\n")
+				return
+			}
+			if err := p.SetTOTP(conn.pendingTOTP); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "couldn't turn on two-factor authentication.\n")
+				return
+			}
+			conn.pendingTOTP = ""
+			fmt.Fprintf(conn, "two-factor authentication is on.\n")
+			printRecoveryCodes(conn)
+		case "codes", "disable":
+			if p.totpSecret == "" {
+				fmt.Fprintf(conn, "two-factor authentication is off.\n")
+				return
+			}
+			if len(args) != 2 || !validTOTP(p.totpSecret, args[1]) {
+				fmt.Fprintf(conn, "that code is not valid.\n")
+				return
+			}
+			if args[0] == "codes" {
+				printRecoveryCodes(conn)
+				return
+			}
+			if p.admin {
+				fmt.Fprintf(conn, "admin accounts must keep two-factor authentication on.\n")
+				return
+			}
+			if err := p.SetTOTP(""); err != nil {
+				log_error("%v", err)
+				fmt.Fprintf(conn, "couldn't turn off two-factor authentication.\n")
+				return
+			}
+			fmt.Fprintf(conn, "two-factor authentication is off.\n")
+		default:
+			fmt.Fprintf(conn, "no such 2fa subcommand: %s\n", args[0])
+		}
+	},
+}
+
+func printRecoveryCodes(conn *Connection) {
+	codes, err := conn.player.NewRecoveryCodes()
+	if err != nil {
+		log_error("%v", err)
+		fmt.Fprintf(conn, "couldn't generate recovery codes.\n")
+		return
+	}
+	fmt.Fprintf(conn, "recovery codes (each works once, store them somewhere safe):\n")
+	for _, code := range codes {
+		fmt.Fprintf(conn, "\t%s\n", code)
+	}
+}
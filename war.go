@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	maxSupply      = 100
+	supplyUpkeep   = 5
+	supplyPerCrate = 10
+	siegeTolerance = 10
+)
+
+type War struct {
+	a, b    *Corporation
+	started time.Time
+}
+
+var wars = make([]*War, 0, 8)
+
+func (w *War) Enemy(c *Corporation) *Corporation {
+	if c == w.a {
+		return w.b
+	}
+	return w.a
+}
+
+func (w *War) Involves(c *Corporation) bool {
+	return w.a == c || w.b == c
+}
+
+func findWar(a, b *Corporation) *War {
+	for _, w := range wars {
+		if w.Involves(a) && w.Involves(b) {
+			return w
+		}
+	}
+	return nil
+}
+
+func AtWar(a, b *Corporation) bool {
+	return a != nil && b != nil && a != b && findWar(a, b) != nil
+}
+
+func (c *Corporation) AtWar() bool {
+	for _, w := range wars {
+		if w.Involves(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func endWar(w *War) {
+	for i, other := range wars {
+		if other == w {
+			wars = append(wars[:i], wars[i+1:]...)
+			break
+		}
+	}
+	for _, s := range allSystems() {
+		if (s.corp == w.a && !w.a.AtWar()) || (s.corp == w.b && !w.b.AtWar()) {
+			s.cutOff = 0
+		}
+	}
+}
+
+func startWars() {
+	After(time.Minute, warTick)
+}
+
+// warTick drains the supplies of every besieged colony.  Colonies that run
+// dry start to fall apart and are lost if nobody resupplies them in time.
+func warTick() {
+	defer After(time.Minute, warTick)
+	for _, s := range allSystems() {
+		if s.corp == nil || !s.corp.AtWar() {
+			continue
+		}
+		if s.supply > 0 {
+			s.supply -= supplyUpkeep
+			if s.supply <= 0 {
+				s.supply = 0
+				s.corp.Notify("the colony on %s is out of supplies!", s.name)
+			}
+			continue
+		}
+		s.cutOff++
+		if s.cutOff >= siegeTolerance {
+			publishNews("the besieged %s colony on %s has collapsed after being cut off", s.corp.name, s.name)
+			s.DestroyColony()
+			recordActivity(A_ColonyDestroyed, "", s)
+			s.cutOff = 0
+			continue
+		}
+		s.corp.Notify("the colony on %s has been cut off for %d minutes.  it will collapse in %d minutes.", s.name, s.cutOff, siegeTolerance-s.cutOff)
+	}
+}
+
+func corpWar(conn *Connection, corp *Corporation, args ...string) {
+	if len(args) == 0 {
+		n := 0
+		for _, w := range wars {
+			if w.Involves(corp) {
+				fmt.Fprintf(conn, "at war with %s since %v\n", w.Enemy(corp).name, w.started.Format(time.Stamp))
+				n++
+			}
+		}
+		if n == 0 {
+			fmt.Fprintf(conn, "%s is at peace.\n", corp.name)
+		}
+		return
+	}
+	if corp.members[conn.PlayerName()] != R_CEO {
+		fmt.Fprintf(conn, "only the ceo can declare war.\n")
+		return
+	}
+	name := strings.Join(args, " ")
+	enemy, ok := corporations[name]
+	if !ok || enemy == corp {
+		fmt.Fprintf(conn, "no such corporation: %s\n", name)
+		return
+	}
+	if AtWar(corp, enemy) {
+		fmt.Fprintf(conn, "you're already at war with %s\n", enemy.name)
+		return
+	}
+	if t := findTreaty(corp, enemy); t != nil {
+		fmt.Fprintf(conn, "you're bound by a peace treaty with %s until %v\n", enemy.name, t.expires.Format(time.Stamp))
+		return
+	}
+	wars = append(wars, &War{a: corp, b: enemy, started: clock.Now()})
+	for _, s := range allSystems() {
+		if s.corp == corp || s.corp == enemy {
+			s.supply = maxSupply
+			s.cutOff = 0
+		}
+	}
+	publishNews("%s has declared war on %s", corp.name, enemy.name)
+	corp.Notify("we are now at war with %s.  keep our colonies supplied!", enemy.name)
+	enemy.Notify("%s has declared war on us.  keep our colonies supplied!", corp.name)
+}
+
+// corpSupply delivers machinery from the player's hold to a besieged corporate
+// colony.  The player has to actually be there with the goods aboard.
+func corpSupply(conn *Connection, corp *Corporation, args ...string) {
+	system := conn.System()
+	if system == nil {
+		fmt.Fprintf(conn, "you can't deliver supplies while in transit.\n")
+		return
+	}
+	if system.corp != corp {
+		fmt.Fprintf(conn, "there's no %s colony in %s\n", corp.name, system.name)
+		return
+	}
+	if !corp.AtWar() {
+		fmt.Fprintf(conn, "the colony on %s isn't under siege.\n", system.name)
+		return
+	}
+	crates := conn.cargo["machinery"]
+	if crates == 0 {
+		fmt.Fprintf(conn, "you have no machinery aboard to deliver.\n")
+		return
+	}
+	if need := (maxSupply - system.supply + supplyPerCrate - 1) / supplyPerCrate; crates > need {
+		crates = need
+	}
+	if crates == 0 {
+		fmt.Fprintf(conn, "the colony on %s is fully supplied.\n", system.name)
+		return
+	}
+	conn.AddCargo(goods["machinery"], -crates)
+	system.supply += crates * supplyPerCrate
+	if system.supply > maxSupply {
+		system.supply = maxSupply
+	}
+	system.cutOff = 0
+	log_info("player %s delivered %d machinery to %s", conn.PlayerName(), crates, system.name)
+	corp.Notify("%s delivered %d crates of machinery to %s.  supply: %d", conn.PlayerName(), crates, system.name, system.supply)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the magic string from RFC 6455 that's hashed with the client's key during
+// the opening handshake.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsOrigins are the pages allowed to open a websocket to the game, from
+// EXO_WS_ORIGINS (a comma separated list like https://play.example.com).
+// Without the check any page a pilot visits could connect on their behalf.
+var wsOrigins = parseOrigins(os.Getenv("EXO_WS_ORIGINS"))
+
+func parseOrigins(s string) map[string]bool {
+	origins := make(map[string]bool, 4)
+	for _, origin := range strings.Split(s, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins[strings.ToLower(origin)] = true
+		}
+	}
+	return origins
+}
+
+const (
+	ws_Continuation = 0x0
+	ws_Text         = 0x1
+	ws_Binary       = 0x2
+	ws_Close        = 0x8
+	ws_Ping         = 0x9
+	ws_Pong         = 0xa
+)
+
+// messages bigger than this are almost certainly not commands.
+const wsMaxMessage = 1 << 16
+
+// WebSocket is a server-side websocket connection.  Each message read from
+// the client comes out as a line of text, and each Write goes to the client
+// as a text message, so a Connection can't tell it from a raw tcp socket.
+type WebSocket struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// buffered message data that hasn't been read yet
+	pending []byte
+
+	sync.Mutex // guards writes and the fields below
+
+	pingSent time.Time
+	onPong   func(time.Duration)
+}
+
+// Ping sends a ping frame.  When the client's pong comes back, pong is
+// called with the round trip time.
+func (ws *WebSocket) Ping(pong func(time.Duration)) error {
+	ws.Lock()
+	ws.pingSent = time.Now()
+	ws.onPong = pong
+	ws.Unlock()
+	return ws.writeFrame(ws_Ping, []byte("exo"))
+}
+
+func (ws *WebSocket) pong() {
+	ws.Lock()
+	fn, sent := ws.onPong, ws.pingSent
+	ws.onPong = nil
+	ws.Unlock()
+	if fn != nil {
+		fn(time.Since(sent))
+	}
+}
+
+func (ws *WebSocket) Read(p []byte) (int, error) {
+	for len(ws.pending) == 0 {
+		msg, err := ws.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		ws.pending = append(msg, '\n')
+	}
+	n := copy(p, ws.pending)
+	ws.pending = ws.pending[n:]
+	return n, nil
+}
+
+func (ws *WebSocket) Write(p []byte) (int, error) {
+	if err := ws.writeFrame(ws_Text, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (ws *WebSocket) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+func (ws *WebSocket) Close() error {
+	ws.writeFrame(ws_Close, nil)
+	return ws.conn.Close()
+}
+
+// readMessage reads frames until it has a complete data message, answering
+// any control frames that come in along the way.
+func (ws *WebSocket) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case ws_Close:
+			return nil, io.EOF
+		case ws_Ping:
+			if err := ws.writeFrame(ws_Pong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case ws_Pong:
+			ws.pong()
+			continue
+		case ws_Text, ws_Binary, ws_Continuation:
+			msg = append(msg, payload...)
+		default:
+			return nil, errors.New("websocket: unknown opcode")
+		}
+		if len(msg) > wsMaxMessage {
+			return nil, errors.New("websocket: message too large")
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (ws *WebSocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(ws.r, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(ws.r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(ws.r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessage {
+		err = errors.New("websocket: frame too large")
+		return
+	}
+	if !masked {
+		err = errors.New("websocket: client frames must be masked")
+		return
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.Lock()
+	defer ws.Unlock()
+	head := make([]byte, 2, 10)
+	head[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		head[1] = byte(n)
+	case n <= 0xffff:
+		head[1] = 126
+		head = head[:4]
+		binary.BigEndian.PutUint16(head[2:], uint16(n))
+	default:
+		head[1] = 127
+		head = head[:10]
+		binary.BigEndian.PutUint64(head[2:], uint64(n))
+	}
+	if _, err := ws.conn.Write(head); err != nil {
+		return err
+	}
+	_, err := ws.conn.Write(payload)
+	return err
+}
+
+func wsAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// wsUpgrade performs the websocket opening handshake and takes over the
+// underlying connection.
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (*WebSocket, error) {
+	if r.Method != "GET" ||
+		!strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	// browsers always send an origin and other clients don't need to
+	if origin := r.Header.Get("Origin"); origin != "" && !wsOrigins[strings.ToLower(origin)] {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, errors.New("websocket: origin not allowed: " + origin)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "can't upgrade this connection", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response can't be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &WebSocket{conn: conn, r: rw.Reader}, nil
+}
+
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	ws, err := wsUpgrade(w, r)
+	if err != nil {
+		log_error("websocket handshake from %s failed: %v", r.RemoteAddr, err)
+		return
+	}
+	handleConnection(NewConnection(ws))
+}
+
+// startWebSockets opens the listener for browser clients, if EXO_WS_ADDR says
+// where.  It serves the same game as the tcp listener, one websocket message
+// per line.
+func startWebSockets() {
+	addr := os.Getenv("EXO_WS_ADDR")
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", wsHandler)
+	go func() {
+		log_info("websocket listener starting on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log_error("websocket listener failed: %v", err)
+		}
+	}()
+}
@@ -2,15 +2,42 @@ package main
 
 import (
 	"container/heap"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-var queue = make(Queue, 0, 32)
+// names for the kinds of work that go through the scheduler.  Anything that
+// doesn't care to be identified is a plain task.
+const (
+	EV_Task        = "task"
+	EV_Travel      = "travel"
+	EV_Bomb        = "bomb"
+	EV_Scan        = "scan"
+	EV_ScanReply   = "scan-reply"
+	EV_BombNotice  = "bomb-notice"
+	EV_Message     = "message"
+	EV_Contest     = "contest"
+	EV_Maintenance = "maintenance"
+	EV_Dragon      = "dragon"
+	EV_Trader      = "trader"
+	EV_Freighter   = "freighter"
+)
 
 type Future struct {
+	id    uint64
+	name  string
 	ts    time.Time
 	index int
 	work  func()
+	data  string
+
+	// what admins see when they inspect the scheduler
+	created time.Time
+	about   string
 }
 
 type Queue []*Future
@@ -23,8 +50,8 @@ func (q Queue) Less(i, j int) bool {
 
 func (q Queue) Swap(i, j int) {
 	q[i], q[j] = q[j], q[i]
-	q[i].index = j
-	q[j].index = i
+	q[i].index = i
+	q[j].index = j
 }
 
 func (q *Queue) Push(v interface{}) {
@@ -43,30 +70,247 @@ func (q *Queue) Pop() interface{} {
 	return future
 }
 
+// Scheduler is the single place where delayed work waits to run.  All of the
+// work runs one piece at a time on the dispatch loop in RunQueue.
+type Scheduler struct {
+	sync.Mutex
+	queue  Queue
+	byId   map[uint64]*Future
+	nextId uint64
+	wake   chan struct{}
+	clock  Clock
+}
+
+var scheduler = &Scheduler{
+	queue: make(Queue, 0, 32),
+	byId:  make(map[uint64]*Future, 32),
+	wake:  make(chan struct{}, 1),
+	clock: clock,
+}
+
+// Wake nudges the dispatch loop to take another look at the queue.
+func (s *Scheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) Schedule(name string, ts time.Time, work func()) *Future {
+	s.Lock()
+	s.nextId++
+	future := &Future{id: s.nextId, name: name, ts: ts, work: work, created: s.clock.Now()}
+	heap.Push(&s.queue, future)
+	s.byId[future.id] = future
+	s.Unlock()
+	s.Wake()
+	return future
+}
+
+// Cancel removes a pending event, reporting whether it was still pending.
+func (s *Scheduler) Cancel(id uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+	future, ok := s.byId[id]
+	if !ok {
+		return false
+	}
+	heap.Remove(&s.queue, future.index)
+	delete(s.byId, id)
+	return true
+}
+
+// Reschedule moves a pending event to a new time, reporting whether it was
+// still pending.
+func (s *Scheduler) Reschedule(id uint64, ts time.Time) bool {
+	s.Lock()
+	future, ok := s.byId[id]
+	if ok {
+		future.ts = ts
+		heap.Fix(&s.queue, future.index)
+	}
+	s.Unlock()
+	if ok {
+		s.Wake()
+	}
+	return ok
+}
+
+// Describe notes what a pending event is for, for the benefit of admins
+// inspecting the scheduler.
+func (f *Future) Describe(template string, args ...interface{}) *Future {
+	about := fmt.Sprintf(template, args...)
+	scheduler.Lock()
+	f.about = about
+	scheduler.Unlock()
+	return f
+}
+
+// Pending returns a snapshot of the pending events in the order they'll run.
+func (s *Scheduler) Pending() []Future {
+	s.Lock()
+	pending := make([]Future, 0, len(s.queue))
+	for _, future := range s.queue {
+		pending = append(pending, *future)
+	}
+	s.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ts.Before(pending[j].ts) })
+	return pending
+}
+
+// next pops the next event that's due, or says how long to wait for one.
+func (s *Scheduler) next() (*Future, time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.queue) == 0 {
+		return nil, -1
+	}
+	if wait := s.queue[0].ts.Sub(s.clock.Now()); wait > 0 {
+		return nil, wait
+	}
+	future := heap.Pop(&s.queue).(*Future)
+	delete(s.byId, future.id)
+	return future, 0
+}
+
 func At(ts time.Time, work func()) {
-	heap.Push(&queue, &Future{ts: ts, work: work})
+	scheduler.Schedule(EV_Task, ts, work)
 }
 
 func After(delay time.Duration, work func()) {
-	heap.Push(&queue, &Future{ts: time.Now().Add(delay), work: work})
+	scheduler.Schedule(EV_Task, scheduler.clock.Now().Add(delay), work)
+}
+
+func AtNamed(name string, ts time.Time, work func()) *Future {
+	return scheduler.Schedule(name, ts, work)
+}
+
+func AfterNamed(name string, delay time.Duration, work func()) *Future {
+	return scheduler.Schedule(name, scheduler.clock.Now().Add(delay), work)
+}
+
+// AfterData schedules an event along with the data needed to rebuild it if
+// the server restarts before it runs.
+func AfterData(name string, delay time.Duration, data string, work func()) *Future {
+	future := AfterNamed(name, delay, work)
+	scheduler.Lock()
+	future.data = data
+	scheduler.Unlock()
+	return future
 }
 
 func RunQueue() {
 	defer log_info("Queue runner done.")
-	heap.Init(&queue)
+	timer := time.NewTimer(time.Hour)
 	for {
-		if len(queue) == 0 {
-			time.Sleep(10 * time.Microsecond)
+		future, wait := scheduler.next()
+		if future != nil {
+			future.work()
 			continue
 		}
-		future, ok := heap.Pop(&queue).(*Future)
-		if !ok {
-			log_error("there's shit on the work heap")
+		if wait >= 0 {
+			// game time doesn't always pass at the pace of real time, or at
+			// all while the server is paused
+			wait = scheduler.clock.Wall(wait)
+		}
+		if wait < 0 {
+			<-scheduler.wake
 			continue
 		}
-		if future.ts.After(time.Now()) {
-			time.Sleep(future.ts.Sub(time.Now()))
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
 		}
-		future.work()
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-scheduler.wake:
+		}
+	}
+}
+
+func parseEventId(conn *Connection, arg string) (uint64, bool) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(arg, "#"), 10, 64)
+	if err != nil {
+		fmt.Fprintf(conn, "that's not an event id: %s\n", arg)
+		return 0, false
 	}
+	return id, true
+}
+
+var schedulerCommand = &Command{
+	name: "scheduler",
+	help: "admin only.  inspects and manipulates pending events.  usage:\n" +
+		"\tscheduler [event-name]\n" +
+		"\tscheduler cancel [id]\n" +
+		"\tscheduler reschedule [id] [delay]   (e.g. 90s, 5m)",
+	mobile: true,
+	handler: func(conn *Connection, args ...string) {
+		if !conn.IsAdmin() {
+			fmt.Fprintf(conn, "only admins can inspect the scheduler.\n")
+			return
+		}
+		if len(args) == 2 && args[0] == "cancel" {
+			id, ok := parseEventId(conn, args[1])
+			if !ok {
+				return
+			}
+			if !scheduler.Cancel(id) {
+				fmt.Fprintf(conn, "there's no pending event %d\n", id)
+				return
+			}
+			forgetInbound(id)
+			log_info("admin %s cancelled event %d", conn.PlayerName(), id)
+			audit(conn.PlayerName(), "cancel event", fmt.Sprintf("#%d", id), "")
+			fmt.Fprintf(conn, "cancelled event %d\n", id)
+			return
+		}
+		if len(args) == 3 && args[0] == "reschedule" {
+			id, ok := parseEventId(conn, args[1])
+			if !ok {
+				return
+			}
+			delay, err := time.ParseDuration(args[2])
+			if err != nil || delay < 0 {
+				fmt.Fprintf(conn, "that's not a delay: %s\n", args[2])
+				return
+			}
+			ts := clock.Now().Add(delay)
+			if !scheduler.Reschedule(id, ts) {
+				fmt.Fprintf(conn, "there's no pending event %d\n", id)
+				return
+			}
+			rescheduleInbound(id, ts)
+			log_info("admin %s rescheduled event %d to run in %v", conn.PlayerName(), id, delay)
+			audit(conn.PlayerName(), "reschedule event", fmt.Sprintf("#%d", id), delay.String())
+			fmt.Fprintf(conn, "event %d will now run in %v\n", id, delay)
+			return
+		}
+		pending := scheduler.Pending()
+		counts := make(map[string]int, 8)
+		for _, future := range pending {
+			counts[future.name]++
+		}
+		fmt.Fprintf(conn, "%d pending events\n", len(pending))
+		for name, n := range counts {
+			fmt.Fprintf(conn, "\t%-12s %d\n", name, n)
+		}
+		shown := 0
+		for _, future := range pending {
+			if shown == 20 {
+				break
+			}
+			if len(args) == 1 && future.name != args[0] {
+				continue
+			}
+			about := future.about
+			if about == "" {
+				about = future.data
+			}
+			fmt.Fprintf(conn, "%-8d %-12s in %-12v age %-10v %s\n", future.id, future.name, future.ts.Sub(clock.Now()).Truncate(time.Second), clock.Now().Sub(future.created).Truncate(time.Second), about)
+			shown++
+		}
+	},
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Wormhole struct {
+	a, b   *System
+	closes time.Time
+}
+
+func (w *Wormhole) Other(s *System) *System {
+	if s == w.a {
+		return w.b
+	}
+	return w.a
+}
+
+func startWormholes() {
+	After(10*time.Minute, spawnWormhole)
+}
+
+func spawnWormhole() {
+	defer After(10*time.Minute, spawnWormhole)
+	for i := 0; i < 20; i++ {
+		a, err := randomSystem()
+		if err != nil {
+			log_error("unable to spawn wormhole: %v", err)
+			return
+		}
+		b, err := randomSystem()
+		if err != nil {
+			log_error("unable to spawn wormhole: %v", err)
+			return
+		}
+		if a == nil || b == nil || a == b || a.wormhole != nil || b.wormhole != nil {
+			continue
+		}
+		if a.DistanceTo(b) < 100 {
+			continue
+		}
+		openWormhole(a, b, 15*time.Minute)
+		return
+	}
+}
+
+func openWormhole(a, b *System, lifetime time.Duration) {
+	w := &Wormhole{a: a, b: b, closes: clock.Now().Add(lifetime)}
+	a.wormhole = w
+	b.wormhole = w
+	log_info("wormhole opened between %s and %s", a.name, b.name)
+	for _, s := range []*System{a, b} {
+		s.EachConn(func(conn *Connection) {
+			fmt.Fprintf(conn, "space tears open around you.  a wormhole to %s has appeared in %s\n", w.Other(s).name, s.name)
+		})
+	}
+	After(lifetime, func() {
+		a.wormhole = nil
+		b.wormhole = nil
+		log_info("wormhole closed between %s and %s", a.name, b.name)
+		for _, s := range []*System{a, b} {
+			s.EachConn(func(conn *Connection) {
+				fmt.Fprintf(conn, "the wormhole in %s collapses\n", s.name)
+			})
+		}
+	})
+}
+
+var jumpCommand = &Command{
+	name: "jump",
+	help: "jumps through a wormhole in the current system",
+	handler: func(conn *Connection, args ...string) {
+		start := conn.System()
+		w := start.wormhole
+		if w == nil {
+			fmt.Fprintf(conn, "there's no wormhole in %s\n", start.name)
+			return
+		}
+		if conn.capital != nil {
+			fmt.Fprintf(conn, "you're aboard the %s.  the helm decides where it goes.\n", conn.capital.name)
+			return
+		}
+		to := w.Other(start)
+		start.Leave(conn)
+		fmt.Fprintf(conn, "you plunge into the wormhole...\n")
+		After(5*time.Second, func() {
+			to.Arrive(conn)
+			fmt.Fprintf(conn, "you emerge from the wormhole in %s\n", to.name)
+		})
+	},
+}